@@ -0,0 +1,34 @@
+package bloomfilter
+
+// Allocator supplies the memory of the bits of filters, such as from an
+// arena, memory pinned to a NUMA node or a shared memory segment
+type Allocator interface {
+	// Alloc returns n zeroed words
+	Alloc(n uint64) ([]uint64, error)
+	// Free releases words returned by Alloc, once the filter using them is
+	// closed or has its bits replaced, such as by UnmarshalBinary
+	Free(words []uint64) error
+}
+
+// WithAllocator allocates the bits with a, rather than on the Go heap or
+// with a memory mapping, and overrides WithOffHeap, WithHugePages and
+// WithLazyPages. The allocator carries over to the filters derived from it,
+// such as by Copy, and the bits must be released with Close.
+func WithAllocator(a Allocator) Option {
+	return func(o *options) {
+		o.allocator = a
+	}
+}
+
+// allocWords allocates words with the allocator set by WithAllocator
+func (o *options) allocWords(words uint64) ([]uint64, error) {
+	bits, err := o.allocator.Alloc(words)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(bits)) != words {
+		_ = o.allocator.Free(bits)
+		return nil, errAllocator(words, len(bits))
+	}
+	return bits, nil
+}
@@ -0,0 +1,85 @@
+package bloomfilter
+
+import (
+	"errors"
+	"testing"
+)
+
+// countingAllocator allocates on the Go heap, counting the words in use
+type countingAllocator struct {
+	inUse uint64
+	fail  bool
+	short bool
+}
+
+func (a *countingAllocator) Alloc(n uint64) ([]uint64, error) {
+	if a.fail {
+		return nil, errors.New("out of arena")
+	}
+	if a.short {
+		n--
+	}
+	a.inUse += n
+	return make([]uint64, n), nil
+}
+
+func (a *countingAllocator) Free(words []uint64) error {
+	a.inUse -= uint64(len(words))
+	return nil
+}
+
+func TestAllocator(t *testing.T) {
+	a := &countingAllocator{}
+	f, err := New(1000, 3, WithAllocator(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.inUse != 16 {
+		t.Fatalf("%d words allocated, expected 16", a.inUse)
+	}
+	f.Add(hashableUint64(1))
+
+	f2, err := f.Copy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.inUse != 32 {
+		t.Errorf("%d words allocated after Copy, expected 32", a.inUse)
+	}
+	if !f2.Contains(hashableUint64(1)) {
+		t.Error("copy lost an element")
+	}
+	if err = f2.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// replacing the bits frees them
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if a.inUse != 0 {
+		t.Errorf("%d words still allocated, expected 0", a.inUse)
+	}
+	if !f.Contains(hashableUint64(1)) {
+		t.Error("unmarshaled filter lost an element")
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	a.fail = true
+	if _, err = New(1000, 3, WithAllocator(a)); err == nil {
+		t.Error("allocation failure was not returned")
+	}
+	a.fail, a.short = false, true
+	if _, err = New(1000, 3, WithAllocator(a)); err == nil {
+		t.Error("short allocation was accepted")
+	}
+	if a.inUse != 0 {
+		t.Errorf("short allocation was not freed: %d words", a.inUse)
+	}
+}
@@ -0,0 +1,75 @@
+package bloomfilter
+
+// containsBatchSize is the number of hashes whose words are gathered
+// before any of them is tested
+const containsBatchSize = 64
+
+// ContainsHashes tests if f contains each of the (already hashed) keys,
+// storing the results in results, which is grown if too small and returned.
+//
+// The keys are queried in batches, one probe at a time for all the keys of a
+// batch not yet known to be absent: first the words of these probes are all
+// loaded, which are independent loads the CPU overlaps, so that the cache
+// misses of a large filter are paid concurrently rather than one after the
+// other. Then the bits are tested in the gathered words.
+func (f *Filter) ContainsHashes(hashes []uint64, results []bool) []bool {
+	if cap(results) < len(hashes) {
+		results = make([]bool, len(hashes))
+	}
+	results = results[:len(hashes)]
+
+	f.lock.RLock()
+	f.containsHashes(hashes, results)
+	f.lock.RUnlock()
+	if f.opts.hooks != nil {
+		for j, hash := range hashes {
+			f.opts.hooks.probed(hash, results[j])
+		}
+	}
+	return results
+}
+
+// containsHashes is ContainsHashes into results of the length of hashes,
+// f must be read locked
+func (f *Filter) containsHashes(hashes []uint64, results []bool) {
+	if f.flags&layoutFlags != 0 {
+		// probes of an element share a cache line, nothing to overlap
+		for j, hash := range hashes {
+			results[j] = f.contains(hash)
+		}
+		return
+	}
+
+	var (
+		indexes [containsBatchSize]uint64
+		words   [containsBatchSize]uint64
+		active  [containsBatchSize]int // keys of the batch maybe contained
+	)
+	for start := 0; start < len(hashes); start += containsBatchSize {
+		batch := hashes[start:]
+		if len(batch) > containsBatchSize {
+			batch = batch[:containsBatchSize]
+		}
+		for j := range batch {
+			active[j] = j
+			results[start+j] = true
+		}
+
+		alive := active[:len(batch)]
+		for n := 0; n < len(f.keys) && len(alive) > 0; n++ {
+			for a, j := range alive {
+				indexes[a] = f.index(batch[j], f.step(batch[j]), n)
+				words[a] = f.bits[indexes[a]>>6]
+			}
+			still := alive[:0]
+			for a, j := range alive {
+				if (words[a]>>uint(indexes[a]&0x3f))&1 == 0 {
+					results[start+j] = false
+				} else {
+					still = append(still, j)
+				}
+			}
+			alive = still
+		}
+	}
+}
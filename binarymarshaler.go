@@ -14,13 +14,14 @@ import (
 	"bytes"
 	"crypto/sha512"
 	"encoding/binary"
+	"io"
 )
 
 // conforms to encoding.BinaryMarshaler
 
 // marshalled binary layout (Little Endian):
 //
-//	 k	1 uint64
+//	 k	1 uint64, flags in the high 32 bits, see WithBlocked
 //	 n	1 uint64
 //	 m	1 uint64
 //	 keys	[k]uint64
@@ -39,49 +40,154 @@ func (f *Filter) marshal() (buf *bytes.Buffer,
 
 	debug("write bf k=%d n=%d m=%d\n", f.K(), f.n, f.m)
 
-	buf = new(bytes.Buffer)
+	return marshalWords(f.keys, f.flags, f.n, f.m, f.bits)
+}
 
-	err = binary.Write(buf, binary.LittleEndian, f.K())
+// marshalWords is appendWords into a new buffer, also returning the hash
+// which ends it
+func marshalWords(keys []uint64, flags uint32, n, m uint64, words []uint64) (
+	buf *bytes.Buffer,
+	hash [sha512.Size384]byte,
+	err error,
+) {
+	data, err := appendWords(nil, keys, flags, n, m, words)
 	if err != nil {
 		return nil, hash, err
 	}
+	copy(hash[:], data[len(data)-sha512.Size384:])
+	return bytes.NewBuffer(data), hash, nil
+}
 
-	err = binary.Write(buf, binary.LittleEndian, f.n)
-	if err != nil {
-		return nil, hash, err
+// binaryHeader is the first 3 words of the binary layout above
+func binaryHeader(k uint64, flags uint32, n, m uint64) [3]uint64 {
+	return [3]uint64{k | uint64(flags)<<32, n, m}
+}
+
+// wordsChunk is the number of words converted at once by writeWords and
+// readWords, rather than all of them, which would take a copy of the
+// whole bit array
+const wordsChunk = 4096
+
+// writeWords writes words to w in little-endian order
+func writeWords(w io.Writer, words []uint64) error {
+	var chunk [wordsChunk * Uint64Bytes]byte
+	return writeWordsChunk(w, words, chunk[:])
+}
+
+// writeWordsChunk writes words to w in little-endian order, converting and
+// writing len(chunk) bytes at a time, a multiple of 8
+func writeWordsChunk(w io.Writer, words []uint64, chunk []byte) error {
+	size := len(chunk) / Uint64Bytes
+	for len(words) > 0 {
+		n := len(words)
+		if n > size {
+			n = size
+		}
+		for i, word := range words[:n] {
+			binary.LittleEndian.PutUint64(chunk[i*Uint64Bytes:], word)
+		}
+		if _, err := w.Write(chunk[:n*Uint64Bytes]); err != nil {
+			return err
+		}
+		words = words[n:]
+	}
+	return nil
+}
+
+// readWords reads words from r in little-endian order
+func readWords(r io.Reader, words []uint64) error {
+	var chunk [wordsChunk * Uint64Bytes]byte
+	for len(words) > 0 {
+		n := len(words)
+		if n > wordsChunk {
+			n = wordsChunk
+		}
+		if _, err := io.ReadFull(r, chunk[:n*Uint64Bytes]); err != nil {
+			return err
+		}
+		for i := range words[:n] {
+			words[i] = binary.LittleEndian.Uint64(chunk[i*Uint64Bytes:])
+		}
+		words = words[n:]
 	}
+	return nil
+}
+
+// writeBinary writes the binary layout above to w, converting len(chunk)
+// bytes at a time rather than the whole filter. f must be locked.
+func (f *Filter) writeBinary(w io.Writer, chunk []byte) error {
+	h := sha512.New384()
+	hw := io.MultiWriter(w, h)
 
-	err = binary.Write(buf, binary.LittleEndian, f.m)
+	header := binaryHeader(uint64(len(f.keys)), f.flags, f.n, f.m)
+	err := writeWordsChunk(hw, header[:], chunk)
 	if err != nil {
-		return nil, hash, err
+		return err
 	}
 
-	err = binary.Write(buf, binary.LittleEndian, f.keys)
+	err = writeWordsChunk(hw, f.keys, chunk)
 	if err != nil {
-		return nil, hash, err
+		return err
 	}
 
-	err = binary.Write(buf, binary.LittleEndian, f.bits)
+	err = writeWordsChunk(hw, f.bits, chunk)
 	if err != nil {
-		return nil, hash, err
+		return err
 	}
 
-	hash = sha512.Sum384(buf.Bytes())
-	err = binary.Write(buf, binary.LittleEndian, hash)
-	return buf, hash, err
+	_, err = w.Write(h.Sum(nil))
+	return err
 }
 
 // MarshalBinary converts a Filter into []bytes
 func (f *Filter) MarshalBinary() (data []byte, err error) {
-	buf, hash, err := f.marshal()
+	return f.AppendBinary(nil)
+}
+
+// AppendBinary appends the binary layout of MarshalBinary to buf, and
+// returns the extended buffer, as encoding.BinaryAppender does. Nothing is
+// allocated if buf has the capacity for it, so that a filter can be
+// snapshotted often into a reused buffer.
+func (f *Filter) AppendBinary(buf []byte) ([]byte, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return appendWords(buf, f.keys, f.flags, f.n, f.m, f.bits)
+}
+
+// appendWords appends the binary layout above to buf, the keys, flags, n,
+// m and words of any structure stored as a filter is
+func appendWords(buf []byte, keys []uint64, flags uint32, n, m uint64,
+	words []uint64,
+) ([]byte, error) {
+	size, err := binarySize(uint64(len(keys)), uint64(len(words)))
 	if err != nil {
-		return nil, err
+		return buf, err
+	}
+
+	start := len(buf)
+	if uint64(cap(buf)-start) < size {
+		grown := make([]byte, start, uint64(start)+size)
+		copy(grown, buf)
+		buf = grown
+	}
+	data := buf[start : uint64(start)+size]
+
+	i := 0
+	for _, word := range binaryHeader(uint64(len(keys)), flags, n, m) {
+		binary.LittleEndian.PutUint64(data[i:], word)
+		i += Uint64Bytes
+	}
+	for _, key := range keys {
+		binary.LittleEndian.PutUint64(data[i:], key)
+		i += Uint64Bytes
+	}
+	for _, word := range words {
+		binary.LittleEndian.PutUint64(data[i:], word)
+		i += Uint64Bytes
 	}
+	hash := sha512.Sum384(data[:i])
+	copy(data[i:], hash[:])
 
-	debug(
-		"bloomfilter.MarshalBinary: Successfully wrote %d byte(s), sha384 %v",
-		buf.Len(), hash,
-	)
-	data = buf.Bytes()
-	return data, nil
+	return buf[:uint64(start)+size], nil
 }
@@ -0,0 +1,56 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAppendBinary(t *testing.T) {
+	f, _ := New(100000, 5, WithBlocked())
+	for i := uint64(0); i < 5000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	data, _ := f.MarshalBinary()
+
+	buf, err := f.AppendBinary([]byte("prefix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:6]) != "prefix" || !bytes.Equal(buf[6:], data) {
+		t.Fatal("AppendBinary differs from MarshalBinary")
+	}
+
+	// a reused buffer is not reallocated
+	buf = make([]byte, 0, len(data))
+	allocs := testing.AllocsPerRun(10, func() {
+		buf, _ = f.AppendBinary(buf[:0])
+	})
+	if allocs != 0 || !bytes.Equal(buf, data) {
+		t.Fatalf("%v allocations", allocs)
+	}
+
+	f2 := new(Filter)
+	if err = f2.UnmarshalBinary(buf); err != nil || !sameFilter(f, f2) {
+		t.Fatal("appended filter did not round-trip", err)
+	}
+}
+
+func BenchmarkAppendBinary(b *testing.B) {
+	f, _ := NewOptimal(100000, 0.01)
+	buf, _ := f.AppendBinary(nil)
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = f.AppendBinary(buf[:0])
+	}
+}
+
+func BenchmarkMarshalBinary(b *testing.B) {
+	f, _ := NewOptimal(100000, 0.01)
+	data, _ := f.MarshalBinary()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = f.MarshalBinary()
+	}
+}
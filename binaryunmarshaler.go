@@ -16,35 +16,91 @@ import (
 	"crypto/sha512"
 	"encoding/binary"
 	"io"
+	"reflect"
+	"unsafe"
 )
 
-func unmarshalBinaryHeader(r io.Reader) (k, n, m uint64, err error) {
+// true if the host stores uint64s in the serialized (little-endian) order
+var nativeLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1 // #nosec
+}()
+
+// uint64sFromBytes aliases b as a []uint64 without copying
+func uint64sFromBytes(b []byte) []uint64 {
+	var words []uint64
+	if len(b) == 0 {
+		return words
+	}
+	h := (*reflect.SliceHeader)(unsafe.Pointer(&words)) // #nosec
+	h.Data = uintptr(unsafe.Pointer(&b[0]))              // #nosec
+	h.Len = len(b) / Uint64Bytes
+	h.Cap = h.Len
+	return words
+}
+
+func unmarshalBinaryHeader(r io.Reader) (
+	k uint64, flags uint32, n, m uint64, err error,
+) {
 	err = binary.Read(r, binary.LittleEndian, &k)
 	if err != nil {
-		return k, n, m, err
+		return k, flags, n, m, err
+	}
+
+	flags, k = uint32(k>>32), k&0xffffffff
+	if !validFlags(flags) {
+		return k, flags, n, m, errFlags(flags)
 	}
 
 	if k < KMin {
-		return k, n, m, errK()
+		return k, flags, n, m, errK()
 	}
 
 	err = binary.Read(r, binary.LittleEndian, &n)
 	if err != nil {
-		return k, n, m, err
+		return k, flags, n, m, err
 	}
 
 	err = binary.Read(r, binary.LittleEndian, &m)
 	if err != nil {
-		return k, n, m, err
+		return k, flags, n, m, err
+	}
+
+	err = checkHeader(k, flags, m)
+	if err != nil {
+		return k, flags, n, m, err
+	}
+
+	debug("read bf k=%d flags=%#x n=%d m=%d\n", k, flags, n, m)
+
+	return k, flags, n, m, err
+}
+
+// checkHeader checks that k keys, flags and m bits make a filter
+func checkHeader(k uint64, flags uint32, m uint64) error {
+	if !validFlags(flags) {
+		return errFlags(flags)
+	}
+
+	if k < KMin {
+		return errK()
 	}
 
 	if m < MMin {
-		return k, n, m, errM()
+		return errM()
 	}
 
-	debug("read bf k=%d n=%d m=%d\n", k, n, m)
+	// the number of words, (m+63)/64, must not overflow
+	if m > ^uint64(0)-63 {
+		return errSize()
+	}
 
-	return k, n, m, err
+	if flags&flagBlocked != 0 && m%blockBits != 0 ||
+		flags&flagRegisterBlocked != 0 && m%64 != 0 ||
+		flags&flagPowerOfTwo != 0 && m&(m-1) != 0 {
+		return errFlags(flags)
+	}
+	return nil
 }
 
 func unmarshalBinaryBits(r io.Reader, m uint64) (bits []uint64, err error) {
@@ -52,11 +108,21 @@ func unmarshalBinaryBits(r io.Reader, m uint64) (bits []uint64, err error) {
 	if err != nil {
 		return bits, err
 	}
-	err = binary.Read(r, binary.LittleEndian, bits)
+	err = readWords(r, bits)
 	return bits, err
 
 }
 
+func unmarshalBinaryWords(r io.Reader, count uint64) (words []uint64, err error) {
+	err = checkWords(count)
+	if err != nil {
+		return nil, err
+	}
+	words = newAlignedWords(count)
+	err = readWords(r, words)
+	return words, err
+}
+
 func unmarshalBinaryKeys(r io.Reader, k uint64) (keys []uint64, err error) {
 	keys = make([]uint64, k)
 	err = binary.Read(r, binary.LittleEndian, keys)
@@ -83,29 +149,171 @@ func checkBinaryHash(r io.Reader, data []byte) (err error) {
 	return nil
 }
 
+// checkBinarySize checks, without overflowing, that size bytes are exactly
+// the binary layout of k keys and the given number of words, so that
+// nothing is allocated for sizes the data does not back
+func checkBinarySize(k, words, size uint64) error {
+	if k > size/Uint64Bytes || words > size/Uint64Bytes ||
+		size != (3+k+words)*Uint64Bytes+sha512.Size384 {
+		return errSize()
+	}
+	return nil
+}
+
+// binarySize is the size of the binary layout of k keys and the given
+// number of words, if it can be addressed
+func binarySize(k, words uint64) (uint64, error) {
+	const maxWords = maxInt / Uint64Bytes / 4
+	if k > maxWords || words > maxWords {
+		return 0, errSize()
+	}
+	return (3+k+words)*Uint64Bytes + sha512.Size384, nil
+}
+
+// checkTrailingBits checks that no bit beyond m is set
+func checkTrailingBits(bits []uint64, m uint64) error {
+	if m%64 != 0 && bits[len(bits)-1]>>(m%64) != 0 {
+		return errTrailingBits()
+	}
+	return nil
+}
+
 // UnmarshalBinary converts []bytes into a Filter
 // conforms to encoding.BinaryUnmarshaler
+//
+// data is fully validated before f is modified, so that data from untrusted
+// sources can be unmarshaled: nothing is allocated beyond the size of data,
+// and f is left unchanged if an error is returned.
+//
+// data may also be in the compact layout of MarshalCompact.
 func (f *Filter) UnmarshalBinary(data []byte) (err error) {
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
+	if isCompact(data) {
+		return f.unmarshalCompact(data, false)
+	}
+
 	buf := bytes.NewBuffer(data)
 
-	var k uint64
-	k, f.n, f.m, err = unmarshalBinaryHeader(buf)
+	k, flags, n, m, err := unmarshalBinaryHeader(buf)
+	if err != nil {
+		return err
+	}
+
+	err = checkBinarySize(k, (m+63)/64, uint64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	keys, err := unmarshalBinaryKeys(buf, k)
+	if err != nil {
+		return err
+	}
+
+	masks, err := newFlagsMasks(flags, keys)
 	if err != nil {
 		return err
 	}
 
-	f.keys, err = unmarshalBinaryKeys(buf, k)
+	bits, err := unmarshalBinaryBits(buf, m)
 	if err != nil {
 		return err
 	}
 
-	f.bits, err = unmarshalBinaryBits(buf, f.m)
+	err = checkTrailingBits(bits, m)
 	if err != nil {
 		return err
 	}
 
-	return checkBinaryHash(buf, data)
+	err = checkBinaryHash(buf, data)
+	if err != nil {
+		f.opts.logf("bloomfilter: corrupt filter of %d bytes: %v", len(data), err)
+		return err
+	}
+
+	f.gen++
+	err = f.releaseMem()
+	if err != nil {
+		return err
+	}
+
+	f.m = m
+	f.n = n
+	f.flags = flags
+	f.keys = keys
+	f.masks = masks
+	f.bits = bits
+	f.recountBits()
+	return nil
+}
+
+// UnmarshalBinaryNoCopy is like UnmarshalBinary, except that the bits of f
+// alias data instead of being copied out of it.
+//
+// data must not be modified or released while f is in use, the bits within
+// it must be 8-byte aligned and the host must be little-endian.
+func (f *Filter) UnmarshalBinaryNoCopy(data []byte) (err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if isCompact(data) {
+		return f.unmarshalCompact(data, true)
+	}
+
+	buf := bytes.NewBuffer(data)
+
+	k, flags, n, m, err := unmarshalBinaryHeader(buf)
+	if err != nil {
+		return err
+	}
+
+	words := (m + 63) / 64
+	err = checkBinarySize(k, words, uint64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	keys, err := unmarshalBinaryKeys(buf, k)
+	if err != nil {
+		return err
+	}
+
+	masks, err := newFlagsMasks(flags, keys)
+	if err != nil {
+		return err
+	}
+
+	raw := buf.Next(int(words * Uint64Bytes))
+	if !nativeLittleEndian ||
+		uintptr(unsafe.Pointer(&raw[0]))%Uint64Bytes != 0 { // #nosec
+		return errAlignment()
+	}
+
+	bits := uint64sFromBytes(raw)
+	err = checkTrailingBits(bits, m)
+	if err != nil {
+		return err
+	}
+
+	err = checkBinaryHash(buf, data)
+	if err != nil {
+		f.opts.logf("bloomfilter: corrupt filter of %d bytes: %v", len(data), err)
+		return err
+	}
+
+	f.gen++
+	err = f.releaseMem()
+	if err != nil {
+		return err
+	}
+
+	f.m = m
+	f.n = n
+	f.flags = flags
+	f.keys = keys
+	f.masks = masks
+	f.bits = bits
+	f.recountBits()
+	return nil
 }
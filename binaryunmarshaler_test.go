@@ -0,0 +1,138 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestUnmarshalBinaryNoCopy(t *testing.T) {
+	f, _ := New(1000, 4)
+	for _, x := range hashableUint64Values() {
+		f.Add(x)
+	}
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var f2 Filter
+	if err = f2.UnmarshalBinaryNoCopy(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range hashableUint64Values() {
+		if !f2.Contains(x) {
+			t.Fatalf("missing value %d", x)
+		}
+	}
+	if f2.N() != f.N() || f2.M() != f.M() || f2.K() != f.K() {
+		t.Fatal("header mismatch")
+	}
+	for i, key := range f.keys {
+		if f2.keys[i] != key {
+			t.Fatal("keys mismatch")
+		}
+	}
+
+	// the bits must alias data
+	bitsOffset := 3*Uint64Bytes + Uint64Bytes*int(f.K())
+	data[bitsOffset] ^= 0xff
+	if f2.bits[0] == f.bits[0] {
+		t.Fatal("bits were copied")
+	}
+}
+
+func TestUnmarshalBinaryNoCopyErrors(t *testing.T) {
+	f, _ := New(1000, 4)
+	data, _ := f.MarshalBinary()
+
+	var f2 Filter
+	if err := f2.UnmarshalBinaryNoCopy(data[:len(data)-1]); err == nil {
+		t.Fatal("expected error for truncated data")
+	}
+
+	shifted := make([]byte, len(data)+1)
+	copy(shifted[1:], data)
+	if err := f2.UnmarshalBinaryNoCopy(shifted[1:]); err == nil {
+		t.Fatal("expected error for misaligned data")
+	}
+
+	data[len(data)-1] ^= 0xff
+	if err := f2.UnmarshalBinaryNoCopy(data); err == nil {
+		t.Fatal("expected error for corrupt data")
+	}
+}
+
+func TestUnmarshalBinaryHostile(t *testing.T) {
+	f, _ := New(1000, 4)
+	f.AddHash(42)
+	data, _ := f.MarshalBinary()
+
+	var f2 Filter
+	for i := 0; i < len(data); i++ {
+		if err := f2.UnmarshalBinary(data[:i]); err == nil {
+			t.Fatalf("expected error for data truncated to %d bytes", i)
+		}
+	}
+
+	// headers claiming huge sizes must be rejected before allocating
+	for _, header := range [][3]uint64{
+		{1 << 31, 0, 1000},
+		{4, 0, 1 << 62},
+		{4, 0, ^uint64(0)},
+		{^uint64(0) >> 32, 0, ^uint64(0) - 63},
+	} {
+		hostile := append([]byte(nil), data...)
+		for i, x := range header {
+			binary.LittleEndian.PutUint64(hostile[i*8:], x)
+		}
+		if err := f2.UnmarshalBinary(hostile); err == nil {
+			t.Fatalf("expected error for header %v", header)
+		}
+	}
+
+	// m so large that its number of words overflows to 0
+	overflow := make([]byte, 7*Uint64Bytes+48)
+	binary.LittleEndian.PutUint64(overflow, 4)
+	binary.LittleEndian.PutUint64(overflow[16:], ^uint64(0))
+	if err := f2.UnmarshalBinary(overflow); err == nil {
+		t.Fatal("expected error for overflowing m")
+	}
+
+	// a failed unmarshal leaves the filter unchanged
+	f3, _ := New(1000, 4)
+	f3.AddHash(42)
+	data[len(data)-1] ^= 0xff
+	if err := f3.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected error for corrupt data")
+	}
+	if f3.K() != 4 || f3.M() != 1000 || !f3.ContainsHash(42) {
+		t.Fatal("failed unmarshal modified the filter")
+	}
+}
+
+func TestCanonicalByteOrder(t *testing.T) {
+	f, _ := NewWithKeys(128, []uint64{0x0102030405060708})
+	f.AddHash(0x0102030405060708 ^ 65) // bit 65: bit 1 of the second word
+	data, _ := f.MarshalBinary()
+
+	want := []byte{
+		1, 0, 0, 0, 0, 0, 0, 0, // k
+		1, 0, 0, 0, 0, 0, 0, 0, // n
+		128, 0, 0, 0, 0, 0, 0, 0, // m
+		8, 7, 6, 5, 4, 3, 2, 1, // keys
+		0, 0, 0, 0, 0, 0, 0, 0, // bits
+		2, 0, 0, 0, 0, 0, 0, 0,
+	}
+	if len(data) != len(want)+48 || !bytes.Equal(data[:len(want)], want) {
+		t.Fatalf("expected % x, got % x", want, data[:len(want)])
+	}
+
+	var f2 Filter
+	if err := f2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !f2.ContainsHash(0x0102030405060708^65) || f2.bits[1] != 2 {
+		t.Fatal("bit 65 is not set after unmarshaling")
+	}
+}
@@ -13,15 +13,27 @@ package bloomfilter
 import (
 	"hash"
 	"sync"
+	"unsafe"
 )
 
 // Filter is an opaque Bloom filter type
 type Filter struct {
 	lock sync.RWMutex
-	bits []uint64
-	keys []uint64
-	m    uint64 // number of bits the "bits" field should recognize
+	// keeps the lock, which every reader writes to, off the cache line
+	// holding the read-mostly fields below
+	_ [cacheLineSize - unsafe.Sizeof(sync.RWMutex{})]byte
+	core
 	n    uint64 // number of inserted elements
+	gen  uint64 // number of modifications, see Generation
+	mem  []byte // memory mapping backing "bits", if not on the Go heap
+	// alarms registered with OnSaturation, if any
+	alarms *saturationAlarms
+	opts options
+	// "bits" come from opts.allocator
+	allocated bool
+	// Fingerprint as of a generation
+	fpLock sync.Mutex
+	fp     fingerprintCache
 }
 
 // M is the size of Bloom filter, in bits
@@ -36,66 +48,149 @@ func (f *Filter) K() uint64 {
 
 // Add a hashable item, v, to the filter
 func (f *Filter) Add(v hash.Hash64) {
-	f.lock.Lock()
-	defer f.lock.Unlock()
-	var (
-		hash = v.Sum64()
-		i    uint64
-	)
-	for n := 0; n < len(f.keys); n++ {
-		i = (hash ^ f.keys[n]) % f.m
-		f.bits[i>>6] |= 1 << uint(i&0x3f)
-	}
-	f.n++
+	f.AddHash(v.Sum64())
 }
 
 // Adds an already hashes item to the filter.
 // Identical to Add (but slightly faster)
 func (f *Filter) AddHash(hash uint64) {
 	f.lock.Lock()
-	defer f.lock.Unlock()
-	var (
-		i uint64
-	)
-	for n := 0; n < len(f.keys); n++ {
-		i = (hash ^ f.keys[n]) % f.m
-		f.bits[i>>6] |= 1 << uint(i&0x3f)
-	}
+	f.gen++
+	f.insert(hash)
 	f.n++
+	var saturated string
+	if f.opts.logger != nil {
+		saturated = f.saturation(f.n - 1)
+	}
+	if f.alarms != nil {
+		f.checkAlarms()
+	}
+	f.lock.Unlock()
+	f.logSaturation(saturated)
+	if f.opts.hooks != nil {
+		f.opts.hooks.added(hash)
+	}
+}
+
+// AddHashes adds already hashed items to the filter, taking the lock once
+// for all of them
+func (f *Filter) AddHashes(hashes []uint64) {
+	f.lock.Lock()
+	f.gen++
+	for _, hash := range hashes {
+		f.insert(hash)
+	}
+	f.n += uint64(len(hashes))
+	var saturated string
+	if f.opts.logger != nil {
+		saturated = f.saturation(f.n - uint64(len(hashes)))
+	}
+	if f.alarms != nil {
+		f.checkAlarms()
+	}
+	f.lock.Unlock()
+	f.logSaturation(saturated)
+	if f.opts.hooks != nil {
+		for _, hash := range hashes {
+			f.opts.hooks.added(hash)
+		}
+	}
+}
+
+// TestAndAdd adds v to f, returning whether f already (maybe) contained v.
+// Both happen atomically, so that of concurrent TestAndAdds of an element,
+// exactly one reports it as not contained. Elements already contained are
+// not counted again in N.
+func (f *Filter) TestAndAdd(v hash.Hash64) bool {
+	return f.TestAndAddHash(v.Sum64())
+}
+
+// TestAndAddHash is TestAndAdd for an already hashed item
+func (f *Filter) TestAndAddHash(hash uint64) bool {
+	f.lock.Lock()
+	f.gen++
+	contained, saturated := f.testAndAddHash(hash)
+	f.lock.Unlock()
+	f.logSaturation(saturated)
+	if f.opts.hooks != nil {
+		f.opts.hooks.probed(hash, contained)
+		if !contained {
+			f.opts.hooks.added(hash)
+		}
+	}
+	return contained
+}
+
+// testAndAddHash is TestAndAddHash, also returning the saturation to log
+// once f is unlocked. f must be locked.
+func (f *Filter) testAndAddHash(hash uint64) (contained bool, saturated string) {
+	contained = f.testAndInsert(hash)
+	if !contained {
+		f.n++
+		if f.opts.logger != nil {
+			saturated = f.saturation(f.n - 1)
+		}
+		if f.alarms != nil {
+			f.checkAlarms()
+		}
+	}
+	return contained, saturated
 }
 
 // Contains tests if f contains v
 // false: f definitely does not contain value v
 // true:  f maybe contains value v
 func (f *Filter) Contains(v hash.Hash64) bool {
-	f.lock.RLock()
-	defer f.lock.RUnlock()
-	var (
-		hash = v.Sum64()
-		i    uint64
-		r    = uint64(1)
-	)
-	for n := 0; n < len(f.keys) && r != 0; n++ {
-		i = (hash ^ f.keys[n]) % f.m
-		r &= (f.bits[i>>6] >> uint(i&0x3f)) & 1
-	}
-	return uint64ToBool(r)
+	return f.ContainsHash(v.Sum64())
 }
 
 // ContainsHash tests if f contains the (already hashed) key
 // Identical to Contains but slightly faster
 func (f *Filter) ContainsHash(hash uint64) bool {
+	f.lock.RLock()
+	contained := f.contains(hash)
+	f.lock.RUnlock()
+	if f.opts.hooks != nil {
+		f.opts.hooks.probed(hash, contained)
+	}
+	return contained
+}
+
+// Locations of the k bits of the (already hashed) key, as indexes from 0
+// to m-1 of bit i%64 of word i/64 of the binary layout (see
+// MarshalBinary), so that other systems can probe the same bits. Filters
+// created WithBlocked or WithRegisterBlocked may have repeated locations.
+func (f *Filter) Locations(hash uint64) []uint64 {
+	return f.LocationsInto(hash, make([]uint64, 0, len(f.keys)))
+}
+
+// LocationsInto is Locations, appending to dst[:0] instead of allocating
+// when dst has room for k locations
+func (f *Filter) LocationsInto(hash uint64, dst []uint64) []uint64 {
 	f.lock.RLock()
 	defer f.lock.RUnlock()
-	var (
-		i uint64
-		r = uint64(1)
-	)
-	for n := 0; n < len(f.keys) && r != 0; n++ {
-		i = (hash ^ f.keys[n]) % f.m
-		r &= (f.bits[i>>6] >> uint(i&0x3f)) & 1
+	return f.locations(hash, dst[:0])
+}
+
+// Reset f to an empty filter, keeping its keys
+func (f *Filter) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.gen++
+	f.reset()
+}
+
+// reset is Reset, f must be locked
+func (f *Filter) reset() {
+	defer f.recountBits()
+	if f.opts.lazyPages && f.mem != nil && dropPages(f.mem) {
+		f.n = 0
+		return
+	}
+	for i := range f.bits {
+		f.bits[i] = 0
 	}
-	return uint64ToBool(r)
+	f.n = 0
 }
 
 // Copy f to a new Bloom filter
@@ -114,25 +209,31 @@ func (f *Filter) Copy() (*Filter, error) {
 
 // UnionInPlace merges Bloom filter f2 into f
 func (f *Filter) UnionInPlace(f2 *Filter) error {
-	if !f.IsCompatible(f2) {
-		return errIncompatibleBloomFilters()
+	if err := f.IsCompatible(f2); err != nil {
+		return err
+	}
+	if invariants {
+		checkCompatible(f, f2)
 	}
 
 	f.lock.Lock()
 	defer f.lock.Unlock()
+	f.gen++
 
-	for i, bitword := range f2.bits {
-		f.bits[i] |= bitword
-	}
+	kernels.or(f.bits, f2.bits)
 	// Also update the counters
 	f.n += f2.n
+	f.recountBits()
 	return nil
 }
 
 // Union merges f2 and f2 into a new Filter out
 func (f *Filter) Union(f2 *Filter) (out *Filter, err error) {
-	if !f.IsCompatible(f2) {
-		return nil, errIncompatibleBloomFilters()
+	if err := f.IsCompatible(f2); err != nil {
+		return nil, err
+	}
+	if invariants {
+		checkCompatible(f, f2)
 	}
 
 	f.lock.RLock()
@@ -142,10 +243,109 @@ func (f *Filter) Union(f2 *Filter) (out *Filter, err error) {
 	if err != nil {
 		return nil, err
 	}
-	for i, bitword := range f2.bits {
-		out.bits[i] = f.bits[i] | bitword
-	}
+	copy(out.bits, f.bits)
+	kernels.or(out.bits, f2.bits)
 	// Also update the counters
 	out.n = f.n + f2.n
 	return out, nil
 }
+
+// IntersectInPlace clears the bits of f which are not set in f2, leaving a
+// filter which contains every element added to both f and f2. It may also
+// contain elements added to only one of them, at a higher false positive
+// probability than a filter built from the intersection. N becomes the
+// smaller N of f and f2, an upper bound of the intersection.
+func (f *Filter) IntersectInPlace(f2 *Filter) error {
+	if err := f.IsCompatible(f2); err != nil {
+		return err
+	}
+	if invariants {
+		checkCompatible(f, f2)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.gen++
+
+	for i, bitword := range f2.bits {
+		f.bits[i] &= bitword
+	}
+	if f2.n < f.n {
+		f.n = f2.n
+	}
+	f.recountBits()
+	return nil
+}
+
+// AndNotInPlace clears the bits of f which are set in f2
+//
+// Unlike a union, this loses information: elements added to f may no longer
+// be reported as contained, even if they were never added to f2. The count
+// of inserted elements, N, is left unchanged.
+func (f *Filter) AndNotInPlace(f2 *Filter) error {
+	if err := f.IsCompatible(f2); err != nil {
+		return err
+	}
+	if invariants {
+		checkCompatible(f, f2)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.gen++
+
+	for i, bitword := range f2.bits {
+		f.bits[i] &^= bitword
+	}
+	f.recountBits()
+	return nil
+}
+
+// XorInPlace flips the bits of f which are set in f2, leaving the bits set in
+// exactly one of them: the symmetric difference of their bits. Xor-ing the
+// result with f2 again restores f.
+//
+// The result is not a Bloom filter of any set of elements, but a delta to be
+// applied to either filter. The count of inserted elements, N, is left
+// unchanged.
+func (f *Filter) XorInPlace(f2 *Filter) error {
+	if err := f.IsCompatible(f2); err != nil {
+		return err
+	}
+	if invariants {
+		checkCompatible(f, f2)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.gen++
+
+	for i, bitword := range f2.bits {
+		f.bits[i] ^= bitword
+	}
+	f.recountBits()
+	return nil
+}
+
+// Xor f and f2 into a new Filter out, see XorInPlace
+func (f *Filter) Xor(f2 *Filter) (out *Filter, err error) {
+	if err := f.IsCompatible(f2); err != nil {
+		return nil, err
+	}
+	if invariants {
+		checkCompatible(f, f2)
+	}
+
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	out, err = f.NewCompatible()
+	if err != nil {
+		return nil, err
+	}
+	for i, bitword := range f2.bits {
+		out.bits[i] = f.bits[i] ^ bitword
+	}
+	out.n = f.n
+	return out, nil
+}
@@ -11,8 +11,10 @@
 package bloomfilter
 
 import (
+	"math/bits"
 	"math/rand"
 	"testing"
+	"unsafe"
 )
 
 // a read-only type that conforms to hash.Hash64, but only Sum64() works.
@@ -166,6 +168,49 @@ func BenchmarkContains100kX10BX20(b *testing.B) {
 	})
 }
 
+func BenchmarkContainsHashes100kX10BX20(b *testing.B) {
+	rand.Seed(1337)
+	b.StopTimer()
+	bf, _ := New(10*1000*1000*1000, 20)
+	for i := 0; i < 100*1000; i++ {
+		bf.Add(hashableUint64(rand.Uint32()))
+	}
+	hashes := make([]uint64, 100*1000)
+	for i := range hashes {
+		hashes[i] = uint64(rand.Uint32())
+	}
+	results := make([]bool, len(hashes))
+	b.Run("containsHash", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j, hash := range hashes {
+				results[j] = bf.ContainsHash(hash)
+			}
+		}
+	})
+	b.Run("containsHashes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			results = bf.ContainsHashes(hashes, results)
+		}
+	})
+}
+
+func TestContainsHashes(t *testing.T) {
+	bf, _ := New(100000, 7)
+	hashes := make([]uint64, 1000)
+	for i := range hashes {
+		hashes[i] = uint64(rand.Uint32())
+		if i%3 == 0 {
+			bf.AddHash(hashes[i])
+		}
+	}
+	results := bf.ContainsHashes(hashes, nil)
+	for i, hash := range hashes {
+		if results[i] != bf.ContainsHash(hash) {
+			t.Fatalf("result %d differs from ContainsHash", i)
+		}
+	}
+}
+
 func TestContains(t *testing.T) {
 	rand.Seed(1337)
 	bf, _ := New(10*1000*1000, 20)
@@ -220,3 +265,331 @@ func BenchmarkContains94percentMisses(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkProbes compares the probes of the layouts and index schemes, in
+// a filter of 1 MiB, which stays in cache
+func BenchmarkProbes(b *testing.B) {
+	for _, c := range []struct {
+		name string
+		opts []Option
+	}{
+		{"modulo", nil},
+		{"fastrange", []Option{WithFastRange()}},
+		{"poweroftwo", []Option{WithPowerOfTwo()}},
+		{"blocked", []Option{WithBlocked()}},
+		{"registerblocked", []Option{WithRegisterBlocked()}},
+	} {
+		bf, _ := New(1<<23, 8, c.opts...)
+		for i := uint64(0); i < 1<<19; i++ {
+			bf.AddHash(i * 0x9e3779b97f4a7c15)
+		}
+		b.Run(c.name+"/add", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bf.AddHash(uint64(i) * 0xbf58476d1ce4e5b9)
+			}
+		})
+		b.Run(c.name+"/contains", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bf.ContainsHash(uint64(i) * 0x94d049bb133111eb)
+			}
+		})
+	}
+}
+
+func TestBitsAligned(t *testing.T) {
+	for _, m := range []uint64{2, 64, 100, 4096, 1 << 20} {
+		bf, _ := New(m, 3)
+		if addr := uintptr(unsafe.Pointer(&bf.bits[0])); addr%cacheLineSize != 0 {
+			t.Errorf("m=%d: bits at %#x are not cache line aligned", m, addr)
+		}
+		if uint64(len(bf.bits)) != (m+63)/64 {
+			t.Errorf("m=%d: wrong number of words %d", m, len(bf.bits))
+		}
+	}
+}
+
+func TestXorAndNot(t *testing.T) {
+	b1, _ := New(10000, 5)
+	b2, _ := b1.NewCompatible()
+	for _, x := range hashableUint64Values() {
+		b1.Add(x)
+	}
+	for _, x := range hashableUint64NotValues() {
+		b1.Add(x)
+		b2.Add(x)
+	}
+
+	delta, err := b1.Xor(b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b2.XorInPlace(delta); err != nil {
+		t.Fatal(err)
+	}
+	for i := range b1.bits {
+		if b1.bits[i] != b2.bits[i] {
+			t.Fatalf("xor-ing the delta did not restore word %d", i)
+		}
+	}
+
+	if err = b1.AndNotInPlace(b2); err != nil {
+		t.Fatal(err)
+	}
+	if b1.PreciseFilledRatio() != 0 {
+		t.Fatal("and-not with itself did not clear all bits")
+	}
+}
+
+func TestAndNotInPlace(t *testing.T) {
+	b1, _ := New(10000, 5)
+	b2, _ := b1.NewCompatible()
+	for i := uint64(0); i < 200; i++ {
+		b1.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	for i := uint64(100); i < 300; i++ {
+		b2.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+
+	if err := b1.AndNotInPlace(b2); err != nil {
+		t.Fatal(err)
+	}
+	for i := range b1.bits {
+		if b1.bits[i]&b2.bits[i] != 0 {
+			t.Fatalf("bits shared in word %d were not cleared", i)
+		}
+	}
+	for i := uint64(100); i < 200; i++ {
+		if b1.ContainsHash(i * 0x9e3779b97f4a7c15) {
+			t.Fatalf("%d is still contained", i)
+		}
+	}
+	if b1.N() != 200 {
+		t.Fatalf("N changed to %d", b1.N())
+	}
+
+	b3, _ := New(10000, 5)
+	if err := b1.AndNotInPlace(b3); err == nil {
+		t.Fatal("expected error for incompatible filters")
+	}
+}
+
+func TestIntersectInPlace(t *testing.T) {
+	b1, _ := New(10000, 5)
+	b2, _ := b1.NewCompatible()
+	for i := uint64(0); i < 200; i++ {
+		b1.AddHash(i)
+		b2.AddHash(i + 100)
+	}
+	b2.AddHash(1000)
+	if err := b1.IntersectInPlace(b2); err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(100); i < 200; i++ {
+		if !b1.ContainsHash(i) {
+			t.Fatalf("%d missing from the intersection", i)
+		}
+	}
+	if b1.N() != 200 || b1.ContainsHash(1000) {
+		t.Fatalf("intersection of n=%d", b1.N())
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	bf, _ := New(10000, 5)
+	for _, x := range hashableUint64Values() {
+		bf.Add(x)
+	}
+	ff := bf.Freeze()
+	for _, x := range hashableUint64NotValues() {
+		bf.Add(x)
+	}
+
+	for _, x := range hashableUint64Values() {
+		if !ff.Contains(x) {
+			t.Fatalf("frozen filter does not contain %d", x)
+		}
+	}
+	if ff.N() != uint64(len(hashableUint64Values())) {
+		t.Fatalf("frozen filter has n=%d", ff.N())
+	}
+
+	thawed, err := ff.Thaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range thawed.bits {
+		if thawed.bits[i] != ff.bits[i] {
+			t.Fatalf("thawed filter differs at word %d", i)
+		}
+	}
+}
+
+func TestSeeds(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBlocked()}, {WithRegisterBlocked()},
+		{WithIndexScheme(DoubleHashing)},
+		{WithIndexScheme(EnhancedDoubleHashing)}, {WithFastRange()},
+		{WithFastRange(), WithIndexScheme(EnhancedDoubleHashing)},
+		{WithPowerOfTwo()}} {
+		f1, _ := New(100000, 4, opts...)
+		f2, _ := New(100000, 4, opts...)
+		f3, _ := f1.NewCompatible()
+		for i := uint64(0); i < 1000; i++ {
+			f1.AddHash(i)
+			f2.AddHash(i)
+			f3.AddHash(i)
+		}
+		if noBranchCompareUint64s(f1.bits, f2.bits) == 0 {
+			t.Fatal("filters with different keys have the same bits")
+		}
+		if noBranchCompareUint64s(f1.bits, f3.bits) != 0 {
+			t.Fatal("compatible filters have different bits")
+		}
+
+		data, _ := f1.MarshalBinary()
+		var f4 Filter
+		if err := f4.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if f4.CompatibilityHash() != f1.CompatibilityHash() {
+			t.Fatal("unmarshaled filter is not compatible")
+		}
+	}
+}
+
+func TestLocations(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBlocked()}, {WithRegisterBlocked()},
+		{WithIndexScheme(DoubleHashing)},
+		{WithIndexScheme(EnhancedDoubleHashing)}, {WithFastRange()},
+		{WithFastRange(), WithIndexScheme(EnhancedDoubleHashing)},
+		{WithPowerOfTwo()}} {
+		f, _ := New(100000, 4, opts...)
+		f.AddHash(42)
+		locations := f.Locations(42)
+		if len(locations) != 4 {
+			t.Fatalf("expected 4 locations, got %v", locations)
+		}
+		set := 0
+		for _, i := range f.bits {
+			set += bits.OnesCount64(i)
+		}
+		distinct := map[uint64]bool{}
+		for _, i := range locations {
+			if f.bits[i/64]&(1<<(i%64)) == 0 {
+				t.Fatalf("bit %d is not set", i)
+			}
+			distinct[i] = true
+		}
+		if set != len(distinct) {
+			t.Fatalf("%d bits set, but %d locations", set, len(distinct))
+		}
+
+		dst := make([]uint64, 0, 4)
+		if got := f.LocationsInto(42, dst); &got[0] != &dst[:1][0] {
+			t.Fatal("LocationsInto allocated")
+		}
+	}
+}
+
+func TestMBeyond32Bits(t *testing.T) {
+	if testing.Short() || maxInt < 1<<32 {
+		t.Skip("needs 1.5 GiB of memory")
+	}
+	const m = 1<<32 + 1000003
+	f, err := NewWithKeys(m, []uint64{0, 1 << 40, 12345})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.bits) != (m+63)/64 {
+		t.Fatalf("%d words for m=%d", len(f.bits), uint64(m))
+	}
+
+	// with key 0, hash is its own location beyond 2^32
+	const high = 1<<32 + 777
+	f.AddHash(high)
+	if locations := f.Locations(high); locations[0] != high {
+		t.Fatalf("expected location %d, got %v", uint64(high), locations)
+	}
+	if f.bits[high/64]&(1<<(high%64)) == 0 || f.bits[777/64]&(1<<(777%64)) != 0 {
+		t.Fatal("bit set below 2^32 instead of beyond")
+	}
+	for i := uint64(0); i < 1000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(data)) != (3+3+(m+63)/64)*Uint64Bytes+48 {
+		t.Fatalf("wrong size %d", len(data))
+	}
+	f = nil
+	var f2 Filter
+	if err = f2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	data = nil
+	if f2.M() != m || !f2.ContainsHash(high) {
+		t.Fatal("unmarshaled filter does not contain the element beyond 2^32")
+	}
+	for i := uint64(0); i < 1000; i++ {
+		if !f2.ContainsHash(i * 0x9e3779b97f4a7c15) {
+			t.Fatalf("does not contain %d", i*0x9e3779b97f4a7c15)
+		}
+	}
+	if estimate := estimateN(countBits(f2.bits), m, 3); estimate < 900 || estimate > 1100 {
+		t.Fatalf("estimated %f elements", estimate)
+	}
+}
+
+func TestNewFromBits(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBlocked()},
+		{WithIndexScheme(DoubleHashing)}} {
+		f, _ := New(10240, 5, opts...)
+		for i := uint64(0); i < 1000; i++ {
+			f.AddHash(i * 0x9e3779b97f4a7c15)
+		}
+		bits := append([]uint64(nil), f.bits...)
+
+		f2, err := NewFromBits(bits, f.M(), f.K(),
+			append(opts, WithKeys(f.keys))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := uint64(0); i < 1000; i++ {
+			if !f2.ContainsHash(i * 0x9e3779b97f4a7c15) {
+				t.Fatalf("false negative for %d", i)
+			}
+		}
+		if n := f2.N(); n < 900 || n > 1100 {
+			t.Fatalf("estimated %d elements", n)
+		}
+		if &f2.bits[0] != &bits[0] {
+			t.Fatal("bits were copied")
+		}
+		if err = f2.IsCompatible(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, _ := New(1000, 3)
+	bits := f.bits
+	for _, tc := range []struct {
+		name string
+		bits []uint64
+		m, k uint64
+		opts []Option
+	}{
+		{"no keys", bits, 1000, 3, nil},
+		{"k", bits, 1000, 4, []Option{WithKeys(f.keys)}},
+		{"words", bits[:5], 1000, 3, []Option{WithKeys(f.keys)}},
+		{"m", bits, 100, 3, []Option{WithKeys(f.keys)}},
+		{"blocked m", bits, 1000, 3, []Option{WithKeys(f.keys), WithBlocked()}},
+		{"trailing bits", []uint64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+			1 << 63}, 1000, 3, []Option{WithKeys(f.keys)}},
+	} {
+		if _, err := NewFromBits(tc.bits, tc.m, tc.k, tc.opts...); err == nil {
+			t.Errorf("expected error for %s", tc.name)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Package bloomsync converges compatible Bloom filters held by two processes
+// to the union of their bits, exchanging digests of fixed-size chunks of the
+// bits, and then only the non-zero words of the chunks which differ.
+//
+// Both peers run Sync (or a Syncer with the same ChunkWords) on either end of
+// a bidirectional stream, such as a net.Conn.
+//
+// Replicas which must become copies of a filter, rather than merge their
+// bits with it, run Pull against a peer running Serve instead.
+//
+// Peers write while reading, so that when reading from the peer fails, a
+// write can be left blocked on a peer which stopped reading: the stream is
+// then closed if it is an io.Closer, such as a net.Conn, otherwise the
+// caller must close it or give it a deadline.
+package bloomsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+const (
+	// DefaultChunkWords is the number of 64-bit words covered by a digest
+	DefaultChunkWords = 512
+	// DefaultMaxRounds is the number of digest exchanges after which Sync
+	// gives up on filters which keep changing while being synced
+	DefaultMaxRounds = 4
+
+	version = 1
+)
+
+var (
+	magic = [4]byte{'B', 'F', 'S', 'Y'}
+
+	crcTable = crc64.MakeTable(crc64.ECMA)
+
+	// ErrNotConverged is returned when the filters still differ after
+	// MaxRounds, because they were modified while being synced
+	ErrNotConverged = errors.New("bloomsync: filters did not converge")
+)
+
+// Syncer syncs filters with a peer
+type Syncer struct {
+	// ChunkWords is the number of words covered by a digest, which must
+	// be the same for both peers, DefaultChunkWords if 0
+	ChunkWords uint64
+	// MaxRounds is the maximum number of digest exchanges,
+	// DefaultMaxRounds if 0
+	MaxRounds int
+}
+
+// Sync f with the peer at the other end of rw, using the default settings
+func Sync(f *bloomfilter.Filter, rw io.ReadWriter) error {
+	var s Syncer
+	_, err := s.Sync(f, rw)
+	return err
+}
+
+type hello struct {
+	Magic      [4]byte
+	Version    uint32
+	Compat     uint64
+	Words      uint64
+	ChunkWords uint64
+}
+
+// Sync f with the peer at the other end of rw, until both hold the union of
+// their bits. It returns the number of words received from the peer.
+func (s *Syncer) Sync(f *bloomfilter.Filter, rw io.ReadWriter) (
+	received uint64, err error,
+) {
+	maxRounds := s.MaxRounds
+	if maxRounds <= 0 {
+		maxRounds = DefaultMaxRounds
+	}
+
+	chunkWords, r, err := s.hello(f, rw)
+	if err != nil {
+		return received, err
+	}
+
+	chunks := (f.Words() + chunkWords - 1) / chunkWords
+	for round := 0; ; round++ {
+		digests := chunkDigests(f, chunkWords, chunks)
+		peerDigests := make([]uint64, chunks)
+		err = exchange(rw, r, encode(digests), func(r io.Reader) error {
+			return binary.Read(r, binary.LittleEndian, peerDigests)
+		})
+		if err != nil {
+			return received, err
+		}
+
+		var differing []uint64
+		for i, digest := range digests {
+			if digest != peerDigests[i] {
+				differing = append(differing, uint64(i))
+			}
+		}
+		if len(differing) == 0 {
+			return received, nil
+		}
+		if round == maxRounds {
+			return received, ErrNotConverged
+		}
+
+		delta := encodeDelta(f, chunkWords, differing)
+		err = exchange(rw, r, delta, func(r io.Reader) error {
+			n, err := applyDelta(f, chunkWords, r)
+			received += n
+			return err
+		})
+		if err != nil {
+			return received, err
+		}
+	}
+}
+
+// exchange writes msg to the peer while reading the peer's message with
+// read, since both peers write first, which would deadlock on transports
+// that do not buffer whole messages.
+//
+// If read fails, the write may never complete, the peer not reading it:
+// w is closed if it is an io.Closer, so that the write fails, else the
+// write is left to complete or fail on its own.
+func exchange(w io.Writer, r io.Reader, msg []byte,
+	read func(io.Reader) error,
+) error {
+	werr := make(chan error, 1)
+	go func() {
+		_, err := w.Write(msg)
+		werr <- err
+	}()
+	rerr := read(r)
+	if rerr != nil {
+		if c, ok := w.(io.Closer); ok {
+			_ = c.Close()
+			<-werr
+		}
+		return rerr
+	}
+	return <-werr
+}
+
+func encode(v interface{}) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, v) // cannot fail
+	return buf.Bytes()
+}
+
+// chunkDigests is the CRC-64 of each chunk of chunkWords words of f
+func chunkDigests(f *bloomfilter.Filter, chunkWords, chunks uint64) []uint64 {
+	digests := make([]uint64, chunks)
+	words := make([]uint64, chunkWords)
+	raw := make([]byte, chunkWords*bloomfilter.Uint64Bytes)
+	for i := range digests {
+		n := f.CopyWords(words, uint64(i)*chunkWords)
+		for j, word := range words[:n] {
+			binary.LittleEndian.PutUint64(raw[j*bloomfilter.Uint64Bytes:], word)
+		}
+		digests[i] = crc64.Checksum(raw[:n*bloomfilter.Uint64Bytes], crcTable)
+	}
+	return digests
+}
+
+// encodeDelta lists the non-zero words of the differing chunks of f
+//
+//	count	1 uint64
+//	words	[count](index uint64, word uint64)
+func encodeDelta(f *bloomfilter.Filter, chunkWords uint64,
+	differing []uint64,
+) []byte {
+	var entries []uint64
+	words := make([]uint64, chunkWords)
+	for _, chunk := range differing {
+		off := chunk * chunkWords
+		n := f.CopyWords(words, off)
+		for j, word := range words[:n] {
+			if word != 0 {
+				entries = append(entries, off+uint64(j), word)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(entries)/2))
+	_ = binary.Write(&buf, binary.LittleEndian, entries)
+	return buf.Bytes()
+}
+
+// applyDelta reads a delta written by encodeDelta and merges it into f,
+// returning the number of words read
+func applyDelta(f *bloomfilter.Filter, chunkWords uint64, r io.Reader) (
+	n uint64, err error,
+) {
+	err = binary.Read(r, binary.LittleEndian, &n)
+	if err != nil {
+		return 0, err
+	}
+	if n > f.Words() {
+		return 0, fmt.Errorf("bloomsync: delta of %d words is larger"+
+			" than the filter", n)
+	}
+	return mergeEntries(f, chunkWords, n, r)
+}
+
+// mergeEntries reads n (index, word) entries of a delta, sorted by index,
+// and merges them into f with a UnionWords per chunk they fall in, returning
+// the number of entries read
+func mergeEntries(f *bloomfilter.Filter, chunkWords, n uint64, r io.Reader) (
+	uint64, error,
+) {
+	var (
+		err   error
+		words = f.Words()
+		entry [2]uint64
+		chunk = make([]uint64, chunkWords)
+		cur   = ^uint64(0) // chunk being collected
+	)
+	flush := func() error {
+		if cur == ^uint64(0) {
+			return nil
+		}
+		off := cur * chunkWords
+		end := off + chunkWords
+		if end > words {
+			end = words
+		}
+		err := f.UnionWords(chunk[:end-off], off)
+		for i := range chunk {
+			chunk[i] = 0
+		}
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		err = binary.Read(r, binary.LittleEndian, &entry)
+		if err != nil {
+			return i, err
+		}
+		index, word := entry[0], entry[1]
+		if index >= words {
+			return i, fmt.Errorf("bloomsync: word %d is out of range", index)
+		}
+		if index/chunkWords != cur {
+			if err = flush(); err != nil {
+				return i, err
+			}
+			cur = index / chunkWords
+		}
+		chunk[index%chunkWords] |= word
+	}
+	return n, flush()
+}
+
+func errHello(ours, theirs hello) error {
+	switch {
+	case theirs.Magic != ours.Magic:
+		return errors.New("bloomsync: peer does not speak the protocol")
+	case theirs.Version != ours.Version:
+		return fmt.Errorf("bloomsync: peer speaks version %d, not %d",
+			theirs.Version, ours.Version)
+	case theirs.ChunkWords != ours.ChunkWords:
+		return fmt.Errorf("bloomsync: peer uses chunks of %d words, not %d",
+			theirs.ChunkWords, ours.ChunkWords)
+	default:
+		return errors.New("bloomsync: peer's filter is not compatible")
+	}
+}
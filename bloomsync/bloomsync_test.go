@@ -0,0 +1,104 @@
+package bloomsync
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+func TestSync(t *testing.T) {
+	a, _ := bloomfilter.New(100000, 5)
+	b, _ := a.NewCompatible()
+	want, _ := a.NewCompatible()
+	for i := uint64(0); i < 1000; i++ {
+		a.AddHash(i)
+		want.AddHash(i)
+	}
+	for i := uint64(500); i < 700; i++ {
+		b.AddHash(i * 7919)
+		want.AddHash(i * 7919)
+	}
+
+	c1, c2 := net.Pipe()
+	s := Syncer{ChunkWords: 64}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := s.Sync(b, c2)
+		errc <- err
+	}()
+	received, err := s.Sync(a, c1)
+	if err == nil {
+		err = <-errc
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received == 0 {
+		t.Fatal("no words received")
+	}
+
+	wantWords := make([]uint64, want.Words())
+	want.CopyWords(wantWords, 0)
+	for _, f := range []*bloomfilter.Filter{a, b} {
+		words := make([]uint64, f.Words())
+		f.CopyWords(words, 0)
+		for i := range words {
+			if words[i] != wantWords[i] {
+				t.Fatalf("word %d is not the union", i)
+			}
+		}
+	}
+}
+
+func TestSyncIncompatible(t *testing.T) {
+	a, _ := bloomfilter.New(100000, 5)
+	b, _ := bloomfilter.New(100000, 5)
+
+	c1, c2 := net.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Sync(b, c2)
+	}()
+	if err := Sync(a, c1); err == nil {
+		t.Fatal("expected error syncing incompatible filters")
+	}
+	if err := <-errc; err == nil {
+		t.Fatal("expected error syncing incompatible filters")
+	}
+}
+
+// stalledPeer fails reads, and blocks writes until closed
+type stalledPeer chan struct{}
+
+func (p stalledPeer) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func (p stalledPeer) Write([]byte) (int, error) {
+	<-p
+	return 0, io.ErrClosedPipe
+}
+
+func (p stalledPeer) Close() error {
+	close(p)
+	return nil
+}
+
+func TestSyncReadError(t *testing.T) {
+	f, _ := bloomfilter.New(100000, 5)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Sync(f, make(stalledPeer))
+	}()
+	select {
+	case err := <-errc:
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("error %v, expected the read error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sync blocked on its write")
+	}
+}
@@ -0,0 +1,349 @@
+package bloomsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+// DefaultMaxLog is the number of versions of deltas a Gossiper keeps, peers
+// lagging further behind are sent the whole filter
+const DefaultMaxLog = 64
+
+const (
+	msgDigest = 'D'
+	msgDelta  = 'U'
+)
+
+// Transport carries gossip messages between the peers of a cluster
+type Transport interface {
+	// Peers lists the peers to gossip with
+	Peers() []string
+	// Send msg to peer, whose Gossiper must be passed it with Receive
+	Send(peer string, msg []byte) error
+}
+
+// Gossiper converges the compatible filters of a cluster of peers to the
+// union of their bits, without a central server.
+//
+// Every Tick, the bits set locally since the previous Tick become a new
+// version of the peer's delta, and every peer is sent a digest: the version
+// vector of the deltas merged from each peer. Peers answer a digest with
+// their deltas newer than the version the sender has merged. Since merged
+// bits are part of the next local delta, changes also spread through peers.
+//
+// The Gossiper keeps a copy of the filter's bits to detect local changes.
+type Gossiper struct {
+	id        string
+	filter    *bloomfilter.Filter
+	transport Transport
+	compat    uint64
+
+	// MaxLog is the number of versions of deltas kept, DefaultMaxLog if 0
+	MaxLog int
+	// OnError, if set, is passed the errors of exchanging messages with
+	// peers, which Run otherwise ignores
+	OnError func(peer string, err error)
+
+	lock     sync.Mutex
+	version  uint64
+	versions map[string]uint64 // versions merged from peers
+	last     []uint64          // bits of f as of version
+	log      []map[uint64]uint64
+}
+
+// NewGossiper for the peer id, holding f
+func NewGossiper(id string, f *bloomfilter.Filter, t Transport) *Gossiper {
+	return &Gossiper{
+		id:        id,
+		filter:    f,
+		transport: t,
+		compat:    f.CompatibilityHash(),
+		versions:  make(map[string]uint64),
+		last:      make([]uint64, f.Words()),
+	}
+}
+
+// Version is the latest version of the local delta
+func (g *Gossiper) Version() uint64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.version
+}
+
+// Versions is the version vector of the deltas merged from each peer
+func (g *Gossiper) Versions() map[string]uint64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	versions := make(map[string]uint64, len(g.versions))
+	for peer, version := range g.versions {
+		versions[peer] = version
+	}
+	return versions
+}
+
+// Run calls Tick every interval until stop is closed
+func (g *Gossiper) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_ = g.Tick()
+		}
+	}
+}
+
+// Tick records the bits set locally since the previous Tick as a new
+// version, and sends a digest to every peer. It returns the last error
+// sending to a peer.
+func (g *Gossiper) Tick() (err error) {
+	g.lock.Lock()
+	g.record()
+	msg := g.encodeDigest()
+	g.lock.Unlock()
+
+	for _, peer := range g.transport.Peers() {
+		if peer == g.id {
+			continue
+		}
+		if serr := g.transport.Send(peer, msg); serr != nil {
+			g.report(peer, serr)
+			err = serr
+		}
+	}
+	return err
+}
+
+// Receive a message sent by a peer's Gossiper
+func (g *Gossiper) Receive(msg []byte) error {
+	r := bytes.NewReader(msg)
+	var header struct {
+		Type   byte
+		Compat uint64
+	}
+	err := binary.Read(r, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+	if header.Compat != g.compat {
+		return errors.New("bloomsync: peer's filter is not compatible")
+	}
+	from, err := readString(r)
+	if err != nil {
+		return err
+	}
+
+	switch header.Type {
+	case msgDigest:
+		err = g.receiveDigest(from, r)
+	case msgDelta:
+		err = g.receiveDelta(from, r)
+	default:
+		err = fmt.Errorf("bloomsync: unknown message type %q", header.Type)
+	}
+	if err != nil {
+		g.report(from, err)
+	}
+	return err
+}
+
+func (g *Gossiper) report(peer string, err error) {
+	if g.OnError != nil {
+		g.OnError(peer, err)
+	}
+}
+
+// record the bits set since the last version as a new version. g must be
+// locked.
+func (g *Gossiper) record() {
+	const chunkWords = DefaultChunkWords
+	delta := make(map[uint64]uint64)
+	words := make([]uint64, chunkWords)
+	for off := uint64(0); off < uint64(len(g.last)); off += chunkWords {
+		n := g.filter.CopyWords(words, off)
+		for i, word := range words[:n] {
+			index := off + uint64(i)
+			if set := word &^ g.last[index]; set != 0 {
+				delta[index] = set
+				g.last[index] |= set
+			}
+		}
+	}
+	if len(delta) == 0 {
+		return
+	}
+
+	g.version++
+	g.log = append(g.log, delta)
+	maxLog := g.MaxLog
+	if maxLog <= 0 {
+		maxLog = DefaultMaxLog
+	}
+	if len(g.log) > maxLog {
+		g.log = g.log[len(g.log)-maxLog:]
+	}
+}
+
+// encodeDigest
+//
+//	type	'D'
+//	compat	1 uint64
+//	from	string
+//	count	1 uint64
+//	vector	[count](peer string, version uint64)
+//
+// strings are written as their uint32 length followed by their bytes
+func (g *Gossiper) encodeDigest() []byte {
+	var buf bytes.Buffer
+	g.encodeHeader(&buf, msgDigest)
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(g.versions)))
+	for peer, version := range g.versions {
+		writeString(&buf, peer)
+		_ = binary.Write(&buf, binary.LittleEndian, version)
+	}
+	return buf.Bytes()
+}
+
+func (g *Gossiper) encodeHeader(buf *bytes.Buffer, msgType byte) {
+	buf.WriteByte(msgType)
+	_ = binary.Write(buf, binary.LittleEndian, g.compat)
+	writeString(buf, g.id)
+}
+
+// receiveDigest answers the digest of peer with the deltas it is missing
+func (g *Gossiper) receiveDigest(peer string, r *bytes.Reader) error {
+	var count uint64
+	err := binary.Read(r, binary.LittleEndian, &count)
+	if err != nil {
+		return err
+	}
+	var have uint64 // version of ours merged by peer
+	for i := uint64(0); i < count; i++ {
+		id, err := readString(r)
+		if err != nil {
+			return err
+		}
+		var version uint64
+		err = binary.Read(r, binary.LittleEndian, &version)
+		if err != nil {
+			return err
+		}
+		if id == g.id {
+			have = version
+		}
+	}
+
+	g.lock.Lock()
+	msg := g.encodeDelta(have)
+	g.lock.Unlock()
+	if msg == nil {
+		return nil
+	}
+	return g.transport.Send(peer, msg)
+}
+
+// encodeDelta of the versions after have, or nil if there are none. g must
+// be locked.
+//
+//	type	'U'
+//	compat	1 uint64
+//	from	string
+//	since	1 uint64, the deltas are of versions after since
+//	version	1 uint64
+//	count	1 uint64
+//	words	[count](index uint64, word uint64)
+func (g *Gossiper) encodeDelta(have uint64) []byte {
+	if have >= g.version {
+		return nil
+	}
+
+	merged := make(map[uint64]uint64)
+	oldest := g.version - uint64(len(g.log)) + 1
+	if have+1 < oldest {
+		// too far behind, send everything
+		have = 0
+		for index, word := range g.last {
+			if word != 0 {
+				merged[uint64(index)] = word
+			}
+		}
+	} else {
+		for _, delta := range g.log[have+1-oldest:] {
+			for index, word := range delta {
+				merged[index] |= word
+			}
+		}
+	}
+	indexes := make([]uint64, 0, len(merged))
+	for index := range merged {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	var buf bytes.Buffer
+	g.encodeHeader(&buf, msgDelta)
+	_ = binary.Write(&buf, binary.LittleEndian,
+		[3]uint64{have, g.version, uint64(len(indexes))})
+	for _, index := range indexes {
+		_ = binary.Write(&buf, binary.LittleEndian,
+			[2]uint64{index, merged[index]})
+	}
+	return buf.Bytes()
+}
+
+// receiveDelta merges the delta of peer into the filter
+func (g *Gossiper) receiveDelta(peer string, r *bytes.Reader) error {
+	var header [3]uint64
+	err := binary.Read(r, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+	since, version, count := header[0], header[1], header[2]
+	if count > uint64(len(g.last)) {
+		return fmt.Errorf("bloomsync: delta of %d words is larger"+
+			" than the filter", count)
+	}
+	_, err = mergeEntries(g.filter, DefaultChunkWords, count, r)
+	if err != nil {
+		return err
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	// merging is idempotent, but only contiguous deltas advance the version
+	if since <= g.versions[peer] && version > g.versions[peer] {
+		g.versions[peer] = version
+	}
+	return nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	var n uint32
+	err := binary.Read(r, binary.LittleEndian, &n)
+	if err != nil {
+		return "", err
+	}
+	if int64(n) > int64(r.Len()) {
+		return "", io.ErrUnexpectedEOF
+	}
+	s := make([]byte, n)
+	_, err = io.ReadFull(r, s)
+	return string(s), err
+}
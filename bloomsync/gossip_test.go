@@ -0,0 +1,100 @@
+package bloomsync
+
+import (
+	"testing"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+// cluster is a Transport delivering messages synchronously
+type cluster map[string]*Gossiper
+
+func (c cluster) Peers() []string {
+	peers := make([]string, 0, len(c))
+	for peer := range c {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+func (c cluster) Send(peer string, msg []byte) error {
+	return c[peer].Receive(msg)
+}
+
+func TestGossip(t *testing.T) {
+	template, _ := bloomfilter.New(100000, 5)
+	want, _ := template.NewCompatible()
+
+	c := make(cluster)
+	filters := make(map[string]*bloomfilter.Filter)
+	for _, id := range []string{"a", "b", "c"} {
+		f, _ := template.NewCompatible()
+		filters[id] = f
+		c[id] = NewGossiper(id, f, c)
+	}
+
+	for round := uint64(0); round < 3; round++ {
+		for i, id := range []string{"a", "b", "c"} {
+			x := round*1000 + uint64(i)
+			filters[id].AddHash(x)
+			want.AddHash(x)
+		}
+		for _, g := range c {
+			if err := g.Tick(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// one more round to spread the last changes
+	for _, g := range c {
+		if err := g.Tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wantWords := make([]uint64, want.Words())
+	want.CopyWords(wantWords, 0)
+	for id, f := range filters {
+		words := make([]uint64, f.Words())
+		f.CopyWords(words, 0)
+		for i := range words {
+			if words[i] != wantWords[i] {
+				t.Fatalf("%s: word %d is not the union", id, i)
+			}
+		}
+		if versions := c[id].Versions(); len(versions) != 2 {
+			t.Fatalf("%s: expected versions of 2 peers, got %v", id, versions)
+		}
+	}
+}
+
+func TestGossipDeltaChunks(t *testing.T) {
+	a, _ := bloomfilter.New(1<<20, 5)
+	b, _ := a.NewCompatible()
+	ga, gb := NewGossiper("a", a, nil), NewGossiper("b", b, nil)
+	for i := uint64(0); i < 20000; i++ {
+		a.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	ga.lock.Lock()
+	ga.record()
+	msg := ga.encodeDelta(0)
+	ga.lock.Unlock()
+
+	gen := b.Generation()
+	if err := gb.Receive(msg); err != nil {
+		t.Fatal(err)
+	}
+	// a UnionWords per chunk, not per word
+	chunks := (b.Words() + DefaultChunkWords - 1) / DefaultChunkWords
+	if changes := b.Generation() - gen; changes > chunks {
+		t.Errorf("%d changes merging a delta of %d chunks", changes, chunks)
+	}
+	wordsA, wordsB := make([]uint64, a.Words()), make([]uint64, b.Words())
+	a.CopyWords(wordsA, 0)
+	b.CopyWords(wordsB, 0)
+	for i := range wordsA {
+		if wordsB[i] != wordsA[i] {
+			t.Fatalf("word %d is not merged", i)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package bloomsync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+// dense marks a chunk of a pull delta holding all its words
+const dense = ^uint64(0)
+
+// Pull brings f, a replica, up to date with the compatible filter of the
+// peer at the other end of rw, which runs Serve, rsync-style: f sends the
+// digests of its chunks, and the peer answers with the chunks which differ,
+// whose words overwrite those of f. Unlike Sync, bits set only in f are
+// cleared, so that f becomes a copy of the peer's filter, whose N is not
+// transferred. It returns the number of words received.
+func (s *Syncer) Pull(f *bloomfilter.Filter, rw io.ReadWriter) (
+	received uint64, err error,
+) {
+	chunkWords, r, err := s.hello(f, rw)
+	if err != nil {
+		return 0, err
+	}
+	chunks := (f.Words() + chunkWords - 1) / chunkWords
+	_, err = rw.Write(encode(chunkDigests(f, chunkWords, chunks)))
+	if err != nil {
+		return 0, err
+	}
+	return readPullDelta(f, chunkWords, chunks, r)
+}
+
+// Serve the filter f to a replica at the other end of rw running Pull. It
+// returns the number of words sent.
+func (s *Syncer) Serve(f *bloomfilter.Filter, rw io.ReadWriter) (
+	sent uint64, err error,
+) {
+	chunkWords, r, err := s.hello(f, rw)
+	if err != nil {
+		return 0, err
+	}
+	chunks := (f.Words() + chunkWords - 1) / chunkWords
+	peerDigests := make([]uint64, chunks)
+	err = binary.Read(r, binary.LittleEndian, peerDigests)
+	if err != nil {
+		return 0, err
+	}
+
+	w := bufio.NewWriter(rw)
+	words := make([]uint64, chunkWords)
+	for i, digest := range chunkDigests(f, chunkWords, chunks) {
+		if digest == peerDigests[i] {
+			continue
+		}
+		n := f.CopyWords(words, uint64(i)*chunkWords)
+		sent += writePullChunk(w, uint64(i), words[:n])
+	}
+	// the end of the delta
+	_ = binary.Write(w, binary.LittleEndian, [2]uint64{dense, 0})
+	return sent, w.Flush()
+}
+
+// hello exchanges the settings of the peers, returning the chunk size and
+// the buffered reader of rw
+func (s *Syncer) hello(f *bloomfilter.Filter, rw io.ReadWriter) (
+	chunkWords uint64, r *bufio.Reader, err error,
+) {
+	chunkWords = s.ChunkWords
+	if chunkWords == 0 {
+		chunkWords = DefaultChunkWords
+	}
+	r = bufio.NewReader(rw)
+	ours := hello{
+		Magic:      magic,
+		Version:    version,
+		Compat:     f.CompatibilityHash(),
+		Words:      f.Words(),
+		ChunkWords: chunkWords,
+	}
+	var theirs hello
+	err = exchange(rw, r, encode(ours), func(r io.Reader) error {
+		return binary.Read(r, binary.LittleEndian, &theirs)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if theirs != ours {
+		return 0, nil, errHello(ours, theirs)
+	}
+	return chunkWords, r, nil
+}
+
+// writePullChunk writes the words of chunk i, as they are or, if it is
+// mostly zeros, only its non-zero words, returning the number of words
+// written
+//
+//	index	1 uint64
+//	count	1 uint64, the number of non-zero words, or dense
+//	words	[len(words)]uint64 if dense, else [count](offset, word uint64)
+func writePullChunk(w io.Writer, i uint64, words []uint64) uint64 {
+	nonZero := uint64(0)
+	for _, word := range words {
+		if word != 0 {
+			nonZero++
+		}
+	}
+	if 2*nonZero >= uint64(len(words)) {
+		_ = binary.Write(w, binary.LittleEndian, [2]uint64{i, dense})
+		_ = binary.Write(w, binary.LittleEndian, words)
+		return uint64(len(words))
+	}
+	_ = binary.Write(w, binary.LittleEndian, [2]uint64{i, nonZero})
+	for off, word := range words {
+		if word != 0 {
+			_ = binary.Write(w, binary.LittleEndian,
+				[2]uint64{uint64(off), word})
+		}
+	}
+	return 2 * nonZero
+}
+
+// readPullDelta reads the chunks written by Serve into f, returning the
+// number of words read
+func readPullDelta(f *bloomfilter.Filter, chunkWords, chunks uint64,
+	r io.Reader,
+) (n uint64, err error) {
+	words := f.Words()
+	chunk := make([]uint64, chunkWords)
+	for {
+		var header [2]uint64
+		err = binary.Read(r, binary.LittleEndian, &header)
+		if err != nil {
+			return n, err
+		}
+		i, count := header[0], header[1]
+		if i == dense {
+			return n, nil
+		}
+		if i >= chunks {
+			return n, fmt.Errorf("bloomsync: chunk %d is out of range", i)
+		}
+		off := i * chunkWords
+		size := chunkWords
+		if words-off < size {
+			size = words - off
+		}
+		if count == dense {
+			err = binary.Read(r, binary.LittleEndian, chunk[:size])
+			n += size
+		} else {
+			err = readSparseChunk(r, chunk[:size], count)
+			n += 2 * count
+		}
+		if err != nil {
+			return n, err
+		}
+		err = f.SetWords(chunk[:size], off)
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// readSparseChunk reads count (offset, word) pairs into chunk, whose other
+// words are zeros
+func readSparseChunk(r io.Reader, chunk []uint64, count uint64) error {
+	if count > uint64(len(chunk)) {
+		return fmt.Errorf("bloomsync: %d words in a chunk of %d", count,
+			len(chunk))
+	}
+	for i := range chunk {
+		chunk[i] = 0
+	}
+	var entry [2]uint64
+	for ; count > 0; count-- {
+		err := binary.Read(r, binary.LittleEndian, &entry)
+		if err != nil {
+			return err
+		}
+		if entry[0] >= uint64(len(chunk)) {
+			return fmt.Errorf("bloomsync: word %d is out of range", entry[0])
+		}
+		chunk[entry[0]] = entry[1]
+	}
+	return nil
+}
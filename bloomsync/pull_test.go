@@ -0,0 +1,94 @@
+package bloomsync
+
+import (
+	"net"
+	"testing"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+// pull replica from primary over a pipe
+func pull(t *testing.T, s Syncer, primary, replica *bloomfilter.Filter) (
+	received, sent uint64,
+) {
+	c1, c2 := net.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		var err error
+		sent, err = s.Serve(primary, c2)
+		errc <- err
+	}()
+	received, err := s.Pull(replica, c1)
+	if serr := <-errc; err == nil {
+		err = serr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return received, sent
+}
+
+func words(f *bloomfilter.Filter) []uint64 {
+	w := make([]uint64, f.Words())
+	f.CopyWords(w, 0)
+	return w
+}
+
+func TestPull(t *testing.T) {
+	primary, _ := bloomfilter.New(64*10000, 5)
+	for i := uint64(0); i < 20000; i++ {
+		primary.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	replica, _ := primary.Copy()
+	for i := uint64(20000); i < 20002; i++ {
+		primary.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	// set only in the replica, to be cleared
+	replica.AddHash(1)
+
+	s := Syncer{ChunkWords: 100}
+	received, sent := pull(t, s, primary, replica)
+	if received != sent || received == 0 || received > 15*100 {
+		t.Fatalf("received %d words, sent %d", received, sent)
+	}
+	want, got := words(primary), words(replica)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("word %d differs after pulling", i)
+		}
+	}
+	if received, _ = pull(t, s, primary, replica); received != 0 {
+		t.Fatalf("received %d words from an identical filter", received)
+	}
+
+	// mostly empty chunks are sent sparse
+	primary.Reset()
+	primary.AddHash(42)
+	received, _ = pull(t, s, primary, replica)
+	if received > 2*5 {
+		t.Fatalf("received %d words for 5 bits", received)
+	}
+	if !replica.ContainsHash(42) || replica.ContainsHash(1) {
+		t.Fatal("replica differs after pulling sparse chunks")
+	}
+}
+
+func TestPullIncompatible(t *testing.T) {
+	a, _ := bloomfilter.New(100000, 5)
+	b, _ := bloomfilter.New(100000, 5)
+
+	c1, c2 := net.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		var s Syncer
+		_, err := s.Serve(b, c2)
+		errc <- err
+	}()
+	var s Syncer
+	if _, err := s.Pull(a, c1); err == nil {
+		t.Fatal("expected error pulling from an incompatible filter")
+	}
+	if err := <-errc; err == nil {
+		t.Fatal("expected error serving an incompatible filter")
+	}
+}
@@ -0,0 +1,87 @@
+// Package bloomtest measures the false positive rate of filters empirically,
+// so that configuration changes can be validated by tests downstream, rather
+// than trusted to the formulas.
+package bloomtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+// z of the 95% confidence bounds
+const z = 1.959964
+
+// FPRate observed by probing a filter with elements it does not contain
+type FPRate struct {
+	Probes         int
+	FalsePositives int
+	// Rate of false positives, FalsePositives / Probes
+	Rate float64
+	// Lower and Upper bounds of the 95% confidence interval of the rate, by
+	// the Wilson score interval, which holds for rates close to 0
+	Lower, Upper float64
+}
+
+// Contains is true if p lies within the confidence interval of r, such as
+// the false positive probability a filter was sized for
+func (r FPRate) Contains(p float64) bool {
+	return r.Lower <= p && p <= r.Upper
+}
+
+func (r FPRate) String() string {
+	return fmt.Sprintf("%.3g%% [%.3g%%, %.3g%%] of %d probes", 100*r.Rate,
+		100*r.Lower, 100*r.Upper, r.Probes)
+}
+
+// MeasureFPRate adds insertN random elements (hashes) drawn from rng to f,
+// then probes it with probeN random elements which were not added, and
+// returns the rate at which f contains them. f should be empty, or hold
+// elements drawn from another source.
+func MeasureFPRate(f bloomfilter.HashFilter, insertN, probeN int,
+	rng *rand.Rand) FPRate {
+	added := make(map[uint64]struct{}, insertN)
+	for len(added) < insertN {
+		hash := rng.Uint64()
+		if _, ok := added[hash]; !ok {
+			added[hash] = struct{}{}
+			f.AddHash(hash)
+		}
+	}
+	r := FPRate{Probes: probeN}
+	for i := 0; i < probeN; {
+		hash := rng.Uint64()
+		if _, ok := added[hash]; ok {
+			continue
+		}
+		if f.ContainsHash(hash) {
+			r.FalsePositives++
+		}
+		i++
+	}
+	if probeN > 0 {
+		r.Rate = float64(r.FalsePositives) / float64(probeN)
+		r.Lower, r.Upper = wilson(r.Rate, float64(probeN))
+	} else {
+		r.Upper = 1
+	}
+	return r
+}
+
+// wilson score interval of rate p over n trials
+func wilson(p, n float64) (lower, upper float64) {
+	d := 1 + z*z/n
+	center := (p + z*z/(2*n)) / d
+	half := z / d * math.Sqrt(p*(1-p)/n+z*z/(4*n*n))
+	lower, upper = math.Max(center-half, 0), math.Min(center+half, 1)
+	// exactly, rather than within rounding errors
+	if p == 0 {
+		lower = 0
+	}
+	if p == 1 {
+		upper = 1
+	}
+	return lower, upper
+}
@@ -0,0 +1,42 @@
+package bloomtest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+func TestMeasureFPRate(t *testing.T) {
+	for _, p := range []float64{0.1, 0.01} {
+		f, _ := bloomfilter.NewOptimal(10000, p)
+		r := MeasureFPRate(f, 10000, 100000, rand.New(rand.NewSource(1)))
+		// keys are random and the expected probability an approximation,
+		// so allow 10% on top of the bounds
+		expected := f.FalsePosititveProbability()
+		if r.Lower > expected*1.1 || r.Upper < expected*0.9 ||
+			r.Rate < r.Lower || r.Rate > r.Upper ||
+			r.Probes != 100000 {
+			t.Errorf("%v, expected %.3g", r, expected)
+		}
+		if f.N() != 10000 {
+			t.Fatalf("%d elements added", f.N())
+		}
+	}
+
+	// no false positive, yet an upper bound above 0
+	f, _ := bloomfilter.NewOptimal(1000, 1e-9)
+	r := MeasureFPRate(f, 10, 1000, rand.New(rand.NewSource(1)))
+	if r.FalsePositives != 0 || r.Lower != 0 || r.Upper <= 0 ||
+		r.Upper > 0.005 {
+		t.Fatal(r)
+	}
+}
+
+func TestWilson(t *testing.T) {
+	// 10 successes out of 100
+	lower, upper := wilson(0.1, 100)
+	if lower < 0.0551 || lower > 0.0553 || upper < 0.1742 || upper > 0.1744 {
+		t.Fatalf("[%v, %v]", lower, upper)
+	}
+}
@@ -0,0 +1,112 @@
+package bloomfilter
+
+import (
+	"bufio"
+	"hash"
+	"io"
+	"sync"
+)
+
+// Builder ingests items into a Filter with several workers hashing them in
+// parallel. Every worker adds to its own filter compatible with the target,
+// and these are merged into the target when ingestion ends, so workers never
+// contend for the target's lock. This uses the memory of one more filter per
+// worker.
+type Builder struct {
+	f       *Filter
+	workers int
+	newHash func() hash.Hash64
+}
+
+// NewBuilder adding to f with workers workers, each hashing with its own
+// hash.Hash64 created by newHash
+func NewBuilder(f *Filter, workers int, newHash func() hash.Hash64) *Builder {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Builder{
+		f:       f,
+		workers: workers,
+		newHash: newHash,
+	}
+}
+
+// AddFromChannel adds the items received from in until it is closed, and
+// returns the number of items added
+func (b *Builder) AddFromChannel(in <-chan []byte) (n uint64, err error) {
+	return b.run(b.workers, func(worker int, add func([]byte)) error {
+		for item := range in {
+			add(item)
+		}
+		return nil
+	})
+}
+
+// AddFromReaders adds the tokens scanned from readers with split, with one
+// worker per reader, and returns the number of tokens added
+func (b *Builder) AddFromReaders(split bufio.SplitFunc,
+	readers ...io.Reader,
+) (n uint64, err error) {
+	return b.run(len(readers), func(worker int, add func([]byte)) error {
+		scanner := bufio.NewScanner(readers[worker])
+		scanner.Split(split)
+		for scanner.Scan() {
+			add(scanner.Bytes())
+		}
+		return scanner.Err()
+	})
+}
+
+// run workers calling ingest, then merges their filters into b.f
+func (b *Builder) run(workers int,
+	ingest func(worker int, add func([]byte)) error,
+) (n uint64, err error) {
+	shards := make([]*Filter, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	var progress struct {
+		sync.Mutex
+		n uint64
+	}
+	for w := range shards {
+		shards[w], err = b.f.NewCompatible()
+		if err != nil {
+			return 0, err
+		}
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			shard, h := shards[w], b.newHash()
+			batch := make([]uint64, 0, addBatchSize)
+			errs[w] = ingest(w, func(item []byte) {
+				h.Reset()
+				_, _ = h.Write(item)
+				batch = append(batch, h.Sum64())
+				if len(batch) == cap(batch) {
+					shard.AddHashes(batch)
+					batch = batch[:0]
+					if b.f.opts.progress != nil {
+						progress.Lock()
+						progress.n += addBatchSize
+						b.f.opts.progress(progress.n, 0)
+						progress.Unlock()
+					}
+				}
+			})
+			shard.AddHashes(batch)
+		}(w)
+	}
+	wg.Wait()
+
+	for w, shard := range shards {
+		n += shard.N()
+		if err == nil {
+			err = errs[w]
+		}
+		if uerr := b.f.UnionInPlace(shard); uerr != nil && err == nil {
+			err = uerr
+		}
+		_ = shard.Close()
+	}
+	return n, err
+}
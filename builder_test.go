@@ -0,0 +1,58 @@
+package bloomfilter
+
+import (
+	"bufio"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	bf, _ := New(100000, 5)
+	b := NewBuilder(bf, 4, func() hash.Hash64 { return fnv.New64a() })
+
+	in := make(chan []byte)
+	go func() {
+		defer close(in)
+		for i := 0; i < 1000; i++ {
+			in <- []byte(fmt.Sprint("channel ", i))
+		}
+	}()
+	n, err := b.AddFromChannel(in)
+	if err != nil || n != 1000 {
+		t.Fatalf("expected 1000 items, got %d (err=%v)", n, err)
+	}
+
+	var readers []io.Reader
+	for r := 0; r < 3; r++ {
+		var lines []string
+		for i := 0; i < 100; i++ {
+			lines = append(lines, fmt.Sprint("reader ", r, " ", i))
+		}
+		readers = append(readers, strings.NewReader(strings.Join(lines, "\n")))
+	}
+	n, err = b.AddFromReaders(bufio.ScanLines, readers...)
+	if err != nil || n != 300 {
+		t.Fatalf("expected 300 items, got %d (err=%v)", n, err)
+	}
+	if bf.N() != 1300 {
+		t.Fatalf("expected n=1300, got %d", bf.N())
+	}
+
+	h := fnv.New64a()
+	for i := 0; i < 1000; i++ {
+		h.Reset()
+		fmt.Fprint(h, "channel ", i)
+		if !bf.ContainsHash(h.Sum64()) {
+			t.Fatalf("item %d was not added", i)
+		}
+	}
+	h.Reset()
+	fmt.Fprint(h, "reader ", 2, " ", 99)
+	if !bf.ContainsHash(h.Sum64()) {
+		t.Fatal("token was not added")
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+// build writes a filter of the lines of an input file, sized for them
+func build(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	fp := fs.Float64("fp", 0.01, "false positive probability")
+	out := fs.String("o", "", "output filter file")
+	n := fs.Uint64("n", 0,
+		"number of elements to size for, else counted in a first pass")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of hashing workers")
+	hashes := fs.Bool("hashes", false,
+		"read uint64 hashes, decimal or 0x-prefixed hex, instead of keys")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *out == "" {
+		return errors.New("expected -o and an input file")
+	}
+	if *fp <= 0 || *fp >= 1 {
+		return errors.New("-fp must be between 0 and 1")
+	}
+	input := fs.Arg(0)
+	if *n == 0 {
+		count, err := countLines(input)
+		if err != nil {
+			return err
+		}
+		*n = count
+	}
+	if *n == 0 {
+		*n = 1
+	}
+
+	f, err := bloomfilter.NewOptimal(*n, *fp)
+	if err != nil {
+		return err
+	}
+	r, closeInput, err := openInput(input)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+	if *hashes {
+		err = addHashes(f, r)
+	} else {
+		err = addLines(f, r, *workers)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteFile(*out); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "%s: m=%d bits (%d bytes), k=%d, n=%d, "+
+		"false positive probability %.3g\n", *out, f.M(), (f.M()+7)/8,
+		f.K(), f.N(), f.FalsePosititveProbability())
+	return nil
+}
+
+// openInput opens the file name, decompressing it if it ends in .gz
+func openInput(name string) (io.Reader, func(), error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return file, func() { file.Close() }, nil
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return gz, func() { gz.Close(); file.Close() }, nil
+}
+
+// countLines of the file name
+func countLines(name string) (n uint64, err error) {
+	r, closeInput, err := openInput(name)
+	if err != nil {
+		return 0, err
+	}
+	defer closeInput()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// lineBatch is the number of lines hashed and added at once
+const lineBatch = 1024
+
+// addLines to f, hashed by workers a batch at a time. The hashes of a batch
+// are added to f itself, taking its lock once, rather than to a filter per
+// worker as with bloomfilter.Builder, so that building takes the memory of
+// f alone.
+func addLines(f *bloomfilter.Filter, r io.Reader, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	batches := make(chan [][]byte, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h := bloomfilter.ComparableHash(f)
+			hashes := make([]uint64, 0, lineBatch)
+			for batch := range batches {
+				hashes = hashes[:0]
+				for _, line := range batch {
+					h.Reset()
+					_, _ = h.Write(line)
+					hashes = append(hashes, h.Sum64())
+				}
+				f.AddHashes(hashes)
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	batch := make([][]byte, 0, lineBatch)
+	for scanner.Scan() {
+		batch = append(batch, append([]byte(nil), scanner.Bytes()...))
+		if len(batch) == lineBatch {
+			batches <- batch
+			batch = make([][]byte, 0, lineBatch)
+		}
+	}
+	batches <- batch
+	close(batches)
+	wg.Wait()
+	return scanner.Err()
+}
+
+// addHashes, one per line, to f
+func addHashes(f *bloomfilter.Filter, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	batch := make([]uint64, 0, lineBatch)
+	for line := 1; scanner.Scan(); line++ {
+		hash, err := strconv.ParseUint(scanner.Text(), 0, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		batch = append(batch, hash)
+		if len(batch) == cap(batch) {
+			f.AddHashes(batch)
+			batch = batch[:0]
+		}
+	}
+	f.AddHashes(batch)
+	return scanner.Err()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+// merge writes the union of filter files
+func merge(args []string, stdin io.Reader, stdout io.Writer) error {
+	return combine("merge", args, (*bloomfilter.Filter).UnionInPlace)
+}
+
+// intersect writes the intersection of filter files
+func intersect(args []string, stdin io.Reader, stdout io.Writer) error {
+	return combine("intersect", args, (*bloomfilter.Filter).IntersectInPlace)
+}
+
+// combine the filter files named after the output file by op, reading
+// them one at a time per worker, so that only one filter per worker, and
+// the result, are held in memory
+func combine(name string, args []string,
+	op func(f, f2 *bloomfilter.Filter) error) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	parallel := fs.Int("parallel", 1, "number of files read concurrently")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return errors.New("expected an output file and input files")
+	}
+	if *parallel < 1 {
+		return errors.New("-parallel must be at least 1")
+	}
+	out, inputs := fs.Arg(0), fs.Args()[1:]
+	if *parallel > len(inputs) {
+		*parallel = len(inputs)
+	}
+
+	names := make(chan string)
+	results := make([]*bloomfilter.Filter, *parallel)
+	errs := make([]error, *parallel)
+	var wg sync.WaitGroup
+	for w := range results {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for name := range names {
+				if errs[w] != nil {
+					continue // drain
+				}
+				results[w], errs[w] = combineFile(results[w], name, op)
+			}
+		}(w)
+	}
+	for _, name := range inputs {
+		names <- name
+	}
+	close(names)
+	wg.Wait()
+
+	var result *bloomfilter.Filter
+	for w, f := range results {
+		if errs[w] != nil {
+			return errs[w]
+		}
+		if f == nil {
+			continue
+		}
+		if result == nil {
+			result = f
+			continue
+		}
+		if err := op(result, f); err != nil {
+			return err
+		}
+	}
+	_, err := result.WriteFile(out)
+	return err
+}
+
+// combineFile reads the filter file name into f, by op, or as f if nil
+func combineFile(f *bloomfilter.Filter, name string,
+	op func(f, f2 *bloomfilter.Filter) error) (*bloomfilter.Filter, error) {
+	f2, _, err := bloomfilter.ReadFile(name)
+	if err != nil {
+		return f, fmt.Errorf("%s: %v", name, err)
+	}
+	if f == nil {
+		return f2, nil
+	}
+	if err = op(f, f2); err != nil {
+		return f, fmt.Errorf("%s: %v", name, err)
+	}
+	return f, nil
+}
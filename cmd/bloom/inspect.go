@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+// inspect prints the header and statistics of filter files, streaming
+// their bits
+func inspect(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no filter file")
+	}
+	for i, name := range fs.Args() {
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		if err := inspectFile(name, stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func inspectFile(name string, stdout io.Writer) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	info, err := bloomfilter.Inspect(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "file\t%s\n", name)
+	fmt.Fprintf(tw, "version\t%d\n", info.Version)
+	fmt.Fprintf(tw, "m\t%d\n", info.M)
+	fmt.Fprintf(tw, "k\t%d\n", info.K)
+	for i, key := range info.Keys {
+		fmt.Fprintf(tw, "key %d\t%#016x\n", i, key)
+	}
+	fmt.Fprintf(tw, "scheme\t%s\n", info.Scheme)
+	fmt.Fprintf(tw, "n\t%d\n", info.N)
+	fmt.Fprintf(tw, "estimated n\t%.0f\n", info.EstimatedN)
+	fmt.Fprintf(tw, "fill ratio\t%.4f\n", info.FillRatio)
+	fmt.Fprintf(tw, "checksum\t%s\n", map[bool]string{
+		true: "valid", false: "INVALID"}[info.ChecksumValid])
+	fmt.Fprintf(tw, "size\t%d bytes, %d on disk\n", info.Size, stat.Size())
+	return tw.Flush()
+}
@@ -0,0 +1,75 @@
+// Command bloom inspects, builds, combines and queries the Bloom filter files
+// of package bloomfilter, as written by Filter.WriteFile.
+//
+// Usage:
+//
+//	bloom <command> [flags] [arguments]
+//
+// The commands are:
+//
+//	build      write a filter of the lines of a file, sized for them
+//	inspect    print the parameters and statistics of filter files
+//	merge      write the union of filter files
+//	intersect  write the intersection of filter files
+//	query      print the lines of stdin which a filter maybe contains
+//
+// Lines are keys hashed by bloomfilter.ComparableSum64, or hashes with the
+// -hashes flag of the commands which read them.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// command runs with its arguments, reading stdin and writing stdout
+type command struct {
+	usage string
+	run   func(args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"build": {"build [-fp p] [-n n] [-workers n] [-hashes] -o out.bf " +
+		"input.txt[.gz]", build},
+	"inspect":   {"inspect file.bf...", inspect},
+	"merge":     {"merge [-parallel n] out.bf in.bf...", merge},
+	"intersect": {"intersect [-parallel n] out.bf in.bf...", intersect},
+	"query":     {"query [-v] [-tsv] [-hashes] filter.bf < lines", query},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run the command named by args[0], returning the exit status
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "bloom: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+	if err := cmd.run(args[1:], stdin, stdout); err != nil {
+		fmt.Fprintf(stderr, "bloom %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "\tbloom %s\n", commands[name].usage)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+// bloom runs the command line args, returning its output and status
+func bloom(t *testing.T, stdin string, args ...string) (string, int) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	if status != 0 {
+		t.Logf("bloom %s: %s", strings.Join(args, " "), stderr.String())
+	}
+	return stdout.String(), status
+}
+
+// tempDir for the files of a test, for the test to remove
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bloom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestUsage(t *testing.T) {
+	if _, status := bloom(t, ""); status != 2 {
+		t.Fatalf("status %d without command", status)
+	}
+	if _, status := bloom(t, "", "frobnicate"); status != 2 {
+		t.Fatalf("status %d for an unknown command", status)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "f.bf.gz")
+	f, _ := bloomfilter.NewWithKeys(1<<16, []uint64{1, 2, 3},
+		bloomfilter.WithBlocked())
+	for i := uint64(0); i < 1000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	if _, err := f.WriteFile(name); err != nil {
+		t.Fatal(err)
+	}
+
+	out, status := bloom(t, "", "inspect", name)
+	if status != 0 {
+		t.Fatalf("status %d", status)
+	}
+	for _, want := range []string{"m            65536", "k            3",
+		"key 1        0x0000000000000002", "scheme       blocked",
+		"n            1000", "checksum     valid"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q missing from\n%s", want, out)
+		}
+	}
+
+	if _, status = bloom(t, "", "inspect", filepath.Join(dir, "none")); status != 1 {
+		t.Fatalf("status %d for a missing file", status)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	f, _ := bloomfilter.New(1<<16, 5)
+	var inputs []string
+	for i := uint64(0); i < 5; i++ {
+		f2, _ := f.NewCompatible()
+		// 0 to 99 in all, and 100 per file
+		for j := uint64(0); j < 100; j++ {
+			f2.AddHash(j)
+			f2.AddHash((i+1)*1000 + j)
+		}
+		name := filepath.Join(dir, fmt.Sprint(i, ".bf.gz"))
+		if _, err := f2.WriteFile(name); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, name)
+	}
+
+	for _, parallel := range []string{"1", "3", "10"} {
+		union := filepath.Join(dir, "union.bf.gz")
+		_, status := bloom(t, "", append([]string{"merge", "-parallel",
+			parallel, union}, inputs...)...)
+		if status != 0 {
+			t.Fatalf("merge status %d", status)
+		}
+		inter := filepath.Join(dir, "inter.bf.gz")
+		_, status = bloom(t, "", append([]string{"intersect", "-parallel",
+			parallel, inter}, inputs...)...)
+		if status != 0 {
+			t.Fatalf("intersect status %d", status)
+		}
+		u, _, err := bloomfilter.ReadFile(union)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in, _, err := bloomfilter.ReadFile(inter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.N() != 1000 || in.N() != 200 {
+			t.Fatalf("n of union %d, of intersection %d", u.N(), in.N())
+		}
+		for j := uint64(0); j < 100; j++ {
+			if !u.ContainsHash(5000+j) || !in.ContainsHash(j) {
+				t.Fatalf("%d missing", j)
+			}
+		}
+		if in.ContainsHash(1000) && in.ContainsHash(2000) &&
+			in.ContainsHash(3000) {
+			t.Fatal("intersection contains elements of single files")
+		}
+	}
+
+	other, _ := bloomfilter.New(1<<16, 5)
+	otherName := filepath.Join(dir, "other.bf.gz")
+	_, _ = other.WriteFile(otherName)
+	_, status := bloom(t, "", "merge", filepath.Join(dir, "x.bf.gz"),
+		inputs[0], otherName)
+	if status != 1 {
+		t.Fatalf("status %d merging incompatible filters", status)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "f.bf.gz")
+	f, _ := bloomfilter.New(1<<16, 5)
+	for _, key := range []string{"apple", "cherry"} {
+		h := bloomfilter.ComparableHash(f)
+		_, _ = h.Write([]byte(key))
+		f.AddHash(h.Sum64())
+	}
+	f.AddHash(42)
+	if _, err := f.WriteFile(name); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		args       []string
+		stdin, out string
+	}{
+		{nil, "apple\nbanana\ncherry\n", "apple\ncherry\n"},
+		{[]string{"-v"}, "apple\nbanana\ncherry", "banana\n"},
+		{[]string{"-tsv"}, "apple\nbanana\n", "apple\thit\nbanana\tmiss\n"},
+		{[]string{"-hashes"}, "42\n0x2a\n43\n", "42\n0x2a\n"},
+	} {
+		out, status := bloom(t, c.stdin,
+			append(append([]string{"query"}, c.args...), name)...)
+		if status != 0 || out != c.out {
+			t.Errorf("%v: status %d, output %q", c.args, status, out)
+		}
+	}
+	if _, status := bloom(t, "x\n", "query", "-hashes", name); status != 1 {
+		t.Fatalf("status %d for a line which is not a hash", status)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	var lines, hashes strings.Builder
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintln(&lines, "key", i)
+		fmt.Fprintln(&hashes, i*7919)
+	}
+	text := filepath.Join(dir, "keys.txt.gz")
+	file, _ := os.Create(text)
+	gz := gzip.NewWriter(file)
+	_, _ = gz.Write([]byte(lines.String()))
+	_ = gz.Close()
+	_ = file.Close()
+	hashFile := filepath.Join(dir, "hashes.txt")
+	_ = ioutil.WriteFile(hashFile, []byte(hashes.String()), 0600)
+
+	out := filepath.Join(dir, "f.bf.gz")
+	report, status := bloom(t, "", "build", "-fp", "0.001", "-workers", "3",
+		"-o", out, text)
+	if status != 0 || !strings.Contains(report, "n=10000,") {
+		t.Fatalf("status %d, report %q", status, report)
+	}
+	f, _, err := bloomfilter.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.M() != bloomfilter.OptimalM(10000, 0.001) {
+		t.Fatalf("m=%d", f.M())
+	}
+	// queried as built
+	queried, _ := bloom(t, lines.String(), "query", "-v", out)
+	if queried != "" {
+		t.Fatalf("keys missing: %q", queried)
+	}
+
+	_, status = bloom(t, "", "build", "-n", "20000", "-hashes", "-o", out,
+		hashFile)
+	f, _, _ = bloomfilter.ReadFile(out)
+	if status != 0 || f.N() != 10000 || !f.ContainsHash(9999*7919) ||
+		f.M() != bloomfilter.OptimalM(20000, 0.01) {
+		t.Fatalf("status %d, filter %#v", status, f)
+	}
+}
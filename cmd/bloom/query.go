@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+// query prints the lines of stdin which the filter maybe contains
+func query(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	invert := fs.Bool("v", false,
+		"print the lines the filter does not contain instead")
+	tsv := fs.Bool("tsv", false,
+		"print every line, followed by a tab and hit or miss")
+	hashes := fs.Bool("hashes", false,
+		"read uint64 hashes, decimal or 0x-prefixed hex, instead of keys")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected a filter file")
+	}
+	f, _, err := bloomfilter.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(nil, 1<<20)
+	w := bufio.NewWriter(stdout)
+	h := bloomfilter.ComparableHash(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		var contained bool
+		if *hashes {
+			hash, err := strconv.ParseUint(text, 0, 64)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+			contained = f.ContainsHash(hash)
+		} else {
+			h.Reset()
+			_, _ = h.Write(scanner.Bytes())
+			contained = f.ContainsHash(h.Sum64())
+		}
+		switch {
+		case *tsv && contained:
+			fmt.Fprintf(w, "%s\thit\n", text)
+		case *tsv:
+			fmt.Fprintf(w, "%s\tmiss\n", text)
+		case contained != *invert:
+			fmt.Fprintln(w, text)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
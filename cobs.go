@@ -0,0 +1,239 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"unsafe"
+)
+
+// BitSlicedIndex is a compact index of many compatible filters, one per
+// document or sample, answering which of them contain at least a fraction
+// of a set of keys, like COBS (the Compact Bit-Sliced signature index).
+//
+// The filters are stored transposed: row i holds bit i of every filter, one
+// bit per document, so that a key is looked up in all documents at once by
+// AND-ing its k rows together. It is immutable once built.
+type BitSlicedIndex struct {
+	core  // keys, m and layout of the filters, "bits" being unused
+	ids   []string
+	width uint64   // words per row
+	rows  []uint64 // m rows of width words
+}
+
+// NewBitSlicedIndex of filters, ids[d] naming filters[d]. The filters must
+// be compatible (see NewCompatible).
+func NewBitSlicedIndex(ids []string, filters []*Filter) (
+	*BitSlicedIndex, error,
+) {
+	if len(filters) == 0 || len(ids) != len(filters) {
+		return nil, errIndexFilters()
+	}
+	first := filters[0]
+	compat := first.CompatibilityHash()
+	x := &BitSlicedIndex{
+		core: core{
+			keys:  first.keys,
+			m:     first.m,
+			flags: first.flags,
+			masks: first.masks,
+		},
+		ids:   ids,
+		width: (uint64(len(filters)) + 63) / 64,
+	}
+	if x.m > maxInt/Uint64Bytes/x.width {
+		return nil, errTooLarge(x.m / 8 * uint64(len(filters)))
+	}
+	if err := checkWords(x.m * x.width); err != nil {
+		return nil, err
+	}
+	x.rows = newAlignedWords(x.m * x.width)
+
+	for d, f := range filters {
+		if f.CompatibilityHash() != compat {
+			return nil, errIndexFilters()
+		}
+		col, bit := uint64(d)/64, uint64(1)<<uint(d%64)
+		f.lock.RLock()
+		for w, bitword := range f.bits {
+			for ; bitword != 0; bitword &= bitword - 1 {
+				i := uint64(w)*64 + uint64(bits.TrailingZeros64(bitword))
+				x.rows[i*x.width+col] |= bit
+			}
+		}
+		f.lock.RUnlock()
+	}
+	return x, nil
+}
+
+// Len is the number of indexed filters
+func (x *BitSlicedIndex) Len() int {
+	return len(x.ids)
+}
+
+// Query returns the ids of the filters which may contain at least a
+// fraction theta of the (already hashed) keys, such as the k-mers of a
+// sequence
+func (x *BitSlicedIndex) Query(hashes []uint64, theta float64) (ids []string) {
+	scores := x.Scores(hashes)
+	need := theta * float64(len(hashes))
+	for d, score := range scores {
+		if float64(score) >= need {
+			ids = append(ids, x.ids[d])
+		}
+	}
+	return ids
+}
+
+// Scores returns, for each indexed filter in the order given to
+// NewBitSlicedIndex, how many of the (already hashed) keys it may contain
+func (x *BitSlicedIndex) Scores(hashes []uint64) []int {
+	scores := make([]int, len(x.ids))
+	hits := make([]uint64, x.width)
+	var locations []uint64
+	for _, hash := range hashes {
+		locations = x.locations(hash, locations[:0])
+		for col := range hits {
+			hits[col] = ^uint64(0)
+		}
+		for _, i := range locations {
+			row := x.rows[i*x.width : (i+1)*x.width]
+			for col, bitword := range row {
+				hits[col] &= bitword
+			}
+		}
+		for col, bitword := range hits {
+			for ; bitword != 0; bitword &= bitword - 1 {
+				d := col*64 + bits.TrailingZeros64(bitword)
+				if d < len(scores) {
+					scores[d]++
+				}
+			}
+		}
+	}
+	return scores
+}
+
+// marshalled binary layout of a BitSlicedIndex (Little Endian), laid out
+// so that the rows can be used in place from a memory-mapped file:
+//
+//	 k	1 uint64, flags in the high 32 bits, see WithBlocked
+//	 d	1 uint64, number of filters
+//	 m	1 uint64
+//	 keys	[k]uint64
+//	 size	1 uint64, size of the ids in bytes
+//	 ids	[d] uvarint length followed by the id, padded to 8 bytes
+//	 rows	[m*((d+63)/64)]uint64
+//
+// Unlike filters, the index has no trailing hash, which would have to be
+// checked by reading all of it.
+
+// WriteTo w the uncompressed index, see OpenBitSlicedIndex
+func (x *BitSlicedIndex) WriteTo(w io.Writer) (n int64, err error) {
+	buf := new(bytes.Buffer)
+	header := []uint64{
+		uint64(len(x.keys)) | uint64(x.flags)<<32, uint64(len(x.ids)), x.m,
+	}
+	header = append(header, x.keys...)
+
+	var ids bytes.Buffer
+	var length [binary.MaxVarintLen64]byte
+	for _, id := range x.ids {
+		ids.Write(length[:binary.PutUvarint(length[:], uint64(len(id)))])
+		ids.WriteString(id)
+	}
+	for ids.Len()%Uint64Bytes != 0 {
+		ids.WriteByte(0)
+	}
+	header = append(header, uint64(ids.Len()))
+
+	err = binary.Write(buf, binary.LittleEndian, header)
+	if err != nil {
+		return 0, err
+	}
+	buf.Write(ids.Bytes())
+
+	written, err := buf.WriteTo(w)
+	n += written
+	if err != nil {
+		return n, err
+	}
+	err = writeWords(w, x.rows)
+	if err != nil {
+		return n, err
+	}
+	return n + int64(len(x.rows))*Uint64Bytes, nil
+}
+
+// OpenBitSlicedIndex written by WriteTo, without copying its rows out of
+// data, which would typically be a memory-mapped file.
+//
+// data must not be modified or released while the index is in use, the
+// rows within it must be 8-byte aligned and the host must be little-endian.
+func OpenBitSlicedIndex(data []byte) (*BitSlicedIndex, error) {
+	buf := bytes.NewBuffer(data)
+
+	k, flags, d, m, err := unmarshalBinaryHeader(buf)
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(len(data))
+	if k > size/Uint64Bytes || d == 0 {
+		return nil, errSize()
+	}
+	keys, err := unmarshalBinaryKeys(buf, k)
+	if err != nil {
+		return nil, err
+	}
+	masks, err := newFlagsMasks(flags, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var idsSize uint64
+	err = binary.Read(buf, binary.LittleEndian, &idsSize)
+	if err != nil {
+		return nil, err
+	}
+	// every id takes a byte at least, which bounds d by the data
+	if idsSize > uint64(buf.Len()) || idsSize%Uint64Bytes != 0 ||
+		d > idsSize {
+		return nil, errSize()
+	}
+	width := (d + 63) / 64
+	if m > size/Uint64Bytes/width ||
+		uint64(buf.Len())-idsSize != m*width*Uint64Bytes {
+		return nil, errSize()
+	}
+
+	idsBuf := bytes.NewBuffer(buf.Next(int(idsSize)))
+	ids := make([]string, 0, d)
+	for uint64(len(ids)) < d {
+		length, err := binary.ReadUvarint(idsBuf)
+		if err != nil {
+			return nil, err
+		}
+		if length > uint64(idsBuf.Len()) {
+			return nil, errSize()
+		}
+		ids = append(ids, string(idsBuf.Next(int(length))))
+	}
+
+	raw := buf.Bytes()
+	if !nativeLittleEndian ||
+		uintptr(unsafe.Pointer(&raw[0]))%Uint64Bytes != 0 { // #nosec
+		return nil, errAlignment()
+	}
+	return &BitSlicedIndex{
+		core: core{
+			keys:  keys,
+			m:     m,
+			flags: flags,
+			masks: masks,
+		},
+		ids:   ids,
+		width: width,
+		rows:  uint64sFromBytes(raw),
+	}, nil
+}
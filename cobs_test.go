@@ -0,0 +1,81 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"unsafe"
+)
+
+func TestBitSlicedIndex(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBlocked()}, {WithRegisterBlocked()}} {
+		template, _ := New(1<<16, 5, opts...)
+		var ids []string
+		var filters []*Filter
+		for d := uint64(0); d < 100; d++ {
+			f, _ := template.NewCompatible()
+			for i := uint64(0); i < 100; i++ {
+				f.AddHash(d*1000 + i)
+			}
+			ids = append(ids, fmt.Sprint("doc", d))
+			filters = append(filters, f)
+		}
+		x, err := NewBitSlicedIndex(ids, filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		n, err := x.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(buf.Len()) {
+			t.Fatalf("wrote %d bytes, reported %d", buf.Len(), n)
+		}
+		words := newAlignedWords(uint64(buf.Len()) / Uint64Bytes)
+		data := (*[1 << 30]byte)(unsafe.Pointer(&words[0]))[:buf.Len()]
+		copy(data, buf.Bytes())
+		opened, err := OpenBitSlicedIndex(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 60% of the keys of doc 42, and 40% of nothing
+		var hashes []uint64
+		for i := uint64(0); i < 60; i++ {
+			hashes = append(hashes, 42000+i)
+		}
+		for i := uint64(0); i < 40; i++ {
+			hashes = append(hashes, 1000000+i)
+		}
+		for _, index := range []*BitSlicedIndex{x, opened} {
+			got := index.Query(hashes, 0.5)
+			if len(got) != 1 || got[0] != "doc42" {
+				t.Fatalf("expected only doc42, got %v", got)
+			}
+			if got = index.Query(hashes, 0.9); len(got) != 0 {
+				t.Fatalf("expected no document, got %v", got)
+			}
+		}
+
+		if _, err = OpenBitSlicedIndex(data[:len(data)-8]); err == nil {
+			t.Fatal("expected error for truncated index")
+		}
+		for _, d := range []uint64{1 << 40, math.MaxUint64} {
+			hostile := append([]byte(nil), data...)
+			binary.LittleEndian.PutUint64(hostile[8:], d)
+			if _, err = OpenBitSlicedIndex(hostile); err == nil {
+				t.Fatalf("expected error for %d documents", d)
+			}
+		}
+	}
+
+	f1, _ := New(1000, 5)
+	f2, _ := New(1000, 5)
+	if _, err := NewBitSlicedIndex([]string{"a", "b"}, []*Filter{f1, f2}); err == nil {
+		t.Fatal("expected error for incompatible filters")
+	}
+}
@@ -0,0 +1,300 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"unsafe"
+)
+
+// compact binary layout (Little Endian), a fixed header that other
+// languages can read as a struct, and that identifies filter files by its
+// first bytes, followed by the keys and bits:
+//
+//	 magic	[4]byte, "BLMF"
+//	 version	1 uint16, compactVersion
+//	 size	1 uint16, of the header, compactHeaderSize
+//	 flags	1 uint32, see WithBlocked
+//	 k	1 uint32
+//	 m	1 uint64
+//	 n	1 uint64
+//	 hash	sha384 of the 32 bytes above, then of keys and bits
+//	 keys	[k]uint64
+//	 bits	[(m+63)/64]uint64
+//
+//	 size = 80 + (k + (m+63)/64) * 8 bytes
+//
+// Read as a first word of the original layout, the magic and version are an
+// invalid k and flags, so that the layouts cannot be mistaken for each other.
+
+const (
+	compactMagic      = "BLMF"
+	compactVersion    = 1
+	compactFixedSize  = 32
+	compactHeaderSize = compactFixedSize + sha512.Size384
+)
+
+// isCompact is true if data starts with the magic of the compact layout
+func isCompact(data []byte) bool {
+	return len(data) >= len(compactMagic) &&
+		string(data[:len(compactMagic)]) == compactMagic
+}
+
+// compactSize is the size of the compact layout of k keys and the given
+// number of words, if it can be addressed
+func compactSize(k, words uint64) (uint64, error) {
+	const maxWords = maxInt / Uint64Bytes / 4
+	if k > maxWords || words > maxWords {
+		return 0, errSize()
+	}
+	return compactHeaderSize + (k+words)*Uint64Bytes, nil
+}
+
+// MarshalCompact converts a Filter into the compact layout, which starts with
+// a fixed header rather than being compressed. UnmarshalBinary,
+// UnmarshalBinaryNoCopy, ReadFrom and Inspect read it as well as the layout
+// of MarshalBinary.
+func (f *Filter) MarshalCompact() (data []byte, err error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	k := uint64(len(f.keys))
+	size, err := compactSize(k, uint64(len(f.bits)))
+	if err != nil {
+		return nil, err
+	}
+
+	data = make([]byte, size)
+	f.putCompactFixed(data)
+	body := data[compactHeaderSize:]
+	for i, key := range f.keys {
+		binary.LittleEndian.PutUint64(body[i*Uint64Bytes:], key)
+	}
+	body = body[k*Uint64Bytes:]
+	for i, word := range f.bits {
+		binary.LittleEndian.PutUint64(body[i*Uint64Bytes:], word)
+	}
+
+	copy(data[compactFixedSize:], compactHash(data))
+
+	debug("bloomfilter.MarshalCompact: Successfully wrote %d byte(s)",
+		len(data))
+	return data, nil
+}
+
+// putCompactFixed puts the fields of the compact header of f before its
+// hash into data. f must be locked.
+func (f *Filter) putCompactFixed(data []byte) {
+	copy(data, compactMagic)
+	binary.LittleEndian.PutUint16(data[4:], compactVersion)
+	binary.LittleEndian.PutUint16(data[6:], compactHeaderSize)
+	binary.LittleEndian.PutUint32(data[8:], f.flags)
+	binary.LittleEndian.PutUint32(data[12:], uint32(len(f.keys)))
+	binary.LittleEndian.PutUint64(data[16:], f.m)
+	binary.LittleEndian.PutUint64(data[24:], f.n)
+}
+
+// compactHeader is the compact header of f, hashing its keys and bits
+// len(chunk) bytes at a time. f must be locked.
+func (f *Filter) compactHeader(chunk []byte) []byte {
+	header := make([]byte, compactHeaderSize)
+	f.putCompactFixed(header)
+	h := sha512.New384()
+	_, _ = h.Write(header[:compactFixedSize])
+	// hashes never fail
+	_ = writeWordsChunk(h, f.keys, chunk)
+	_ = writeWordsChunk(h, f.bits, chunk)
+	copy(header[compactFixedSize:], h.Sum(nil))
+	return header
+}
+
+// compactHash is the hash of the compact layout in data
+func compactHash(data []byte) []byte {
+	h := sha512.New384()
+	_, _ = h.Write(data[:compactFixedSize])
+	_, _ = h.Write(data[compactHeaderSize:])
+	return h.Sum(nil)
+}
+
+// unmarshalCompactHeader reads the fixed header of the compact layout
+func unmarshalCompactHeader(header []byte) (k uint64, flags uint32,
+	n, m uint64, err error,
+) {
+	if len(header) < compactHeaderSize {
+		return k, flags, n, m, io.ErrUnexpectedEOF
+	}
+	if !isCompact(header) {
+		return k, flags, n, m, errSize()
+	}
+	version := binary.LittleEndian.Uint16(header[4:])
+	size := binary.LittleEndian.Uint16(header[6:])
+	if version != compactVersion || size != compactHeaderSize {
+		return k, flags, n, m, errCompactVersion(version, size)
+	}
+
+	flags = binary.LittleEndian.Uint32(header[8:])
+	k = uint64(binary.LittleEndian.Uint32(header[12:]))
+	m = binary.LittleEndian.Uint64(header[16:])
+	n = binary.LittleEndian.Uint64(header[24:])
+	err = checkHeader(k, flags, m)
+
+	debug("read compact bf k=%d flags=%#x n=%d m=%d\n", k, flags, n, m)
+
+	return k, flags, n, m, err
+}
+
+// unmarshalCompact is UnmarshalBinary of the compact layout, with the bits
+// aliasing data if noCopy. f must be locked.
+func (f *Filter) unmarshalCompact(data []byte, noCopy bool) error {
+	k, flags, n, m, err := unmarshalCompactHeader(data)
+	if err != nil {
+		return err
+	}
+
+	words := (m + 63) / 64
+	size, err := compactSize(k, words)
+	if err != nil {
+		return err
+	}
+	if uint64(len(data)) != size {
+		return errSize()
+	}
+
+	buf := bytes.NewBuffer(data[compactHeaderSize:])
+	keys, err := unmarshalBinaryKeys(buf, k)
+	if err != nil {
+		return err
+	}
+
+	masks, err := newFlagsMasks(flags, keys)
+	if err != nil {
+		return err
+	}
+
+	var bits []uint64
+	if noCopy {
+		raw := buf.Next(int(words * Uint64Bytes))
+		if !nativeLittleEndian ||
+			uintptr(unsafe.Pointer(&raw[0]))%Uint64Bytes != 0 { // #nosec
+			return errAlignment()
+		}
+		bits = uint64sFromBytes(raw)
+	} else {
+		bits, err = unmarshalBinaryBits(buf, m)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = checkTrailingBits(bits, m)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(data[compactFixedSize:compactHeaderSize],
+		compactHash(data)) {
+		err = errHash()
+		f.opts.logf("bloomfilter: corrupt filter of %d bytes: %v", len(data), err)
+		return err
+	}
+
+	f.gen++
+	err = f.releaseMem()
+	if err != nil {
+		return err
+	}
+
+	f.m = m
+	f.n = n
+	f.flags = flags
+	f.keys = keys
+	f.masks = masks
+	f.bits = bits
+	f.recountBits()
+	return nil
+}
+
+// readCompact is readFrom for the compact layout
+func readCompact(r io.Reader, progress Progress) (f *Filter, n int64, err error) {
+	// the header bounds the size of the content, so that untrusted data
+	// cannot claim more than it holds
+	header := make([]byte, compactHeaderSize)
+	_, err = io.ReadFull(r, header)
+	if err != nil {
+		return nil, -1, err
+	}
+	k, _, _, m, err := unmarshalCompactHeader(header)
+	if err != nil {
+		return nil, -1, err
+	}
+	size, err := compactSize(k, (m+63)/64)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	content, err := ioutil.ReadAll(newProgressReader(io.LimitReader(
+		io.MultiReader(bytes.NewReader(header), r), int64(size)),
+		size, progress))
+	if err != nil {
+		return nil, -1, err
+	}
+
+	f = new(Filter)
+	n = int64(len(content))
+	err = f.UnmarshalBinary(content)
+	if err != nil {
+		return nil, -1, err
+	}
+	return f, n, nil
+}
+
+// WriteCompactTo a Writer w from Bloom filter f in the compact layout,
+// uncompressed, so that its header can be read in place. Like WriteTo, it
+// writes a chunk at a time, see WithWriteChunk.
+func (f *Filter) WriteCompactTo(w io.Writer) (n int64, err error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	size, err := compactSize(uint64(len(f.keys)), uint64(len(f.bits)))
+	if err != nil {
+		return -1, err
+	}
+
+	cw := &countingWriter{w: newProgressWriter(w, size, f.opts.progress)}
+	chunk := f.opts.newWriteChunk()
+	_, err = cw.Write(f.compactHeader(chunk))
+	if err != nil {
+		return cw.n, err
+	}
+
+	err = writeWordsChunk(cw, f.keys, chunk)
+	if err != nil {
+		return cw.n, err
+	}
+
+	err = writeWordsChunk(cw, f.bits, chunk)
+	return cw.n, err
+}
+
+// WriteCompactFile filename from Bloom filter f in the compact layout,
+// which ReadFile reads
+// Suggested file extension: .bf
+func (f *Filter) WriteCompactFile(filename string) (n int64, err error) {
+	w, err := os.Create(filename)
+	if err != nil {
+		return -1, err
+	}
+	defer func() {
+		// keep the first error
+		closeErr := w.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	return f.WriteCompactTo(w)
+}
@@ -0,0 +1,132 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompactLayout(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBlocked()},
+		{WithRegisterBlocked()}, {WithIndexScheme(EnhancedDoubleHashing)}} {
+		f, _ := New(10048, 5, opts...)
+		for i := uint64(0); i < 500; i++ {
+			f.AddHash(i * 0x9e3779b97f4a7c15)
+		}
+		data, err := f.MarshalCompact()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data[:4]) != "BLMF" ||
+			binary.LittleEndian.Uint16(data[4:]) != 1 ||
+			binary.LittleEndian.Uint16(data[6:]) != 80 ||
+			binary.LittleEndian.Uint32(data[8:]) != f.flags ||
+			binary.LittleEndian.Uint32(data[12:]) != 5 ||
+			binary.LittleEndian.Uint64(data[16:]) != f.M() ||
+			binary.LittleEndian.Uint64(data[24:]) != 500 ||
+			len(data) != 80+(5+len(f.bits))*8 {
+			t.Fatalf("header % x", data[:32])
+		}
+
+		f2 := new(Filter)
+		if err = f2.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if !sameFilter(f, f2) || f2.N() != 500 {
+			t.Fatal("compact layout did not round-trip")
+		}
+
+		f3 := new(Filter)
+		if err = f3.UnmarshalBinaryNoCopy(data); err != nil &&
+			err.Error() != errAlignment().Error() {
+			t.Fatal(err)
+		} else if err == nil && !sameFilter(f, f3) {
+			t.Fatal("compact layout did not round-trip without copying")
+		}
+	}
+}
+
+func TestCompactLayoutCorrupt(t *testing.T) {
+	f, _ := New(10048, 5)
+	f.AddHash(42)
+	data, _ := f.MarshalCompact()
+
+	for _, tc := range []struct {
+		name   string
+		offset int
+	}{
+		{"magic", 0}, {"version", 4}, {"header size", 6}, {"flags", 10},
+		{"k", 12}, {"n", 24}, {"hash", 40}, {"key", 80}, {"bits", len(data) - 1},
+	} {
+		corrupt := append([]byte(nil), data...)
+		corrupt[tc.offset] ^= 0x40
+		if err := new(Filter).UnmarshalBinary(corrupt); err == nil {
+			t.Errorf("expected error for a corrupt %s", tc.name)
+		}
+	}
+	for _, size := range []int{4, 79, 80, len(data) - 1} {
+		if err := new(Filter).UnmarshalBinary(data[:size]); err == nil {
+			t.Errorf("expected error for %d bytes", size)
+		}
+	}
+	if err := new(Filter).UnmarshalBinary(append(data, 0)); err == nil {
+		t.Error("expected error for a trailing byte")
+	}
+}
+
+func TestCompactLayoutFile(t *testing.T) {
+	f, _ := New(100000, 5, WithRegisterBlocked())
+	for i := uint64(0); i < 5000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	dir, err := ioutil.TempDir("", "bloomfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "filter.bf")
+	n, err := f.WriteCompactFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, n2, err := ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != n2 || !sameFilter(f, f2) {
+		t.Fatalf("read %d bytes of %d", n2, n)
+	}
+
+	var buf bytes.Buffer
+	_, _ = f.WriteCompactTo(&buf)
+	info, err := Inspect(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != 1 || info.M != f.M() || info.K != 5 ||
+		info.N != 5000 || info.Scheme != "register-blocked" ||
+		info.Keys[4] != f.keys[4] || info.SetBits != countBits(f.bits) ||
+		!info.ChecksumValid || info.Size != uint64(n) {
+		t.Fatalf("%+v", info)
+	}
+
+	data, _ := f.MarshalCompact()
+	data[len(data)-1] ^= 1
+	info, err = Inspect(bytes.NewReader(data))
+	if err != nil || info.ChecksumValid {
+		t.Fatalf("corrupt filter inspected as %+v, %v", info, err)
+	}
+	if _, err = Inspect(bytes.NewReader(data[:100])); err == nil {
+		t.Fatal("expected error for a truncated filter")
+	}
+}
+
+// sameFilter is true if f and f2 marshal alike
+func sameFilter(f, f2 *Filter) bool {
+	data, _ := f.MarshalBinary()
+	data2, _ := f2.MarshalBinary()
+	return bytes.Equal(data, data2)
+}
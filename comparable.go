@@ -0,0 +1,64 @@
+//go:build go1.18
+// +build go1.18
+
+package bloomfilter
+
+import (
+	"math"
+	"reflect"
+)
+
+// Comparable keys can be added to and tested against a filter without
+// choosing a hash function, see AddComparable
+type Comparable interface {
+	~string | ~bool |
+		~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// AddComparable adds key to f, hashed with ComparableSum64
+func AddComparable[K Comparable](f *Filter, key K) {
+	f.AddHash(ComparableSum64(f, key))
+}
+
+// ContainsComparable tests if f contains key, hashed with ComparableSum64
+// false: f definitely does not contain key
+// true:  f maybe contains key
+func ContainsComparable[K Comparable](f *Filter, key K) bool {
+	return f.ContainsHash(ComparableSum64(f, key))
+}
+
+// ComparableSum64 is the hash of key in f: the XXH64 of a string, or of the
+// 8 little-endian bytes of a number, seeded by the first key of f. Integers
+// are widened to 64 bits and floats to float64, so that equal integers of
+// different types hash alike, as do equal floats.
+//
+// It is not based on hash/maphash, whose seeds cannot be restored by another
+// process, and whose hashes may change between Go releases: since the seed
+// is serialized along with the keys of f, and compatible filters share it,
+// a filter read back in another process answers for the same keys.
+func ComparableSum64[K Comparable](f *Filter, key K) uint64 {
+	seed := f.keys[0]
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.String:
+		return xxh64String(seed, v.String())
+	case reflect.Bool:
+		if v.Bool() {
+			return xxh64Uint64(seed, 1)
+		}
+		return xxh64Uint64(seed, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return xxh64Uint64(seed, uint64(v.Int()))
+	case reflect.Float32, reflect.Float64:
+		x := v.Float()
+		if x == 0 {
+			x = 0 // -0 == 0
+		}
+		return xxh64Uint64(seed, math.Float64bits(x))
+	default:
+		return xxh64Uint64(seed, v.Uint())
+	}
+}
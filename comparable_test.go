@@ -0,0 +1,58 @@
+//go:build go1.18
+// +build go1.18
+
+package bloomfilter
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+type color string
+
+func TestComparable(t *testing.T) {
+	f, _ := New(10000, 5)
+	for i := 0; i < 100; i++ {
+		AddComparable(f, i)
+		AddComparable(f, color(strings.Repeat("x", i)))
+	}
+	for i := 0; i < 100; i++ {
+		if !ContainsComparable(f, i) || !ContainsComparable(f, uint8(i)) ||
+			!ContainsComparable(f, strings.Repeat("x", i)) {
+			t.Fatalf("%d missing", i)
+		}
+	}
+	AddComparable(f, float32(0.5))
+	if !ContainsComparable(f, 0.5) {
+		t.Fatal("0.5 missing")
+	}
+	if ContainsComparable(f, "y") || ContainsComparable(f, -1) {
+		t.Fatal("unexpected keys")
+	}
+	if ComparableSum64(f, 0.0) != ComparableSum64(f, math.Copysign(0, -1)) {
+		t.Fatal("-0 and 0 hash differently")
+	}
+
+	// seeded by the keys, so compatible filters agree and others do not
+	f2, _ := f.NewCompatible()
+	f3, _ := New(10000, 5)
+	if ComparableSum64(f2, "a") != ComparableSum64(f, "a") ||
+		ComparableSum64(f3, "a") == ComparableSum64(f, "a") {
+		t.Fatal("hashes are not seeded by the keys")
+	}
+}
+
+func TestComparableHash(t *testing.T) {
+	f, _ := New(1000, 3)
+	h := ComparableHash(f)
+	_, _ = h.Write([]byte("hel"))
+	_, _ = h.Write([]byte("lo"))
+	if h.Sum64() != ComparableSum64(f, "hello") {
+		t.Fatal("hash of the bytes differs from the hash of the string")
+	}
+	h.Reset()
+	if h.Sum64() != ComparableSum64(f, "") {
+		t.Fatal("hash not reset")
+	}
+}
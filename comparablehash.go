@@ -0,0 +1,97 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// ComparableHash of f hashes the bytes written to it as ComparableSum64
+// hashes a string of them, for APIs taking a hash.Hash64, such as Builder.
+// Unlike ComparableSum64, it does not need Go 1.18.
+func ComparableHash(f *Filter) hash.Hash64 {
+	return &comparableHash{seed: f.keys[0]}
+}
+
+// comparableHash buffers the bytes written, to hash them at once
+type comparableHash struct {
+	seed uint64
+	buf  []byte
+}
+
+func (h *comparableHash) Write(p []byte) (int, error) {
+	h.buf = append(h.buf, p...)
+	return len(p), nil
+}
+
+func (h *comparableHash) Sum64() uint64 {
+	return xxh64String(h.seed, string(h.buf))
+}
+
+func (h *comparableHash) Sum(b []byte) []byte {
+	var sum [Uint64Bytes]byte
+	binary.BigEndian.PutUint64(sum[:], h.Sum64())
+	return append(b, sum[:]...)
+}
+
+func (h *comparableHash) Reset()         { h.buf = h.buf[:0] }
+func (h *comparableHash) Size() int      { return Uint64Bytes }
+func (h *comparableHash) BlockSize() int { return 32 }
+
+// xxh64Uint64 is the XXH64 of the 8 little-endian bytes of x
+func xxh64Uint64(seed, x uint64) uint64 {
+	h := seed + xxhPrime5 + Uint64Bytes
+	h ^= xxhRound(0, x)
+	h = bits.RotateLeft64(h, 27)*xxhPrime1 + xxhPrime4
+	return xxhAvalanche(h)
+}
+
+// xxh64String is the XXH64 of s
+func xxh64String(seed uint64, s string) uint64 {
+	var h uint64
+	n := uint64(len(s))
+	if len(s) >= 32 {
+		p1 := xxhPrime1 // wrapping around, unlike constants
+		v := [4]uint64{seed + p1 + xxhPrime2, seed + xxhPrime2, seed, seed - p1}
+		for ; len(s) >= 32; s = s[32:] {
+			for i := range v {
+				v[i] = xxhRound(v[i], le64(s[8*i:]))
+			}
+		}
+		h = bits.RotateLeft64(v[0], 1) + bits.RotateLeft64(v[1], 7) +
+			bits.RotateLeft64(v[2], 12) + bits.RotateLeft64(v[3], 18)
+		for _, x := range v {
+			h = xxhMerge(h, x)
+		}
+	} else {
+		h = seed + xxhPrime5
+	}
+	h += n
+	for ; len(s) >= 8; s = s[8:] {
+		h ^= xxhRound(0, le64(s))
+		h = bits.RotateLeft64(h, 27)*xxhPrime1 + xxhPrime4
+	}
+	if len(s) >= 4 {
+		h ^= uint64(le32(s)) * xxhPrime1
+		h = bits.RotateLeft64(h, 23)*xxhPrime2 + xxhPrime3
+		s = s[4:]
+	}
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i]) * xxhPrime5
+		h = bits.RotateLeft64(h, 11) * xxhPrime1
+	}
+	return xxhAvalanche(h)
+}
+
+func le64(s string) uint64 {
+	_ = s[7]
+	return uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 |
+		uint64(s[3])<<24 | uint64(s[4])<<32 | uint64(s[5])<<40 |
+		uint64(s[6])<<48 | uint64(s[7])<<56
+}
+
+func le32(s string) uint32 {
+	_ = s[3]
+	return uint32(s[0]) | uint32(s[1])<<8 | uint32(s[2])<<16 |
+		uint32(s[3])<<24
+}
@@ -0,0 +1,38 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestXXH64String(t *testing.T) {
+	for s, sum := range map[string]uint64{
+		"":    0xef46db3751d8e999,
+		"a":   0xd24ec4f1a98c6e5b,
+		"abc": 0x44bc2cf5ad770999,
+	} {
+		if got := xxh64String(0, s); got != sum {
+			t.Errorf("XXH64 of %q is %#x, not %#x", s, got, sum)
+		}
+	}
+
+	// the same as the XXH64 of words, in all stripe positions
+	var b strings.Builder
+	var words []uint64
+	for i := uint64(0); i < 11; i++ {
+		var h xxh64
+		h.write(words)
+		if got := xxh64String(0, b.String()); got != h.sum() {
+			t.Fatalf("XXH64 of %d words is %#x, not %#x", i, got, h.sum())
+		}
+		word := i * 0x9e3779b97f4a7c15
+		var buf [Uint64Bytes]byte
+		binary.LittleEndian.PutUint64(buf[:], word)
+		b.Write(buf[:])
+		words = append(words, word)
+		if got := xxh64Uint64(42, word); got != xxh64String(42, string(buf[:])) {
+			t.Fatalf("XXH64 of %#x is %#x", word, got)
+		}
+	}
+}
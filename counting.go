@@ -0,0 +1,332 @@
+package bloomfilter
+
+import (
+	"sync/atomic"
+)
+
+// CountingFilter is a counting Bloom filter (Fan et al., "Summary Cache"):
+// a counter in place of every bit, incremented by AddHash and decremented
+// by RemoveHash, so that elements can be removed as well as added.
+//
+// It is safe for concurrent use without locking: counters are updated
+// atomically, so that dozens of goroutines can add and remove at once. A
+// counter saturates at its maximum rather than wrap around, and is never
+// decremented nor halved after, since its count is lost: an element is
+// then never entirely removed, but no other element is removed along with
+// it.
+type CountingFilter struct {
+	counters []uint64 // 64/width counters per word
+	keys     []uint64
+	m        uint64
+	width    uint64 // bits per counter
+	max      uint64 // the count at which counters saturate
+	halve    uint64 // the mask of a word shifted right to halve its counters
+	n        uint64 // accessed atomically
+	// counters which saturated, accessed atomically
+	saturated uint64
+	// removals refused by RemoveHash, accessed atomically
+	underflows uint64
+
+	// OnUnderflow, if not nil, is called with the hash of every element
+	// RemoveHash refuses to remove, from the removing goroutine. It must be
+	// set before the filter is shared. While it is nil, builds with -tags
+	// bloomfilterdebug panic on underflows instead.
+	OnUnderflow func(hash uint64)
+}
+
+// NewCountingFilter of m 32-bit counters, with k random keys
+func NewCountingFilter(m, k uint64) (*CountingFilter, error) {
+	return newCountingFilter(m, k, 32)
+}
+
+// NewPackedCountingFilter of m 4-bit counters, two per byte, with k random
+// keys: the classic design, 8 times smaller than NewCountingFilter. With
+// the optimal k, the probability that any counter would exceed 15 is below
+// 1.37*10^-15*m (Fan et al.), as long as elements are added once each, so
+// that it suits workloads which add and remove distinct elements rather
+// than count repeated ones.
+func NewPackedCountingFilter(m, k uint64) (*CountingFilter, error) {
+	return newCountingFilter(m, k, counterBits)
+}
+
+func newCountingFilter(m, k, width uint64) (*CountingFilter, error) {
+	if m < MMin {
+		return nil, errM()
+	}
+	if k < KMin {
+		return nil, errK()
+	}
+	perWord := 64 / width
+	words := m/perWord + (m%perWord+perWord-1)/perWord
+	if err := checkWords(words); err != nil {
+		return nil, err
+	}
+	keys, err := newKeysCopy(newRandKeys(k))
+	if err != nil {
+		return nil, err
+	}
+	c := &CountingFilter{
+		counters: make([]uint64, words),
+		keys:     keys,
+		m:        m,
+		width:    width,
+		max:      1<<width - 1,
+	}
+	for shift := uint64(0); shift < 64; shift += width {
+		c.halve |= c.max >> 1 << shift
+	}
+	return c, nil
+}
+
+// NewOptimalCountingFilter for maxN elements with a false positive
+// probability of p, like NewOptimal
+func NewOptimalCountingFilter(maxN uint64, p float64) (*CountingFilter, error) {
+	m := OptimalM(maxN, p)
+	return NewCountingFilter(m, OptimalK(m, maxN))
+}
+
+// M is the number of counters
+func (c *CountingFilter) M() uint64 {
+	return c.m
+}
+
+// K is the number of keys
+func (c *CountingFilter) K() uint64 {
+	return uint64(len(c.keys))
+}
+
+// N is the number of elements added and not removed
+func (c *CountingFilter) N() uint64 {
+	return atomic.LoadUint64(&c.n)
+}
+
+// Saturated is the number of counters which reached their maximum, and will
+// no longer be decremented, nor halved by HalveAll. Elements counted in them
+// can no longer be removed entirely, so that a filter with many saturated
+// counters yields more false positives after removals, yet never false
+// negatives: a hot element cannot make other elements look removed by
+// overflowing counters.
+func (c *CountingFilter) Saturated() uint64 {
+	return atomic.LoadUint64(&c.saturated)
+}
+
+// Underflows is the number of removals RemoveHash refused, the element
+// having a counter at 0. Each means that the caller removed an element it
+// never added, or removed one more often than it added it. The removal
+// refused leaves the counters unchanged, but others like it whose counters
+// were shared with other elements went through undetected, so that false
+// negatives are then possible.
+func (c *CountingFilter) Underflows() uint64 {
+	return atomic.LoadUint64(&c.underflows)
+}
+
+// index of the counter of the nth key of the (already hashed) element
+func (c *CountingFilter) index(hash uint64, n int) uint64 {
+	return (hash ^ c.keys[n]) % c.m
+}
+
+// AddHash adds the (already hashed) element
+func (c *CountingFilter) AddHash(hash uint64) {
+	for n := range c.keys {
+		c.increment(c.index(hash, n))
+	}
+	atomic.AddUint64(&c.n, 1)
+}
+
+// ContainsHash is false if the (already hashed) element was surely not
+// added or was removed, true if it may have been added
+func (c *CountingFilter) ContainsHash(hash uint64) bool {
+	for n := range c.keys {
+		if c.count(c.index(hash, n)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// CountHash is the number of times the (already hashed) element was added
+// and not removed, the smallest of its counters, so that the filter serves
+// approximate frequency queries as a count-min sketch does.
+//
+// It is never less than the actual count, unless counters saturated, which
+// caps it, or elements not added were removed, see Underflows. It is more
+// if all of its counters are shared with other elements: the counters of m
+// counting N additions in all average k*N/m, so that by the Markov
+// inequality, CountHash exceeds the count by more than e*k*N/m with a
+// probability of about e^-k at most.
+func (c *CountingFilter) CountHash(hash uint64) uint64 {
+	count := c.max
+	for n := range c.keys {
+		if i := c.count(c.index(hash, n)); i < count {
+			count = i
+		}
+	}
+	return count
+}
+
+// RemoveHash removes the (already hashed) element, and is true if it may
+// have been added. Otherwise, one of its counters is 0 and none is changed,
+// and the underflow is reported to OnUnderflow and counted by Underflows.
+func (c *CountingFilter) RemoveHash(hash uint64) bool {
+	if !c.remove(hash) {
+		return false
+	}
+	c.subN(1)
+	return true
+}
+
+// RemoveHashes removes the (already hashed) elements like RemoveHash,
+// updating N once for all of them, and returns the number removed. Every
+// element is checked for underflow on its own, so that one never added is
+// reported to OnUnderflow and left out, while the others are removed.
+func (c *CountingFilter) RemoveHashes(hashes []uint64) int {
+	removed := 0
+	for _, hash := range hashes {
+		if c.remove(hash) {
+			removed++
+		}
+	}
+	c.subN(uint64(removed))
+	return removed
+}
+
+// AddHashes adds the (already hashed) elements like AddHash, updating N
+// once for all of them
+func (c *CountingFilter) AddHashes(hashes []uint64) {
+	for _, hash := range hashes {
+		for n := range c.keys {
+			c.increment(c.index(hash, n))
+		}
+	}
+	atomic.AddUint64(&c.n, uint64(len(hashes)))
+}
+
+// remove is RemoveHash, but for N. The counters are checked before any is
+// decremented, so that an underflow does not make other elements look
+// removed meanwhile, not even briefly.
+func (c *CountingFilter) remove(hash uint64) bool {
+	for n := range c.keys {
+		if c.count(c.index(hash, n)) == 0 {
+			c.underflow(hash)
+			return false
+		}
+	}
+	for n := range c.keys {
+		if !c.decrement(c.index(hash, n)) {
+			// a concurrent removal emptied the counter since: restore the
+			// counters decremented, which the element may share with it
+			for n--; n >= 0; n-- {
+				c.increment(c.index(hash, n))
+			}
+			c.underflow(hash)
+			return false
+		}
+	}
+	return true
+}
+
+// underflow reports the removal of the element of hash, refused
+func (c *CountingFilter) underflow(hash uint64) {
+	if invariants {
+		c.checkUnderflow(hash)
+	}
+	atomic.AddUint64(&c.underflows, 1)
+	if c.OnUnderflow != nil {
+		c.OnUnderflow(hash)
+	}
+}
+
+// subN subtracts removed from N, down to 0
+func (c *CountingFilter) subN(removed uint64) {
+	for {
+		n := atomic.LoadUint64(&c.n)
+		if removed > n {
+			removed = n
+		}
+		if atomic.CompareAndSwapUint64(&c.n, n, n-removed) {
+			return
+		}
+	}
+}
+
+// HalveAll halves every counter, like FrequencySketch.HalveAll, so that
+// counts decay exponentially when it is called periodically, and queries of
+// recent heavy hitters stay meaningful on long streams. Every word of
+// counters is halved atomically, so that concurrent additions are never
+// lost, though they can be halved or not. Elements added once are removed,
+// and N is halved as an estimate. Saturated counters are left saturated,
+// their counts being lost, as they are left by RemoveHash.
+func (c *CountingFilter) HalveAll() {
+	for i := range c.counters {
+		word := &c.counters[i]
+		for {
+			w := atomic.LoadUint64(word)
+			if atomic.CompareAndSwapUint64(word, w, c.halveWord(w)) {
+				break
+			}
+		}
+	}
+	for {
+		n := atomic.LoadUint64(&c.n)
+		if atomic.CompareAndSwapUint64(&c.n, n, n/2) {
+			return
+		}
+	}
+}
+
+// halveWord halves the counters of word w, but for the saturated ones
+func (c *CountingFilter) halveWord(w uint64) uint64 {
+	halved := w >> 1 & c.halve
+	for shift := uint64(0); shift < 64; shift += c.width {
+		if w>>shift&c.max == c.max {
+			halved |= c.max << shift
+		}
+	}
+	return halved
+}
+
+// counter is the word of counter i and its shift within it
+func (c *CountingFilter) counter(i uint64) (word *uint64, shift uint64) {
+	perWord := 64 / c.width
+	return &c.counters[i/perWord], i % perWord * c.width
+}
+
+// count of counter i
+func (c *CountingFilter) count(i uint64) uint64 {
+	word, shift := c.counter(i)
+	return atomic.LoadUint64(word) >> shift & c.max
+}
+
+// increment counter i, unless saturated
+func (c *CountingFilter) increment(i uint64) {
+	word, shift := c.counter(i)
+	for {
+		w := atomic.LoadUint64(word)
+		count := w >> shift & c.max
+		if count == c.max {
+			return
+		}
+		if atomic.CompareAndSwapUint64(word, w, w+1<<shift) {
+			if count+1 == c.max {
+				atomic.AddUint64(&c.saturated, 1)
+			}
+			return
+		}
+	}
+}
+
+// decrement counter i, unless saturated, and be false if it is 0
+func (c *CountingFilter) decrement(i uint64) bool {
+	word, shift := c.counter(i)
+	for {
+		w := atomic.LoadUint64(word)
+		count := w >> shift & c.max
+		if count == 0 {
+			return false
+		}
+		if count == c.max ||
+			atomic.CompareAndSwapUint64(word, w, w-1<<shift) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package bloomfilter
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestCountingFilter(t *testing.T) {
+	c, err := NewOptimalCountingFilter(10000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 10000; i++ {
+		c.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	for i := uint64(0); i < 10000; i++ {
+		if !c.ContainsHash(i * 0x9e3779b97f4a7c15) {
+			t.Fatalf("false negative for %d", i)
+		}
+	}
+	for i := uint64(0); i < 5000; i++ {
+		if !c.RemoveHash(i * 0x9e3779b97f4a7c15) {
+			t.Fatalf("cannot remove %d", i)
+		}
+	}
+	if c.N() != 5000 {
+		t.Fatalf("%d elements", c.N())
+	}
+	for i := uint64(5000); i < 10000; i++ {
+		if !c.ContainsHash(i * 0x9e3779b97f4a7c15) {
+			t.Fatalf("false negative for %d after removals", i)
+		}
+	}
+	removed := 0
+	for i := uint64(0); i < 5000; i++ {
+		if !c.ContainsHash(i * 0x9e3779b97f4a7c15) {
+			removed++
+		}
+	}
+	if removed < 4900 {
+		t.Fatalf("only %d elements of 5000 removed", removed)
+	}
+
+}
+
+func TestCountingFilterUnderflow(t *testing.T) {
+	c, _ := NewCountingFilter(10000, 4)
+	var reported []uint64
+	c.OnUnderflow = func(hash uint64) {
+		reported = append(reported, hash)
+	}
+	c.AddHash(1)
+	c.AddHash(2)
+
+	// nothing is changed by removing an element which was never added
+	if c.RemoveHash(3) {
+		t.Fatal("removed an element which was never added")
+	}
+	if !c.RemoveHash(2) || c.RemoveHash(2) {
+		t.Fatal("removed an element twice")
+	}
+	if c.Underflows() != 2 || len(reported) != 2 ||
+		reported[0] != 3 || reported[1] != 2 {
+		t.Fatalf("%d underflows, reported %v", c.Underflows(), reported)
+	}
+	if !c.ContainsHash(1) || c.ContainsHash(2) || c.N() != 1 {
+		t.Fatal("underflows changed the counters")
+	}
+}
+
+// setCount sets counter i of c to count
+func (c *CountingFilter) setCount(i, count uint64) {
+	word, shift := c.counter(i)
+	*word = *word&^(c.max<<shift) | count<<shift
+}
+
+func TestCountingFilterSaturation(t *testing.T) {
+	for _, width := range []uint64{4, 32} {
+		c, _ := newCountingFilter(1000, 3, width)
+		// fixed keys, so that the counters of 42 are distinct
+		c.keys = []uint64{0x243f6a8885a308d3, 0x13198a2e03707344,
+			0xa4093822299f31d0}
+		for n := range c.keys {
+			c.setCount(c.index(42, n), c.max-1)
+		}
+		c.AddHash(42)
+		c.AddHash(42)
+		if c.Saturated() != uint64(len(c.keys)) {
+			t.Fatalf("%d %d-bit counters saturated", c.Saturated(), width)
+		}
+		for n := range c.keys {
+			if count := c.count(c.index(42, n)); count != c.max {
+				t.Fatalf("%d-bit counter wrapped to %d", width, count)
+			}
+		}
+		// saturated counters are never decremented
+		for i := 0; i < 3; i++ {
+			c.RemoveHash(42)
+		}
+		if !c.ContainsHash(42) {
+			t.Fatalf("saturated %d-bit counters were decremented", width)
+		}
+		// nor do they overflow into their neighbors
+		for i := uint64(0); i < c.m; i++ {
+			if count := c.count(i); count != 0 && count != c.max {
+				t.Fatalf("%d-bit counter %d overflowed to %d", width, i, count)
+			}
+		}
+	}
+}
+
+func TestCountingFilterHotElement(t *testing.T) {
+	c, _ := NewPackedCountingFilter(10000, 5)
+	for i := uint64(0); i < 100; i++ {
+		c.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	// a hot element, added far more often than its counters count
+	for i := 0; i < 1000; i++ {
+		c.AddHash(42)
+	}
+	if c.Saturated() < 5 {
+		t.Fatalf("%d counters saturated", c.Saturated())
+	}
+	for i := 0; i < 1000; i++ {
+		c.RemoveHash(42)
+	}
+	for i := uint64(0); i < 100; i++ {
+		if !c.ContainsHash(i * 0x9e3779b97f4a7c15) {
+			t.Fatalf("false negative for %d", i)
+		}
+	}
+}
+
+func TestPackedCountingFilter(t *testing.T) {
+	c, _ := NewPackedCountingFilter(10000, 7)
+	c32, _ := NewCountingFilter(10000, 7)
+	if len(c.counters)*8 != 5000 || len(c32.counters)*8 != 40000 {
+		t.Fatalf("%d and %d words", len(c.counters), len(c32.counters))
+	}
+	for i := uint64(0); i < 1000; i++ {
+		c.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	for i := uint64(0); i < 1000; i += 2 {
+		c.RemoveHash(i * 0x9e3779b97f4a7c15)
+	}
+	for i := uint64(1); i < 1000; i += 2 {
+		if !c.ContainsHash(i * 0x9e3779b97f4a7c15) {
+			t.Fatalf("false negative for %d", i)
+		}
+	}
+}
+
+func TestCountingFilterConcurrent(t *testing.T) {
+	c, _ := NewCountingFilter(1<<16, 4)
+	var wg sync.WaitGroup
+	for g := uint64(0); g < 32; g++ {
+		wg.Add(1)
+		go func(g uint64) {
+			defer wg.Done()
+			for i := uint64(0); i < 2000; i++ {
+				hash := (g<<32 | i) * 0x9e3779b97f4a7c15
+				c.AddHash(hash)
+				if !c.ContainsHash(hash) {
+					t.Errorf("false negative for %d", hash)
+				}
+				if i%2 == 0 && !c.RemoveHash(hash) {
+					t.Errorf("cannot remove %d", hash)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if c.N() != 32*1000 {
+		t.Fatalf("%d elements", c.N())
+	}
+	var sum uint64
+	for i := uint64(0); i < c.m; i++ {
+		sum += c.count(i)
+	}
+	if sum != 32*1000*4 {
+		t.Fatalf("counters sum to %d", sum)
+	}
+}
+
+func TestCountingFilterHalveAll(t *testing.T) {
+	for _, width := range []uint64{4, 32} {
+		c, _ := newCountingFilter(1000, 3, width)
+		for i := uint64(0); i < c.m; i++ {
+			c.setCount(i, i%16)
+		}
+		c.n = 1001
+		c.HalveAll()
+		for i := uint64(0); i < c.m; i++ {
+			expected := i % 16 / 2
+			if i%16 == c.max {
+				expected = c.max
+			}
+			if count := c.count(i); count != expected {
+				t.Fatalf("%d-bit counter %d halved from %d to %d",
+					width, i, i%16, count)
+			}
+		}
+		if c.N() != 500 {
+			t.Fatalf("%d elements", c.N())
+		}
+	}
+
+	// saturated counters stay so, and are counted once
+	c, _ := NewCountingFilter(1000, 3)
+	c.setCount(0, c.max-1)
+	c.increment(0)
+	c.HalveAll()
+	c.increment(0)
+	if c.count(0) != c.max || c.Saturated() != 1 {
+		t.Fatalf("saturated counter halved to %d", c.count(0))
+	}
+}
+
+func TestCountingFilterCountHash(t *testing.T) {
+	c, _ := NewCountingFilter(1<<16, 4)
+	// element i added i%10 times
+	var total uint64
+	for i := uint64(0); i < 5000; i++ {
+		for j := uint64(0); j < i%10; j++ {
+			c.AddHash(i * 0x9e3779b97f4a7c15)
+			total++
+		}
+	}
+	bound := uint64(math.Ceil(math.E * 4 * float64(total) / float64(c.M())))
+	over := 0
+	for i := uint64(0); i < 5000; i++ {
+		count := c.CountHash(i * 0x9e3779b97f4a7c15)
+		if count < i%10 {
+			t.Fatalf("element %d added %d times, counted %d", i, i%10, count)
+		}
+		if count > i%10+bound {
+			over++
+		}
+	}
+	// at most e^-4 of 5000 elements, about 92, with room for chance
+	if over > 2*92 {
+		t.Fatalf("%d counts beyond the bound of %d", over, bound)
+	}
+
+	// element 7, added 7 times
+	hash := uint64(7)
+	hash *= 0x9e3779b97f4a7c15
+	c.RemoveHash(hash)
+	if count := c.CountHash(hash); count < 6 {
+		t.Fatalf("counted %d after a removal", count)
+	}
+}
+
+func TestCountingFilterBatch(t *testing.T) {
+	c, _ := NewPackedCountingFilter(1<<16, 4)
+	// fixed keys, so that the element never added is not a false positive
+	c.keys = []uint64{0x243f6a8885a308d3, 0x13198a2e03707344,
+		0xa4093822299f31d0, 0x082efa98ec4e6c89}
+	var underflows []uint64
+	c.OnUnderflow = func(hash uint64) {
+		underflows = append(underflows, hash)
+	}
+	hashes := make([]uint64, 5000)
+	for i := range hashes {
+		hashes[i] = uint64(i) * 0x9e3779b97f4a7c15
+	}
+	c.AddHashes(hashes)
+	if c.N() != 5000 {
+		t.Fatalf("%d elements", c.N())
+	}
+
+	// an element never added among the aged-out ones
+	expired := append([]uint64{1}, hashes[:1000]...)
+	if removed := c.RemoveHashes(expired); removed != 1000 {
+		t.Fatalf("removed %d elements", removed)
+	}
+	if c.N() != 4000 || len(underflows) != 1 || underflows[0] != 1 {
+		t.Fatalf("%d elements, underflows %v", c.N(), underflows)
+	}
+	for _, hash := range hashes[1000:] {
+		if !c.ContainsHash(hash) {
+			t.Fatalf("false negative for %d", hash)
+		}
+	}
+	if removed := c.RemoveHashes(hashes[1000:]); removed != 4000 || c.N() != 0 {
+		t.Fatalf("removed %d elements, %d left", removed, c.N())
+	}
+}
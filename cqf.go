@@ -0,0 +1,597 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"math/bits"
+	"sync"
+)
+
+// metadata bits of the slots of a CountingQuotientFilter
+const (
+	// the quotient of the slot has a run
+	cqfOccupied uint64 = 1 << iota
+	// the slot continues the run of the slot before it
+	cqfContinuation
+	// the slot is not at the canonical slot of its quotient
+	cqfShifted
+	// the slot holds a digit of the count of the remainder before it
+	cqfCounter
+
+	cqfMetaBits = 4
+	cqfMeta     = 1<<cqfMetaBits - 1
+)
+
+// CountingQuotientFilter is a quotient filter (Bender et al., "Don't Thrash:
+// How to Cache Your Hash on Flash") counting its elements like the counting
+// quotient filter of Pandey et al.: it supports adding, removing and
+// counting elements, as well as merging and serialization.
+//
+// The top q bits of a hash are its quotient, which selects one of 2^q
+// slots, and the next r bits its remainder, which is stored in that slot or
+// shifted to the next free ones, along with 4 bits of metadata. The false
+// positive probability is about the load factor divided by 2^r.
+//
+// Every distinct element takes one slot, and elements counted more than
+// once take one more slot per r bits of their count, so that it stays
+// compact at load factors above 90%, unlike a counting Bloom filter, whose
+// counters are all as wide as the highest count requires.
+type CountingQuotientFilter struct {
+	lock  sync.RWMutex
+	slots []uint64 // packed slots of 4 metadata bits and r remainder bits
+	q, r  uint64
+	size  uint64 // 2^q slots
+	used  uint64 // slots holding a remainder or a digit
+	n     uint64 // sum of the counts of the elements
+}
+
+// NewCountingQuotientFilter of 2^q slots with remainders of r bits
+func NewCountingQuotientFilter(q, r uint64) (*CountingQuotientFilter, error) {
+	c := &CountingQuotientFilter{q: q, r: r, size: 1 << q}
+	slots, err := c.newSlots()
+	if err != nil {
+		return nil, err
+	}
+	c.slots = slots
+	return c, nil
+}
+
+// newSlots allocates the slots for q and r
+func (c *CountingQuotientFilter) newSlots() ([]uint64, error) {
+	if c.q < 1 || c.q > 48 || c.r < 1 || c.r > 60 || c.q+c.r > 64 {
+		return nil, errQuotientFilterBits(c.q, c.r)
+	}
+	words, err := wordsOf(c.size * c.width())
+	if err != nil {
+		return nil, err
+	}
+	return newAlignedWords(words), nil
+}
+
+// width of a slot, in bits
+func (c *CountingQuotientFilter) width() uint64 {
+	return c.r + cqfMetaBits
+}
+
+// Size is the number of slots
+func (c *CountingQuotientFilter) Size() uint64 {
+	return c.size
+}
+
+// N is the number of elements added and not removed, counting repeated
+// elements as many times as they were added
+func (c *CountingQuotientFilter) N() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.n
+}
+
+// LoadFactor is the fraction of slots used
+func (c *CountingQuotientFilter) LoadFactor() float64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return float64(c.used) / float64(c.size)
+}
+
+// AddHash adds an already hashed element once
+func (c *CountingQuotientFilter) AddHash(hash uint64) error {
+	return c.AddHashCount(hash, 1)
+}
+
+// AddHashCount adds an already hashed element count times. It fails,
+// leaving c unchanged, if there are not enough free slots.
+func (c *CountingQuotientFilter) AddHashCount(hash, count uint64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	fq, fr := c.split(hash)
+	return c.add(fq, fr, count)
+}
+
+// CountHash is the number of times the already hashed element was added
+// and not removed, or more if it collides with other elements
+func (c *CountingQuotientFilter) CountHash(hash uint64) uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	fq, fr := c.split(hash)
+	if _, _, count, found := c.find(fq, fr); found {
+		return count
+	}
+	return 0
+}
+
+// ContainsHash tests if the already hashed element (maybe) was added
+func (c *CountingQuotientFilter) ContainsHash(hash uint64) bool {
+	return c.CountHash(hash) != 0
+}
+
+// RemoveHash removes the already hashed element once, returning whether it
+// was contained. Removing an element which was never added may remove
+// another one, which collides with it.
+func (c *CountingQuotientFilter) RemoveHash(hash uint64) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	fq, fr := c.split(hash)
+	pos, end, count, found := c.find(fq, fr)
+	if !found {
+		return false
+	}
+	c.n--
+	if count > 1 {
+		c.setCount(fq, pos, end, count, count-1)
+		return true
+	}
+
+	s := c.runStart(fq)
+	more := c.get(c.next(pos))&cqfContinuation != 0
+	prevQ := fq
+	switch {
+	case pos == s && !more:
+		// the run is gone
+		c.set(fq, c.get(fq)&^cqfOccupied)
+	case pos == s:
+		// the next remainder starts the run
+		c.set(c.next(pos), c.get(c.next(pos))&^cqfContinuation)
+		prevQ = c.prev(fq)
+	}
+	c.removeSlot(pos, prevQ)
+	return true
+}
+
+// Merge adds the elements of c2, which must have the same q and r, to c.
+// It fails if c runs out of slots, leaving c with part of the elements of
+// c2 added.
+func (c *CountingQuotientFilter) Merge(c2 *CountingQuotientFilter) (err error) {
+	if c == c2 {
+		c2, err = c.copy()
+		if err != nil {
+			return err
+		}
+	}
+	if c.q != c2.q || c.r != c2.r {
+		return errIncompatibleBloomFilters()
+	}
+	c2.lock.RLock()
+	defer c2.lock.RUnlock()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c2.each(func(fq, fr, count uint64) bool {
+		err = c.add(fq, fr, count)
+		return err == nil
+	})
+	return err
+}
+
+// copy c
+func (c *CountingQuotientFilter) copy() (*CountingQuotientFilter, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	out := &CountingQuotientFilter{q: c.q, r: c.r, size: c.size, used: c.used, n: c.n}
+	slots, err := out.newSlots()
+	if err != nil {
+		return nil, err
+	}
+	copy(slots, c.slots)
+	out.slots = slots
+	return out, nil
+}
+
+// HalveAll halves the count of every element, rounding down, so that a
+// long-running frequency tracker forgets old weight. Elements counted once
+// are removed.
+func (c *CountingQuotientFilter) HalveAll() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.rebuild(func(count uint64) uint64 {
+		return count / 2
+	})
+}
+
+// Vacuum clamps the count of every element to at most max, freeing the
+// slots of the digits of higher counts. A max of 0 removes every element.
+func (c *CountingQuotientFilter) Vacuum(max uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.rebuild(func(count uint64) uint64 {
+		if count > max {
+			return max
+		}
+		return count
+	})
+}
+
+// rebuild c with the counts of its elements changed by fn, c must be locked
+func (c *CountingQuotientFilter) rebuild(fn func(count uint64) uint64) {
+	type entry struct{ fq, fr, count uint64 }
+	var entries []entry
+	c.each(func(fq, fr, count uint64) bool {
+		if count = fn(count); count > 0 {
+			entries = append(entries, entry{fq, fr, count})
+		}
+		return true
+	})
+	for i := range c.slots {
+		c.slots[i] = 0
+	}
+	c.used, c.n = 0, 0
+	for _, e := range entries {
+		// the counts only shrink, so that the entries fit
+		_ = c.add(e.fq, e.fr, e.count)
+	}
+}
+
+// MarshalBinary converts c into []bytes, in the same layout as a Filter,
+// with q and r as the keys, the sum of the counts as n and the packed slots
+// as the bits
+func (c *CountingQuotientFilter) MarshalBinary() (data []byte, err error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	buf, _, err := marshalWords([]uint64{c.q, c.r}, 0, c.n,
+		c.size*c.width(), c.slots)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary converts []bytes written by MarshalBinary into c, which
+// is left unchanged if an error is returned
+func (c *CountingQuotientFilter) UnmarshalBinary(data []byte) (err error) {
+	buf := bytes.NewBuffer(data)
+	k, flags, n, m, err := unmarshalBinaryHeader(buf)
+	if err != nil {
+		return err
+	}
+	if flags != 0 {
+		return errFlags(flags)
+	}
+	if k != 2 {
+		return errSize()
+	}
+	words := (m + 63) / 64
+	err = checkBinarySize(k, words, uint64(len(data)))
+	if err != nil {
+		return err
+	}
+	params, err := unmarshalBinaryKeys(buf, k)
+	if err != nil {
+		return err
+	}
+	c2 := &CountingQuotientFilter{q: params[0], r: params[1], n: n}
+	if c2.q < 1 || c2.q > 48 {
+		return errQuotientFilterBits(c2.q, c2.r)
+	}
+	c2.size = 1 << c2.q
+	if m != c2.size*c2.width() {
+		return errSize()
+	}
+	c2.slots, err = c2.newSlots()
+	if err != nil {
+		return err
+	}
+	err = readWords(buf, c2.slots)
+	if err != nil {
+		return err
+	}
+	err = checkBinaryHash(buf, data)
+	if err != nil {
+		return err
+	}
+	err = c2.check()
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.slots, c.q, c.r, c.size, c.used, c.n =
+		c2.slots, c2.q, c2.r, c2.size, c2.used, c2.n
+	return nil
+}
+
+// check that the slots are consistent, so that walking them terminates,
+// and sets used
+func (c *CountingQuotientFilter) check() error {
+	unshifted := false
+	for i := uint64(0); i < c.size; i++ {
+		meta := c.get(i) & cqfMeta
+		prevEmpty := c.empty(c.prev(i))
+		if meta&cqfContinuation != 0 && (meta&cqfShifted == 0 || prevEmpty) ||
+			meta&cqfCounter != 0 && meta&cqfContinuation == 0 ||
+			meta&cqfShifted != 0 && prevEmpty {
+			return errQuotientFilterCorrupt()
+		}
+		if meta&cqfShifted == 0 {
+			unshifted = true
+		}
+		if !c.empty(i) {
+			c.used++
+		}
+	}
+	if !unshifted {
+		return errQuotientFilterCorrupt()
+	}
+
+	var slots, n uint64
+	overflow := false
+	c.each(func(fq, fr, count uint64) bool {
+		if count == 0 || n+count < n {
+			overflow = true
+			return false
+		}
+		slots += 1 + c.digits(count-1)
+		n += count
+		return true
+	})
+	if overflow || slots != c.used || n != c.n {
+		return errQuotientFilterCorrupt()
+	}
+	return nil
+}
+
+// split hash into its quotient and remainder
+func (c *CountingQuotientFilter) split(hash uint64) (fq, fr uint64) {
+	return hash >> (64 - c.q), hash >> (64 - c.q - c.r) & (1<<c.r - 1)
+}
+
+// get slot i, metadata and remainder
+func (c *CountingQuotientFilter) get(i uint64) uint64 {
+	w := c.width()
+	bit := i * w
+	word, off := bit/64, bit%64
+	v := c.slots[word] >> off
+	if off+w > 64 {
+		v |= c.slots[word+1] << (64 - off)
+	}
+	return v & (1<<w - 1)
+}
+
+// set slot i to v
+func (c *CountingQuotientFilter) set(i, v uint64) {
+	w := c.width()
+	bit := i * w
+	word, off := bit/64, bit%64
+	mask := uint64(1)<<w - 1
+	c.slots[word] = c.slots[word]&^(mask<<off) | v<<off
+	if off+w > 64 {
+		c.slots[word+1] = c.slots[word+1]&^(mask>>(64-off)) | v>>(64-off)
+	}
+}
+
+func (c *CountingQuotientFilter) empty(i uint64) bool {
+	return c.get(i)&(cqfOccupied|cqfContinuation|cqfShifted) == 0
+}
+
+func (c *CountingQuotientFilter) next(i uint64) uint64 {
+	return (i + 1) & (c.size - 1)
+}
+
+func (c *CountingQuotientFilter) prev(i uint64) uint64 {
+	return (i - 1) & (c.size - 1)
+}
+
+// nextOccupied is the first quotient after q with a run
+func (c *CountingQuotientFilter) nextOccupied(q uint64) uint64 {
+	for q = c.next(q); c.get(q)&cqfOccupied == 0; q = c.next(q) {
+	}
+	return q
+}
+
+// runStart is the slot where the run of quotient fq starts, or would start
+func (c *CountingQuotientFilter) runStart(fq uint64) uint64 {
+	b := fq
+	for c.get(b)&cqfShifted != 0 {
+		b = c.prev(b)
+	}
+	// b starts a cluster, walk its runs up to the run of fq
+	s := b
+	for b != fq {
+		for s = c.next(s); c.get(s)&cqfContinuation != 0; s = c.next(s) {
+		}
+		for b = c.next(b); c.get(b)&cqfOccupied == 0; b = c.next(b) {
+		}
+	}
+	return s
+}
+
+// entry at pos, returning its last slot and its count
+func (c *CountingQuotientFilter) entry(pos uint64) (end, count uint64) {
+	end = pos
+	var digits, shift uint64
+	for c.get(c.next(end))&cqfCounter != 0 {
+		end = c.next(end)
+		if shift < 64 {
+			digits |= c.get(end) >> cqfMetaBits << shift
+		}
+		shift += c.r
+	}
+	return end, digits + 1
+}
+
+// find the entry of remainder fr in the run of quotient fq
+func (c *CountingQuotientFilter) find(fq, fr uint64) (
+	pos, end, count uint64, found bool,
+) {
+	if c.get(fq)&cqfOccupied == 0 {
+		return 0, 0, 0, false
+	}
+	for pos = c.runStart(fq); ; pos = c.next(end) {
+		end, count = c.entry(pos)
+		rem := c.get(pos) >> cqfMetaBits
+		if rem == fr {
+			return pos, end, count, true
+		}
+		if rem > fr || c.get(c.next(end))&cqfContinuation == 0 {
+			return 0, 0, 0, false
+		}
+	}
+}
+
+// each calls fn with every entry, in the order of the slots, until fn
+// returns false
+func (c *CountingQuotientFilter) each(fn func(fq, fr, count uint64) bool) {
+	for fq := uint64(0); fq < c.size; fq++ {
+		if c.get(fq)&cqfOccupied == 0 {
+			continue
+		}
+		for pos := c.runStart(fq); ; {
+			end, count := c.entry(pos)
+			if !fn(fq, c.get(pos)>>cqfMetaBits, count) {
+				return
+			}
+			pos = c.next(end)
+			if c.get(pos)&cqfContinuation == 0 {
+				break
+			}
+		}
+	}
+}
+
+// digits of the count of an entry counted count+1 times
+func (c *CountingQuotientFilter) digits(count uint64) uint64 {
+	return (uint64(bits.Len64(count)) + c.r - 1) / c.r
+}
+
+// add the entry fq, fr count times, c must be locked
+func (c *CountingQuotientFilter) add(fq, fr, count uint64) error {
+	if count == 0 {
+		return nil
+	}
+	if c.n+count < c.n {
+		return errQuotientFilterCount()
+	}
+	pos, end, old, found := c.find(fq, fr)
+	if found {
+		if old+count < old {
+			return errQuotientFilterCount()
+		}
+		if c.size-c.used < c.digits(old+count-1)-c.digits(old-1) {
+			return errQuotientFilterFull()
+		}
+		c.setCount(fq, pos, end, old, old+count)
+		c.n += count
+		return nil
+	}
+	if c.size-c.used < 1+c.digits(count-1) {
+		return errQuotientFilterFull()
+	}
+
+	meta := fr << cqfMetaBits
+	switch {
+	case c.empty(fq):
+		pos = fq
+		c.set(fq, meta|cqfOccupied)
+		c.used++
+	case c.get(fq)&cqfOccupied == 0:
+		// a new run
+		c.set(fq, c.get(fq)|cqfOccupied)
+		pos = c.runStart(fq)
+		if pos != fq {
+			meta |= cqfShifted
+		}
+		c.insertSlot(pos, meta)
+	default:
+		// keep the remainders of the run sorted
+		s := c.runStart(fq)
+		for pos = s; ; pos = c.next(end) {
+			end, _ = c.entry(pos)
+			if c.get(pos)>>cqfMetaBits > fr {
+				break
+			}
+			if c.get(c.next(end))&cqfContinuation == 0 {
+				pos = c.next(end)
+				break
+			}
+		}
+		if pos == s {
+			if pos != fq {
+				meta |= cqfShifted
+			}
+			c.insertSlot(pos, meta)
+			next := c.next(pos)
+			c.set(next, c.get(next)|cqfContinuation)
+		} else {
+			c.insertSlot(pos, meta|cqfContinuation|cqfShifted)
+		}
+	}
+	c.setCount(fq, pos, pos, 1, count)
+	c.n += count
+	return nil
+}
+
+// setCount of the entry from pos to end, of quotient fq, from old to count
+func (c *CountingQuotientFilter) setCount(fq, pos, end, old, count uint64) {
+	have, want := c.digits(old-1), c.digits(count-1)
+	for ; have < want; have++ {
+		end = c.next(end)
+		c.insertSlot(end, cqfContinuation|cqfShifted|cqfCounter)
+	}
+	for ; have > want; have-- {
+		c.removeSlot(end, fq)
+		end = c.prev(end)
+	}
+	digits := count - 1
+	for i := c.next(pos); want > 0; i, want = c.next(i), want-1 {
+		c.set(i, c.get(i)&cqfMeta|digits&(1<<c.r-1)<<cqfMetaBits)
+		digits >>= c.r
+	}
+}
+
+// insertSlot v at pos, shifting the slots from pos to the next empty one.
+// The occupied bits stay in place, since they belong to the quotients.
+func (c *CountingQuotientFilter) insertSlot(pos, v uint64) {
+	for i := pos; ; i = c.next(i) {
+		old := c.get(i)
+		c.set(i, v&^cqfOccupied|old&cqfOccupied)
+		if old&(cqfOccupied|cqfContinuation|cqfShifted) == 0 {
+			break
+		}
+		v = old | cqfShifted
+	}
+	c.used++
+}
+
+// removeSlot at pos, shifting the rest of its cluster back. prevQ is the
+// quotient of the last run starting at or before pos which remains, so that
+// the quotients of the runs shifted back can be told.
+func (c *CountingQuotientFilter) removeSlot(pos, prevQ uint64) {
+	i := pos
+	for {
+		j := c.next(i)
+		v := c.get(j)
+		if v&(cqfContinuation|cqfShifted) == 0 {
+			// empty, or a run at its canonical slot
+			c.set(i, c.get(i)&cqfOccupied)
+			break
+		}
+		meta := v&(cqfContinuation|cqfCounter) | cqfShifted
+		if v&cqfContinuation == 0 {
+			prevQ = c.nextOccupied(prevQ)
+			if i == prevQ {
+				meta &^= cqfShifted
+			}
+		}
+		c.set(i, v&^cqfMeta|meta|c.get(i)&cqfOccupied)
+		i = j
+	}
+	c.used--
+}
@@ -0,0 +1,177 @@
+package bloomfilter
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestCountingQuotientFilter checks random operations on small filters,
+// where clusters wrap around, against exact counts of the fingerprints
+func TestCountingQuotientFilter(t *testing.T) {
+	for _, qr := range [][2]uint64{{6, 2}, {6, 5}, {8, 13}, {4, 60}} {
+		q, r := qr[0], qr[1]
+		c, err := NewCountingQuotientFilter(q, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rng := rand.New(rand.NewSource(int64(q*64 + r)))
+		counts := make(map[uint64]uint64)
+		fingerprint := func(hash uint64) uint64 { return hash >> (64 - q - r) }
+		var hashes []uint64
+		var n uint64
+		for op := 0; op < 20000; op++ {
+			switch x := rng.Intn(10); {
+			case x < 5 || len(hashes) == 0:
+				hash := rng.Uint64()
+				count := uint64(1)
+				if x == 0 {
+					count = uint64(rng.Intn(100)) + 1
+				}
+				if err := c.AddHashCount(hash, count); err != nil {
+					if c.LoadFactor() < 0.8 {
+						t.Fatalf("q=%d r=%d: %v at load factor %g",
+							q, r, err, c.LoadFactor())
+					}
+					continue
+				}
+				hashes = append(hashes, hash)
+				counts[fingerprint(hash)] += count
+				n += count
+			case x < 8:
+				// re-add a known element
+				hash := hashes[rng.Intn(len(hashes))]
+				if err := c.AddHash(hash); err == nil {
+					counts[fingerprint(hash)]++
+					n++
+				}
+			default:
+				i := rng.Intn(len(hashes))
+				hash := hashes[i]
+				if counts[fingerprint(hash)] == 0 {
+					if c.RemoveHash(hash) {
+						t.Fatalf("q=%d r=%d: removed missing %#x", q, r, hash)
+					}
+					continue
+				}
+				if !c.RemoveHash(hash) {
+					t.Fatalf("q=%d r=%d: cannot remove %#x", q, r, hash)
+				}
+				counts[fingerprint(hash)]--
+				n--
+			}
+
+			if op%97 == 0 {
+				for _, hash := range hashes {
+					if got, want := c.CountHash(hash), counts[fingerprint(hash)]; got != want {
+						t.Fatalf("q=%d r=%d op %d: count of %#x is %d, expected %d",
+							q, r, op, hash, got, want)
+					}
+				}
+				if c.N() != n {
+					t.Fatalf("q=%d r=%d: N is %d, expected %d", q, r, c.N(), n)
+				}
+				check := &CountingQuotientFilter{
+					slots: c.slots, q: q, r: r, size: c.size, n: c.n,
+				}
+				if err := check.check(); err != nil || check.used != c.used {
+					t.Fatalf("q=%d r=%d op %d: %v, %d slots used, expected %d",
+						q, r, op, err, check.used, c.used)
+				}
+			}
+		}
+	}
+}
+
+func TestCountingQuotientFilterMerge(t *testing.T) {
+	a, _ := NewCountingQuotientFilter(10, 8)
+	b, _ := NewCountingQuotientFilter(10, 8)
+	for i := uint64(0); i < 300; i++ {
+		_ = a.AddHash(i * 0x9e3779b97f4a7c15)
+		_ = b.AddHashCount(i*0x9e3779b97f4a7c15, 2)
+	}
+	_ = b.AddHash(^uint64(0))
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Merge(a); err != nil {
+		t.Fatal(err)
+	}
+	if a.N() != 2*(3*300+1) {
+		t.Errorf("N is %d, expected %d", a.N(), 2*(3*300+1))
+	}
+	seven := uint64(7)
+	if got := a.CountHash(seven * 0x9e3779b97f4a7c15); got < 6 {
+		t.Errorf("count %d, expected 6", got)
+	}
+
+	c, _ := NewCountingQuotientFilter(10, 9)
+	if err := a.Merge(c); err == nil {
+		t.Error("merged filters with different remainders")
+	}
+	full, _ := NewCountingQuotientFilter(4, 8)
+	if err := full.Merge(a); err == nil {
+		t.Error("merged more elements than slots")
+	}
+}
+
+func TestCountingQuotientFilterBinary(t *testing.T) {
+	c, _ := NewCountingQuotientFilter(10, 7)
+	for i := uint64(0); i < 500; i++ {
+		_ = c.AddHashCount(i*0x9e3779b97f4a7c15, i%5+1)
+	}
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c2 CountingQuotientFilter
+	if err = c2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if c2.N() != c.N() || c2.LoadFactor() != c.LoadFactor() {
+		t.Errorf("N %d and load %g, expected %d and %g",
+			c2.N(), c2.LoadFactor(), c.N(), c.LoadFactor())
+	}
+	for i := uint64(0); i < 500; i++ {
+		if got := c2.CountHash(i * 0x9e3779b97f4a7c15); got < i%5+1 {
+			t.Fatalf("count %d, expected %d", got, i%5+1)
+		}
+	}
+
+	data[len(data)-49] ^= 1
+	if err = c2.UnmarshalBinary(data); err == nil {
+		t.Error("corrupt filter unmarshaled")
+	}
+	if _, err = NewCountingQuotientFilter(40, 30); err == nil {
+		t.Error("created a filter of 70 bits of fingerprint")
+	}
+}
+
+func TestCountingQuotientFilterDecay(t *testing.T) {
+	c, _ := NewCountingQuotientFilter(9, 4)
+	for i := uint64(0); i < 100; i++ {
+		_ = c.AddHashCount(i*0x9e3779b97f4a7c15, i+1)
+	}
+	load := c.LoadFactor()
+	c.HalveAll()
+	for i := uint64(0); i < 100; i++ {
+		if got := c.CountHash(i * 0x9e3779b97f4a7c15); got != (i+1)/2 {
+			t.Fatalf("count %d after halving, expected %d", got, (i+1)/2)
+		}
+	}
+	c.Vacuum(10)
+	var n uint64
+	for i := uint64(0); i < 100; i++ {
+		want := (i + 1) / 2
+		if want > 10 {
+			want = 10
+		}
+		n += want
+		if got := c.CountHash(i * 0x9e3779b97f4a7c15); got != want {
+			t.Fatalf("count %d after vacuum, expected %d", got, want)
+		}
+	}
+	if c.N() != n || c.LoadFactor() >= load {
+		t.Errorf("N %d, expected %d, load factor %g, from %g",
+			c.N(), n, c.LoadFactor(), load)
+	}
+}
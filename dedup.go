@@ -0,0 +1,22 @@
+//go:build go1.18
+// +build go1.18
+
+package bloomfilter
+
+// Dedup passes through the items received from in which f does not contain
+// yet, adding them to f, until in is closed. hasher hashes an item.
+//
+// Items are dropped if f already contains them or if they collide with
+// items added before, at f's false positive rate.
+func Dedup[T any](f *Filter, in <-chan T, hasher func(T) uint64) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for item := range in {
+			if !f.TestAndAddHash(hasher(item)) {
+				out <- item
+			}
+		}
+	}()
+	return out
+}
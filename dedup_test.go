@@ -0,0 +1,30 @@
+//go:build go1.18
+// +build go1.18
+
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	bf, _ := New(10000, 5)
+	in := make(chan uint64)
+	go func() {
+		defer close(in)
+		for i := uint64(0); i < 100; i++ {
+			in <- i % 10
+		}
+	}()
+
+	var seen []uint64
+	for x := range Dedup(bf, in, func(x uint64) uint64 { return x * 0x9e3779b97f4a7c15 }) {
+		seen = append(seen, x)
+	}
+	if len(seen) != 10 {
+		t.Fatalf("expected 10 distinct items, got %v", seen)
+	}
+	if bf.N() != 10 {
+		t.Fatalf("expected n=10, got %d", bf.N())
+	}
+}
@@ -0,0 +1,75 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// DensityProfile splits the bits of f into buckets regions of equal size
+// and returns the fill ratio of each, which should be about the same for
+// all of them: a region much fuller or emptier than the others points at a
+// poorly distributed hash, or at corruption. buckets is at most m.
+func (f *Filter) DensityProfile(buckets int) []float64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if buckets < 1 {
+		return nil
+	}
+	if uint64(buckets) > f.m {
+		buckets = int(f.m)
+	}
+	profile := make([]float64, buckets)
+	lo := uint64(0)
+	for b := range profile {
+		// (b+1)*m/buckets, without overflowing
+		h, l := bits.Mul64(uint64(b+1), f.m)
+		hi, _ := bits.Div64(h, l, uint64(buckets))
+		profile[b] = float64(countBitsRange(f.bits, lo, hi)) / float64(hi-lo)
+		lo = hi
+	}
+	return profile
+}
+
+// countBitsRange is the number of 1's among bits lo to hi-1 of words
+func countBitsRange(words []uint64, lo, hi uint64) (n uint64) {
+	for i := lo >> 6; i <= (hi-1)>>6; i++ {
+		word := words[i]
+		if i == lo>>6 {
+			word &= ^uint64(0) << (lo & 0x3f)
+		}
+		if i == (hi-1)>>6 && hi&0x3f != 0 {
+			word &= ^uint64(0) >> (64 - hi&0x3f)
+		}
+		n += uint64(bits.OnesCount64(word))
+	}
+	return n
+}
+
+// WriteDensitySVG renders a DensityProfile as an SVG strip of one cell per
+// region, from white for empty regions to black for full ones
+func WriteDensitySVG(w io.Writer, profile []float64) error {
+	const cellWidth, height = 4, 40
+	width := cellWidth * len(profile)
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg"`+
+		` width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		width, height, width, height)
+	if err != nil {
+		return err
+	}
+	for i, density := range profile {
+		shade := int(255 * (1 - density))
+		if shade < 0 {
+			shade = 0
+		}
+		_, err = fmt.Fprintf(w, `<rect x="%d" y="0" width="%d" height="%d"`+
+			` fill="rgb(%d,%d,%d)"><title>%d: %.4f</title></rect>`+"\n",
+			i*cellWidth, cellWidth, height, shade, shade, shade, i, density)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(w, "</svg>")
+	return err
+}
@@ -0,0 +1,44 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDensityProfile(t *testing.T) {
+	f, _ := NewWithKeys(1000, []uint64{0})
+	// fill the second quarter, bits 250 to 499
+	for i := uint64(250); i < 500; i++ {
+		f.AddHash(i)
+	}
+	profile := f.DensityProfile(4)
+	want := []float64{0, 1, 0, 0}
+	for b := range want {
+		if profile[b] != want[b] {
+			t.Fatalf("expected %v, got %v", want, profile)
+		}
+	}
+	if len(f.DensityProfile(5000)) != 1000 || f.DensityProfile(0) != nil {
+		t.Fatal("unexpected number of buckets")
+	}
+
+	f, _ = New(100000, 5)
+	for i := uint64(0); i < 10000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	for b, density := range f.DensityProfile(10) {
+		if density < 0.35 || density > 0.45 {
+			t.Fatalf("region %d has a density of %f", b, density)
+		}
+	}
+
+	var svg bytes.Buffer
+	if err := WriteDensitySVG(&svg, profile); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(svg.String(), "<rect") != 4 ||
+		!strings.Contains(svg.String(), `fill="rgb(0,0,0)"`) {
+		t.Fatalf("unexpected SVG %s", svg.String())
+	}
+}
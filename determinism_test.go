@@ -0,0 +1,163 @@
+//go:build go1.18
+// +build go1.18
+
+package bloomfilter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+var determinismOptions = [][]Option{nil, {WithBlocked()},
+	{WithRegisterBlocked()}, {WithIndexScheme(DoubleHashing)},
+	{WithIndexScheme(EnhancedDoubleHashing)}, {WithFastRange()},
+	{WithPowerOfTwo()}}
+
+// crossProcessDir, if set, makes TestCrossProcess query the filters saved in
+// it by the parent test process
+const crossProcessDir = "BLOOMFILTER_CROSS_PROCESS_DIR"
+
+// answers of f for keys 0 to 2000, of which 0 to 1000 were added
+func answers(f *Filter) []byte {
+	a := make([]byte, 2000)
+	for i := range a {
+		if ContainsComparable(f, fmt.Sprint("key", i)) {
+			a[i] |= 1
+		}
+		if ContainsComparable(f, i) {
+			a[i] |= 2
+		}
+		if f.ContainsHash(uint64(i) * 0x9e3779b97f4a7c15) {
+			a[i] |= 4
+		}
+	}
+	return a
+}
+
+func TestCrossProcess(t *testing.T) {
+	if dir := os.Getenv(crossProcessDir); dir != "" {
+		queryCrossProcess(t, dir)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "bloomfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	want := make([][]byte, len(determinismOptions))
+	for i, opts := range determinismOptions {
+		f, _ := NewOptimal(1000, 0.01, opts...)
+		for j := 0; j < 1000; j++ {
+			AddComparable(f, fmt.Sprint("key", j))
+			AddComparable(f, j)
+			f.AddHash(uint64(j) * 0x9e3779b97f4a7c15)
+		}
+		want[i] = answers(f)
+		binary, _ := f.MarshalBinary()
+		text, _ := f.MarshalText()
+		for ext, data := range map[string][]byte{"bin": binary, "txt": text} {
+			name := filepath.Join(dir, fmt.Sprintf("%d.%s", i, ext))
+			if err = ioutil.WriteFile(name, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrossProcess$")
+	cmd.Env = append(os.Environ(), crossProcessDir+"="+dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	for i := range determinismOptions {
+		for _, ext := range []string{"bin", "txt"} {
+			got, err := ioutil.ReadFile(
+				filepath.Join(dir, fmt.Sprintf("%d.%s.answers", i, ext)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want[i]) {
+				t.Errorf("filter %d read from %s answers differently in "+
+					"another process", i, ext)
+			}
+		}
+	}
+}
+
+// queryCrossProcess saves the answers of the filters saved in dir
+func queryCrossProcess(t *testing.T, dir string) {
+	for i := range determinismOptions {
+		name := filepath.Join(dir, fmt.Sprint(i))
+		binary, err := ioutil.ReadFile(name + ".bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f Filter
+		if err = f.UnmarshalBinary(binary); err != nil {
+			t.Fatal(err)
+		}
+		text, err := ioutil.ReadFile(name + ".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f2, err := UnmarshalText(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ext, g := range map[string]*Filter{"bin": &f, "txt": f2} {
+			err = ioutil.WriteFile(name+"."+ext+".answers", answers(g), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// TestDeterministicHashes checks that the bits set for given keys do not
+// change, so that filters saved by earlier releases keep their answers
+func TestDeterministicHashes(t *testing.T) {
+	fingerprints := []uint64{0xe30dfae7c8d3b9f3, 0x9ccceaad929826e1,
+		0x803b1729e8c2a55d, 0x6be61c5c78f3df7a, 0x5dc5e28d927965d0,
+		0x9f3e7ee04ae06de9, 0x768cc4645bc2c6fa}
+	for i, opts := range determinismOptions {
+		f, _ := NewWithKeys(10000, []uint64{1, 2, 3, 4}, opts...)
+		for j := 0; j < 100; j++ {
+			AddComparable(f, fmt.Sprint("key", j))
+			AddComparable(f, j)
+			f.AddHash(uint64(j) * 0x9e3779b97f4a7c15)
+		}
+		if fp := f.Fingerprint(); fp != fingerprints[i] {
+			t.Errorf("filter %d has fingerprint %#x, not %#x", i, fp,
+				fingerprints[i])
+		}
+	}
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	for _, opts := range determinismOptions {
+		f, _ := New(1000, 3, opts...)
+		for i := uint64(0); i < 100; i++ {
+			f.AddHash(i)
+		}
+		text, err := f.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f2 Filter
+		if err = f2.UnmarshalText(text); err != nil {
+			t.Fatal(err)
+		}
+		if f2.Fingerprint() != f.Fingerprint() {
+			t.Fatal("text round trip changed the filter")
+		}
+		text[len(text)-2] ^= 1
+		if _, err = UnmarshalText(text); err == nil {
+			t.Fatal("corrupt text was unmarshaled")
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package bloomfilter
+
+// Doorkeeper is the admission filter in front of a TinyLFU cache policy: it
+// only admits keys seen at least twice since it was last reset, so that
+// one-hit wonders never reach the frequency sketch or the cache. It resets
+// itself after a sample of resetAfter distinct keys, so that it only reflects
+// recent history.
+type Doorkeeper struct {
+	f          *Filter
+	resetAfter uint64
+}
+
+// NewDoorkeeper which resets after resetAfter distinct keys, with a false
+// positive probability of at most p until then
+func NewDoorkeeper(resetAfter uint64, p float64) (*Doorkeeper, error) {
+	f, err := NewOptimal(resetAfter, p)
+	if err != nil {
+		return nil, err
+	}
+	return &Doorkeeper{
+		f:          f,
+		resetAfter: resetAfter,
+	}, nil
+}
+
+// Allow records the key and reports whether it was already seen since the
+// last reset, i.e. whether it should be admitted
+func (d *Doorkeeper) Allow(keyHash uint64) bool {
+	d.f.lock.Lock()
+	d.f.gen++
+
+	if d.f.n >= d.resetAfter {
+		d.f.reset()
+	}
+	seen, saturated := d.f.testAndAddHash(keyHash)
+	d.f.lock.Unlock()
+	d.f.logSaturation(saturated)
+	return seen
+}
+
+// Contains reports whether the key was seen since the last reset, without
+// recording it
+func (d *Doorkeeper) Contains(keyHash uint64) bool {
+	return d.f.ContainsHash(keyHash)
+}
+
+// Reset forgets all keys, as TinyLFU does when it ages its frequency sketch
+func (d *Doorkeeper) Reset() {
+	d.f.Reset()
+}
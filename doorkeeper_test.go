@@ -0,0 +1,27 @@
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func TestDoorkeeper(t *testing.T) {
+	d, err := NewDoorkeeper(100, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Allow(42) {
+		t.Fatal("admitted a key seen once")
+	}
+	if !d.Allow(42) {
+		t.Fatal("did not admit a key seen twice")
+	}
+
+	for i := uint64(1000); i < 1100; i++ {
+		d.Allow(i * 0x9e3779b97f4a7c15)
+	}
+	// the sample is full: the next key resets the doorkeeper
+	d.Allow(7)
+	if d.Contains(42) {
+		t.Fatal("doorkeeper was not reset")
+	}
+}
@@ -0,0 +1,117 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+	"text/tabwriter"
+)
+
+// GoString describes the header of f, for %#v
+func (f *Filter) GoString() string {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return fmt.Sprintf("&bloomfilter.Filter{m:%d, k:%d, n:%d, flags:%#x}",
+		f.m, len(f.keys), f.n, f.flags)
+}
+
+// flagNames of the flags of a filter, for DebugDump
+func flagNames(flags uint32) string {
+	var names []string
+	if flags&flagBlocked != 0 {
+		names = append(names, "blocked")
+	}
+	if flags&flagRegisterBlocked != 0 {
+		names = append(names, "register-blocked")
+	}
+	if flags&flagDoubleHashing != 0 {
+		names = append(names, "double hashing")
+	}
+	if flags&flagEnhancedDoubleHashing != 0 {
+		names = append(names, "enhanced double hashing")
+	}
+	if flags&flagFastRange != 0 {
+		names = append(names, "fast range")
+	}
+	if flags&flagPowerOfTwo != 0 {
+		names = append(names, "power of 2")
+	}
+	if flags&^knownFlags != 0 {
+		names = append(names, "unknown")
+	}
+	if len(names) == 0 {
+		return "classic"
+	}
+	return strings.Join(names, ", ")
+}
+
+// DebugDump writes what it takes to investigate a suspicious filter without
+// a hex editor: its header, keys, the first and last words with any bit
+// set, and a histogram of the number of bits set per word, which should
+// look binomial for a healthy filter.
+func (f *Filter) DebugDump(w io.Writer) error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "m\t%d\n", f.m)
+	fmt.Fprintf(tw, "k\t%d\n", len(f.keys))
+	fmt.Fprintf(tw, "n\t%d\n", f.n)
+	fmt.Fprintf(tw, "flags\t%#x (%s)\n", f.flags, flagNames(f.flags))
+	for i, key := range f.keys {
+		fmt.Fprintf(tw, "key %d\t%#016x\n", i, key)
+	}
+	fmt.Fprintf(tw, "words\t%d\n", len(f.bits))
+	memory := "Go heap"
+	if f.mem != nil {
+		memory = "mapped"
+	}
+	if f.allocated {
+		memory = "allocator"
+	}
+	fmt.Fprintf(tw, "memory\t%s\n", memory)
+
+	first, last := -1, -1
+	var histogram [65]uint64
+	var set uint64
+	for i, word := range f.bits {
+		count := bits.OnesCount64(word)
+		histogram[count]++
+		set += uint64(count)
+		if count != 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		fmt.Fprintf(tw, "non-zero words\tnone\n")
+	} else {
+		fmt.Fprintf(tw, "first non-zero word\t%d: %#016x\n", first, f.bits[first])
+		fmt.Fprintf(tw, "last non-zero word\t%d: %#016x\n", last, f.bits[last])
+	}
+	fmt.Fprintf(tw, "bits set\t%d (fill %.4f)\n", set, float64(set)/float64(f.m))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintln(w, "bits set per word:")
+	if err != nil {
+		return err
+	}
+	words := float64(len(f.bits))
+	for count, n := range histogram {
+		if n == 0 {
+			continue
+		}
+		share := float64(n) / words
+		_, err = fmt.Fprintf(w, "%4d %12d %6.2f%% %s\n", count, n, 100*share,
+			strings.Repeat("#", int(share*50+0.5)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
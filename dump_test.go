@@ -0,0 +1,36 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDebugDump(t *testing.T) {
+	f, _ := NewWithKeys(1024, []uint64{0, 1}, WithBlocked())
+	if s := fmt.Sprintf("%#v", f); s != "&bloomfilter.Filter{m:1024, k:2, n:0, flags:0x1}" {
+		t.Fatalf("unexpected GoString %s", s)
+	}
+
+	var out bytes.Buffer
+	if err := f.DebugDump(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"(blocked)", "non-zero words  none", "0           16 100.00%"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("dump does not contain %q:\n%s", want, out.String())
+		}
+	}
+
+	f.AddHash(42)
+	out.Reset()
+	if err := f.DebugDump(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"key 1", "first non-zero word", "bits set"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("dump does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
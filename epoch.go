@@ -0,0 +1,200 @@
+package bloomfilter
+
+import (
+	"hash"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// EpochFilter is a Bloom filter whose readers never take a lock, for
+// filters queried by many goroutines while others keep adding to them.
+//
+// Writers are serialized by a mutex and set bits with atomic stores, which
+// readers load atomically. Adding only sets bits, so a query racing with
+// Adds reports what the filter held either before or after each of them.
+// Operations which clear bits, Reset and Load, are bracketed by an epoch
+// counter, odd while they run (a seqlock): a query which saw the epoch
+// change retries, rather than report an element from the bits of both the
+// old and the new contents which is in neither.
+type EpochFilter struct {
+	epoch uint64 // first for 64-bit alignment on 32-bit platforms
+	n     uint64
+	lock  sync.Mutex // serializes writers
+	f     *Filter    // holds the bits and options, never locked
+}
+
+// NewEpoch creates an EpochFilter of m bits and k keys, see New
+func NewEpoch(m, k uint64, opts ...Option) (*EpochFilter, error) {
+	f, err := New(m, k, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &EpochFilter{f: f}, nil
+}
+
+// M is the size of the filter, in bits
+func (e *EpochFilter) M() uint64 {
+	return e.f.m
+}
+
+// K is the count of keys
+func (e *EpochFilter) K() uint64 {
+	return uint64(len(e.f.keys))
+}
+
+// N is how many elements have been inserted
+func (e *EpochFilter) N() uint64 {
+	return atomic.LoadUint64(&e.n)
+}
+
+// Add a hashable item, v, to the filter
+func (e *EpochFilter) Add(v hash.Hash64) {
+	e.AddHash(v.Sum64())
+}
+
+// AddHash adds an already hashed item to the filter
+func (e *EpochFilter) AddHash(hash uint64) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.f.atomicAdd(hash)
+	atomic.AddUint64(&e.n, 1)
+}
+
+// Contains tests if the filter contains v, without taking any lock
+func (e *EpochFilter) Contains(v hash.Hash64) bool {
+	return e.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if the filter contains the already hashed item,
+// without taking any lock
+func (e *EpochFilter) ContainsHash(hash uint64) bool {
+	for {
+		epoch := atomic.LoadUint64(&e.epoch)
+		if epoch&1 != 0 {
+			// bits are being cleared
+			runtime.Gosched()
+			continue
+		}
+		contained := e.f.atomicContains(hash)
+		if atomic.LoadUint64(&e.epoch) == epoch {
+			return contained
+		}
+	}
+}
+
+// Reset the filter to an empty one, keeping its keys
+func (e *EpochFilter) Reset() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	atomic.AddUint64(&e.epoch, 1)
+	for i := range e.f.bits {
+		atomic.StoreUint64(&e.f.bits[i], 0)
+	}
+	atomic.StoreUint64(&e.n, 0)
+	atomic.AddUint64(&e.epoch, 1)
+}
+
+// Load replaces the contents of the filter with those of f2, which must be
+// compatible with it, such as a filter rebuilt in the background
+func (e *EpochFilter) Load(f2 *Filter) error {
+	if err := e.f.IsCompatible(f2); err != nil {
+		return err
+	}
+	if invariants {
+		checkCompatible(e.f, f2)
+	}
+	f2.lock.RLock()
+	defer f2.lock.RUnlock()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	atomic.AddUint64(&e.epoch, 1)
+	for i, word := range f2.bits {
+		atomic.StoreUint64(&e.f.bits[i], word)
+	}
+	atomic.StoreUint64(&e.n, f2.n)
+	atomic.AddUint64(&e.epoch, 1)
+	return nil
+}
+
+// Snapshot copies the filter to a Filter, consistent with the writes which
+// completed before it
+func (e *EpochFilter) Snapshot() (*Filter, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	out, err := e.f.NewCompatible()
+	if err != nil {
+		return nil, err
+	}
+	copy(out.bits, e.f.bits)
+	out.n = e.n
+	return out, nil
+}
+
+// Close releases the memory of a filter created with WithOffHeap,
+// WithHugePages or WithAllocator, see Filter.Close
+func (e *EpochFilter) Close() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.f.Close()
+}
+
+// atomicAdd is add, storing every word atomically. Writers must be
+// serialized.
+func (c *core) atomicAdd(hash uint64) {
+	if invariants {
+		c.checkProbe(hash)
+	}
+	if c.flags&flagRegisterBlocked != 0 {
+		w, mask := c.wordIndexAndMask(hash)
+		atomicOr(&c.bits[w], mask)
+		return
+	}
+	if c.flags&flagBlocked != 0 {
+		block := c.block(hash)
+		for _, key := range c.keys {
+			i := mix64(hash^key) >> blockShift
+			atomicOr(&block[i>>6], 1<<uint(i&0x3f))
+		}
+		return
+	}
+	step := c.step(hash)
+	for n := range c.keys {
+		i := c.index(hash, step, n)
+		atomicOr(&c.bits[i>>6], 1<<uint(i&0x3f))
+	}
+}
+
+// atomicOr sets the bits of mask in *word. Writers must be serialized.
+func atomicOr(word *uint64, mask uint64) {
+	atomic.StoreUint64(word, atomic.LoadUint64(word)|mask)
+}
+
+// atomicContains is contains, loading every word atomically
+func (c *core) atomicContains(hash uint64) bool {
+	if invariants {
+		c.checkProbe(hash)
+	}
+	if c.flags&flagRegisterBlocked != 0 {
+		w, mask := c.wordIndexAndMask(hash)
+		return atomic.LoadUint64(&c.bits[w])&mask == mask
+	}
+	if c.flags&flagBlocked != 0 {
+		block := c.block(hash)
+		for _, key := range c.keys {
+			i := mix64(hash^key) >> blockShift
+			if atomic.LoadUint64(&block[i>>6])&(1<<uint(i&0x3f)) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	step := c.step(hash)
+	for n := range c.keys {
+		i := c.index(hash, step, n)
+		if atomic.LoadUint64(&c.bits[i>>6])&(1<<uint(i&0x3f)) == 0 {
+			return false
+		}
+	}
+	return true
+}
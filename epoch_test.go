@@ -0,0 +1,104 @@
+package bloomfilter
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestEpochFilter(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"plain":            nil,
+		"blocked":          {WithBlocked()},
+		"register-blocked": {WithRegisterBlocked()},
+	} {
+		e, err := NewEpoch(1<<16, 5, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, _ := e.f.NewCompatible()
+		for i := uint64(0); i < 1000; i++ {
+			e.AddHash(i * 0x9e3779b97f4a7c15)
+			f.AddHash(i * 0x9e3779b97f4a7c15)
+		}
+		for i := uint64(0); i < 2000; i++ {
+			hash := i * 0x9e3779b97f4a7c15
+			if e.ContainsHash(hash) != f.ContainsHash(hash) {
+				t.Fatalf("%s: %#x: EpochFilter and Filter disagree", name, hash)
+			}
+		}
+		if e.N() != 1000 {
+			t.Errorf("%s: N is %d, expected 1000", name, e.N())
+		}
+
+		snapshot, err := e.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if noBranchCompareUint64s(snapshot.bits, f.bits) != 0 ||
+			snapshot.N() != f.N() {
+			t.Errorf("%s: snapshot differs from the filter", name)
+		}
+
+		e.Reset()
+		if e.N() != 0 || e.ContainsHash(0) {
+			t.Errorf("%s: not empty after Reset", name)
+		}
+		if err = e.Load(f); err != nil {
+			t.Fatal(err)
+		}
+		if e.N() != 1000 || !e.ContainsHash(0) {
+			t.Errorf("%s: Load lost the contents of the filter", name)
+		}
+	}
+}
+
+// TestEpochFilterLoad checks that queries racing with Load never see a mix
+// of two filters, run with -race
+func TestEpochFilterLoad(t *testing.T) {
+	e, err := NewEpoch(1<<12, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a and b each hold one half of the locations of x, so that only a mix
+	// of both contains it
+	a, _ := e.f.NewCompatible()
+	b, _ := e.f.NewCompatible()
+	const x = 0x123456789
+	for j, i := range e.f.Locations(x) {
+		half := a
+		if j%2 != 0 {
+			half = b
+		}
+		half.bits[i>>6] |= 1 << (i & 0x3f)
+	}
+	if a.ContainsHash(x) || b.ContainsHash(x) {
+		t.Skip("locations of x collide")
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if i%2 == 0 {
+				_ = e.Load(a)
+			} else {
+				_ = e.Load(b)
+			}
+		}
+	}()
+	for i := 0; i < 20000; i++ {
+		if e.ContainsHash(x) {
+			t.Error("query saw a mix of two filters")
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -10,7 +10,15 @@
 //
 package bloomfilter
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMutated is returned by a WordsIterator when its filter was modified
+// since the iteration started
+var ErrMutated = errors.New("Bloom filter was modified during iteration")
 
 func errHash() error {
 	return fmt.Errorf(
@@ -32,3 +40,149 @@ func errIncompatibleBloomFilters() error {
 	return fmt.Errorf(
 		"Cannot perform union on two incompatible Bloom filters")
 }
+func errAlignment() error {
+	return fmt.Errorf(
+		"Bloom filter bits must be %d-byte aligned and little-endian to be used without copying",
+		Uint64Bytes)
+}
+func errSize() error {
+	return fmt.Errorf(
+		"Bloom filter data has the wrong size for its header")
+}
+func errHugePageSize(size HugePageSize) error {
+	return fmt.Errorf(
+		"Unsupported huge page size 2^%d bytes", uint(size))
+}
+func errTooLarge(size uint64) error {
+	return fmt.Errorf(
+		"Bloom filter of %d bytes cannot be addressed on this platform", size)
+}
+func errWordRange(off uint64, n int) error {
+	return fmt.Errorf(
+		"Words %d to %d are out of the Bloom filter's range", off, off+uint64(n))
+}
+func errFoldFactor(m uint64, factor uint) error {
+	return fmt.Errorf(
+		"Cannot fold a Bloom filter of %d bits by a factor of %d", m, factor)
+}
+func errFlags(flags uint32) error {
+	return fmt.Errorf(
+		"Unsupported Bloom filter flags %#x", flags)
+}
+func errMaskK() error {
+	return fmt.Errorf(
+		"Register-blocked Bloom filters must have at most %d keys", maskMaxK)
+}
+func errIndexFilters() error {
+	return fmt.Errorf(
+		"A bit-sliced index needs at least one filter, one id per filter and compatible filters")
+}
+func errTrailingBits() error {
+	return fmt.Errorf(
+		"Bloom filter data has bits set beyond m")
+}
+func errSegmentSize(size uint64) error {
+	return fmt.Errorf(
+		"Segments of %d bytes are not a power of 2 of at least %d bytes",
+		size, cacheLineSize)
+}
+func errMaxMemory(size, max uint64) error {
+	return fmt.Errorf(
+		"Bloom filter needs %d bytes (%.1f MiB), more than the maximum of %d bytes",
+		size, float64(size)/(1<<20), max)
+}
+func errTargetFP(maxN uint64, maxFP float64) error {
+	return fmt.Errorf(
+		"Cannot create a Bloom filter of %d elements with a false positive probability of %g",
+		maxN, maxFP)
+}
+func errMemoryBudget(maxBytes, maxN uint64) error {
+	return fmt.Errorf(
+		"Cannot fit a Bloom filter of %d elements in %d bytes", maxN, maxBytes)
+}
+func errAllocator(words uint64, got int) error {
+	return fmt.Errorf(
+		"Allocator returned %d words rather than %d", got, words)
+}
+func errFilterExists(name string) error {
+	return fmt.Errorf(
+		"Bloom filter %q already exists", name)
+}
+func errNoFilter(name string) error {
+	return fmt.Errorf(
+		"No Bloom filter named %q", name)
+}
+func errNoNegatives() error {
+	return fmt.Errorf(
+		"Learned Bloom filter needs a sample of negatives to measure its model")
+}
+func errQuotientFilterBits(q, r uint64) error {
+	return fmt.Errorf(
+		"Quotient filter needs 1 to 48 quotient bits and 1 to 60 remainder bits, at most 64 in all, not %d and %d",
+		q, r)
+}
+func errQuotientFilterFull() error {
+	return fmt.Errorf(
+		"Quotient filter is full")
+}
+func errQuotientFilterCorrupt() error {
+	return fmt.Errorf(
+		"Quotient filter slots are inconsistent, the filter is probably corrupt")
+}
+func errQuotientFilterCount() error {
+	return fmt.Errorf(
+		"Quotient filter count overflows")
+}
+func errGolombSetBits(n uint64, fpBits uint) error {
+	return fmt.Errorf(
+		"Cannot code %d values with a false positive probability of 2^-%d",
+		n, fpBits)
+}
+func errGolombSetCorrupt() error {
+	return fmt.Errorf(
+		"Golomb-coded set is corrupt")
+}
+func errMerkleTrees() error {
+	return fmt.Errorf(
+		"Merkle trees of different shapes cannot be compared")
+}
+func errTTLSlice(slice, maxTTL time.Duration) error {
+	return fmt.Errorf(
+		"Time slices of %v cannot cover a maximum TTL of %v in %d slices",
+		slice, maxTTL, maxExpiringSlices)
+}
+func errMergeUnsupported(s, s2 Set) error {
+	return fmt.Errorf(
+		"Cannot merge a %T into a %T", s2, s)
+}
+func errCompactVersion(version, size uint16) error {
+	return fmt.Errorf(
+		"Unsupported compact layout version %d with a %d byte header",
+		version, size)
+}
+func errFromBitsKeys() error {
+	return fmt.Errorf(
+		"NewFromBits needs the keys the bits were computed with, see WithKeys")
+}
+func errKeysLen(k uint64, keys int) error {
+	return fmt.Errorf(
+		"A filter of %d keys was given %d keys", k, keys)
+}
+func errFromBitsWords(m uint64, words int) error {
+	return fmt.Errorf(
+		"A filter of %d bits takes %d words, not %d", m, (m+63)/64, words)
+}
+func errStorageLen(m, words uint64) error {
+	return fmt.Errorf(
+		"A filter of %d bits takes %d words of storage, not %d",
+		m, (m+63)/64, words)
+}
+func errKeyFilter(keyM, m uint64) error {
+	return fmt.Errorf(
+		"A Key made by another filter (of %d bits) for one of %d bits",
+		keyM, m)
+}
+func errInterval(interval time.Duration) error {
+	return fmt.Errorf(
+		"An interval of %v is not positive", interval)
+}
@@ -0,0 +1,119 @@
+// Package exactset is an exact set of hashes, implementing the interfaces of
+// the filters of package bloomfilter with a map, to serve as the oracle of
+// property tests: whatever the usage pattern, a filter must contain every
+// element the exact set contains, and a test can assert so by adding the
+// same elements to both.
+package exactset
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash"
+	"sort"
+	"sync"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+// Set of already hashed elements. It is safe for concurrent use.
+type Set struct {
+	lock   sync.RWMutex
+	hashes map[uint64]struct{}
+}
+
+// New empty Set
+func New() *Set {
+	return &Set{hashes: make(map[uint64]struct{})}
+}
+
+// Add a hashable item, v, to s
+func (s *Set) Add(v hash.Hash64) {
+	s.AddHash(v.Sum64())
+}
+
+// AddHash adds an already hashed item to s
+func (s *Set) AddHash(hash uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.hashes[hash] = struct{}{}
+}
+
+// Contains tests if v was added to s
+func (s *Set) Contains(v hash.Hash64) bool {
+	return s.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if the already hashed item was added to s
+func (s *Set) ContainsHash(hash uint64) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	_, ok := s.hashes[hash]
+	return ok
+}
+
+// RemoveHash removes an already hashed item from s, returning whether it
+// was contained, for oracles of filters supporting removals
+func (s *Set) RemoveHash(hash uint64) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.hashes[hash]
+	delete(s.hashes, hash)
+	return ok
+}
+
+// Len is the number of elements of s
+func (s *Set) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.hashes)
+}
+
+// Hashes of the elements of s, in increasing order
+func (s *Set) Hashes() []uint64 {
+	s.lock.RLock()
+	hashes := make([]uint64, 0, len(s.hashes))
+	for hash := range s.hashes {
+		hashes = append(hashes, hash)
+	}
+	s.lock.RUnlock()
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	return hashes
+}
+
+// FalseNegatives are the elements of s which f does not contain, in
+// increasing order, which must be none for f to be correct
+func (s *Set) FalseNegatives(f bloomfilter.Set) []uint64 {
+	var missing []uint64
+	for _, hash := range s.Hashes() {
+		if !f.ContainsHash(hash) {
+			missing = append(missing, hash)
+		}
+	}
+	return missing
+}
+
+// MarshalBinary converts s into []bytes, the little-endian hashes of its
+// elements in increasing order
+func (s *Set) MarshalBinary() ([]byte, error) {
+	hashes := s.Hashes()
+	data := make([]byte, 8*len(hashes))
+	for i, hash := range hashes {
+		binary.LittleEndian.PutUint64(data[8*i:], hash)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary converts []bytes written by MarshalBinary into s
+func (s *Set) UnmarshalBinary(data []byte) error {
+	if len(data)%8 != 0 {
+		return errors.New("exact set data is not a whole number of hashes")
+	}
+	hashes := make(map[uint64]struct{}, len(data)/8)
+	for i := 0; i < len(data); i += 8 {
+		hashes[binary.LittleEndian.Uint64(data[i:])] = struct{}{}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.hashes = hashes
+	return nil
+}
@@ -0,0 +1,65 @@
+package exactset
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/shenwei356/bloomfilter"
+)
+
+var (
+	_ bloomfilter.Set        = (*Set)(nil)
+	_ bloomfilter.HashFilter = (*Set)(nil)
+)
+
+// TestOracle is the property test of the package doc: filters never miss
+// an element of the exact set, whatever the mix of operations
+func TestOracle(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	f, _ := bloomfilter.NewOptimal(10000, 0.01)
+	m, _ := bloomfilter.NewMortonFilter(20000)
+	oracle, morton := New(), New()
+	for i := 0; i < 20000; i++ {
+		hash := rng.Uint64() % 50000
+		switch rng.Intn(4) {
+		case 0:
+			f.AddHash(hash)
+			oracle.AddHash(hash)
+		case 1:
+			m.AddHash(hash)
+			morton.AddHash(hash)
+		case 2:
+			if morton.RemoveHash(hash) && !m.RemoveHash(hash) {
+				t.Fatalf("%d not removed", hash)
+			}
+		default:
+			if oracle.ContainsHash(hash) && !f.ContainsHash(hash) {
+				t.Fatalf("false negative %d", hash)
+			}
+		}
+	}
+	if missing := oracle.FalseNegatives(f); len(missing) != 0 {
+		t.Fatalf("false negatives %v", missing)
+	}
+	if missing := morton.FalseNegatives(m); len(missing) != 0 {
+		t.Fatalf("false negatives %v", missing)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	s := New()
+	for i := uint64(0); i < 100; i++ {
+		s.AddHash(i * 7919)
+	}
+	data, _ := s.MarshalBinary()
+	s2 := New()
+	if err := s2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if s2.Len() != 100 || !s2.ContainsHash(99*7919) || s2.ContainsHash(1) {
+		t.Fatal("round trip changed the set")
+	}
+	if s2.UnmarshalBinary(data[1:]) == nil {
+		t.Fatal("expected error for truncated data")
+	}
+}
@@ -0,0 +1,160 @@
+package bloomfilter
+
+import (
+	"hash"
+	"sync"
+	"time"
+)
+
+// ExpiringFilter remembers every element for its own time to live (TTL),
+// for uses such as suppressing duplicate alerts for 24 hours, where a
+// TTLFilter would forget all elements at once.
+//
+// Time is cut into slices, and the filter is a ring of compatible
+// filters, one per slice of expiry: an element is added to the filter of
+// the slice in which its TTL ends, and is contained until that slice ends,
+// for at least its TTL and at most one slice more. Every slice, the filter
+// of the slice which just ended is cleared, to be reused for the elements
+// expiring one maximum TTL later. Contains only tests the filters of the
+// slices not yet ended.
+type ExpiringFilter struct {
+	lock    sync.RWMutex
+	filters []*Filter // filters[s % len] holds the elements expiring in s
+	slice   time.Duration
+	maxTTL  time.Duration
+	current int64            // slice of the last operation
+	now     func() time.Time // clock, replaced by tests
+}
+
+// maxExpiringSlices is the most filters of an ExpiringFilter, each of
+// which is as large as the filter given
+const maxExpiringSlices = 4096
+
+// NewExpiringFilter of elements with a TTL of at most maxTTL, in slices
+// of the given duration, made of f and compatible filters, maxTTL / slice
+// + 1 in all, up to maxExpiringSlices. The filters are owned by the
+// ExpiringFilter from now on.
+func NewExpiringFilter(f *Filter, slice, maxTTL time.Duration) (
+	*ExpiringFilter, error,
+) {
+	if slice <= 0 || maxTTL < 0 || maxTTL/slice >= maxExpiringSlices-1 {
+		return nil, errTTLSlice(slice, maxTTL)
+	}
+	n := int(maxTTL/slice) + 1
+	if maxTTL%slice != 0 {
+		n++
+	}
+	e := &ExpiringFilter{
+		filters: []*Filter{f},
+		slice:   slice,
+		maxTTL:  maxTTL,
+		now:     time.Now,
+	}
+	for len(e.filters) < n {
+		f2, err := f.NewCompatible()
+		if err != nil {
+			for _, f := range e.filters[1:] {
+				_ = f.Close()
+			}
+			return nil, err
+		}
+		e.filters = append(e.filters, f2)
+	}
+	e.current = e.sliceOf(e.now())
+	return e, nil
+}
+
+func (e *ExpiringFilter) sliceOf(t time.Time) int64 {
+	return t.UnixNano() / int64(e.slice)
+}
+
+// advance to the current slice, clearing the filters of the slices which
+// ended, and returns it with e read locked
+func (e *ExpiringFilter) advance() int64 {
+	now := e.sliceOf(e.now())
+	e.lock.RLock()
+	if now <= e.current {
+		return e.current
+	}
+	e.lock.RUnlock()
+
+	e.lock.Lock()
+	if ended := now - e.current; ended > 0 {
+		if ended > int64(len(e.filters)) {
+			ended = int64(len(e.filters))
+		}
+		for s := e.current; s < e.current+ended; s++ {
+			e.filters[e.index(s)].Reset()
+		}
+		e.current = now
+	}
+	e.lock.Unlock()
+	e.lock.RLock()
+	return e.current
+}
+
+// index in filters of the filter of slice s
+func (e *ExpiringFilter) index(s int64) int {
+	i := int(s % int64(len(e.filters)))
+	if i < 0 {
+		i += len(e.filters)
+	}
+	return i
+}
+
+// AddWithTTL adds a hashable item, v, for ttl, at most the maximum TTL
+func (e *ExpiringFilter) AddWithTTL(v hash.Hash64, ttl time.Duration) {
+	e.AddHashWithTTL(v.Sum64(), ttl)
+}
+
+// AddHashWithTTL adds an already hashed item for ttl, at most the maximum
+// TTL. An item added again is contained until the later of its expiries.
+func (e *ExpiringFilter) AddHashWithTTL(hash uint64, ttl time.Duration) {
+	if ttl > e.maxTTL {
+		ttl = e.maxTTL
+	}
+	if ttl < 0 {
+		return
+	}
+	now := e.now()
+	e.advance()
+	defer e.lock.RUnlock()
+
+	expiry := e.sliceOf(now.Add(ttl))
+	if expiry < e.current {
+		// the clock went past now while advancing
+		return
+	}
+	e.filters[e.index(expiry)].AddHash(hash)
+}
+
+// Contains tests if v was added and its TTL has not ended
+func (e *ExpiringFilter) Contains(v hash.Hash64) bool {
+	return e.ContainsHash(v.Sum64())
+}
+
+// ContainsHash is Contains for an already hashed item
+func (e *ExpiringFilter) ContainsHash(hash uint64) bool {
+	e.advance()
+	defer e.lock.RUnlock()
+
+	for _, f := range e.filters {
+		if f.ContainsHash(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close the filters
+func (e *ExpiringFilter) Close() (err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, f := range e.filters {
+		if ferr := f.Close(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package bloomfilter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpiringFilter(t *testing.T) {
+	f, _ := New(10000, 5)
+	e, err := NewExpiringFilter(f, time.Minute, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if len(e.filters) != 24*60+1 {
+		t.Fatalf("%d filters", len(e.filters))
+	}
+	now := time.Unix(1e9, 0)
+	e.now = func() time.Time { return now }
+	e.current = e.sliceOf(now)
+
+	e.AddHashWithTTL(1, time.Hour)
+	e.AddHashWithTTL(2, 2*time.Hour)
+	e.AddHashWithTTL(3, 48*time.Hour) // capped to 24 hours
+	e.AddHashWithTTL(4, -time.Second)
+	if !e.ContainsHash(1) || !e.ContainsHash(2) || !e.ContainsHash(3) ||
+		e.ContainsHash(4) {
+		t.Fatal("elements missing")
+	}
+
+	now = now.Add(time.Hour + time.Minute)
+	if e.ContainsHash(1) || !e.ContainsHash(2) || !e.ContainsHash(3) {
+		t.Fatal("elements expired at the wrong time")
+	}
+	// added again, until the later expiry
+	e.AddHashWithTTL(2, 10*time.Hour)
+	e.AddHashWithTTL(2, time.Minute)
+	now = now.Add(5 * time.Hour)
+	if !e.ContainsHash(2) {
+		t.Fatal("element expired before its later TTL")
+	}
+
+	// beyond the whole ring at once
+	now = now.Add(30 * 24 * time.Hour)
+	if e.ContainsHash(2) || e.ContainsHash(3) {
+		t.Fatal("elements did not expire")
+	}
+	for _, f := range e.filters {
+		if f.N() != 0 {
+			t.Fatal("filters of ended slices were not cleared")
+		}
+	}
+
+	if _, err = NewExpiringFilter(f, 0, time.Hour); err == nil {
+		t.Fatal("expected error for slices of 0")
+	}
+	if _, err = NewExpiringFilter(f, time.Nanosecond, time.Hour); err == nil {
+		t.Fatal("expected error for too many slices")
+	}
+}
+
+func TestExpiringFilterConcurrent(t *testing.T) {
+	f, _ := New(10000, 5)
+	e, _ := NewExpiringFilter(f, time.Millisecond, time.Second)
+	defer e.Close()
+	var wg sync.WaitGroup
+	for g := uint64(0); g < 4; g++ {
+		wg.Add(1)
+		go func(g uint64) {
+			defer wg.Done()
+			for i := uint64(0); i < 1000; i++ {
+				e.AddHashWithTTL(g<<32|i, time.Second)
+				if !e.ContainsHash(g<<32 | i) {
+					t.Error("element missing right after adding it")
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
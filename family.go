@@ -0,0 +1,71 @@
+package bloomfilter
+
+// Family of compatible filters: it holds the parameters, m, the keys and
+// the options, shared by all the filters it creates, so that filters to be
+// unioned, intersected or queried together are compatible by construction
+// rather than by care. It is immutable, and safe for concurrent use.
+type Family struct {
+	core // m, keys and flags, without bits
+	opts options
+}
+
+// NewFamily of filters of m bits and k random keys, see New
+func NewFamily(m, k uint64, opts ...Option) (*Family, error) {
+	o := newOptions(opts)
+	c, err := newCore(m, newRandKeys(k), o.flags)
+	if err != nil {
+		return nil, err
+	}
+	return &Family{core: c, opts: o}, nil
+}
+
+// NewOptimalFamily of filters sized for maxN elements with a false positive
+// probability of p, see NewOptimal
+func NewOptimalFamily(maxN uint64, p float64, opts ...Option) (*Family, error) {
+	m := OptimalM(maxN, p)
+	k := OptimalK(m, maxN)
+	return NewFamily(m, k, opts...)
+}
+
+// FamilyOf f, such as a filter read from a file, whose filters are
+// compatible with f and created with the same options
+func FamilyOf(f *Filter) *Family {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	o := f.opts
+	o.flags = f.flags
+	return &Family{
+		core: core{
+			keys:  append([]uint64(nil), f.keys...),
+			m:     f.m,
+			flags: f.flags,
+			masks: f.masks,
+		},
+		opts: o,
+	}
+}
+
+// New empty filter of the family
+func (fam *Family) New() (*Filter, error) {
+	return newWithOptions(fam.m, fam.keys, fam.opts)
+}
+
+// Check returns nil if f is compatible with the filters of the family, or
+// else an *IncompatibleError, see IsCompatible
+func (fam *Family) Check(f *Filter) error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return fam.isCompatible(&f.core)
+}
+
+// M is the number of bits of the filters of the family
+func (fam *Family) M() uint64 {
+	return fam.m
+}
+
+// K is the number of keys of the filters of the family
+func (fam *Family) K() uint64 {
+	return uint64(len(fam.keys))
+}
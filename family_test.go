@@ -0,0 +1,46 @@
+package bloomfilter
+
+import "testing"
+
+func TestFamily(t *testing.T) {
+	fam, err := NewOptimalFamily(1000, 0.01, WithBlocked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f1, _ := fam.New()
+	f2, _ := fam.New()
+	if f1.M() != fam.M() || f1.K() != fam.K() || f1.M()%blockBits != 0 {
+		t.Fatalf("filter of m=%d k=%d in family of m=%d k=%d",
+			f1.M(), f1.K(), fam.M(), fam.K())
+	}
+	for i := uint64(0); i < 100; i++ {
+		f1.AddHash(i)
+		f2.AddHash(i + 100)
+	}
+	if err = f1.UnionInPlace(f2); err != nil {
+		t.Fatal(err)
+	}
+	if !f1.ContainsHash(150) || fam.Check(f1) != nil {
+		t.Fatal("union of the family is not in the family")
+	}
+
+	other, _ := NewOptimalFamily(1000, 0.01, WithBlocked())
+	f3, _ := other.New()
+	if fam.Check(f3) == nil {
+		t.Fatal("filter of another family with different keys checked")
+	}
+
+	// a family of a filter read back
+	data, _ := f1.MarshalBinary()
+	var f4 Filter
+	if err = f4.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	f5, _ := FamilyOf(&f4).New()
+	if err = fam.Check(f5); err != nil {
+		t.Fatal(err)
+	}
+	if f5.N() != 0 {
+		t.Fatal("new filter of a family is not empty")
+	}
+}
@@ -11,6 +11,8 @@
 package bloomfilter
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"io"
 	"io/ioutil"
@@ -19,30 +21,70 @@ import (
 
 // ReadFrom r and overwrite f with new Bloom filter data
 func (f *Filter) ReadFrom(r io.Reader) (n int64, err error) {
-	f2, n, err := ReadFrom(r)
+	f2, n, err := readFrom(r, f.opts.progress)
 	if err != nil {
+		f.opts.logf("bloomfilter: cannot read filter: %v", err)
 		return -1, err
 	}
+	f.opts.logf("bloomfilter: read filter of m=%d bits, k=%d keys, n=%d",
+		f2.m, len(f2.keys), f2.n)
 	f.lock.Lock()
 	defer f.lock.Unlock()
-	f.m = f2.m
+	f.gen++
+	err = f.releaseMem()
+	if err != nil {
+		return -1, err
+	}
+	f.core = f2.core
 	f.n = f2.n
-	f.bits = f2.bits
-	f.keys = f2.keys
+	f.recountBits()
 	return n, nil
 }
 
-// ReadFrom Reader r into a lossless-compressed Bloom filter f
+// ReadFrom Reader r into a lossless-compressed Bloom filter f, or one in
+// the compact layout of WriteCompactTo
 func ReadFrom(r io.Reader) (f *Filter, n int64, err error) {
-	rawR, err := gzip.NewReader(r)
+	return readFrom(r, nil)
+}
+
+// readFrom is ReadFrom, reporting the bytes decompressed to progress
+func readFrom(r io.Reader, progress Progress) (f *Filter, n int64, err error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(compactMagic)); isCompact(magic) {
+		return readCompact(br, progress)
+	}
+
+	rawR, err := gzip.NewReader(br)
 	if err != nil {
 		return nil, -1, err
 	}
 	defer func() {
-		err = rawR.Close()
+		// keep the first error
+		closeErr := rawR.Close()
+		if err == nil {
+			err = closeErr
+		}
 	}()
 
-	content, err := ioutil.ReadAll(rawR)
+	// the header bounds the size of the content, so that untrusted data
+	// cannot decompress to more than it claims
+	header := make([]byte, 3*Uint64Bytes)
+	_, err = io.ReadFull(rawR, header)
+	if err != nil {
+		return nil, -1, err
+	}
+	k, _, _, m, err := unmarshalBinaryHeader(bytes.NewReader(header))
+	if err != nil {
+		return nil, -1, err
+	}
+	size, err := binarySize(k, (m+63)/64)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	content, err := ioutil.ReadAll(newProgressReader(io.LimitReader(
+		io.MultiReader(bytes.NewReader(header), rawR), int64(size)),
+		size, progress))
 	if err != nil {
 		return nil, -1, err
 	}
@@ -64,29 +106,52 @@ func ReadFile(filename string) (f *Filter, n int64, err error) {
 		return nil, -1, err
 	}
 	defer func() {
-		err = r.Close()
+		// keep the first error
+		closeErr := r.Close()
+		if err == nil {
+			err = closeErr
+		}
 	}()
 
 	return ReadFrom(r)
 }
 
 // WriteTo a Writer w from lossless-compressed Bloom Filter f
+//
+// The filter is converted and compressed a chunk at a time, see
+// WithWriteChunk, so that writing a filter takes little memory beyond it.
 func (f *Filter) WriteTo(w io.Writer) (n int64, err error) {
 	f.lock.RLock()
 	defer f.lock.RUnlock()
 
 	rawW := gzip.NewWriter(w)
 	defer func() {
-		err = rawW.Close()
+		// keep the first error
+		closeErr := rawW.Close()
+		if err == nil {
+			err = closeErr
+		}
 	}()
 
-	content, err := f.MarshalBinary()
+	size, err := binarySize(uint64(len(f.keys)), uint64(len(f.bits)))
 	if err != nil {
 		return -1, err
 	}
 
-	intN, err := rawW.Write(content)
-	n = int64(intN)
+	cw := &countingWriter{w: newProgressWriter(rawW, size, f.opts.progress)}
+	err = f.writeBinary(cw, f.opts.newWriteChunk())
+	return cw.n, err
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (n int, err error) {
+	n, err = c.w.Write(b)
+	c.n += int64(n)
 	return n, err
 }
 
@@ -98,7 +163,11 @@ func (f *Filter) WriteFile(filename string) (n int64, err error) {
 		return -1, err
 	}
 	defer func() {
-		err = w.Close()
+		// keep the first error
+		closeErr := w.Close()
+		if err == nil {
+			err = closeErr
+		}
 	}()
 
 	return f.WriteTo(w)
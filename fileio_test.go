@@ -12,6 +12,8 @@ package bloomfilter
 
 import (
 	"bytes"
+	"io/ioutil"
+	"runtime"
 	"testing"
 )
 
@@ -38,3 +40,67 @@ func TestWriteRead(t *testing.T) {
 		t.Error("Filters not equal")
 	}
 }
+
+// chunkRecorder records the largest write
+type chunkRecorder struct {
+	bytes.Buffer
+	largest int
+}
+
+func (c *chunkRecorder) Write(b []byte) (int, error) {
+	if len(b) > c.largest {
+		c.largest = len(b)
+	}
+	return c.Buffer.Write(b)
+}
+
+func TestWriteToChunks(t *testing.T) {
+	f, _ := New(1<<20, 5, WithWriteChunk(1001))
+	for i := uint64(0); i < 10000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	data, _ := f.MarshalBinary()
+
+	var c chunkRecorder
+	if err := f.writeBinary(&c, f.opts.newWriteChunk()); err != nil {
+		t.Fatal(err)
+	}
+	if c.largest != 1000 || !bytes.Equal(c.Bytes(), data) {
+		t.Fatalf("largest write of %d bytes", c.largest)
+	}
+
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("wrote %d bytes of %d: %v", n, len(data), err)
+	}
+	f2, _, err := ReadFrom(&buf)
+	if err != nil || !sameFilter(f, f2) {
+		t.Fatal("chunked filter did not round-trip", err)
+	}
+
+	c = chunkRecorder{}
+	if _, err = f.WriteCompactTo(&c); err != nil {
+		t.Fatal(err)
+	}
+	compact, _ := f.MarshalCompact()
+	if c.largest != 1000 || !bytes.Equal(c.Bytes(), compact) {
+		t.Fatalf("largest compact write of %d bytes", c.largest)
+	}
+}
+
+func TestWriteToMemory(t *testing.T) {
+	// 32 MiB of bits
+	f, _ := New(1<<28, 3)
+	f.AddHash(42)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := f.WriteTo(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 4<<20 {
+		t.Fatalf("WriteTo allocated %d bytes", allocated)
+	}
+}
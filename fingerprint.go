@@ -0,0 +1,108 @@
+package bloomfilter
+
+import "math/bits"
+
+// fingerprintCache holds the Fingerprint of a filter as of a generation
+type fingerprintCache struct {
+	valid       bool
+	gen         uint64
+	fingerprint uint64
+}
+
+// Fingerprint of the content of f, a 64-bit hash of its header, keys and
+// bits, so that replicas can check cheaply whether two filters are
+// identical before comparing or transferring them. It is the XXH64 (seed 0)
+// of the binary layout of f written by MarshalBinary, without the SHA-384.
+//
+// The fingerprint is cached until f is modified, so that asking again for
+// the fingerprint of an unchanged filter costs nothing.
+func (f *Filter) Fingerprint() uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	f.fpLock.Lock()
+	defer f.fpLock.Unlock()
+	if f.fp.valid && f.fp.gen == f.gen {
+		return f.fp.fingerprint
+	}
+	var h xxh64
+	h.write([]uint64{uint64(len(f.keys)) | uint64(f.flags)<<32, f.n, f.m})
+	h.write(f.keys)
+	h.write(f.bits)
+	f.fp = fingerprintCache{valid: true, gen: f.gen, fingerprint: h.sum()}
+	return f.fp.fingerprint
+}
+
+const (
+	xxhPrime1 uint64 = 0x9e3779b185ebca87
+	xxhPrime2 uint64 = 0xc2b2ae3d27d4eb4f
+	xxhPrime3 uint64 = 0x165667b19e3779f9
+	xxhPrime4 uint64 = 0x85ebca77c2b2ae63
+	xxhPrime5 uint64 = 0x27d4eb2f165667c5
+)
+
+// xxh64 computes the XXH64, with seed 0, of the little-endian bytes of the
+// words written to it, which is all it takes for the whole words of a
+// filter
+type xxh64 struct {
+	v      [4]uint64 // accumulators
+	stripe [4]uint64 // words not yet accumulated
+	n      int       // number of words in stripe
+	total  uint64    // number of bytes written
+}
+
+func xxhRound(acc, word uint64) uint64 {
+	acc += word * xxhPrime2
+	return bits.RotateLeft64(acc, 31) * xxhPrime1
+}
+
+func xxhMerge(h, v uint64) uint64 {
+	h ^= xxhRound(0, v)
+	return h*xxhPrime1 + xxhPrime4
+}
+
+func (x *xxh64) write(words []uint64) {
+	if x.total == 0 {
+		p1 := xxhPrime1 // wrapping around, unlike constants
+		x.v = [4]uint64{p1 + xxhPrime2, xxhPrime2, 0, -p1}
+	}
+	x.total += uint64(len(words)) * Uint64Bytes
+	for _, word := range words {
+		x.stripe[x.n] = word
+		x.n++
+		if x.n == 4 {
+			for i := range x.v {
+				x.v[i] = xxhRound(x.v[i], x.stripe[i])
+			}
+			x.n = 0
+		}
+	}
+}
+
+func (x *xxh64) sum() uint64 {
+	var h uint64
+	if x.total >= 32 {
+		h = bits.RotateLeft64(x.v[0], 1) + bits.RotateLeft64(x.v[1], 7) +
+			bits.RotateLeft64(x.v[2], 12) + bits.RotateLeft64(x.v[3], 18)
+		for _, v := range x.v {
+			h = xxhMerge(h, v)
+		}
+	} else {
+		h = xxhPrime5
+	}
+	h += x.total
+	for _, word := range x.stripe[:x.n] {
+		h ^= xxhRound(0, word)
+		h = bits.RotateLeft64(h, 27)*xxhPrime1 + xxhPrime4
+	}
+	return xxhAvalanche(h)
+}
+
+func xxhAvalanche(h uint64) uint64 {
+	h ^= h >> 33
+	h *= xxhPrime2
+	h ^= h >> 29
+	h *= xxhPrime3
+	h ^= h >> 32
+	return h
+}
@@ -0,0 +1,61 @@
+package bloomfilter
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"testing"
+)
+
+func TestXXH64(t *testing.T) {
+	var h xxh64
+	if sum := h.sum(); sum != 0xef46db3751d8e999 {
+		t.Fatalf("XXH64 of nothing is %#x", sum)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	f, _ := New(10000, 5)
+	for i := uint64(0); i < 1000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	f2, _ := f.Copy()
+	fp := f.Fingerprint()
+	if f2.Fingerprint() != fp || f.Fingerprint() != fp {
+		t.Fatal("identical filters have different fingerprints")
+	}
+
+	// the XXH64 of the binary layout
+	data, _ := f.MarshalBinary()
+	var h xxh64
+	words := make([]uint64, (len(data)-sha512.Size384)/Uint64Bytes)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(data[i*Uint64Bytes:])
+	}
+	h.write(words)
+	if h.sum() != fp {
+		t.Fatal("fingerprint is not the hash of the binary layout")
+	}
+
+	// invalidated by writes
+	f2.AddHash(42)
+	if f2.Fingerprint() == fp {
+		t.Fatal("fingerprint unchanged after adding")
+	}
+	other, _ := f.NewCompatible()
+	if other.Fingerprint() == fp {
+		t.Fatal("empty filter has the same fingerprint")
+	}
+	f.Reset()
+	if f.Fingerprint() != other.Fingerprint() {
+		t.Fatal("fingerprint of a reset filter differs from an empty one")
+	}
+}
+
+func BenchmarkFingerprint(b *testing.B) {
+	f, _ := New(8*1<<20, 5)
+	b.SetBytes(1 << 20)
+	for i := 0; i < b.N; i++ {
+		f.gen++
+		f.Fingerprint()
+	}
+}
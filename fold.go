@@ -0,0 +1,157 @@
+package bloomfilter
+
+import (
+	"math"
+	"math/bits"
+)
+
+// foldBits ORs the m bits of src into the m2 bits of dst, bit i of src
+// going to bit i%m2 of dst
+func foldBits(dst, src []uint64, m2 uint64) {
+	if m2%64 == 0 {
+		words := m2 / 64
+		for i, bitword := range src {
+			dst[uint64(i)%words] |= bitword
+		}
+		return
+	}
+	for i, bitword := range src {
+		for bitword != 0 {
+			j := (uint64(i)*64 + uint64(bits.TrailingZeros64(bitword))) % m2
+			dst[j>>6] |= 1 << uint(j&0x3f)
+			bitword &= bitword - 1
+		}
+	}
+}
+
+// foldRange ORs the bits of src into dst, bit i of src going to bit
+// i/factor of dst
+func foldRange(dst, src []uint64, factor uint64) {
+	for i, bitword := range src {
+		for bitword != 0 {
+			j := (uint64(i)*64 + uint64(bits.TrailingZeros64(bitword))) / factor
+			dst[j>>6] |= 1 << uint(j&0x3f)
+			bitword &= bitword - 1
+		}
+	}
+}
+
+// foldBlocks ORs the blocks of size words of src into the blocks of dst,
+// block b of src going to block b/factor of dst
+func foldBlocks(dst, src []uint64, factor, size uint64) {
+	for i, bitword := range src {
+		block := uint64(i) / size
+		dst[block/factor*size+uint64(i)%size] |= bitword
+	}
+}
+
+// foldable is true if c can be folded by factor
+func (c *core) foldable(factor uint64) bool {
+	if factor == 0 {
+		return false
+	}
+	if c.flags&flagBlocked != 0 {
+		return (c.m/blockBits)%factor == 0
+	}
+	if c.flags&flagRegisterBlocked != 0 {
+		return (c.m/64)%factor == 0
+	}
+	return c.m%factor == 0 && c.m/factor >= MMin
+}
+
+// fold f into a new Filter of m/factor bits, f must be foldable by factor
+// and locked
+func (f *Filter) fold(factor uint64) (*Filter, error) {
+	o := f.opts
+	o.flags = f.flags
+	out, err := newWithOptions(f.m/factor, f.keys, o)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case f.flags&flagBlocked != 0:
+		foldBlocks(out.bits, f.bits, factor, blockWords)
+	case f.flags&flagRegisterBlocked != 0:
+		foldBlocks(out.bits, f.bits, factor, 1)
+	case f.flags&flagFastRange != 0:
+		foldRange(out.bits, f.bits, factor)
+	default:
+		foldBits(out.bits, f.bits, out.m)
+	}
+	out.n = f.n
+	return out, nil
+}
+
+// Fold f into a new Filter of m/factor bits, trading accuracy for memory.
+// m must be a multiple of factor.
+//
+// Since every index (hash ^ key) % m is congruent to (hash ^ key) % (m/factor)
+// modulo m/factor, bit i of f becomes bit i % (m/factor) of the result, which
+// contains everything f contains. Folded filters are only compatible with
+// filters folded the same way.
+//
+// For filters created WithBlocked, the number of blocks, m/512, must be a
+// multiple of factor instead, and block b of f becomes block b/factor of the
+// result. Likewise for the words of filters created WithRegisterBlocked.
+// For filters created WithFastRange, whose indexes are the high bits of
+// x * m, bit i of f becomes bit i / factor of the result instead.
+//
+// Folding by factor is like inserting the n elements into a filter of
+// m/factor bits, raising the false positive probability to about
+//
+//	(1 - exp(-k*n*factor/m)) ** k
+func (f *Filter) Fold(factor uint) (*Filter, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if !f.foldable(uint64(factor)) {
+		return nil, errFoldFactor(f.m, factor)
+	}
+	out, err := f.fold(uint64(factor))
+	if err == nil {
+		f.logFolded(out)
+	}
+	return out, err
+}
+
+// logFolded reports f being folded into out
+func (f *Filter) logFolded(out *Filter) {
+	f.opts.logf("bloomfilter: folded filter from m=%d to m=%d bits",
+		f.m, out.m)
+}
+
+// Compact f into a new smaller Filter, for consumers short on memory.
+//
+// f is folded in half (see Fold) for as long as it can be and the false
+// positive probability of the result, estimated from its fill ratio as
+// fill ** k, stays within targetFP. If f cannot be folded even once, the
+// result is a copy of f.
+func (f *Filter) Compact(targetFP float64) (*Filter, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	out, err := f.fold(1)
+	if err != nil {
+		return nil, err
+	}
+	k := float64(len(f.keys))
+	for out.foldable(2) {
+		folded, err := out.fold(2)
+		if err != nil {
+			_ = out.Close()
+			return nil, err
+		}
+		fill := float64(countBits(folded.bits)) /
+			float64(folded.m)
+		if math.Pow(fill, k) > targetFP {
+			_ = folded.Close()
+			break
+		}
+		_ = out.releaseMem()
+		out = folded
+	}
+	if out.m != f.m {
+		f.logFolded(out)
+	}
+	return out, nil
+}
@@ -0,0 +1,126 @@
+package bloomfilter
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	bf, _ := New(3*64*10, 5)
+	for _, x := range hashableUint64Values() {
+		bf.Add(x)
+	}
+	for _, factor := range []uint{1, 2, 3, 7} {
+		folded, err := bf.Fold(factor)
+		if factor == 7 {
+			if err == nil {
+				t.Fatal("expected error folding by a non-divisor")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if folded.M() != bf.M()/uint64(factor) {
+			t.Fatalf("folded by %d: m=%d", factor, folded.M())
+		}
+		for _, x := range hashableUint64Values() {
+			if !folded.Contains(x) {
+				t.Fatalf("folded by %d: does not contain %d", factor, x)
+			}
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	bf, _ := New(1<<20, 5)
+	for i := uint64(0); i < 1000; i++ {
+		bf.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	compacted, err := bf.Compact(0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compacted.M() >= bf.M() {
+		t.Fatalf("not compacted: m=%d", compacted.M())
+	}
+	fp := math.Pow(compacted.PreciseFilledRatio(), float64(compacted.K()))
+	if fp > 0.01 {
+		t.Fatalf("compacted to m=%d with fp=%f", compacted.M(), fp)
+	}
+	for i := uint64(0); i < 1000; i++ {
+		if !compacted.ContainsHash(i * 0x9e3779b97f4a7c15) {
+			t.Fatalf("compacted filter does not contain %d", i)
+		}
+	}
+}
+
+func TestCompactReleases(t *testing.T) {
+	a := &countingAllocator{}
+	bf, _ := New(1<<20, 5, WithAllocator(a))
+	for i := uint64(0); i < 1000; i++ {
+		bf.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	compacted, err := bf.Compact(0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only bf and the result are left
+	if used := uint64(len(bf.bits) + len(compacted.bits)); a.inUse != used {
+		t.Fatalf("%d words in use, expected %d", a.inUse, used)
+	}
+	_ = compacted.Close()
+	_ = bf.Close()
+	if a.inUse != 0 {
+		t.Fatalf("%d words leaked", a.inUse)
+	}
+}
+
+func TestFoldFastRange(t *testing.T) {
+	bf, _ := New(3*64*10, 5, WithFastRange())
+	o := bf.opts
+	o.flags = bf.flags
+	for _, factor := range []uint64{2, 3, 5} {
+		direct, _ := newWithOptions(bf.M()/factor, bf.keys, o)
+		for _, x := range hashableUint64Values() {
+			bf.Add(x)
+			direct.Add(x)
+		}
+		folded, err := bf.Fold(uint(factor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// folding is exact: the same as adding to the smaller filter
+		if noBranchCompareUint64s(folded.bits, direct.bits) != 0 {
+			t.Fatalf("folded by %d: bits differ from a filter of m=%d",
+				factor, direct.M())
+		}
+	}
+}
+
+func TestFoldPowerOfTwo(t *testing.T) {
+	bf, _ := New(3000, 5, WithPowerOfTwo())
+	if bf.M() != 4096 {
+		t.Fatalf("m=%d is not rounded up to a power of 2", bf.M())
+	}
+	o := bf.opts
+	o.flags = bf.flags
+	for _, factor := range []uint64{2, 4, 64} {
+		direct, _ := newWithOptions(bf.M()/factor, bf.keys, o)
+		for _, x := range hashableUint64Values() {
+			bf.Add(x)
+			direct.Add(x)
+		}
+		folded, err := bf.Fold(uint(factor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if noBranchCompareUint64s(folded.bits, direct.bits) != 0 {
+			t.Fatalf("folded by %d: bits differ from a filter of m=%d",
+				factor, direct.M())
+		}
+	}
+	if _, err := bf.Fold(3); err == nil {
+		t.Fatal("expected error folding a power of 2 by 3")
+	}
+}
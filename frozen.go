@@ -0,0 +1,69 @@
+package bloomfilter
+
+import "hash"
+
+// FrozenFilter is an immutable snapshot of a Filter. Since it cannot change,
+// it is queried without any locking, for filters which are built once and
+// then only queried.
+type FrozenFilter struct {
+	core
+	n uint64
+}
+
+// Freeze f into a FrozenFilter. Later changes to f do not affect it.
+func (f *Filter) Freeze() *FrozenFilter {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	ff := &FrozenFilter{
+		core: core{
+			bits:  newAlignedWords(uint64(len(f.bits))),
+			keys:  make([]uint64, len(f.keys)),
+			m:     f.m,
+			flags: f.flags,
+			masks: f.masks,
+		},
+		n: f.n,
+	}
+	copy(ff.bits, f.bits)
+	copy(ff.keys, f.keys)
+	return ff
+}
+
+// Thaw ff into a new Filter which can be modified again
+func (ff *FrozenFilter) Thaw() (*Filter, error) {
+	f, err := newWithOptions(ff.m, ff.keys, options{flags: ff.flags})
+	if err != nil {
+		return nil, err
+	}
+	copy(f.bits, ff.bits)
+	f.n = ff.n
+	return f, nil
+}
+
+// M is the size of Bloom filter, in bits
+func (ff *FrozenFilter) M() uint64 {
+	return ff.m
+}
+
+// K is the count of keys
+func (ff *FrozenFilter) K() uint64 {
+	return uint64(len(ff.keys))
+}
+
+// N is how many elements had been inserted when the filter was frozen
+func (ff *FrozenFilter) N() uint64 {
+	return ff.n
+}
+
+// Contains tests if ff contains v
+// false: ff definitely does not contain value v
+// true:  ff maybe contains value v
+func (ff *FrozenFilter) Contains(v hash.Hash64) bool {
+	return ff.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if ff contains the (already hashed) key
+func (ff *FrozenFilter) ContainsHash(hash uint64) bool {
+	return ff.contains(hash)
+}
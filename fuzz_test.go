@@ -0,0 +1,140 @@
+//go:build go1.18
+// +build go1.18
+
+package bloomfilter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func fuzzSeeds(f *testing.F) {
+	for _, opts := range [][]Option{nil, {WithBlocked()}, {WithRegisterBlocked()},
+		{WithIndexScheme(DoubleHashing)},
+		{WithIndexScheme(EnhancedDoubleHashing)}, {WithFastRange()},
+		{WithFastRange(), WithIndexScheme(EnhancedDoubleHashing)},
+		{WithPowerOfTwo()}} {
+		bf, _ := New(1000, 3, opts...)
+		bf.AddHash(42)
+		data, _ := bf.MarshalBinary()
+		f.Add(data)
+	}
+	f.Add([]byte{})
+}
+
+func FuzzUnmarshalBinary(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var bf Filter
+		if err := bf.UnmarshalBinary(data); err != nil {
+			return
+		}
+		bf.AddHash(42)
+		bf.ContainsHash(43)
+		if _, err := bf.MarshalBinary(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func FuzzUnmarshalBinaryNoCopy(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var bf Filter
+		if err := bf.UnmarshalBinaryNoCopy(data); err != nil {
+			return
+		}
+		bf.ContainsHash(43)
+	})
+}
+
+func FuzzUnmarshalText(f *testing.F) {
+	for _, opts := range [][]Option{nil, {WithBlocked()}, {WithRegisterBlocked()}} {
+		bf, _ := New(1000, 3, opts...)
+		bf.AddHash(42)
+		text, _ := bf.MarshalText()
+		f.Add(text)
+	}
+	f.Add([]byte("k\n3\nn\n0\nm\n18446744073709551615\nflags\n0\nkeys\n"))
+	f.Fuzz(func(t *testing.T, text []byte) {
+		bf, err := UnmarshalText(text)
+		if err != nil {
+			return
+		}
+		bf.AddHash(42)
+		if _, err := bf.MarshalText(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func FuzzReadFrom(f *testing.F) {
+	bf, _ := New(1000, 3)
+	var buf bytes.Buffer
+	_, _ = bf.WriteTo(&buf)
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if bf, _, err := ReadFrom(bytes.NewReader(data)); err == nil {
+			bf.ContainsHash(43)
+		}
+	})
+}
+
+func FuzzFrequencySketchUnmarshalBinary(f *testing.F) {
+	s, _ := NewFrequencySketch(1000, 3, 0)
+	data, _ := s.MarshalBinary()
+	f.Add(data)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var s FrequencySketch
+		if err := s.UnmarshalBinary(data); err == nil {
+			s.Increment(42)
+			s.CountHash(42)
+		}
+	})
+}
+
+// FuzzCountingQuotientFilterSlots checks that slots accepted by check can
+// be operated on, and stay consistent
+func FuzzCountingQuotientFilterSlots(f *testing.F) {
+	c, _ := NewCountingQuotientFilter(4, 4)
+	for i := uint64(0); i < 6; i++ {
+		_ = c.AddHashCount(i*0x9e3779b97f4a7c15, i+1)
+	}
+	f.Add(c.slots[0], c.slots[1], c.n, uint64(0x123456789abcdef))
+	f.Fuzz(func(t *testing.T, slot0, slot1, n, hash uint64) {
+		c := &CountingQuotientFilter{
+			slots: []uint64{slot0, slot1}, q: 4, r: 4, size: 16, n: n,
+		}
+		if c.check() != nil {
+			return
+		}
+		count := c.CountHash(hash)
+		if err := c.AddHash(hash); err == nil && c.CountHash(hash) != count+1 {
+			t.Fatalf("count %d after adding, expected %d", c.CountHash(hash), count+1)
+		}
+		c.RemoveHash(hash ^ 1<<60)
+		used := c.used
+		c.used = 0
+		if err := c.check(); err != nil || c.used != used {
+			t.Fatalf("%v, %d slots used, expected %d", err, c.used, used)
+		}
+	})
+}
+
+// FuzzGolombSetCodes checks that codes accepted by check can be queried
+func FuzzGolombSetCodes(f *testing.F) {
+	s, _ := NewGolombSet([]uint64{1, 2, 3, 4, 5}, 8)
+	f.Add(s.codes[0], uint64(0), s.size, s.n, uint(8), uint64(3))
+	f.Fuzz(func(t *testing.T, code0, code1, size, n uint64, p uint,
+		hash uint64) {
+		if size > 128 || p > 63 {
+			return
+		}
+		s := &GolombSet{
+			n: n, rng: 5 << 8, p: p, codes: []uint64{code0, code1}, size: size,
+		}
+		if s.check() == nil {
+			s.ContainsHash(hash)
+		}
+	})
+}
@@ -0,0 +1,334 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"hash"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// GolombSet is a Golomb-coded set (GCS): a sorted set of values below a
+// range, stored as the Golomb-Rice codes of the gaps between them, which
+// comes within a few percent of the minimum size for the false positive
+// probability. It suits shipping membership data to clients short on
+// bandwidth, at the price of queries decoding the set from the start. It is
+// immutable.
+//
+// A GolombSet is either built from hashes, by NewGolombSet, the value of a
+// hash being its position in a range of n * 2**fpBits, or from a Filter, by
+// GolombSet, the values being the indexes of the bits set, whose
+// positions are derived from the hashes like those of the filter.
+type GolombSet struct {
+	// keys, m and layout of the filter, if any, "bits" being unused
+	core
+	n     uint64   // number of values
+	rng   uint64   // range of the values
+	p     uint     // Rice parameter: the low p bits of a gap are stored as is
+	codes []uint64 // Golomb-Rice codes of the gaps, starting at bit 0
+	size  uint64   // number of bits of codes
+}
+
+// NewGolombSet of the (already hashed) keys, with a false positive
+// probability of 2**-fpBits
+func NewGolombSet(hashes []uint64, fpBits uint) (*GolombSet, error) {
+	n := uint64(len(hashes))
+	if fpBits > 32 || n > math.MaxUint64>>fpBits {
+		return nil, errGolombSetBits(n, fpBits)
+	}
+	s := &GolombSet{rng: n << fpBits, p: fpBits}
+	values := make([]uint64, len(hashes))
+	for i, hash := range hashes {
+		values[i] = s.value(hash)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	s.encode(values)
+	return s, nil
+}
+
+// GolombSet of the bits set in f, which can be queried like f, the gaps
+// between the bits set being Golomb-Rice coded rather than stored as they
+// are. This only takes less data than the bits of sparse filters, such as
+// filters with more bits and fewer keys than optimal for the same false
+// positive probability: the bits of filters about half full, as NewOptimal
+// sizes them, do not compress.
+func (f *Filter) GolombSet() *GolombSet {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	s := &GolombSet{
+		core: core{
+			keys:  append([]uint64(nil), f.keys...),
+			m:     f.m,
+			flags: f.flags,
+			masks: f.masks,
+		},
+		rng: f.m,
+	}
+	var values []uint64
+	for w, bitword := range f.bits {
+		for ; bitword != 0; bitword &= bitword - 1 {
+			values = append(values,
+				uint64(w)*64+uint64(bits.TrailingZeros64(bitword)))
+		}
+	}
+	if len(values) > 0 {
+		// the Rice parameter closest to the optimal Golomb parameter of
+		// geometric gaps of mean m/set
+		gap := float64(f.m) / float64(len(values))
+		s.p = uint(math.Max(math.Floor(math.Log2(gap*math.Ln2)), 0))
+	}
+	s.encode(values)
+	return s
+}
+
+// value of hash in a GolombSet built from hashes
+func (s *GolombSet) value(hash uint64) uint64 {
+	v, _ := bits.Mul64(mix64(hash), s.rng)
+	return v
+}
+
+// encode the sorted values into s, dropping duplicates
+func (s *GolombSet) encode(values []uint64) {
+	var w golombWriter
+	prev := uint64(0)
+	for i, v := range values {
+		if i > 0 && v == prev {
+			continue
+		}
+		gap := v - prev
+		w.writeUnary(gap >> s.p)
+		w.writeBits(gap, s.p)
+		prev = v
+		s.n++
+	}
+	if len(w.words) == 0 {
+		w.words = make([]uint64, 1)
+	}
+	s.codes, s.size = w.words, w.size
+}
+
+// N is the number of distinct values in s
+func (s *GolombSet) N() uint64 {
+	return s.n
+}
+
+// Size of the codes of s, in bytes
+func (s *GolombSet) Size() uint64 {
+	return (s.size + 7) / 8
+}
+
+// Contains tests if s contains v
+// false: s definitely does not contain value v
+// true:  s maybe contains value v
+func (s *GolombSet) Contains(v hash.Hash64) bool {
+	return s.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if s contains the (already hashed) key, decoding s
+// from the start
+func (s *GolombSet) ContainsHash(hash uint64) bool {
+	if s.keys == nil {
+		return s.containsSorted([]uint64{s.value(hash)})
+	}
+	var buf [32]uint64
+	locations := s.locations(hash, buf[:0])
+	sort.Slice(locations, func(i, j int) bool {
+		return locations[i] < locations[j]
+	})
+	return s.containsSorted(locations)
+}
+
+// containsSorted is true if s contains all the sorted values
+func (s *GolombSet) containsSorted(values []uint64) bool {
+	r := golombReader{words: s.codes, size: s.size}
+	v := uint64(0)
+	for i := uint64(0); i < s.n; i++ {
+		gap, _ := r.read(s.p)
+		v += gap
+		for len(values) > 0 && values[0] <= v {
+			if values[0] < v {
+				return false
+			}
+			values = values[1:]
+		}
+		if len(values) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// check that the codes of s decode to n increasing values within the range
+func (s *GolombSet) check() error {
+	r := golombReader{words: s.codes, size: s.size}
+	v := uint64(0)
+	for i := uint64(0); i < s.n; i++ {
+		gap, ok := r.read(s.p)
+		if !ok || i > 0 && gap == 0 || gap >= s.rng-v {
+			return errGolombSetCorrupt()
+		}
+		v += gap
+	}
+	if r.pos != s.size || s.size%64 != 0 &&
+		s.codes[len(s.codes)-1]>>(s.size%64) != 0 ||
+		s.size == 0 && s.codes[0] != 0 {
+		return errGolombSetCorrupt()
+	}
+	return nil
+}
+
+// MarshalBinary converts s into []bytes, in the same layout as a Filter,
+// with the range, the Rice parameter and the number of bits of the codes,
+// followed by the flags and keys of the filter, if any, as the keys, the
+// number of values as n, and the codes as the bits
+func (s *GolombSet) MarshalBinary() (data []byte, err error) {
+	keys := []uint64{s.rng, uint64(s.p), s.size}
+	if s.keys != nil {
+		keys = append(append(keys, uint64(s.flags)), s.keys...)
+	}
+	buf, _, err := marshalWords(keys, 0, s.n,
+		uint64(len(s.codes))*64, s.codes)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary converts []bytes written by MarshalBinary into s, which
+// is left unchanged if an error is returned
+func (s *GolombSet) UnmarshalBinary(data []byte) (err error) {
+	buf := bytes.NewBuffer(data)
+	k, flags, n, m, err := unmarshalBinaryHeader(buf)
+	if err != nil {
+		return err
+	}
+	words := (m + 63) / 64
+	err = checkBinarySize(k, words, uint64(len(data)))
+	if err != nil {
+		return err
+	}
+	keys, err := unmarshalBinaryKeys(buf, k)
+	if err != nil {
+		return err
+	}
+	if flags != 0 {
+		return errFlags(flags)
+	}
+	if k < 3 || k == 4 || m%64 != 0 || keys[1] > 63 ||
+		words != golombWords(keys[2]) {
+		return errGolombSetCorrupt()
+	}
+	s2 := &GolombSet{n: n, rng: keys[0], p: uint(keys[1]), size: keys[2]}
+	if k > 4 {
+		if keys[3] > math.MaxUint32 || s2.rng < MMin {
+			return errGolombSetCorrupt()
+		}
+		s2.core, err = newCore(s2.rng, keys[4:], uint32(keys[3]))
+		if err != nil {
+			return err
+		}
+		if s2.m != s2.rng {
+			return errFlags(s2.flags)
+		}
+	}
+	s2.codes = make([]uint64, words)
+	err = readWords(buf, s2.codes)
+	if err != nil {
+		return err
+	}
+	err = checkBinaryHash(buf, data)
+	if err != nil {
+		return err
+	}
+	err = s2.check()
+	if err != nil {
+		return err
+	}
+	*s = *s2
+	return nil
+}
+
+// golombWords holding size bits of codes, at least one, so that the codes
+// are never empty
+func golombWords(size uint64) uint64 {
+	if size == 0 {
+		return 1
+	}
+	return size/64 + (size%64+63)/64
+}
+
+// golombWriter appends bits to words, starting from bit 0 of word 0
+type golombWriter struct {
+	words []uint64
+	size  uint64 // number of bits written
+}
+
+// writeBits writes the low width bits of v
+func (w *golombWriter) writeBits(v uint64, width uint) {
+	if width == 0 {
+		return
+	}
+	v &= ^uint64(0) >> (64 - width)
+	off := uint(w.size % 64)
+	if off == 0 {
+		w.words = append(w.words, 0)
+	}
+	w.words[len(w.words)-1] |= v << off
+	if off+width > 64 {
+		w.words = append(w.words, v>>(64-off))
+	}
+	w.size += uint64(width)
+}
+
+// writeUnary writes q as q ones and a zero
+func (w *golombWriter) writeUnary(q uint64) {
+	for ; q >= 63; q -= 63 {
+		w.writeBits(^uint64(0), 63)
+	}
+	w.writeBits(^uint64(0)>>(64-q-1)>>1, uint(q)+1)
+}
+
+// golombReader reads the bits written by a golombWriter
+type golombReader struct {
+	words []uint64
+	size  uint64
+	pos   uint64
+}
+
+// read a Golomb-Rice code of Rice parameter p, returning false if it runs
+// beyond the end of the words
+func (r *golombReader) read(p uint) (uint64, bool) {
+	var q uint64
+	for {
+		if r.pos >= r.size {
+			return 0, false
+		}
+		word := r.words[r.pos/64] >> (r.pos % 64)
+		ones := uint64(bits.TrailingZeros64(^word))
+		if avail := 64 - r.pos%64; ones >= avail {
+			// the ones continue in the next word
+			q += avail
+			r.pos += avail
+			continue
+		}
+		q += ones
+		r.pos += ones + 1
+		break
+	}
+	if r.pos > r.size || p > 0 && q > math.MaxUint64>>p ||
+		r.size-r.pos < uint64(p) {
+		return 0, false
+	}
+	v := q << p
+	if p > 0 {
+		off := uint(r.pos % 64)
+		lo := r.words[r.pos/64] >> off
+		if off+p > 64 {
+			lo |= r.words[r.pos/64+1] << (64 - off)
+		}
+		v |= lo & (^uint64(0) >> (64 - p))
+		r.pos += uint64(p)
+	}
+	return v, true
+}
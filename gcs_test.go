@@ -0,0 +1,103 @@
+package bloomfilter
+
+import (
+	"crypto/sha512"
+	"testing"
+)
+
+func TestGolombSet(t *testing.T) {
+	hashes := make([]uint64, 10000)
+	for i := range hashes {
+		hashes[i] = uint64(i) * 0x9e3779b97f4a7c15
+	}
+	s, err := NewGolombSet(hashes, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range hashes {
+		if !s.ContainsHash(hash) {
+			t.Fatalf("does not contain %#x", hash)
+		}
+	}
+	fp := 0
+	for i := uint64(10000); i < 30000; i++ {
+		if s.ContainsHash(i * 0x9e3779b97f4a7c15) {
+			fp++
+		}
+	}
+	// 2**-10 is about 0.1%
+	if fp > 40 {
+		t.Fatalf("%d false positives out of 20000", fp)
+	}
+	// about fpBits + 1.5 bits per value
+	if bits := s.Size() * 8 / s.N(); bits > 12 {
+		t.Fatalf("%d bits per value", bits)
+	}
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s2 GolombSet
+	if err = s2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range hashes[:1000] {
+		if !s2.ContainsHash(hash) {
+			t.Fatalf("does not contain %#x after unmarshaling", hash)
+		}
+	}
+
+	data[len(data)-sha512.Size384-1] ^= 0x10
+	if err = s2.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected error for corrupt codes")
+	}
+
+	empty, err := NewGolombSet(nil, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.ContainsHash(42) {
+		t.Fatal("empty set contains 42")
+	}
+	data, _ = empty.MarshalBinary()
+	if err = s2.UnmarshalBinary(data); err != nil || s2.N() != 0 {
+		t.Fatalf("unmarshaling an empty set: %v", err)
+	}
+
+	if _, err = NewGolombSet(hashes, 40); err == nil {
+		t.Fatal("expected error for too many bits")
+	}
+}
+
+func TestFilterGolombSet(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBlocked()}, {WithRegisterBlocked()},
+		{WithFastRange(), WithIndexScheme(DoubleHashing)}} {
+		// sparse, about 11% full
+		f, _ := New(1<<17, 3, opts...)
+		for i := uint64(0); i < 5000; i++ {
+			f.AddHash(i * 0x9e3779b97f4a7c15)
+		}
+		s := f.GolombSet()
+		if s.Size() >= uint64(len(f.bits))*Uint64Bytes*2/3 {
+			t.Fatalf("%d bytes of codes for %d bytes of bits", s.Size(),
+				len(f.bits)*Uint64Bytes)
+		}
+
+		data, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s2 GolombSet
+		if err = s2.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		for i := uint64(4000); i < 6000; i++ {
+			hash := i * 0x9e3779b97f4a7c15
+			if s2.ContainsHash(hash) != f.ContainsHash(hash) {
+				t.Fatalf("flags %#x: set and filter differ for %#x",
+					f.flags, hash)
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package bloomfilter
+
+// Generation is incremented by every modification of f, such as Add, Reset
+// or UnmarshalBinary, so that reads spanning several calls can tell whether
+// f changed in between
+func (f *Filter) Generation() uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.gen
+}
+
+// MutationPolicy is what a WordsIterator does when its filter is modified
+// during the iteration
+type MutationPolicy uint8
+
+const (
+	// FailOnMutation stops the iteration with ErrMutated
+	FailOnMutation MutationPolicy = iota
+	// IgnoreMutation carries on, so that the words read are a mix of the
+	// filter before and after the modifications. Since Add only sets bits,
+	// such a mix is still a filter containing every element added before
+	// the iteration started, as long as the filter is not reset or
+	// replaced.
+	IgnoreMutation
+)
+
+// WordsIterator reads the words of a Filter in chunks, each read taking the
+// lock of the filter only once, so that writers are not held up for as long
+// as it takes to process all the words of a large filter
+type WordsIterator struct {
+	f      *Filter
+	policy MutationPolicy
+	gen    uint64
+	off    uint64
+	err    error
+}
+
+// IterWords returns a WordsIterator over the words of f, from the first
+func (f *Filter) IterWords(policy MutationPolicy) *WordsIterator {
+	return &WordsIterator{f: f, policy: policy, gen: f.Generation()}
+}
+
+// Next copies the next words into dst, returning how many were copied, or
+// 0 once all were read or on error, see Err
+func (it *WordsIterator) Next(dst []uint64) int {
+	if it.err != nil {
+		return 0
+	}
+	f := it.f
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if f.gen != it.gen && it.policy == FailOnMutation {
+		it.err = ErrMutated
+		return 0
+	}
+	if it.off >= uint64(len(f.bits)) {
+		return 0
+	}
+	n := copy(dst, f.bits[it.off:])
+	it.off += uint64(n)
+	return n
+}
+
+// Offset is the index of the word which the next call to Next reads first
+func (it *WordsIterator) Offset() uint64 {
+	return it.off
+}
+
+// Err is the error which stopped the iteration, if any
+func (it *WordsIterator) Err() error {
+	return it.err
+}
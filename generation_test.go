@@ -0,0 +1,86 @@
+package bloomfilter
+
+import "testing"
+
+func TestGeneration(t *testing.T) {
+	f, _ := New(1<<12, 3)
+	gen := f.Generation()
+	f.AddHash(1)
+	if f.Generation() == gen {
+		t.Error("AddHash did not change the generation")
+	}
+	gen = f.Generation()
+	f.ContainsHash(1)
+	_, _ = f.MarshalBinary()
+	if f.Generation() != gen {
+		t.Error("reads changed the generation")
+	}
+	f.Reset()
+	if f.Generation() == gen {
+		t.Error("Reset did not change the generation")
+	}
+
+	// rejected input leaves f unchanged
+	f.AddHash(1)
+	data, _ := f.MarshalBinary()
+	text, _ := f.MarshalText()
+	gen = f.Generation()
+	data[len(data)-1] ^= 1
+	text[len(text)-2] ^= 1
+	if f.UnmarshalBinary(data) == nil || f.UnmarshalText(text) == nil ||
+		f.SetWords([]uint64{1}, f.Words()) == nil {
+		t.Fatal("expected errors for corrupt input")
+	}
+	if f.Generation() != gen {
+		t.Error("rejected input changed the generation")
+	}
+	data[len(data)-1] ^= 1
+	if err := f.UnmarshalBinary(data); err != nil || f.Generation() == gen {
+		t.Error("UnmarshalBinary did not change the generation")
+	}
+
+	// clearing f in a pool changes it too
+	fp := f.Fingerprint()
+	gen = f.Generation()
+	NewPool(f).Put(f)
+	if f.Generation() == gen || f.Fingerprint() == fp {
+		t.Error("Pool.Put did not change the generation")
+	}
+}
+
+func TestWordsIterator(t *testing.T) {
+	f, _ := New(1<<12, 3)
+	for i := uint64(0); i < 100; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+
+	var words []uint64
+	chunk := make([]uint64, 10)
+	it := f.IterWords(FailOnMutation)
+	for n := it.Next(chunk); n > 0; n = it.Next(chunk) {
+		words = append(words, chunk[:n]...)
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	if noBranchCompareUint64s(words, f.bits) != 0 {
+		t.Error("iterated words differ from the bits")
+	}
+
+	it = f.IterWords(FailOnMutation)
+	it.Next(chunk)
+	f.AddHash(12345)
+	if n := it.Next(chunk); n != 0 || it.Err() != ErrMutated {
+		t.Errorf("Next after a modification read %d words, error %v", n, it.Err())
+	}
+
+	it = f.IterWords(IgnoreMutation)
+	it.Next(chunk)
+	f.AddHash(123456)
+	if n := it.Next(chunk); n != len(chunk) || it.Err() != nil {
+		t.Errorf("best effort Next read %d words, error %v", n, it.Err())
+	}
+	if it.Offset() != 2*uint64(len(chunk)) {
+		t.Errorf("offset %d, expected %d", it.Offset(), 2*len(chunk))
+	}
+}
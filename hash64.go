@@ -0,0 +1,43 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"hash"
+)
+
+// Hash64 adapts h, such as sha256.New() or crc32.NewIEEE(), to the
+// hash.Hash64 taken by Add and Contains, its Sum64 being DigestSum64 of its
+// digest, or is h itself if it already is a hash.Hash64
+func Hash64(h hash.Hash) hash.Hash64 {
+	if h64, ok := h.(hash.Hash64); ok {
+		return h64
+	}
+	return hash64{h}
+}
+
+type hash64 struct {
+	hash.Hash
+}
+
+func (h hash64) Sum64() uint64 {
+	var buf [64]byte
+	return DigestSum64(h.Sum(buf[:0]))
+}
+
+// DigestSum64 derives the 64 bits of an (already hashed) key from a digest
+// of any size, such as a SHA-1 or SHA-256 digest already at hand, to be
+// added with AddHash: it is the xor of the little-endian uint64s of the
+// digest, the last one padded with zeros. Since filters are serialized
+// along with the bits it sets, it is guaranteed to never change.
+func DigestSum64(digest []byte) (sum uint64) {
+	for len(digest) >= Uint64Bytes {
+		sum ^= binary.LittleEndian.Uint64(digest)
+		digest = digest[Uint64Bytes:]
+	}
+	if len(digest) > 0 {
+		var last [Uint64Bytes]byte
+		copy(last[:], digest)
+		sum ^= binary.LittleEndian.Uint64(last[:])
+	}
+	return sum
+}
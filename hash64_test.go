@@ -0,0 +1,45 @@
+package bloomfilter
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"testing"
+)
+
+func TestHash64(t *testing.T) {
+	// these must never change, filters built with them being serialized
+	for _, c := range []struct {
+		h    hash.Hash
+		want uint64
+	}{
+		{sha256.New(), 0xea9b2516ae5b0862},
+		{sha1.New(), 0x7bc48de75f5be3de},
+		{crc32.NewIEEE(), 0x86a61036},
+	} {
+		h := Hash64(c.h)
+		_, _ = h.Write([]byte("hello"))
+		if sum := h.Sum64(); sum != c.want {
+			t.Errorf("%T: Sum64 %#x, expected %#x", c.h, sum, c.want)
+		}
+		digest := c.h.Sum(nil)
+		if DigestSum64(digest) != c.want {
+			t.Errorf("%T: DigestSum64 differs from Sum64", c.h)
+		}
+	}
+
+	fnv64 := fnv.New64a()
+	if Hash64(fnv64) != fnv64 {
+		t.Error("hash.Hash64 is wrapped")
+	}
+
+	f, _ := New(1000, 3)
+	h := Hash64(sha256.New())
+	_, _ = h.Write([]byte("hello"))
+	f.Add(h)
+	if !f.ContainsHash(0xea9b2516ae5b0862) {
+		t.Error("adapted hash is not added")
+	}
+}
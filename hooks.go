@@ -0,0 +1,45 @@
+package bloomfilter
+
+// Hooks are called on the operations of filters created WithHooks, for
+// applications to layer sampling, tracing or secondary indexing on a filter
+// without wrapping every call site. They are called after the operation,
+// outside the lock of the filter, so that they may use it, and concurrently
+// when the filter is, so they must be safe for concurrent use and quick.
+// Any hook may be nil.
+type Hooks struct {
+	// OnAdd is called with every (hashed) element added, by Add, AddHash,
+	// AddHashes, AddKey, AddMinimizers or TestAndAdd when the element was
+	// not contained
+	OnAdd func(hash uint64)
+	// OnHit is called with every element tested and maybe contained, by
+	// Contains, ContainsHash, ContainsHashes, ContainsHashesBitmap,
+	// ContainsKey, ContainsMinimizers or TestAndAdd
+	OnHit func(hash uint64)
+	// OnMiss is called with every element tested and definitely not
+	// contained
+	OnMiss func(hash uint64)
+}
+
+// WithHooks calls hooks on the operations of the filter. They carry over to
+// the filters derived from the filter, such as by Copy.
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		o.hooks = &hooks
+	}
+}
+
+func (h *Hooks) added(hash uint64) {
+	if h.OnAdd != nil {
+		h.OnAdd(hash)
+	}
+}
+
+func (h *Hooks) probed(hash uint64, contained bool) {
+	if contained {
+		if h.OnHit != nil {
+			h.OnHit(hash)
+		}
+	} else if h.OnMiss != nil {
+		h.OnMiss(hash)
+	}
+}
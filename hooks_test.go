@@ -0,0 +1,53 @@
+package bloomfilter
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	var adds, hits, misses uint64
+	var f *Filter
+	f, _ = New(10000, 5, WithHooks(Hooks{
+		OnAdd: func(hash uint64) {
+			atomic.AddUint64(&adds, 1)
+			// outside the lock
+			_ = f.N()
+			f.lock.Lock()
+			f.lock.Unlock()
+		},
+		OnHit:  func(hash uint64) { atomic.AddUint64(&hits, 1) },
+		OnMiss: func(hash uint64) { atomic.AddUint64(&misses, 1) },
+	}))
+
+	f.AddHash(1)
+	f.AddHashes([]uint64{2, 3})
+	f.TestAndAddHash(1) // hit
+	f.TestAndAddHash(4) // miss, add
+	f.ContainsHash(2)
+	f.ContainsHash(5)
+	f.ContainsHashes([]uint64{1, 6}, nil)
+	f.ContainsHashesBitmap([]uint64{1, 2, 7}, nil)
+	if adds != 4 || hits != 5 || misses != 4 {
+		t.Fatalf("%d adds, %d hits and %d misses", adds, hits, misses)
+	}
+
+	// keys and minimizers
+	f.AddKey(f.MakeKey(9))
+	f.ContainsKey(f.MakeKey(9))
+	f.ContainsKey(f.MakeKey(10))
+	f.ContainsMinimizers([]uint64{1, 11}, 1)
+	if adds != 5 || hits != 7 || misses != 6 {
+		t.Fatalf("%d adds, %d hits and %d misses", adds, hits, misses)
+	}
+
+	// carried over to copies, and hooks may be nil
+	f2, _ := f.Copy()
+	f2.AddHash(8)
+	if adds != 6 {
+		t.Fatal("hooks not carried over to a copy")
+	}
+	f3, _ := New(1000, 3, WithHooks(Hooks{}))
+	f3.AddHash(1)
+	f3.ContainsHash(1)
+}
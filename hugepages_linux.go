@@ -0,0 +1,33 @@
+//go:build !arm && !tinygo
+// +build !arm,!tinygo
+
+package bloomfilter
+
+import "syscall"
+
+// flags selecting the size of hugetlbfs pages, see mmap(2)
+const mapHugeShift = 26
+
+// mmapHuge maps size bytes with the given extra flags, backed by huge pages
+// if hugePages is not 0
+func mmapHuge(size int, hugePages HugePageSize, flags int) (
+	mem []byte, err error,
+) {
+	if hugePages == 0 {
+		return mmapAnon(size, flags)
+	}
+	mem, err = mmapAnon(size,
+		flags|syscall.MAP_HUGETLB|int(hugePages)<<mapHugeShift)
+	if err == nil {
+		return mem, nil
+	}
+	debug("bloomfilter: no 2^%d byte huge pages reserved (err=%v),"+
+		" falling back to transparent huge pages", uint(hugePages), err)
+	mem, err = mmapAnon(size, flags)
+	if err != nil {
+		return nil, err
+	}
+	// best effort, transparent huge pages may be disabled
+	_ = syscall.Madvise(mem, syscall.MADV_HUGEPAGE)
+	return mem, nil
+}
@@ -0,0 +1,11 @@
+//go:build (darwin || dragonfly || freebsd || (linux && arm) || netbsd || openbsd) && !tinygo
+// +build darwin dragonfly freebsd linux,arm netbsd openbsd
+// +build !tinygo
+
+package bloomfilter
+
+// mmapHuge maps size bytes with the given extra flags, huge pages are not
+// supported here
+func mmapHuge(size int, hugePages HugePageSize, flags int) ([]byte, error) {
+	return mmapAnon(size, flags)
+}
@@ -0,0 +1,145 @@
+package bloomfilter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+// FileInfo describes a filter file, as found by Inspect
+type FileInfo struct {
+	// Version of the binary layout, 0 for the original, unversioned one,
+	// and 1 for the compact layout of WriteCompactTo
+	Version int
+	M, K, N uint64
+	// Scheme names the layout and index scheme of the filter, such as
+	// "classic" or "blocked", see WithBlocked and WithIndexScheme
+	Scheme string
+	Keys   []uint64
+	// SetBits is the number of bits set, and EstimatedN the number of
+	// distinct elements estimated from it
+	SetBits    uint64
+	EstimatedN float64
+	FillRatio  float64
+	// ChecksumValid is true if the SHA-384 of the content matches
+	ChecksumValid bool
+	// Size of the binary layout, decompressed
+	Size uint64
+}
+
+// Inspect a filter written by WriteTo or WriteCompactTo, such as a file,
+// streaming its bits rather than loading them, so that files larger than
+// memory can be inspected. A checksum mismatch is reported in the FileInfo
+// rather than as an error, which is returned if the filter cannot be read at
+// all.
+func Inspect(r io.Reader) (*FileInfo, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(compactMagic)); isCompact(magic) {
+		return inspectCompact(br)
+	}
+
+	rawR, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	defer rawR.Close()
+
+	h := sha512.New384()
+	tr := io.TeeReader(rawR, h)
+	header := make([]byte, 3*Uint64Bytes)
+	_, err = io.ReadFull(tr, header)
+	if err != nil {
+		return nil, err
+	}
+	k, flags, n, m, err := unmarshalBinaryHeader(bytes.NewReader(header))
+	if err != nil {
+		return nil, err
+	}
+	size, err := binarySize(k, (m+63)/64)
+	if err != nil {
+		return nil, err
+	}
+	info := &FileInfo{M: m, K: k, N: n, Scheme: flagNames(flags), Size: size}
+
+	err = info.inspectBody(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make([]byte, sha512.Size384)
+	_, err = io.ReadFull(rawR, expected)
+	if err != nil {
+		return nil, err
+	}
+	info.ChecksumValid = hmac.Equal(expected, h.Sum(nil))
+	return info, nil
+}
+
+// inspectCompact is Inspect of the compact layout
+func inspectCompact(r io.Reader) (*FileInfo, error) {
+	header := make([]byte, compactHeaderSize)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+	k, flags, n, m, err := unmarshalCompactHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	size, err := compactSize(k, (m+63)/64)
+	if err != nil {
+		return nil, err
+	}
+	info := &FileInfo{Version: compactVersion, M: m, K: k, N: n,
+		Scheme: flagNames(flags), Size: size}
+
+	h := sha512.New384()
+	_, _ = h.Write(header[:compactFixedSize])
+	err = info.inspectBody(io.TeeReader(r, h))
+	if err != nil {
+		return nil, err
+	}
+	info.ChecksumValid = hmac.Equal(header[compactFixedSize:], h.Sum(nil))
+	return info, nil
+}
+
+// inspectBody reads the keys and bits of info from r, counting the bits set
+func (info *FileInfo) inspectBody(r io.Reader) error {
+	k, m := info.K, info.M
+
+	// read incrementally, so that a forged k does not allocate beyond the
+	// data
+	raw, err := ioutil.ReadAll(io.LimitReader(r, int64(k*Uint64Bytes)))
+	if err != nil {
+		return err
+	}
+	if uint64(len(raw)) != k*Uint64Bytes {
+		return io.ErrUnexpectedEOF
+	}
+	info.Keys = make([]uint64, k)
+	for i := range info.Keys {
+		info.Keys[i] = binary.LittleEndian.Uint64(raw[i*Uint64Bytes:])
+	}
+
+	words := make([]uint64, wordsChunk)
+	for left := (m + 63) / 64; left > 0; {
+		chunk := words
+		if left < uint64(len(chunk)) {
+			chunk = chunk[:left]
+		}
+		err = readWords(r, chunk)
+		if err != nil {
+			return err
+		}
+		info.SetBits += countBits(chunk)
+		left -= uint64(len(chunk))
+	}
+	info.EstimatedN = estimateN(info.SetBits, m, k)
+	info.FillRatio = float64(info.SetBits) / float64(m)
+	return nil
+}
@@ -0,0 +1,54 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	f, _ := New(100000, 5, WithRegisterBlocked())
+	for i := uint64(0); i < 5000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	info, err := Inspect(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := f.MarshalBinary()
+	if info.M != f.M() || info.K != 5 || info.N != 5000 ||
+		info.Scheme != "register-blocked" || info.Keys[4] != f.keys[4] ||
+		info.SetBits != countBits(f.bits) || !info.ChecksumValid ||
+		info.Size != uint64(len(data)) ||
+		math.Abs(info.EstimatedN-5000) > 250 {
+		t.Fatalf("%+v", info)
+	}
+
+	// a corrupt bit
+	data[len(data)-100] ^= 1
+	buf.Reset()
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	info, err = Inspect(&buf)
+	if err != nil || info.ChecksumValid {
+		t.Fatalf("corrupt filter inspected as %+v, %v", info, err)
+	}
+
+	// truncated
+	buf.Reset()
+	w = gzip.NewWriter(&buf)
+	_, _ = w.Write(data[:100])
+	_ = w.Close()
+	if _, err = Inspect(&buf); err == nil {
+		t.Fatal("expected error for a truncated filter")
+	}
+	if _, err = Inspect(bytes.NewReader(nil)); err == nil {
+		t.Fatal("expected error for no filter")
+	}
+}
@@ -0,0 +1,66 @@
+package bloomfilter
+
+import (
+	"log"
+)
+
+// Building with -tags bloomfilterdebug checks the invariants below on every
+// operation, panicking as soon as one is violated, to catch integration
+// bugs such as filters corrupted by unsafe code, unions of incompatible
+// filters, or removals of elements never added from counting filters, which
+// would otherwise only show as odd false positive or negative rates.
+// Without the tag, the checks are compiled out.
+
+// invariant panics with the formatted message if ok is false
+func invariant(ok bool, format string, a ...interface{}) {
+	if !ok {
+		log.Panicf("bloomfilter: invariant violated: "+format, a...)
+	}
+}
+
+// checkHeader checks that the keys, m, layout and bits of c are consistent
+func (c *core) checkHeader() {
+	invariant(len(c.keys) >= KMin, "k=%d", len(c.keys))
+	invariant(c.m >= MMin, "m=%d", c.m)
+	invariant(uint64(len(c.bits)) == (c.m+63)/64,
+		"%d words for m=%d", len(c.bits), c.m)
+	invariant(validFlags(c.flags), "flags=%#x", c.flags)
+	invariant(c.flags&flagBlocked == 0 || c.m%blockBits == 0,
+		"blocked m=%d", c.m)
+	invariant(c.flags&flagRegisterBlocked == 0 ||
+		c.m%64 == 0 && len(c.masks) == maskPatterns,
+		"register-blocked m=%d with %d masks", c.m, len(c.masks))
+	invariant(c.flags&flagPowerOfTwo == 0 || c.m&(c.m-1) == 0,
+		"power of 2 m=%d", c.m)
+	if c.m%64 != 0 {
+		invariant(c.bits[len(c.bits)-1]>>(c.m%64) == 0,
+			"bits set beyond m=%d", c.m)
+	}
+}
+
+// checkProbe checks the header of c, and that the bits of hash are within it
+func (c *core) checkProbe(hash uint64) {
+	c.checkHeader()
+	for _, i := range c.locations(hash, nil) {
+		invariant(i < c.m, "location %d of %#x beyond m=%d", i, hash, c.m)
+	}
+}
+
+// checkCompatible checks that f and f2, about to be combined once
+// IsCompatible passed, are both consistent and of as many words, which
+// IsCompatible takes for granted
+func checkCompatible(f, f2 *Filter) {
+	f.checkHeader()
+	f2.checkHeader()
+	invariant(len(f.bits) == len(f2.bits),
+		"combining %d words with %d words", len(f.bits), len(f2.bits))
+}
+
+// checkUnderflow checks that the counters of the element removed from c
+// were not 0, unless the caller handles underflows with OnUnderflow: else
+// an element removed but never added goes unnoticed, and the removals of
+// others like it which share its counters cause false negatives
+func (c *CountingFilter) checkUnderflow(hash uint64) {
+	invariant(c.OnUnderflow != nil,
+		"removing %#x, which was never added", hash)
+}
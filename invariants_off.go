@@ -0,0 +1,7 @@
+//go:build !bloomfilterdebug
+// +build !bloomfilterdebug
+
+package bloomfilter
+
+// invariants are only checked when built with -tags bloomfilterdebug
+const invariants = false
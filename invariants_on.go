@@ -0,0 +1,7 @@
+//go:build bloomfilterdebug
+// +build bloomfilterdebug
+
+package bloomfilter
+
+// invariants are checked on every operation, see invariants.go
+const invariants = true
@@ -0,0 +1,37 @@
+//go:build bloomfilterdebug
+// +build bloomfilterdebug
+
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func expectPanic(t *testing.T, what string, fn func()) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected %s to panic", what)
+		}
+	}()
+	fn()
+}
+
+func TestInvariants(t *testing.T) {
+	f, _ := New(1000, 5)
+	f.bits[len(f.bits)-1] |= 1 << 63
+	expectPanic(t, "bits beyond m", func() { f.ContainsHash(1) })
+
+	f, _ = New(1000, 5)
+	f.bits = f.bits[:1]
+	expectPanic(t, "truncated bits", func() { f.AddHash(1) })
+
+	f, _ = New(1000, 5)
+	f2, _ := New(1000, 5)
+	f2.bits = f2.bits[:1]
+	expectPanic(t, "truncated filter", func() { checkCompatible(f, f2) })
+
+	c, _ := NewCountingFilter(1000, 5)
+	expectPanic(t, "counter underflow", func() { c.RemoveHash(1) })
+	c.OnUnderflow = func(uint64) {}
+	c.RemoveHash(1)
+}
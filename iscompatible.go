@@ -10,10 +10,17 @@
 //
 package bloomfilter
 
-import "unsafe"
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+)
 
+// uint64ToBool is true if x is not 0. It compiles to a flag-setting
+// instruction rather than a branch, and unlike reading the first byte of x
+// as a bool, does not depend on the byte order of the host.
 func uint64ToBool(x uint64) bool {
-	return *(*bool)(unsafe.Pointer(&x)) // #nosec
+	return x != 0
 }
 
 // returns 0 if equal, does not compare len(b0) with len(b1)
@@ -25,17 +32,90 @@ func noBranchCompareUint64s(b0, b1 []uint64) uint64 {
 	return r
 }
 
-// IsCompatible is true if f and f2 can be Union()ed together
-func (f *Filter) IsCompatible(f2 *Filter) bool {
+// IsCompatible returns nil if f and f2 can be combined, by Union() and
+// the like, or else an *IncompatibleError naming the first parameter which
+// differs, in the order m, k, keys, layout, index scheme and range reduction
+func (f *Filter) IsCompatible(f2 *Filter) error {
 	f.lock.RLock()
 	defer f.lock.RUnlock()
 
 	f2.lock.RLock()
 	defer f2.lock.RUnlock()
 
-	// 0 is true, non-0 is false
-	compat := f.M() ^ f2.M()
-	compat |= f.K() ^ f2.K()
-	compat |= noBranchCompareUint64s(f.keys, f2.keys)
-	return uint64ToBool(^compat)
+	return f.core.isCompatible(&f2.core)
+}
+
+func (c *core) isCompatible(c2 *core) error {
+	switch {
+	case c.m != c2.m:
+		return &IncompatibleError{Param: "m",
+			Value: fmt.Sprint(c.m), Other: fmt.Sprint(c2.m)}
+	case len(c.keys) != len(c2.keys):
+		return &IncompatibleError{Param: "k",
+			Value: fmt.Sprint(len(c.keys)), Other: fmt.Sprint(len(c2.keys))}
+	case noBranchCompareUint64s(c.keys, c2.keys) != 0:
+		// the keys are not disclosed
+		return &IncompatibleError{Param: "keys"}
+	}
+	for _, group := range []struct {
+		param string
+		flags uint32
+		none  string
+	}{
+		{"layout", layoutFlags, "unblocked"},
+		{"index scheme", schemeFlags, "seeded indexes"},
+		{"range reduction", rangeFlags, "modulo"},
+	} {
+		flags, flags2 := c.flags&group.flags, c2.flags&group.flags
+		if flags == flags2 {
+			continue
+		}
+		e := &IncompatibleError{Param: group.param,
+			Value: group.none, Other: group.none}
+		if flags != 0 {
+			e.Value = flagNames(flags)
+		}
+		if flags2 != 0 {
+			e.Other = flagNames(flags2)
+		}
+		return e
+	}
+	return nil
+}
+
+// IncompatibleError explains why two filters cannot be combined
+type IncompatibleError struct {
+	// Param which differs: "m", "k", "keys", "layout", "index scheme" or
+	// "range reduction"
+	Param string
+	// Value of Param in each filter, empty for the keys, which are private
+	Value, Other string
+}
+
+func (e *IncompatibleError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf(
+			"Incompatible Bloom filters: different %s", e.Param)
+	}
+	return fmt.Sprintf(
+		"Incompatible Bloom filters: %s is %s in one and %s in the other",
+		e.Param, e.Value, e.Other)
+}
+
+// CompatibilityHash is equal for filters which are compatible, and almost
+// certainly different otherwise, so that filters held by different processes
+// can be checked for compatibility without exchanging their keys
+func (f *Filter) CompatibilityHash() uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.compatibilityHash()
+}
+
+func (c *core) compatibilityHash() uint64 {
+	h := fnv.New64a()
+	_ = binary.Write(h, binary.LittleEndian, c.m)
+	_ = binary.Write(h, binary.LittleEndian, c.flags)
+	_ = binary.Write(h, binary.LittleEndian, c.keys)
+	return h.Sum64()
 }
@@ -0,0 +1,52 @@
+package bloomfilter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsCompatible(t *testing.T) {
+	f, _ := New(10048, 5)
+	f2, _ := f.NewCompatible()
+	if err := f.IsCompatible(f2); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.IsCompatible(f); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([]uint64, 5)
+	for i := range keys {
+		keys[i] = uint64(i + 1)
+	}
+	f, _ = NewWithKeys(10048, keys)
+	for _, c := range []struct {
+		opts         []Option
+		m            uint64
+		keys         []uint64
+		param        string
+		value, other string
+	}{
+		{nil, 20000, keys, "m", "10048", "20000"},
+		{nil, 10048, keys[:4], "k", "5", "4"},
+		{nil, 10048, []uint64{1, 2, 3, 4, 6}, "keys", "", ""},
+		{[]Option{WithRegisterBlocked()}, 10048, keys, "layout",
+			"unblocked", "register-blocked"},
+		{[]Option{WithIndexScheme(DoubleHashing)}, 10048, keys,
+			"index scheme", "seeded indexes", "double hashing"},
+		{[]Option{WithFastRange()}, 10048, keys,
+			"range reduction", "modulo", "fast range"},
+	} {
+		f2, _ := NewWithKeys(c.m, c.keys, c.opts...)
+		err := f.IsCompatible(f2)
+		var e *IncompatibleError
+		if !errors.As(err, &e) || e.Param != c.param ||
+			e.Value != c.value || e.Other != c.other {
+			t.Fatalf("%s: %#v", c.param, err)
+		}
+		if err2 := f.UnionInPlace(f2); err2 == nil ||
+			err2.Error() != err.Error() {
+			t.Fatalf("%s: union returned %v", c.param, err2)
+		}
+	}
+}
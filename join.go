@@ -0,0 +1,64 @@
+package bloomfilter
+
+// NewJoinFilter of the (already hashed) join keys of the build side of a
+// join, sized for them with a false positive probability of p, to drop the
+// rows of the probe side which cannot match before they are shuffled or
+// looked up in the hash table: a Bloom join. Duplicate keys count towards
+// the size, so that the build side can be passed as it is.
+func NewJoinFilter(buildHashes []uint64, p float64, opts ...Option) (
+	*Filter, error,
+) {
+	maxN := uint64(len(buildHashes))
+	if maxN == 0 {
+		maxN = 1
+	}
+	f, err := NewOptimal(maxN, p, opts...)
+	if err != nil {
+		return nil, err
+	}
+	f.AddHashes(buildHashes)
+	return f, nil
+}
+
+// ContainsHashesBitmap probes f with a batch of (already hashed) keys of
+// the probe side of a join, such as a column of a batch of rows, and
+// returns the selection bitmap of the rows which may match: bit j%64 of
+// word j/64 is set if f maybe contains hashes[j]. The bitmap is stored in
+// selection, which is grown if too small, and the number of rows selected
+// is returned with it. Keys are probed as by ContainsHashes, one bitmap
+// word at a time.
+func (f *Filter) ContainsHashesBitmap(hashes []uint64, selection []uint64) (
+	[]uint64, int,
+) {
+	words := (len(hashes) + 63) / 64
+	if cap(selection) < words {
+		selection = make([]uint64, words)
+	}
+	selection = selection[:words]
+
+	f.lock.RLock()
+	var results [64]bool
+	selected := 0
+	for w := range selection {
+		batch := hashes[w*64:]
+		if len(batch) > 64 {
+			batch = batch[:64]
+		}
+		f.containsHashes(batch, results[:len(batch)])
+		word := uint64(0)
+		for j, ok := range results[:len(batch)] {
+			if ok {
+				word |= 1 << uint(j)
+				selected++
+			}
+		}
+		selection[w] = word
+	}
+	f.lock.RUnlock()
+	if f.opts.hooks != nil {
+		for j, hash := range hashes {
+			f.opts.hooks.probed(hash, selection[j/64]>>uint(j%64)&1 == 1)
+		}
+	}
+	return selection, selected
+}
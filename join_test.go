@@ -0,0 +1,47 @@
+package bloomfilter
+
+import "testing"
+
+func TestJoin(t *testing.T) {
+	build := make([]uint64, 1000)
+	for i := range build {
+		build[i] = uint64(i) * 0x9e3779b97f4a7c15
+	}
+	f, err := NewJoinFilter(build, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range [][]Option{nil, {WithBlocked()}} {
+		f2, _ := NewJoinFilter(build, 0.01, opts...)
+		// every other row of the probe side matches, in a batch which does
+		// not fill its last word
+		probe := make([]uint64, 1000)
+		for i := range probe {
+			probe[i] = uint64(i/2+(i%2)*5000) * 0x9e3779b97f4a7c15
+		}
+		selection, selected := f2.ContainsHashesBitmap(probe, nil)
+		if len(selection) != 16 || selection[15]>>(1000%64) != 0 {
+			t.Fatalf("bitmap of %d words", len(selection))
+		}
+		results := f2.ContainsHashes(probe, nil)
+		count := 0
+		for j, ok := range results {
+			if selection[j/64]>>uint(j%64)&1 == 1 != ok {
+				t.Fatalf("row %d selected differently", j)
+			}
+			if ok {
+				count++
+			}
+			if j%2 == 0 && !ok {
+				t.Fatalf("matching row %d not selected", j)
+			}
+		}
+		if count != selected || selected < 500 || selected > 530 {
+			t.Fatalf("%d rows selected, counted %d", selected, count)
+		}
+	}
+	selection, selected := f.ContainsHashesBitmap(nil, nil)
+	if len(selection) != 0 || selected != 0 {
+		t.Fatal("empty batch selected rows")
+	}
+}
@@ -0,0 +1,61 @@
+package bloomfilter
+
+import (
+	"os"
+
+	"github.com/steakknife/hamming"
+)
+
+// portableVar forces the portable kernels when set, to rule out the
+// optimized ones when debugging
+const portableVar = "GOLANG_STEAKKNIFE_BLOOMFILTER_PORTABLE"
+
+// kernelSet holds the bulk operations over whole bit arrays, which have
+// faster implementations on some CPUs. The probes of Add and Contains
+// have none, their loops costing little next to the cache misses and the
+// locking around them, see the README.
+//
+// Only AVX2 kernels exist, for or and popcount, on amd64. There are no
+// AVX-512 or NEON kernels, nor kernels for the probes: other CPUs use the
+// portable loops.
+type kernelSet struct {
+	name     string
+	or       func(dst, src []uint64) // dst[i] |= src[i]
+	popcount func(words []uint64) uint64
+}
+
+var portableKernels = kernelSet{
+	name:     "portable",
+	or:       orWords,
+	popcount: popcountWords,
+}
+
+// kernels selected at startup for this CPU
+var kernels = selectKernels()
+
+func selectKernels() kernelSet {
+	if os.Getenv(portableVar) != "" {
+		return portableKernels
+	}
+	return cpuKernels()
+}
+
+// Kernels is the name of the implementation of the bulk operations selected
+// for this CPU, such as "avx2" or "portable"
+func Kernels() string {
+	return kernels.name
+}
+
+func orWords(dst, src []uint64) {
+	dst = dst[:len(src)]
+	for i, word := range src {
+		dst[i] |= word
+	}
+}
+
+func popcountWords(words []uint64) (n uint64) {
+	for _, word := range words {
+		n += uint64(hamming.CountBitsUint64(word))
+	}
+	return n
+}
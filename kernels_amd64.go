@@ -0,0 +1,65 @@
+//go:build amd64 && !purego && !tinygo
+// +build amd64,!purego,!tinygo
+
+package bloomfilter
+
+var avx2Kernels = kernelSet{
+	name:     "avx2",
+	or:       orWordsAVX2,
+	popcount: popcountWordsAVX2,
+}
+
+func cpuKernels() kernelSet {
+	if hasAVX2() {
+		return avx2Kernels
+	}
+	return portableKernels
+}
+
+// hasAVX2 reports whether the CPU supports AVX2 and POPCNT, and the OS
+// saves the YMM registers across context switches
+func hasAVX2() bool {
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 7 {
+		return false
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	const (
+		popcnt  = 1 << 23
+		osxsave = 1 << 27
+		avx     = 1 << 28
+	)
+	if ecx1&(popcnt|osxsave|avx) != popcnt|osxsave|avx {
+		return false
+	}
+	if xcr0 := xgetbv(); xcr0&6 != 6 { // XMM and YMM state
+		return false
+	}
+	_, ebx7, _, _ := cpuid(7, 0)
+	return ebx7&(1<<5) != 0
+}
+
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+func xgetbv() (eax uint32)
+
+//go:noescape
+func orAVX2(dst, src *uint64, n int)
+
+//go:noescape
+func popcountAVX2(words *uint64, n int) uint64
+
+func orWordsAVX2(dst, src []uint64) {
+	if len(src) == 0 {
+		return
+	}
+	_ = dst[len(src)-1]
+	orAVX2(&dst[0], &src[0], len(src))
+}
+
+func popcountWordsAVX2(words []uint64) uint64 {
+	if len(words) == 0 {
+		return 0
+	}
+	return popcountAVX2(&words[0], len(words))
+}
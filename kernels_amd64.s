@@ -0,0 +1,133 @@
+//go:build amd64 && !purego && !tinygo
+// +build amd64,!purego,!tinygo
+
+#include "textflag.h"
+
+// popcounts of the nibbles 0 to 15, twice
+DATA nibbles<>+0(SB)/8, $0x0302020102010100
+DATA nibbles<>+8(SB)/8, $0x0403030203020201
+DATA nibbles<>+16(SB)/8, $0x0302020102010100
+DATA nibbles<>+24(SB)/8, $0x0403030203020201
+GLOBL nibbles<>(SB), RODATA|NOPTR, $32
+
+DATA lowNibbles<>+0(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA lowNibbles<>+8(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA lowNibbles<>+16(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA lowNibbles<>+24(SB)/8, $0x0f0f0f0f0f0f0f0f
+GLOBL lowNibbles<>(SB), RODATA|NOPTR, $32
+
+// func orAVX2(dst, src *uint64, n int)
+TEXT ·orAVX2(SB), NOSPLIT, $0-24
+	MOVQ dst+0(FP), DI
+	MOVQ src+8(FP), SI
+	MOVQ n+16(FP), CX
+
+loop16:
+	CMPQ    CX, $16
+	JL      tail
+	VMOVDQU (DI), Y0
+	VMOVDQU 32(DI), Y1
+	VMOVDQU 64(DI), Y2
+	VMOVDQU 96(DI), Y3
+	VPOR    (SI), Y0, Y0
+	VPOR    32(SI), Y1, Y1
+	VPOR    64(SI), Y2, Y2
+	VPOR    96(SI), Y3, Y3
+	VMOVDQU Y0, (DI)
+	VMOVDQU Y1, 32(DI)
+	VMOVDQU Y2, 64(DI)
+	VMOVDQU Y3, 96(DI)
+	ADDQ    $128, DI
+	ADDQ    $128, SI
+	SUBQ    $16, CX
+	JMP     loop16
+
+tail:
+	TESTQ CX, CX
+	JE    done
+	MOVQ  (SI), AX
+	ORQ   AX, (DI)
+	ADDQ  $8, DI
+	ADDQ  $8, SI
+	DECQ  CX
+	JMP   tail
+
+done:
+	VZEROUPPER
+	RET
+
+// func popcountAVX2(words *uint64, n int) uint64
+//
+// Counts the bits of each nibble by looking them up in a table with
+// VPSHUFB, then sums the bytes of each word with VPSADBW (W. Muła).
+TEXT ·popcountAVX2(SB), NOSPLIT, $0-24
+	MOVQ    words+0(FP), SI
+	MOVQ    n+8(FP), CX
+	VMOVDQU nibbles<>(SB), Y14
+	VMOVDQU lowNibbles<>(SB), Y15
+	VPXOR   Y13, Y13, Y13 // zero
+	VPXOR   Y12, Y12, Y12 // sums of the 4 lanes
+	XORQ    AX, AX
+
+loop8:
+	CMPQ    CX, $8
+	JL      reduce
+	VMOVDQU (SI), Y0
+	VMOVDQU 32(SI), Y2
+	VPSRLW  $4, Y0, Y1
+	VPSRLW  $4, Y2, Y3
+	VPAND   Y15, Y0, Y0
+	VPAND   Y15, Y1, Y1
+	VPAND   Y15, Y2, Y2
+	VPAND   Y15, Y3, Y3
+	VPSHUFB Y0, Y14, Y0
+	VPSHUFB Y1, Y14, Y1
+	VPSHUFB Y2, Y14, Y2
+	VPSHUFB Y3, Y14, Y3
+	VPADDB  Y0, Y1, Y0
+	VPADDB  Y2, Y3, Y2
+	VPADDB  Y0, Y2, Y0
+	VPSADBW Y13, Y0, Y0
+	VPADDQ  Y0, Y12, Y12
+	ADDQ    $64, SI
+	SUBQ    $8, CX
+	JMP     loop8
+
+reduce:
+	VEXTRACTI128 $1, Y12, X1
+	VPADDQ       X1, X12, X12
+	MOVQ         X12, AX
+	VPEXTRQ      $1, X12, BX
+	ADDQ         BX, AX
+
+tail:
+	TESTQ   CX, CX
+	JE      done
+	POPCNTQ (SI), BX
+	ADDQ    BX, AX
+	ADDQ    $8, SI
+	DECQ    CX
+	JMP     tail
+
+done:
+	VZEROUPPER
+	MOVQ AX, ret+16(FP)
+	RET
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-4
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	RET
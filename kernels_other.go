@@ -0,0 +1,8 @@
+//go:build !amd64 || purego || tinygo
+// +build !amd64 purego tinygo
+
+package bloomfilter
+
+func cpuKernels() kernelSet {
+	return portableKernels
+}
@@ -0,0 +1,84 @@
+package bloomfilter
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func randomWords(rng *rand.Rand, n int) []uint64 {
+	words := make([]uint64, n)
+	for i := range words {
+		words[i] = rng.Uint64()
+	}
+	return words
+}
+
+func TestKernels(t *testing.T) {
+	t.Logf("kernels: %s", Kernels())
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 300; n++ {
+		src := randomWords(rng, n)
+		dst := randomWords(rng, n+1) // longer than src
+		want := append([]uint64(nil), dst...)
+		portableKernels.or(want, src)
+		kernels.or(dst, src)
+		for i := range want {
+			if dst[i] != want[i] {
+				t.Fatalf("or of %d words: word %d is %#x, expected %#x",
+					n, i, dst[i], want[i])
+			}
+		}
+
+		if got, want := kernels.popcount(src), portableKernels.popcount(src); got != want {
+			t.Fatalf("popcount of %d words: %d, expected %d", n, got, want)
+		}
+	}
+	all := make([]uint64, 1001)
+	for i := range all {
+		all[i] = ^uint64(0)
+	}
+	if got := kernels.popcount(all); got != 64*1001 {
+		t.Errorf("popcount of all ones: %d, expected %d", got, 64*1001)
+	}
+}
+
+func TestPortableOverride(t *testing.T) {
+	old, set := os.LookupEnv(portableVar)
+	defer func() {
+		if set {
+			os.Setenv(portableVar, old)
+		} else {
+			os.Unsetenv(portableVar)
+		}
+	}()
+	os.Setenv(portableVar, "1")
+	if got := selectKernels(); got.name != portableKernels.name {
+		t.Errorf("%s=1 selected %q kernels", portableVar, got.name)
+	}
+}
+
+func benchmarkKernels(b *testing.B, set kernelSet) {
+	rng := rand.New(rand.NewSource(1))
+	src, dst := randomWords(rng, 1<<16), randomWords(rng, 1<<16)
+	b.Run("or", func(b *testing.B) {
+		b.SetBytes(int64(len(src) * Uint64Bytes))
+		for i := 0; i < b.N; i++ {
+			set.or(dst, src)
+		}
+	})
+	b.Run("popcount", func(b *testing.B) {
+		b.SetBytes(int64(len(src) * Uint64Bytes))
+		for i := 0; i < b.N; i++ {
+			set.popcount(src)
+		}
+	})
+}
+
+func BenchmarkKernelsPortable(b *testing.B) {
+	benchmarkKernels(b, portableKernels)
+}
+
+func BenchmarkKernelsSelected(b *testing.B) {
+	benchmarkKernels(b, kernels)
+}
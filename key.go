@@ -0,0 +1,81 @@
+package bloomfilter
+
+import "math/bits"
+
+// Key is an element whose bits have been located once, by MakeKey, to be
+// added to or tested against any number of compatible filters, such as the
+// shards or generations of a larger structure, without locating them again
+type Key struct {
+	hash  uint64   // the element, for hooks
+	words []uint64 // indexes of the words holding the bits of the element
+	masks []uint64 // bits of the element in each of those words
+
+	// m, flags and first key of the filter which made the Key, to reject
+	// filters it is not meant for (the zero Key is meant for none)
+	m     uint64
+	flags uint32
+	seed  uint64
+}
+
+// MakeKey locates the bits of the (already hashed) key in f and in any
+// filter compatible with f. Filters of another m, layout or first key reject
+// the Key, other incompatible filters give meaningless results.
+func (f *Filter) MakeKey(hash uint64) Key {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	words, masks := f.wordMasks(hash, make([]uint64, 0, len(f.keys)),
+		make([]uint64, 0, len(f.keys)))
+	return Key{hash: hash, words: words, masks: masks,
+		m: f.m, flags: f.flags, seed: f.keys[0]}
+}
+
+// madeFor is true if key was made by a filter with the m, flags and first
+// key of c. c must be locked.
+func (key *Key) madeFor(c *core) bool {
+	return key.m != 0 && key.m == c.m && key.flags == c.flags &&
+		key.seed == c.keys[0]
+}
+
+// AddKey adds the element of key to f, see MakeKey, unless key was made by
+// a filter f rejects
+func (f *Filter) AddKey(key Key) error {
+	f.lock.Lock()
+	if !key.madeFor(&f.core) {
+		f.lock.Unlock()
+		return errKeyFilter(key.m, f.m)
+	}
+	f.gen++
+	var added uint64
+	for j, w := range key.words {
+		if f.alarms != nil {
+			added += uint64(bits.OnesCount64(key.masks[j] &^ f.bits[w]))
+		}
+		f.bits[w] |= key.masks[j]
+	}
+	f.n++
+	if f.alarms != nil {
+		f.alarms.setBits += added
+		f.checkAlarms()
+	}
+	f.lock.Unlock()
+	if f.opts.hooks != nil {
+		f.opts.hooks.added(key.hash)
+	}
+	return nil
+}
+
+// ContainsKey tests if f contains the element of key, see MakeKey. It does
+// not if key was made by a filter f rejects.
+func (f *Filter) ContainsKey(key Key) bool {
+	f.lock.RLock()
+	contained := key.madeFor(&f.core)
+	for j := 0; contained && j < len(key.words); j++ {
+		contained = f.bits[key.words[j]]&key.masks[j] == key.masks[j]
+	}
+	f.lock.RUnlock()
+	if f.opts.hooks != nil {
+		f.opts.hooks.probed(key.hash, contained)
+	}
+	return contained
+}
@@ -0,0 +1,81 @@
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBlocked()}, {WithRegisterBlocked()}} {
+		template, _ := New(100000, 5, opts...)
+		shards := make([]*Filter, 8)
+		for s := range shards {
+			shards[s], _ = template.NewCompatible()
+		}
+		for i := uint64(0); i < 1000; i++ {
+			key := template.MakeKey(i)
+			shards[i%8].AddKey(key)
+			if !shards[i%8].ContainsHash(i) {
+				t.Fatalf("shard does not contain %d", i)
+			}
+		}
+		fp := 0
+		for i := uint64(0); i < 1000; i++ {
+			key := template.MakeKey(i)
+			for s, shard := range shards {
+				contained := shard.ContainsKey(key)
+				if uint64(s) == i%8 && !contained {
+					t.Fatalf("shard does not contain key %d", i)
+				}
+				if contained != shard.ContainsHash(i) {
+					t.Fatalf("ContainsKey and ContainsHash disagree on %d", i)
+				}
+				if uint64(s) != i%8 && contained {
+					fp++
+				}
+			}
+		}
+		if fp > 100 {
+			t.Fatalf("%d false positives", fp)
+		}
+	}
+}
+
+func TestKeyRejected(t *testing.T) {
+	small, _ := New(1000, 5)
+	large, _ := New(100000, 5)
+	key := large.MakeKey(1)
+	if small.ContainsKey(key) {
+		t.Error("contains a key of a larger filter")
+	}
+	if err := small.AddKey(key); err == nil {
+		t.Error("expected error adding a key of a larger filter")
+	}
+	other, _ := New(100000, 5) // other keys
+	if err := other.AddKey(key); err == nil || other.ContainsKey(key) {
+		t.Error("accepted a key of a filter with other keys")
+	}
+	if small.ContainsKey(Key{}) || small.AddKey(Key{}) == nil {
+		t.Error("accepted the zero Key")
+	}
+	if small.N() != 0 || other.N() != 0 {
+		t.Error("rejected keys were added")
+	}
+	if err := large.AddKey(key); err != nil || !large.ContainsKey(key) {
+		t.Error("rejected the key of its maker")
+	}
+}
+
+func BenchmarkContainsKeyX16(b *testing.B) {
+	template, _ := New(1<<20, 10)
+	shards := make([]*Filter, 16)
+	for s := range shards {
+		shards[s], _ = template.NewCompatible()
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := template.MakeKey(uint64(i))
+		for _, shard := range shards {
+			shard.ContainsKey(key)
+		}
+	}
+}
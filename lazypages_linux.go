@@ -0,0 +1,15 @@
+//go:build !tinygo
+// +build !tinygo
+
+package bloomfilter
+
+import "syscall"
+
+// mapNoReserve maps memory without reserving swap space for it
+const mapNoReserve = syscall.MAP_NORESERVE
+
+// dropPages returns the pages of mem to the kernel, which reads them back as
+// zeros, see WithLazyPages
+func dropPages(mem []byte) bool {
+	return syscall.Madvise(mem, syscall.MADV_DONTNEED) == nil
+}
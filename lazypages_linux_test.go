@@ -0,0 +1,53 @@
+//go:build !tinygo
+// +build !tinygo
+
+package bloomfilter
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// residentBytes of the test process
+func residentBytes(t *testing.T) uint64 {
+	statm, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		t.Skip(err)
+	}
+	pages, _ := strconv.ParseUint(strings.Fields(string(statm))[1], 10, 64)
+	return pages * 4096
+}
+
+func TestLazyPages(t *testing.T) {
+	if maxInt < 1<<32 {
+		t.Skip("needs a 64-bit address space")
+	}
+	before := residentBytes(t)
+	// 8 GiB of bits
+	f, err := New(1<<36, 3, WithLazyPages())
+	if err != nil {
+		t.Skip(err)
+	}
+	defer f.Close()
+
+	for i := uint64(0); i < 1000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	for i := uint64(0); i < 1000; i++ {
+		if !f.ContainsHash(i * 0x9e3779b97f4a7c15) {
+			t.Fatalf("does not contain %d", i)
+		}
+	}
+	// at most 3000 pages of 4 KiB were touched, while the runtime may have
+	// released others since
+	if after := residentBytes(t); after > before+64<<20 {
+		t.Fatalf("resident memory grew by %d bytes", after-before)
+	}
+
+	f.Reset()
+	if f.N() != 0 || f.ContainsHash(0) || f.ContainsHash(0x9e3779b97f4a7c15) {
+		t.Fatal("Reset did not empty the filter")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build (darwin || dragonfly || freebsd || netbsd || openbsd) && !tinygo
+// +build darwin dragonfly freebsd netbsd openbsd
+// +build !tinygo
+
+package bloomfilter
+
+// mapNoReserve is only supported on Linux
+const mapNoReserve = 0
+
+// dropPages is only supported on Linux, where dropped pages of private
+// mappings are guaranteed to read back as zeros
+func dropPages(mem []byte) bool {
+	return false
+}
@@ -0,0 +1,95 @@
+package bloomfilter
+
+import "math"
+
+// Predictor scores how likely an already hashed item is to be in the set,
+// from 0 to 1, such as a model trained on the keys and on items seen
+// outside of them
+type Predictor func(hash uint64) float64
+
+// LearnedFilter is a learned Bloom filter (Kraska et al., "The Case for
+// Learned Index Structures"): items which the model scores at or above a
+// threshold are reported as contained, and a backup Bloom filter holds the
+// keys it scores below, so that there are no false negatives. A good model
+// makes the backup filter much smaller than a filter of all the keys.
+//
+// Its false positive rate is that of the model on items outside of the set,
+// plus that of the backup filter on the items the model rejects.
+type LearnedFilter struct {
+	predict   Predictor
+	threshold float64
+	modelFP   float64
+	backup    *Filter
+}
+
+// NewLearnedFilter of the already hashed keys, scored by predict against
+// threshold. negatives is a sample of items outside of the set, to measure
+// the false positive rate of the model, and backupFP the false positive
+// probability of the backup filter, created with opts.
+func NewLearnedFilter(predict Predictor, threshold float64,
+	keys, negatives []uint64, backupFP float64, opts ...Option,
+) (*LearnedFilter, error) {
+	if len(negatives) == 0 {
+		return nil, errNoNegatives()
+	}
+	var missed []uint64
+	for _, key := range keys {
+		if predict(key) < threshold {
+			missed = append(missed, key)
+		}
+	}
+	var falsePositives int
+	for _, hash := range negatives {
+		if predict(hash) >= threshold {
+			falsePositives++
+		}
+	}
+	maxN := uint64(len(missed))
+	if maxN == 0 {
+		maxN = 1
+	}
+	backup, err := NewOptimal(maxN, backupFP, opts...)
+	if err != nil {
+		return nil, err
+	}
+	backup.AddHashes(missed)
+	return &LearnedFilter{
+		predict:   predict,
+		threshold: threshold,
+		modelFP:   float64(falsePositives) / float64(len(negatives)),
+		backup:    backup,
+	}, nil
+}
+
+// AddHash adds an already hashed key, to the backup filter if the model
+// scores it below the threshold
+func (l *LearnedFilter) AddHash(hash uint64) {
+	if l.predict(hash) < l.threshold {
+		l.backup.AddHash(hash)
+	}
+}
+
+// ContainsHash tests if the already hashed item is (maybe) in the set
+func (l *LearnedFilter) ContainsHash(hash uint64) bool {
+	return l.predict(hash) >= l.threshold || l.backup.ContainsHash(hash)
+}
+
+// Backup is the backup filter, holding the keys the model misses
+func (l *LearnedFilter) Backup() *Filter {
+	return l.backup
+}
+
+// ModelFP is the false positive rate of the model alone, measured on the
+// sample of negatives
+func (l *LearnedFilter) ModelFP() float64 {
+	return l.modelFP
+}
+
+// FalsePositiveRate is the expected false positive rate of l: items
+// outside of the set are reported as contained by the model, or else by the
+// backup filter, with the probability that all k of their bits are set.
+// There are no false negatives.
+func (l *LearnedFilter) FalsePositiveRate() float64 {
+	backupFP := math.Pow(l.backup.PreciseFilledRatio(), float64(l.backup.K()))
+	return l.modelFP + (1-l.modelFP)*backupFP
+}
@@ -0,0 +1,60 @@
+package bloomfilter
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestLearnedFilter(t *testing.T) {
+	// keys are mostly even, and the model scores even items highly, as a
+	// model learning such a pattern would
+	rng := rand.New(rand.NewSource(1))
+	var keys, negatives []uint64
+	for i := 0; i < 10000; i++ {
+		key := rng.Uint64() &^ 1
+		if i%10 == 0 {
+			key |= 1 // missed by the model
+		}
+		keys = append(keys, key)
+		negatives = append(negatives, rng.Uint64())
+	}
+	predict := func(hash uint64) float64 {
+		if hash&1 == 0 && hash%3 == 0 {
+			return 0.9
+		}
+		return 0.1
+	}
+
+	l, err := NewLearnedFilter(predict, 0.5, keys, negatives, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if !l.ContainsHash(key) {
+			t.Fatalf("false negative %#x", key)
+		}
+	}
+	if n := l.Backup().N(); n >= uint64(len(keys)) || n < uint64(len(keys))/10 {
+		t.Errorf("backup filter holds %d keys", n)
+	}
+
+	var falsePositives int
+	for i := 0; i < 100000; i++ {
+		if l.ContainsHash(rng.Uint64()) {
+			falsePositives++
+		}
+	}
+	measured, expected := float64(falsePositives)/100000, l.FalsePositiveRate()
+	if expected < l.ModelFP() || measured > 1.2*expected || measured < 0.8*expected {
+		t.Errorf("false positive rate %g, expected %g (model %g)",
+			measured, expected, l.ModelFP())
+	}
+
+	l.AddHash(3)
+	if !l.ContainsHash(3) {
+		t.Error("added key not contained")
+	}
+	if _, err = NewLearnedFilter(predict, 0.5, keys, nil, 0.01); err == nil {
+		t.Error("created without negatives")
+	}
+}
@@ -0,0 +1,59 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Logger receives the notable events of filters created WithLogger. The
+// standard *log.Logger is one.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger reports notable events to logger, such as filters becoming
+// saturated, being folded, read, or found corrupt when unmarshaled. It
+// carries over to the filters derived from the filter, such as by Copy.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// logf to the logger of o, if any
+func (o *options) logf(format string, v ...interface{}) {
+	if o.logger != nil {
+		o.logger.Printf(format, v...)
+	}
+}
+
+// saturationFP is the false positive probability above which filters are
+// reported as saturated
+const saturationFP = 0.1
+
+// saturation is the report of f as saturated if its false positive
+// probability is above saturationFP, or "". It is only estimated each time
+// n reaches a power of 2, n having been old before the last additions. f
+// must be locked, while the report is logged once f is unlocked, as hooks
+// are called, so that the logger never holds up the filter.
+func (f *Filter) saturation(old uint64) string {
+	if bits.Len64(old) == bits.Len64(f.n) {
+		return ""
+	}
+	k := float64(len(f.keys))
+	fp := math.Pow(1-math.Exp(-k*float64(f.n)/float64(f.m)), k)
+	if fp <= saturationFP {
+		return ""
+	}
+	return fmt.Sprintf("bloomfilter: saturated filter of m=%d bits, k=%d keys:"+
+		" n=%d elements give a false positive probability of %.3f",
+		f.m, len(f.keys), f.n, fp)
+}
+
+// logSaturation logs the report of saturation, if any. f must not be locked.
+func (f *Filter) logSaturation(report string) {
+	if report != "" {
+		f.opts.logf("%s", report)
+	}
+}
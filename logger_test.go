@@ -0,0 +1,66 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var out bytes.Buffer
+	f, _ := New(10000, 5, WithLogger(log.New(&out, "", 0)))
+	for i := uint64(0); i < 1000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("unexpected log: %s", out.String())
+	}
+	for i := uint64(1000); i < 5000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	if !strings.Contains(out.String(), "saturated filter") {
+		t.Fatalf("saturation not logged: %q", out.String())
+	}
+
+	out.Reset()
+	if _, err := f.Fold(2); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "from m=10000 to m=5000") {
+		t.Fatalf("folding not logged: %q", out.String())
+	}
+
+	out.Reset()
+	data, _ := f.MarshalBinary()
+	data[100] ^= 1
+	if err := f.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected error for corrupt data")
+	}
+	if !strings.Contains(out.String(), "corrupt filter") {
+		t.Fatalf("corruption not logged: %q", out.String())
+	}
+}
+
+// loggerFunc adapts a function to Logger
+type loggerFunc func(format string, v ...interface{})
+
+func (l loggerFunc) Printf(format string, v ...interface{}) {
+	l(format, v...)
+}
+
+func TestLoggerUnlocked(t *testing.T) {
+	var f *Filter
+	logged := 0
+	f, _ = New(1000, 5, WithLogger(loggerFunc(func(string, ...interface{}) {
+		// would deadlock if the filter were still locked
+		f.AddHash(0)
+		logged++
+	})))
+	for i := uint64(1); i < 1000; i++ {
+		f.TestAndAddHash(i * 0x9e3779b97f4a7c15)
+	}
+	if logged == 0 {
+		t.Fatal("saturation not logged")
+	}
+}
@@ -0,0 +1,153 @@
+package bloomfilter
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// DefaultChunkWords is the number of words per chunk of ChunkDigests, 64 KiB
+const DefaultChunkWords = 8192
+
+// Digest is a SHA-256 digest
+type Digest [sha256.Size]byte
+
+// MerkleTree of the chunks of the bits of a filter: its leaves are the
+// digests of the chunks, and every other node is the digest of its two
+// children, up to a root which changes with any bit. Comparing the roots of
+// two filters verifies their integrity, and comparing their trees from the
+// root down finds the chunks which differ, in time proportional to their
+// number.
+type MerkleTree struct {
+	ChunkWords uint64 // number of words per chunk, the last may be short
+	// Levels of the tree, from the digests of the chunks, Levels[0], to the
+	// root, alone in the last level. A node without a sibling is carried up
+	// as it is.
+	Levels [][]Digest
+}
+
+// ChunkDigests computes the MerkleTree of the chunks of chunkWords words of
+// f, DefaultChunkWords if 0
+func (f *Filter) ChunkDigests(chunkWords uint64) *MerkleTree {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if chunkWords == 0 {
+		chunkWords = DefaultChunkWords
+	}
+	var leaves []Digest
+	for off := uint64(0); off < uint64(len(f.bits)); off += chunkWords {
+		end := uint64(len(f.bits))
+		if end-off > chunkWords {
+			end = off + chunkWords
+		}
+		leaves = append(leaves, leafDigest(f.bits[off:end]))
+	}
+	t := &MerkleTree{ChunkWords: chunkWords, Levels: [][]Digest{leaves}}
+	for level := leaves; len(level) > 1; {
+		up := make([]Digest, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				up = append(up, level[i])
+			} else {
+				up = append(up, nodeDigest(level[i], level[i+1]))
+			}
+		}
+		t.Levels = append(t.Levels, up)
+		level = up
+	}
+	return t
+}
+
+// leafDigest of the words of a chunk, prefixed by 0 so that leaves and
+// nodes cannot be confused
+func leafDigest(words []uint64) (d Digest) {
+	h := sha256.New()
+	_, _ = h.Write([]byte{0})
+	var buf [wordsChunk * Uint64Bytes]byte
+	for len(words) > 0 {
+		n := len(words)
+		if n > wordsChunk {
+			n = wordsChunk
+		}
+		for i, word := range words[:n] {
+			binary.LittleEndian.PutUint64(buf[i*Uint64Bytes:], word)
+		}
+		_, _ = h.Write(buf[:n*Uint64Bytes])
+		words = words[n:]
+	}
+	h.Sum(d[:0])
+	return d
+}
+
+// nodeDigest of two children, prefixed by 1
+func nodeDigest(left, right Digest) (d Digest) {
+	h := sha256.New()
+	_, _ = h.Write([]byte{1})
+	_, _ = h.Write(left[:])
+	_, _ = h.Write(right[:])
+	h.Sum(d[:0])
+	return d
+}
+
+// Root digest of t, or the zero Digest if t has no chunks, as for a closed
+// filter, or is malformed
+func (t *MerkleTree) Root() Digest {
+	if !t.valid() {
+		return Digest{}
+	}
+	return t.Levels[len(t.Levels)-1][0]
+}
+
+// Chunks is the number of chunks of t, or 0 if t has no chunks or is
+// malformed, like Root
+func (t *MerkleTree) Chunks() int {
+	if !t.valid() {
+		return 0
+	}
+	return len(t.Levels[0])
+}
+
+// Diff lists the chunks which differ between t and t2, the tree of a
+// compatible filter with the same chunks, descending only into the
+// subtrees whose digests differ
+func (t *MerkleTree) Diff(t2 *MerkleTree) ([]uint64, error) {
+	if !t.valid() || !t2.valid() || t.ChunkWords != t2.ChunkWords ||
+		t.Chunks() != t2.Chunks() {
+		return nil, errMerkleTrees()
+	}
+	differing := []uint64{0}
+	for l := len(t.Levels) - 1; l >= 0; l-- {
+		level, level2 := t.Levels[l], t2.Levels[l]
+		var next []uint64
+		for _, i := range differing {
+			if level[i] == level2[i] {
+				continue
+			}
+			if l == 0 {
+				next = append(next, i)
+				continue
+			}
+			// children in the level below
+			next = append(next, 2*i)
+			if 2*i+1 < uint64(len(t.Levels[l-1])) {
+				next = append(next, 2*i+1)
+			}
+		}
+		differing = next
+	}
+	return differing, nil
+}
+
+// valid is true if every level of t has half as many nodes as the level
+// below, rounded up, such as for a tree received from elsewhere
+func (t *MerkleTree) valid() bool {
+	if len(t.Levels) == 0 || len(t.Levels[0]) == 0 {
+		return false
+	}
+	for l := 1; l < len(t.Levels); l++ {
+		if len(t.Levels[l]) != (len(t.Levels[l-1])+1)/2 {
+			return false
+		}
+	}
+	return len(t.Levels[len(t.Levels)-1]) == 1
+}
@@ -0,0 +1,53 @@
+package bloomfilter
+
+import "testing"
+
+func TestChunkDigests(t *testing.T) {
+	f, _ := New(64*10000, 5)
+	for i := uint64(0); i < 20000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	f2, _ := f.Copy()
+	tree := f.ChunkDigests(1000)
+	if tree.Chunks() != 10 || len(tree.Levels) != 5 {
+		t.Fatalf("%d chunks in %d levels", tree.Chunks(), len(tree.Levels))
+	}
+	if f2.ChunkDigests(1000).Root() != tree.Root() {
+		t.Fatal("copies have different roots")
+	}
+
+	// bits in chunks 2 and 9
+	f2.bits[2500] ^= 1
+	f2.bits[9999] ^= 1 << 63
+	tree2 := f2.ChunkDigests(1000)
+	if tree2.Root() == tree.Root() {
+		t.Fatal("roots are the same after changing bits")
+	}
+	differing, err := tree.Diff(tree2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(differing) != 2 || differing[0] != 2 || differing[1] != 9 {
+		t.Fatalf("chunks %v differ, expected 2 and 9", differing)
+	}
+
+	if f.ChunkDigests(0).Chunks() != 2 {
+		t.Fatalf("%d chunks of the default size", f.ChunkDigests(0).Chunks())
+	}
+	if _, err = tree.Diff(f.ChunkDigests(0)); err == nil {
+		t.Fatal("expected error comparing trees of different chunks")
+	}
+	tree2.Levels = tree2.Levels[:2]
+	if _, err = tree.Diff(tree2); err == nil {
+		t.Fatal("expected error comparing a truncated tree")
+	}
+	if tree2.Root() != (Digest{}) {
+		t.Fatal("expected no root for a truncated tree")
+	}
+	if chunks := (&MerkleTree{}).Chunks(); chunks != 0 {
+		t.Fatalf("%d chunks in an empty tree", chunks)
+	}
+	if root := (&MerkleTree{ChunkWords: 1000}).Root(); root != (Digest{}) {
+		t.Fatal("expected no root for an empty tree")
+	}
+}
@@ -0,0 +1,166 @@
+package bloomfilter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The decorators below wrap any HashFilter, the minimal interface of an
+// approximate set, with a cross-cutting concern, so that it is not
+// reimplemented for every kind of filter. They are HashFilters themselves,
+// and can be stacked.
+
+// MetricsFilter counts the operations on a filter
+type MetricsFilter struct {
+	HashFilter
+	metrics Metrics // updated atomically
+}
+
+// Metrics of a MetricsFilter
+type Metrics struct {
+	Adds    uint64
+	Queries uint64
+	Hits    uint64 // queries of elements maybe contained
+}
+
+// NewMetricsFilter counting the operations on inner
+func NewMetricsFilter(inner HashFilter) *MetricsFilter {
+	return &MetricsFilter{HashFilter: inner}
+}
+
+// AddHash adds an already hashed item to the filter
+func (m *MetricsFilter) AddHash(hash uint64) {
+	m.HashFilter.AddHash(hash)
+	atomic.AddUint64(&m.metrics.Adds, 1)
+}
+
+// ContainsHash tests if the filter contains the (already hashed) key
+func (m *MetricsFilter) ContainsHash(hash uint64) bool {
+	contained := m.HashFilter.ContainsHash(hash)
+	atomic.AddUint64(&m.metrics.Queries, 1)
+	if contained {
+		atomic.AddUint64(&m.metrics.Hits, 1)
+	}
+	return contained
+}
+
+// Metrics so far
+func (m *MetricsFilter) Metrics() Metrics {
+	return Metrics{
+		Adds:    atomic.LoadUint64(&m.metrics.Adds),
+		Queries: atomic.LoadUint64(&m.metrics.Queries),
+		Hits:    atomic.LoadUint64(&m.metrics.Hits),
+	}
+}
+
+// LoggingFilter logs every operation on a filter, for debugging
+type LoggingFilter struct {
+	HashFilter
+	Logger Logger
+}
+
+// NewLoggingFilter logging the operations on inner to logger
+func NewLoggingFilter(inner HashFilter, logger Logger) *LoggingFilter {
+	return &LoggingFilter{HashFilter: inner, Logger: logger}
+}
+
+// AddHash adds an already hashed item to the filter
+func (l *LoggingFilter) AddHash(hash uint64) {
+	l.HashFilter.AddHash(hash)
+	l.Logger.Printf("bloomfilter: add %#016x", hash)
+}
+
+// ContainsHash tests if the filter contains the (already hashed) key
+func (l *LoggingFilter) ContainsHash(hash uint64) bool {
+	contained := l.HashFilter.ContainsHash(hash)
+	l.Logger.Printf("bloomfilter: contains %#016x: %v", hash, contained)
+	return contained
+}
+
+// RateFilter tracks the rate at which elements are added to a filter, over
+// fixed intervals, such as to see a filter filling up faster than planned
+type RateFilter struct {
+	HashFilter
+
+	lock     sync.Mutex
+	interval time.Duration
+	start    time.Time // of the current interval
+	adds     uint64    // in the current interval
+	rate     float64   // adds per second over the last complete interval
+	now      func() time.Time
+}
+
+// NewRateFilter tracking the rate of additions to inner over intervals of
+// the given duration
+func NewRateFilter(inner HashFilter, interval time.Duration) *RateFilter {
+	r := &RateFilter{HashFilter: inner, interval: interval, now: time.Now}
+	r.start = r.now()
+	return r
+}
+
+// advance to the interval of now, r must be locked
+func (r *RateFilter) advance(now time.Time) {
+	elapsed := now.Sub(r.start)
+	if elapsed < r.interval {
+		return
+	}
+	if elapsed < 2*r.interval {
+		r.rate = float64(r.adds) / r.interval.Seconds()
+	} else {
+		r.rate = 0 // nothing was added in the last complete interval
+	}
+	r.start = r.start.Add(elapsed / r.interval * r.interval)
+	r.adds = 0
+}
+
+// AddHash adds an already hashed item to the filter
+func (r *RateFilter) AddHash(hash uint64) {
+	r.HashFilter.AddHash(hash)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.advance(r.now())
+	r.adds++
+}
+
+// Rate of additions per second over the last complete interval
+func (r *RateFilter) Rate() float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.advance(r.now())
+	return r.rate
+}
+
+// ReadThroughFilter is a local filter in front of a remote one, such as a
+// client of a filter served by another process: elements are added to both,
+// and queries are answered by the remote filter only when the local one
+// does not contain the element, which is then added locally when the remote
+// filter does, to answer the next queries of it locally.
+type ReadThroughFilter struct {
+	Local, Remote HashFilter
+}
+
+// NewReadThroughFilter querying remote through local
+func NewReadThroughFilter(local, remote HashFilter) *ReadThroughFilter {
+	return &ReadThroughFilter{Local: local, Remote: remote}
+}
+
+// AddHash adds an already hashed item to both filters
+func (r *ReadThroughFilter) AddHash(hash uint64) {
+	r.Local.AddHash(hash)
+	r.Remote.AddHash(hash)
+}
+
+// ContainsHash tests if the local filter, or else the remote one, contains
+// the (already hashed) key
+func (r *ReadThroughFilter) ContainsHash(hash uint64) bool {
+	if r.Local.ContainsHash(hash) {
+		return true
+	}
+	if !r.Remote.ContainsHash(hash) {
+		return false
+	}
+	r.Local.AddHash(hash)
+	return true
+}
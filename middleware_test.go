@@ -0,0 +1,75 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	_ HashFilter = (*MetricsFilter)(nil)
+	_ HashFilter = (*LoggingFilter)(nil)
+	_ HashFilter = (*RateFilter)(nil)
+	_ HashFilter = (*ReadThroughFilter)(nil)
+)
+
+func TestMiddleware(t *testing.T) {
+	f, _ := New(10000, 5)
+	var buf bytes.Buffer
+	m := NewMetricsFilter(NewLoggingFilter(f, log.New(&buf, "", 0)))
+	m.AddHash(1)
+	m.ContainsHash(1)
+	m.ContainsHash(2)
+	if got := m.Metrics(); got != (Metrics{Adds: 1, Queries: 2, Hits: 1}) {
+		t.Fatalf("metrics %+v", got)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || lines[0] != "bloomfilter: add 0x0000000000000001" ||
+		lines[2] != "bloomfilter: contains 0x0000000000000002: false" {
+		t.Fatalf("logged %q", buf.String())
+	}
+}
+
+func TestRateFilter(t *testing.T) {
+	f, _ := New(10000, 5)
+	r := NewRateFilter(f, time.Minute)
+	now := time.Unix(1e9, 0)
+	r.now = func() time.Time { return now }
+	r.start = now
+	for i := uint64(0); i < 120; i++ {
+		r.AddHash(i)
+	}
+	if r.Rate() != 0 {
+		t.Fatal("rate before the first complete interval")
+	}
+	now = now.Add(time.Minute + time.Second)
+	r.AddHash(1000)
+	if rate := r.Rate(); rate != 2 {
+		t.Fatalf("rate %v, expected 2 per second", rate)
+	}
+	now = now.Add(time.Hour)
+	if r.Rate() != 0 {
+		t.Fatal("rate after idle intervals")
+	}
+}
+
+func TestReadThroughFilter(t *testing.T) {
+	local, _ := New(10000, 5)
+	remote, _ := New(10000, 5)
+	remote.AddHash(1)
+	r := NewReadThroughFilter(local, NewMetricsFilter(remote))
+	r.AddHash(2)
+	if !r.ContainsHash(1) || !r.ContainsHash(1) || !r.ContainsHash(2) ||
+		r.ContainsHash(3) {
+		t.Fatal("wrong answers")
+	}
+	// 1 was queried remotely once, 2 never, 3 every time
+	if m := r.Remote.(*MetricsFilter).Metrics(); m.Queries != 2 || m.Adds != 1 {
+		t.Fatalf("remote metrics %+v", m)
+	}
+	if !local.ContainsHash(1) {
+		t.Fatal("remote element not cached locally")
+	}
+}
@@ -0,0 +1,60 @@
+package bloomfilter
+
+// Minimizers appends to dst the minimizers of the hashes of the consecutive
+// k-mers of a sequence, such as ntHash values: the smallest hash of every
+// window of w consecutive k-mers, each minimizer being appended once even
+// if it is the smallest of several windows. Ties go to the leftmost k-mer.
+//
+// Consecutive windows mostly share their minimizer, so about 2/(w+1) of the
+// k-mers are kept, and two sequences sharing a stretch of at least w+k-1
+// bases share its minimizers. Adding and querying only minimizers thus
+// shrinks filters of long sequences about (w+1)/2-fold. Sequences of fewer
+// than w k-mers have the smallest of their hashes as only minimizer.
+func Minimizers(hashes []uint64, w int, dst []uint64) []uint64 {
+	if w < 1 {
+		w = 1
+	}
+	// indexes of increasing hashes, the first being the minimum of the
+	// current window
+	window := make([]int, 0, w)
+	last := -1
+	for i, hash := range hashes {
+		for len(window) > 0 && hashes[window[len(window)-1]] > hash {
+			window = window[:len(window)-1]
+		}
+		window = append(window, i)
+		if window[0] <= i-w {
+			window = window[1:]
+		}
+		if i >= w-1 && window[0] != last {
+			last = window[0]
+			dst = append(dst, hashes[last])
+		}
+	}
+	if last < 0 && len(window) > 0 {
+		dst = append(dst, hashes[window[0]])
+	}
+	return dst
+}
+
+// AddMinimizers adds the minimizers of the k-mer hashes to f, see
+// Minimizers
+func (f *Filter) AddMinimizers(hashes []uint64, w int) {
+	f.AddHashes(Minimizers(hashes, w, nil))
+}
+
+// ContainsMinimizers is the fraction of the minimizers of the k-mer hashes
+// which f may contain, see Minimizers
+func (f *Filter) ContainsMinimizers(hashes []uint64, w int) float64 {
+	minimizers := Minimizers(hashes, w, nil)
+	if len(minimizers) == 0 {
+		return 0
+	}
+	found := 0
+	for _, contained := range f.ContainsHashes(minimizers, nil) {
+		if contained {
+			found++
+		}
+	}
+	return float64(found) / float64(len(minimizers))
+}
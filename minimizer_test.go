@@ -0,0 +1,37 @@
+package bloomfilter
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMinimizers(t *testing.T) {
+	got := Minimizers([]uint64{5, 3, 7, 8, 2, 9, 9, 4}, 3, nil)
+	want := []uint64{3, 2, 4}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+	if got = Minimizers([]uint64{5, 3}, 3, nil); len(got) != 1 || got[0] != 3 {
+		t.Fatalf("expected [3] for a short sequence, got %v", got)
+	}
+
+	hashes := make([]uint64, 100000)
+	for i := range hashes {
+		hashes[i] = rand.Uint64()
+	}
+	const w = 15
+	if n := len(Minimizers(hashes, w, nil)); n > 3*len(hashes)/(w+1) {
+		t.Fatalf("kept %d minimizers of %d k-mers", n, len(hashes))
+	}
+
+	f, _ := NewOptimal(20000, 0.001)
+	f.AddMinimizers(hashes, w)
+	if fraction := f.ContainsMinimizers(hashes[5000:9000], w); fraction != 1 {
+		t.Fatalf("contains only %f of a stretch of the sequence", fraction)
+	}
+}
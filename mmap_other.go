@@ -0,0 +1,21 @@
+//go:build (!darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd) || tinygo
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd tinygo
+
+package bloomfilter
+
+// mmapWords falls back to the Go heap where memory cannot be mapped, or
+// under TinyGo, whose syscall package does not map memory everywhere
+func mmapWords(n uint64, hugePages HugePageSize, lazy bool) (
+	words []uint64, mem []byte, err error,
+) {
+	return newAlignedWords(n), nil, nil
+}
+
+func munmap(mem []byte) error {
+	return nil
+}
+
+// dropPages is never called, since there is never any mapped memory
+func dropPages(mem []byte) bool {
+	return false
+}
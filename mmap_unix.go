@@ -0,0 +1,45 @@
+//go:build (darwin || dragonfly || freebsd || linux || netbsd || openbsd) && !tinygo
+// +build darwin dragonfly freebsd linux netbsd openbsd
+// +build !tinygo
+
+package bloomfilter
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapWords maps n zeroed words outside of the Go heap, without reserving
+// swap space for them if lazy
+func mmapWords(n uint64, hugePages HugePageSize, lazy bool) (
+	words []uint64, mem []byte, err error,
+) {
+	pageSize := uint64(os.Getpagesize())
+	if hugePages != 0 {
+		pageSize = uint64(1) << hugePages
+	}
+	size := (n*Uint64Bytes + pageSize - 1) / pageSize * pageSize
+	if n > size/Uint64Bytes || size > maxInt {
+		return nil, nil, errTooLarge(n * Uint64Bytes)
+	}
+
+	flags := 0
+	if lazy {
+		flags = mapNoReserve
+	}
+	mem, err = mmapHuge(int(size), hugePages, flags)
+	if err != nil {
+		return nil, nil, err
+	}
+	return uint64sFromBytes(mem[:n*Uint64Bytes]), mem, nil
+}
+
+func mmapAnon(size int, flags int) ([]byte, error) {
+	return syscall.Mmap(-1, 0, size,
+		syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_PRIVATE|syscall.MAP_ANON|flags)
+}
+
+func munmap(mem []byte) error {
+	return syscall.Munmap(mem)
+}
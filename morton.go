@@ -0,0 +1,382 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"math/bits"
+	"sync"
+)
+
+// layout of the blocks of a MortonFilter, one cache line each
+const (
+	mortonBlockWords = cacheLineSize / Uint64Bytes
+	// fingerprints of 8 bits, in bytes 0 to 45
+	mortonSlots = 46
+	// overflow tracking bits, in bytes 46 and 47
+	mortonOTAWord  = 5
+	mortonOTAShift = 48
+	mortonOTABits  = 16
+	// fullness counters of 2 bits, in words 6 and 7
+	mortonFCAWord    = 6
+	mortonBuckets    = 64
+	mortonBucketSize = 3
+
+	mortonMaxKicks = 500
+
+	fca01 = 0x5555555555555555
+	fca10 = 0xaaaaaaaaaaaaaaaa
+)
+
+// MortonFilter is a Morton filter (Breslow and Jayasena, "Morton Filters:
+// Faster, Space-Efficient Cuckoo Filters via Biasing, Compression, and
+// Decoupled Logical Sparsity"), a compressed cuckoo filter supporting
+// removal.
+//
+// Elements are 8-bit fingerprints, stored in the first of two buckets of up
+// to 3 fingerprints, or else in the second. Each block of one cache line
+// holds 64 buckets, whose fingerprints are packed into 46 slots, a counter
+// of 2 bits per bucket, and 16 overflow bits recording which elements may
+// have been moved to their second bucket, so that most queries, positive
+// or negative, read a single cache line.
+//
+// When neither bucket has room, fingerprints are moved to their other
+// bucket, as in cuckoo hashing. An element which still finds no room is
+// kept in a small exact stash, so that AddHash never fails, but the filter
+// should be sized for the elements it will hold: its false positive
+// probability is about 1 to 2%, rising with the load factor.
+type MortonFilter struct {
+	lock    sync.RWMutex
+	blocks  []uint64
+	buckets uint64   // number of buckets, a power of 2
+	stash   []uint64 // bucket<<8 | fingerprint of the elements without room
+	n       uint64
+	rng     uint64 // state choosing the fingerprints moved
+}
+
+// NewMortonFilter with room for at least capacity elements, rounded up to
+// a power of 2 blocks of 46 slots
+func NewMortonFilter(capacity uint64) (*MortonFilter, error) {
+	if capacity/mortonSlots > maxBytes/cacheLineSize {
+		return nil, errTooLarge(capacity / mortonSlots * cacheLineSize)
+	}
+	blocks := uint64(1)
+	for blocks*mortonSlots < capacity {
+		blocks *= 2
+	}
+	return newMortonFilter(blocks)
+}
+
+func newMortonFilter(blocks uint64) (*MortonFilter, error) {
+	words := blocks * mortonBlockWords
+	if err := checkWords(words); err != nil {
+		return nil, err
+	}
+	return &MortonFilter{
+		blocks:  newAlignedWords(words),
+		buckets: blocks * mortonBuckets,
+		rng:     0x9e3779b97f4a7c15,
+	}, nil
+}
+
+// N is the number of elements added and not removed
+func (f *MortonFilter) N() uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.n
+}
+
+// LoadFactor is the fraction of fingerprint slots used
+func (f *MortonFilter) LoadFactor() float64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return float64(f.n-uint64(len(f.stash))) /
+		float64(uint64(len(f.blocks))/mortonBlockWords*mortonSlots)
+}
+
+// Stashed is the number of elements which found no room in their buckets
+func (f *MortonFilter) Stashed() int {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return len(f.stash)
+}
+
+// AddHash adds an already hashed element
+func (f *MortonFilter) AddHash(hash uint64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.n++
+	b, fp := f.bucketAndFingerprint(hash)
+	if f.insert(b, fp) {
+		return
+	}
+	f.setOverflow(b, fp)
+	b = f.alternate(b, fp)
+	for kicks := 0; kicks < mortonMaxKicks; kicks++ {
+		if f.insert(b, fp) {
+			return
+		}
+		// make room by moving out a fingerprint of the bucket or, if the
+		// bucket has room but its block does not, of the block
+		block, i := f.block(b), b%mortonBuckets
+		victim := i
+		if fullness(block, i) == 0 {
+			victim = f.random() % mortonBuckets
+			for fullness(block, victim) == 0 {
+				victim = (victim + 1) % mortonBuckets
+			}
+		}
+		vb := b - i + victim
+		start := fullnessBefore(block, victim)
+		pos := start + f.random()%fullness(block, victim)
+		vfp := fingerprintAt(block, pos)
+		removeAt(block, victim, pos)
+		f.insert(b, fp)
+		f.setOverflow(vb, vfp)
+		b, fp = f.alternate(vb, vfp), vfp
+	}
+	f.stash = append(f.stash, b<<8|fp)
+}
+
+// ContainsHash tests if the already hashed element (maybe) was added
+func (f *MortonFilter) ContainsHash(hash uint64) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	b, fp := f.bucketAndFingerprint(hash)
+	if _, ok := f.find(b, fp); ok {
+		return true
+	}
+	b2 := f.alternate(b, fp)
+	if f.overflow(b, fp) {
+		if _, ok := f.find(b2, fp); ok {
+			return true
+		}
+	}
+	return f.stashed(b, b2, fp) >= 0
+}
+
+// RemoveHash removes the already hashed element once, returning whether it
+// was contained. Removing an element which was never added may remove
+// another one, which collides with it.
+func (f *MortonFilter) RemoveHash(hash uint64) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	b, fp := f.bucketAndFingerprint(hash)
+	b2 := f.alternate(b, fp)
+	for _, bucket := range [2]uint64{b, b2} {
+		if pos, ok := f.find(bucket, fp); ok {
+			removeAt(f.block(bucket), bucket%mortonBuckets, pos)
+			f.n--
+			return true
+		}
+	}
+	if i := f.stashed(b, b2, fp); i >= 0 {
+		f.stash = append(f.stash[:i], f.stash[i+1:]...)
+		f.n--
+		return true
+	}
+	return false
+}
+
+// MarshalBinary converts f into []bytes, in the same layout as a Filter,
+// with the number of blocks followed by the stash as the keys, and the
+// blocks as the bits
+func (f *MortonFilter) MarshalBinary() (data []byte, err error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	keys := append([]uint64{uint64(len(f.blocks)) / mortonBlockWords},
+		f.stash...)
+	buf, _, err := marshalWords(keys, 0, f.n, uint64(len(f.blocks))*64,
+		f.blocks)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary converts []bytes written by MarshalBinary into f, which
+// is left unchanged if an error is returned
+func (f *MortonFilter) UnmarshalBinary(data []byte) (err error) {
+	buf := bytes.NewBuffer(data)
+	k, flags, n, m, err := unmarshalBinaryHeader(buf)
+	if err != nil {
+		return err
+	}
+	if flags != 0 {
+		return errFlags(flags)
+	}
+	words := (m + 63) / 64
+	err = checkBinarySize(k, words, uint64(len(data)))
+	if err != nil {
+		return err
+	}
+	keys, err := unmarshalBinaryKeys(buf, k)
+	if err != nil {
+		return err
+	}
+	blocks := keys[0]
+	if blocks == 0 || blocks&(blocks-1) != 0 ||
+		m != blocks*mortonBlockWords*64 {
+		return errSize()
+	}
+	f2, err := newMortonFilter(blocks)
+	if err != nil {
+		return err
+	}
+	err = readWords(buf, f2.blocks)
+	if err != nil {
+		return err
+	}
+	err = checkBinaryHash(buf, data)
+	if err != nil {
+		return err
+	}
+
+	f2.stash, f2.n = keys[1:], n
+	count := uint64(len(f2.stash))
+	for _, e := range f2.stash {
+		if e>>8 >= f2.buckets {
+			return errSize()
+		}
+	}
+	for b := uint64(0); b < f2.buckets; b += mortonBuckets {
+		used := fullnessBefore(f2.block(b), mortonBuckets)
+		if used > mortonSlots {
+			return errSize()
+		}
+		count += used
+	}
+	if count != n {
+		return errSize()
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.blocks, f.buckets, f.stash, f.n = f2.blocks, f2.buckets, f2.stash, f2.n
+	if f.rng == 0 {
+		f.rng = f2.rng
+	}
+	return nil
+}
+
+// bucketAndFingerprint of hash
+func (f *MortonFilter) bucketAndFingerprint(hash uint64) (uint64, uint64) {
+	h := mix64(hash)
+	return h & (f.buckets - 1), h >> 56
+}
+
+// alternate bucket of the fingerprint in bucket b, so that the alternate
+// of the alternate is b
+func (f *MortonFilter) alternate(b, fp uint64) uint64 {
+	return b ^ mix64(fp+1)&(f.buckets-1)
+}
+
+// block holding bucket b
+func (f *MortonFilter) block(b uint64) []uint64 {
+	i := b / mortonBuckets * mortonBlockWords
+	return f.blocks[i : i+mortonBlockWords]
+}
+
+// overflow bit of the fingerprint in bucket b, set when it may have been
+// moved to its alternate bucket
+func (f *MortonFilter) overflow(b, fp uint64) bool {
+	return f.block(b)[mortonOTAWord]>>overflowBit(b, fp)&1 != 0
+}
+
+func (f *MortonFilter) setOverflow(b, fp uint64) {
+	f.block(b)[mortonOTAWord] |= 1 << overflowBit(b, fp)
+}
+
+func overflowBit(b, fp uint64) uint64 {
+	return mortonOTAShift + mix64(b<<8|fp)%mortonOTABits
+}
+
+// insert fp into bucket b, if it has room
+func (f *MortonFilter) insert(b, fp uint64) bool {
+	block, i := f.block(b), b%mortonBuckets
+	count, used := fullness(block, i), fullnessBefore(block, mortonBuckets)
+	if count == mortonBucketSize || used == mortonSlots {
+		return false
+	}
+	pos := fullnessBefore(block, i) + count
+	for j := used; j > pos; j-- {
+		setFingerprintAt(block, j, fingerprintAt(block, j-1))
+	}
+	setFingerprintAt(block, pos, fp)
+	block[mortonFCAWord+i/32] += 1 << (i % 32 * 2)
+	return true
+}
+
+// find fp in bucket b, returning its slot
+func (f *MortonFilter) find(b, fp uint64) (uint64, bool) {
+	block, i := f.block(b), b%mortonBuckets
+	start := fullnessBefore(block, i)
+	for pos := start; pos < start+fullness(block, i); pos++ {
+		if fingerprintAt(block, pos) == fp {
+			return pos, true
+		}
+	}
+	return 0, false
+}
+
+// stashed is the index of fp, of bucket b or b2, in the stash, or -1
+func (f *MortonFilter) stashed(b, b2, fp uint64) int {
+	for i, e := range f.stash {
+		if e&0xff == fp && (e>>8 == b || e>>8 == b2) {
+			return i
+		}
+	}
+	return -1
+}
+
+// random number, of a xorshift generator
+func (f *MortonFilter) random() uint64 {
+	f.rng ^= f.rng << 13
+	f.rng ^= f.rng >> 7
+	f.rng ^= f.rng << 17
+	return f.rng
+}
+
+// removeAt removes the fingerprint at slot pos of bucket i of block
+func removeAt(block []uint64, i, pos uint64) {
+	used := fullnessBefore(block, mortonBuckets)
+	for j := pos; j+1 < used; j++ {
+		setFingerprintAt(block, j, fingerprintAt(block, j+1))
+	}
+	setFingerprintAt(block, used-1, 0)
+	block[mortonFCAWord+i/32] -= 1 << (i % 32 * 2)
+}
+
+func fingerprintAt(block []uint64, pos uint64) uint64 {
+	return block[pos/8] >> (pos % 8 * 8) & 0xff
+}
+
+func setFingerprintAt(block []uint64, pos, fp uint64) {
+	shift := pos % 8 * 8
+	block[pos/8] = block[pos/8]&^(0xff<<shift) | fp<<shift
+}
+
+// fullness of bucket i of block
+func fullness(block []uint64, i uint64) uint64 {
+	return block[mortonFCAWord+i/32] >> (i % 32 * 2) & 3
+}
+
+// fullnessBefore is the number of fingerprints of the buckets of block
+// before bucket i
+func fullnessBefore(block []uint64, i uint64) (sum uint64) {
+	for w := uint64(mortonFCAWord); i > 0; w, i = w+1, i-min64(i, 32) {
+		counters := block[w]
+		if i < 32 {
+			counters &= 1<<(i*2) - 1
+		}
+		sum += uint64(bits.OnesCount64(counters&fca01)) +
+			2*uint64(bits.OnesCount64(counters&fca10))
+	}
+	return sum
+}
+
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
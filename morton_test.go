@@ -0,0 +1,103 @@
+package bloomfilter
+
+import (
+	"math/rand"
+	"testing"
+)
+
+var _ HashFilter = (*MortonFilter)(nil)
+
+func TestMortonFilter(t *testing.T) {
+	f, err := NewMortonFilter(100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	// 90% of the slots, the filter being rounded up to a power of 2 blocks
+	slots := len(f.blocks) / mortonBlockWords * mortonSlots
+	hashes := make([]uint64, slots*9/10)
+	for i := range hashes {
+		hashes[i] = rng.Uint64()
+		f.AddHash(hashes[i])
+	}
+	for _, hash := range hashes {
+		if !f.ContainsHash(hash) {
+			t.Fatalf("false negative %#x", hash)
+		}
+	}
+	if f.N() != uint64(len(hashes)) {
+		t.Errorf("N is %d, expected %d", f.N(), len(hashes))
+	}
+	t.Logf("load factor %.3f, %d stashed", f.LoadFactor(), f.Stashed())
+
+	var falsePositives int
+	for i := 0; i < 100000; i++ {
+		if f.ContainsHash(rng.Uint64()) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 100000; rate > 0.03 {
+		t.Errorf("false positive rate %g", rate)
+	}
+
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f2 MortonFilter
+	if err = f2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range hashes[:1000] {
+		if !f2.ContainsHash(hash) {
+			t.Fatalf("false negative %#x after unmarshaling", hash)
+		}
+	}
+
+	for i, hash := range hashes {
+		if !f.RemoveHash(hash) {
+			t.Fatalf("cannot remove %#x", hash)
+		}
+		if i%1000 == 0 {
+			for _, hash := range hashes[i+1:] {
+				if !f.ContainsHash(hash) {
+					t.Fatalf("false negative %#x after removals", hash)
+				}
+			}
+		}
+	}
+	if f.N() != 0 || f.LoadFactor() != 0 {
+		t.Errorf("N %d and load factor %g after removing all", f.N(), f.LoadFactor())
+	}
+}
+
+func TestMortonFilterOverfull(t *testing.T) {
+	f, _ := NewMortonFilter(1000)
+	rng := rand.New(rand.NewSource(2))
+	hashes := make([]uint64, 1600) // more than the 1472 slots
+	for i := range hashes {
+		hashes[i] = rng.Uint64()
+		f.AddHash(hashes[i])
+	}
+	if f.Stashed() == 0 {
+		t.Error("nothing stashed beyond capacity")
+	}
+	for _, hash := range hashes {
+		if !f.ContainsHash(hash) {
+			t.Fatalf("false negative %#x", hash)
+		}
+	}
+	data, _ := f.MarshalBinary()
+	var f2 MortonFilter
+	if err := f2.UnmarshalBinary(data); err != nil || f2.Stashed() != f.Stashed() {
+		t.Fatalf("%v, %d stashed, expected %d", err, f2.Stashed(), f.Stashed())
+	}
+	for _, hash := range hashes {
+		if !f.RemoveHash(hash) {
+			t.Fatalf("cannot remove %#x", hash)
+		}
+	}
+	if f.N() != 0 || f.Stashed() != 0 {
+		t.Errorf("N %d and %d stashed after removing all", f.N(), f.Stashed())
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"log"
+	"math/bits"
+	"unsafe"
 )
 
 const (
@@ -25,13 +27,23 @@ const (
 	Uint64Bytes = 8
 )
 
+// cacheLineSize is the alignment of the bits, in bytes
+const cacheLineSize = 64
+
+const maxInt = uint64(^uint(0) >> 1)
+
 // New Filter with CSPRNG keys
 //
 // m is the size of the Bloom filter, in bits, >= 2
 //
 // k is the number of random keys, >= 1
-func New(m, k uint64) (*Filter, error) {
-	return NewWithKeys(m, newRandKeys(k))
+//
+// The keys seed the k hash functions, every index being derived from a hash
+// xored with a key, so that filters of the same elements have different
+// bits unless they share their keys, by NewCompatible or NewWithKeys. The
+// keys are serialized along with the bits.
+func New(m, k uint64, opts ...Option) (*Filter, error) {
+	return NewWithKeys(m, newRandKeys(k), opts...)
 }
 
 func newRandKeys(k uint64) []uint64 {
@@ -48,11 +60,13 @@ func newRandKeys(k uint64) []uint64 {
 
 // NewCompatible Filter compatible with f
 func (f *Filter) NewCompatible() (*Filter, error) {
-	return NewWithKeys(f.m, f.keys)
+	o := f.opts
+	o.flags = f.flags
+	return newWithOptions(f.m, f.keys, o)
 }
 
 // NewOptimal Bloom filter with random CSPRNG keys
-func NewOptimal(maxN uint64, p float64) (*Filter, error) {
+func NewOptimal(maxN uint64, p float64, opts ...Option) (*Filter, error) {
 	m := OptimalM(maxN, p)
 	k := OptimalK(m, maxN)
 	debug("New optimal bloom filter ::"+
@@ -61,7 +75,60 @@ func NewOptimal(maxN uint64, p float64) (*Filter, error) {
 		"-> recommends -> bits (m): %d (%f GiB), "+
 		"number of keys (k): %d",
 		maxN, p, m, float64(m)/(gigabitsPerGiB), k)
-	return New(m, k)
+	return New(m, k, opts...)
+}
+
+// NewStrict Bloom filter for up to maxN elements with a false positive
+// probability of at most maxFP, which is recorded as its TargetFP, so that
+// the live estimates can be checked against it. With WithMaxMemory, it
+// fails rather than exceed the memory budget.
+func NewStrict(maxN uint64, maxFP float64, opts ...Option) (*Filter, error) {
+	if maxN == 0 || !(maxFP > 0 && maxFP < 1) {
+		return nil, errTargetFP(maxN, maxFP)
+	}
+	opts = append(opts[:len(opts):len(opts)], func(o *options) {
+		o.targetFP = maxFP
+	})
+	return NewOptimal(maxN, maxFP, opts...)
+}
+
+// NewWithMemoryBudget Bloom filter for maxN elements with the most bits
+// fitting in maxBytes, and the optimal number of keys for those, returning
+// the false positive probability it achieves with maxN elements. Only the
+// bits count against the budget, as with WithMaxMemory, and budgets beyond
+// what can be allocated at once are an error.
+func NewWithMemoryBudget(maxBytes, maxN uint64, opts ...Option) (
+	f *Filter, fp float64, err error,
+) {
+	o := newOptions(opts)
+	// checked before m, which more words would overflow
+	words := maxBytes / Uint64Bytes
+	if err = checkWords(words); err != nil {
+		return nil, 0, err
+	}
+	m := words * 64
+	if o.flags&flagBlocked != 0 {
+		m = m / blockBits * blockBits
+	}
+	if o.flags&flagPowerOfTwo != 0 && m != 0 {
+		m = 1 << uint(bits.Len64(m)-1)
+	}
+	if maxN == 0 || m < MMin {
+		return nil, 0, errMemoryBudget(maxBytes, maxN)
+	}
+	k := OptimalK(m, maxN)
+	f, err = newWithOptions(m, newRandKeys(k), o)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, FalsePositiveProbability(m, k, maxN), nil
+}
+
+// TargetFP is the maximum false positive probability f was created for by
+// NewStrict, or 0. It carries over to the filters derived from f, such as by
+// Copy, but is not serialized.
+func (f *Filter) TargetFP() float64 {
+	return f.opts.targetFP
 }
 
 // UniqueKeys is true if all keys are unique
@@ -78,20 +145,108 @@ func UniqueKeys(keys []uint64) bool {
 }
 
 // NewWithKeys creates a new Filter from user-supplied origKeys
-func NewWithKeys(m uint64, origKeys []uint64) (f *Filter, err error) {
-	bits, err := newBits(m)
+func NewWithKeys(m uint64, origKeys []uint64, opts ...Option) (
+	f *Filter, err error,
+) {
+	return newWithOptions(m, origKeys, newOptions(opts))
+}
+
+// NewFromBits wraps bits computed elsewhere, such as by a batch job or in
+// another language, in a Filter of m bits and k keys, rather than
+// serializing them first. The keys the bits were computed with must be
+// given WithKeys, and the options must give the layout and index scheme
+// they were computed with, such as WithBlocked.
+//
+// bits must be the (m+63)/64 words of the filter, bit i being bit i%64 of
+// word i/64, with no bit set beyond m. The Filter uses bits rather than a
+// copy of them, so that options allocating the bits, such as WithOffHeap,
+// do not apply. As the number of elements added is not known, N is
+// estimated from the bits set.
+func NewFromBits(bits []uint64, m, k uint64, opts ...Option) (*Filter, error) {
+	o := newOptions(opts)
+	if o.keys == nil {
+		return nil, errFromBitsKeys()
+	}
+	if uint64(len(o.keys)) != k {
+		return nil, errKeysLen(k, len(o.keys))
+	}
+	err := checkHeader(k, o.flags, m)
 	if err != nil {
 		return nil, err
 	}
-	keys, err := newKeysCopy(origKeys)
+	c, err := newCore(m, o.keys, o.flags)
 	if err != nil {
 		return nil, err
 	}
+	if uint64(len(bits)) != (m+63)/64 {
+		return nil, errFromBitsWords(m, len(bits))
+	}
+	err = checkTrailingBits(bits, m)
+	if err != nil {
+		return nil, err
+	}
+	c.bits = bits
+
+	f := &Filter{core: c, opts: o}
+	setBits := countBits(bits)
+	if setBits < m {
+		f.n = uint64(estimateN(setBits, m, k) + 0.5)
+	} else {
+		f.n = maxInt
+	}
+	f.recountBits()
+	return f, nil
+}
+
+func newWithOptions(m uint64, origKeys []uint64, o options) (
+	f *Filter, err error,
+) {
+	c, err := newCore(m, origKeys, o.flags)
+	if err != nil {
+		return nil, err
+	}
+	bits, mem, err := o.newBits(c.m)
+	if err != nil {
+		return nil, err
+	}
+	c.bits = bits
 	return &Filter{
-		m:    m,
-		n:    0,
-		bits: bits,
-		keys: keys,
+		core:      c,
+		n:         0,
+		mem:       mem,
+		opts:      o,
+		allocated: o.allocator != nil,
+	}, nil
+}
+
+// newCore of m bits, rounded up as required by flags, without allocating
+// the bits
+func newCore(m uint64, origKeys []uint64, flags uint32) (c core, err error) {
+	keys, err := newKeysCopy(origKeys)
+	if err != nil {
+		return c, err
+	}
+	if flags&flagBlocked != 0 {
+		m = (m + blockBits - 1) / blockBits * blockBits
+	}
+	if flags&flagRegisterBlocked != 0 {
+		m = (m + 63) / 64 * 64
+	}
+	if flags&flagPowerOfTwo != 0 && m&(m-1) != 0 {
+		if m > 1<<63 {
+			return c, errTooLarge(m / 8)
+		}
+		m = 1 << uint(bits.Len64(m))
+	}
+	masks, err := newFlagsMasks(flags, keys)
+	if err != nil {
+		return c, err
+	}
+	return core{
+		keys:  keys,
+		m:     m,
+		flags: flags,
+		masks: masks,
 	}, nil
 }
 
@@ -99,7 +254,46 @@ func newBits(m uint64) ([]uint64, error) {
 	if m < MMin {
 		return nil, errM()
 	}
-	return make([]uint64, (m+63)/64), nil
+	words, err := wordsOf(m)
+	if err != nil {
+		return nil, err
+	}
+	return newAlignedWords(words), nil
+}
+
+// wordsOf m bits, (m+63)/64 without overflowing, if they can be addressed
+func wordsOf(m uint64) (uint64, error) {
+	words := m/64 + (m%64+63)/64
+	return words, checkWords(words)
+}
+
+// maxBytes that can be allocated at once: what an int can address, up to
+// the 2^48 bytes of the Go heap on 64-bit platforms
+var maxBytes = func() uint64 {
+	if maxInt < 1<<48 {
+		return maxInt
+	}
+	return 1 << 48
+}()
+
+// checkWords is an error if n words, allocated by newAlignedWords, cannot be
+// addressed on this platform, such as more than 2 GiB on 32-bit ones
+func checkWords(n uint64) error {
+	if n > maxBytes/Uint64Bytes-cacheLineSize {
+		return errTooLarge(n * Uint64Bytes)
+	}
+	return nil
+}
+
+// newAlignedWords allocates n zeroed words starting on a cache line boundary,
+// so that a word never straddles two lines and blocks of 8 words map to
+// exactly one line
+func newAlignedWords(n uint64) []uint64 {
+	const slack = cacheLineSize/Uint64Bytes - 1
+	words := make([]uint64, n+slack)
+	addr := uintptr(unsafe.Pointer(&words[0])) // #nosec
+	off := uint64((cacheLineSize - addr%cacheLineSize) % cacheLineSize / Uint64Bytes)
+	return words[off : off+n : off+n]
 }
 
 func newKeysBlank(k uint64) ([]uint64, error) {
@@ -121,14 +315,30 @@ func newKeysCopy(origKeys []uint64) (keys []uint64, err error) {
 	return keys, err
 }
 
-func newWithKeysAndBits(m uint64, keys []uint64, bits []uint64, n uint64) (
-	f *Filter, err error,
-) {
-	f, err = NewWithKeys(m, keys)
+func newWithKeysAndBits(m uint64, keys []uint64, bits []uint64, n uint64,
+	flags uint32) (f *Filter, err error) {
+	f, err = newWithOptions(m, keys, options{flags: flags})
 	if err != nil {
 		return nil, err
 	}
+	if f.m != m {
+		return nil, errFlags(flags)
+	}
 	copy(f.bits, bits)
 	f.n = n
 	return f, nil
 }
+
+// newFlagsMasks validates flags, returning the masks they need, if any
+func newFlagsMasks(flags uint32, keys []uint64) ([]uint64, error) {
+	if !validFlags(flags) {
+		return nil, errFlags(flags)
+	}
+	if flags&flagRegisterBlocked == 0 {
+		return nil, nil
+	}
+	if len(keys) > maskMaxK {
+		return nil, errMaskK()
+	}
+	return newMasks(keys), nil
+}
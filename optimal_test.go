@@ -1,6 +1,7 @@
 package bloomfilter
 
 import (
+	"math"
 	"testing"
 )
 
@@ -53,3 +54,69 @@ func TestOptimal(t *testing.T) {
 		}
 	}
 }
+
+func TestNewStrict(t *testing.T) {
+	f, err := NewStrict(10000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.TargetFP() != 0.01 {
+		t.Fatalf("target %f", f.TargetFP())
+	}
+	if f2, _ := f.Copy(); f2.TargetFP() != 0.01 {
+		t.Fatal("copy lost the target")
+	}
+	if f.M() != OptimalM(10000, 0.01) || f.K() != OptimalK(f.M(), 10000) {
+		t.Fatalf("m=%d k=%d are not optimal", f.M(), f.K())
+	}
+
+	if _, err = NewStrict(1e9, 0.001, WithMaxMemory(1<<30)); err == nil {
+		t.Fatal("expected error over the memory budget")
+	}
+	for _, p := range []float64{0, 1, -1, math.NaN()} {
+		if _, err = NewStrict(1000, p); err == nil {
+			t.Fatalf("expected error for p=%f", p)
+		}
+	}
+	if _, err = NewStrict(0, 0.01); err == nil {
+		t.Fatal("expected error for no elements")
+	}
+	if f, _ = New(1000, 3); f.TargetFP() != 0 {
+		t.Fatal("unexpected target")
+	}
+}
+
+func TestNewWithMemoryBudget(t *testing.T) {
+	f, fp, err := NewWithMemoryBudget(12000, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.M() != 96000 || f.K() != OptimalK(96000, 10000) {
+		t.Fatalf("m=%d k=%d", f.M(), f.K())
+	}
+	if uint64(len(f.bits))*Uint64Bytes > 12000 {
+		t.Fatalf("%d words over the budget", len(f.bits))
+	}
+	if fp != f.FPForN(10000) || fp > 0.011 {
+		t.Fatalf("fp %f", fp)
+	}
+
+	f, _, err = NewWithMemoryBudget(1000, 100, WithBlocked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.M() != 15*blockBits {
+		t.Fatalf("blocked m=%d", f.M())
+	}
+
+	if _, _, err = NewWithMemoryBudget(7, 100); err == nil {
+		t.Fatal("expected error for a budget below one word")
+	}
+	// 2^59+125 words, whose bits would overflow m down to 8000
+	if _, _, err = NewWithMemoryBudget(1<<62+1000, 100); err == nil {
+		t.Fatal("expected error for a budget beyond memory")
+	}
+	if _, _, err = NewWithMemoryBudget(1000, 0); err == nil {
+		t.Fatal("expected error for no elements")
+	}
+}
@@ -0,0 +1,264 @@
+package bloomfilter
+
+// Option configures how a Filter is created, see New
+type Option func(*options)
+
+type options struct {
+	hugePages HugePageSize
+	offHeap   bool
+	lazyPages bool
+	maxMemory uint64
+	allocator Allocator
+	progress  Progress
+	logger    Logger
+	hooks     *Hooks
+	chunk     int
+	keys      []uint64
+	targetFP  float64
+	// conservative update of FrequencySketch counters
+	conservative bool
+	flags        uint32
+}
+
+func newOptions(opts []Option) (o options) {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// HugePageSize is the size of the pages backing a Filter, as log2(bytes)
+type HugePageSize uint
+
+const (
+	// HugePages2MB backs the bits with 2 MiB pages
+	HugePages2MB HugePageSize = 21
+	// HugePages1GB backs the bits with 1 GiB pages
+	HugePages1GB HugePageSize = 30
+)
+
+// WithHugePages backs the bits with huge pages of the given size, which
+// cuts TLB misses when probing very large filters.
+//
+// It implies WithOffHeap. On Linux, pages reserved with hugetlbfs are used
+// when available, otherwise the kernel is asked for transparent huge pages.
+// Elsewhere, the page size is left to the operating system.
+func WithHugePages(size HugePageSize) Option {
+	return func(o *options) {
+		o.hugePages = size
+		o.offHeap = true
+	}
+}
+
+// WithOffHeap allocates the bits with an anonymous memory mapping outside of
+// the Go heap, so that the garbage collector never has to scan them. The
+// memory must be released with Close.
+//
+// Where memory cannot be mapped, the option is ignored.
+func WithOffHeap() Option {
+	return func(o *options) {
+		o.offHeap = true
+	}
+}
+
+// WithLazyPages allocates the bits like WithOffHeap, for filters sized for a
+// worst case that may never come: the pages of the mapping only take memory
+// once a bit within them is set, reading as zeros until then. On Linux, no
+// swap space is reserved for them either, and Reset returns them to the
+// operating system.
+//
+// Operations which write every word, such as UnionInPlace, take memory for
+// all pages.
+func WithLazyPages() Option {
+	return func(o *options) {
+		o.offHeap = true
+		o.lazyPages = true
+	}
+}
+
+// WithMaxMemory makes creating a filter whose bits would take more than
+// bytes of memory fail with an error stating the size required, rather than
+// attempting an allocation which could get the process killed. The limit
+// carries over to the filters derived from it, such as by Copy.
+func WithMaxMemory(bytes uint64) Option {
+	return func(o *options) {
+		o.maxMemory = bytes
+	}
+}
+
+// WithWriteChunk makes WriteTo and WriteCompactTo convert and write the
+// filter at most bytes at a time, 32 KiB by default, which bounds the memory
+// they take beyond the filter. bytes is rounded down to a multiple of 8, and
+// up to at least 8.
+func WithWriteChunk(bytes int) Option {
+	return func(o *options) {
+		o.chunk = bytes
+	}
+}
+
+// newWriteChunk allocates a buffer of the chunk size of WithWriteChunk
+func (o *options) newWriteChunk() []byte {
+	size := o.chunk
+	if size <= 0 {
+		size = wordsChunk * Uint64Bytes
+	}
+	if size < Uint64Bytes {
+		size = Uint64Bytes
+	}
+	return make([]byte, size/Uint64Bytes*Uint64Bytes)
+}
+
+// WithKeys gives NewFromBits the keys the bits were computed with, and
+// NewStorageFilter the keys to use rather than random ones
+func WithKeys(keys []uint64) Option {
+	return func(o *options) {
+		o.keys = keys
+	}
+}
+
+// WithBlocked confines the k bits of every element to a single block of 512
+// bits, one cache line, chosen by the hash, so that Add and Contains cost
+// exactly one cache miss however large the filter, at the price of a
+// slightly higher false positive probability, since blocks do not fill up
+// evenly. m is rounded up to a multiple of 512.
+func WithBlocked() Option {
+	return func(o *options) {
+		o.flags |= flagBlocked
+	}
+}
+
+// WithRegisterBlocked confines the k bits of every element to a single
+// 64-bit word chosen by the hash, set to one of 1024 patterns of k bits also
+// chosen by the hash, so that Contains is a single load and the branch-free
+// test (word & mask) == mask. It suits the highest rates of mostly negative
+// lookups, at the price of a notably higher false positive probability than
+// WithBlocked. k must be at most 32, and m is rounded up to a multiple of 64.
+func WithRegisterBlocked() Option {
+	return func(o *options) {
+		o.flags |= flagRegisterBlocked
+	}
+}
+
+// IndexScheme is how the k indexes of an element are derived from its hash
+// in filters which are not blocked, see WithIndexScheme
+type IndexScheme uint32
+
+const (
+	// SeededIndexes derive every index from the hash and a key of its own,
+	// (hash ^ key) % m, which is the default and the most robust to weak
+	// hashes
+	SeededIndexes IndexScheme = 0
+	// DoubleHashing derives the indexes from two hashes, h1 and h2, as
+	// (h1 + i*h2) % m (Kirsch and Mitzenmacher), h2 being a mix of the
+	// hash, so that only one key is used. Its false positive probability is
+	// slightly higher, above all at high k.
+	DoubleHashing = IndexScheme(flagDoubleHashing)
+	// EnhancedDoubleHashing adds (i**3 - i)/6 to the indexes of
+	// DoubleHashing (Dillinger and Manolios), which brings its false
+	// positive probability back close to that of SeededIndexes at high k,
+	// for the cost of a few multiplications
+	EnhancedDoubleHashing = IndexScheme(flagEnhancedDoubleHashing)
+)
+
+// WithIndexScheme selects how the indexes of an element are derived from
+// its hash, trading hash quality against the cost of every probe. The
+// scheme is serialized along with k, so that filters read back probe the
+// same bits. It cannot be combined with WithBlocked or WithRegisterBlocked.
+func WithIndexScheme(scheme IndexScheme) Option {
+	return func(o *options) {
+		o.flags = o.flags&^schemeFlags | uint32(scheme)
+	}
+}
+
+// WithFastRange maps the indexes of an element to the m bits with a
+// multiplication (Lemire's fast range) rather than the modulo m, whose
+// integer division is a large share of the cost of every probe at high k.
+// It is serialized along with k, and cannot be combined with
+// WithBlocked or WithRegisterBlocked, which already avoid the modulo.
+func WithFastRange() Option {
+	return func(o *options) {
+		o.flags |= flagFastRange
+	}
+}
+
+// WithPowerOfTwo rounds m up to a power of 2, so that the indexes of an
+// element are mapped to the m bits with a mask rather than the modulo m,
+// which speeds up every probe, at the price of up to twice the memory. Such
+// filters can always be folded by 2, exactly, see Fold and Compact. It is
+// serialized along with k, and cannot be combined with WithFastRange,
+// WithBlocked or WithRegisterBlocked.
+func WithPowerOfTwo() Option {
+	return func(o *options) {
+		o.flags |= flagPowerOfTwo
+	}
+}
+
+// newBits allocates the bits for a filter of m bits as configured by o,
+// returning the memory mapping backing them, if any
+func (o *options) newBits(m uint64) (bits []uint64, mem []byte, err error) {
+	if m < MMin {
+		return nil, nil, errM()
+	}
+	switch o.hugePages {
+	case 0, HugePages2MB, HugePages1GB:
+	default:
+		return nil, nil, errHugePageSize(o.hugePages)
+	}
+	words, err := wordsOf(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = o.checkMemory(words)
+	if err != nil {
+		return nil, nil, err
+	}
+	if o.allocator != nil {
+		bits, err = o.allocWords(words)
+		return bits, nil, err
+	}
+	if o.offHeap {
+		return mmapWords(words, o.hugePages, o.lazyPages)
+	}
+	bits, err = newBits(m)
+	return bits, nil, err
+}
+
+// checkMemory is an error if words exceed the limit set by WithMaxMemory
+func (o *options) checkMemory(words uint64) error {
+	if o.maxMemory != 0 && words*Uint64Bytes > o.maxMemory {
+		return errMaxMemory(words*Uint64Bytes, o.maxMemory)
+	}
+	return nil
+}
+
+// Close releases the memory of a Filter created with WithOffHeap,
+// WithHugePages or WithAllocator. The Filter must not be used afterwards. It
+// is a no-op for other filters, whose bits are left to the garbage
+// collector, so that they can still be used.
+func (f *Filter) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.gen++
+
+	if !f.allocated && f.mem == nil {
+		return nil
+	}
+	err := f.releaseMem()
+	f.bits = nil
+	return err
+}
+
+// releaseMem unmaps or frees the memory backing f.bits, if any. f must be
+// locked.
+func (f *Filter) releaseMem() error {
+	if f.allocated {
+		f.allocated = false
+		return f.opts.allocator.Free(f.bits)
+	}
+	if f.mem == nil {
+		return nil
+	}
+	err := munmap(f.mem)
+	f.mem = nil
+	return err
+}
@@ -0,0 +1,346 @@
+package bloomfilter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHugePages(t *testing.T) {
+	for _, size := range []HugePageSize{HugePages2MB, HugePages1GB} {
+		bf, err := New(1<<20, 5, WithHugePages(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, x := range hashableUint64Values() {
+			bf.Add(x)
+		}
+		bf2, err := bf.Copy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = bf.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for _, x := range hashableUint64Values() {
+			if !bf2.Contains(x) {
+				t.Fatalf("copy does not contain %d", x)
+			}
+		}
+		if err = bf2.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := New(1<<20, 5, WithHugePages(12)); err == nil {
+		t.Fatal("expected error for unsupported page size")
+	}
+}
+
+func TestOffHeap(t *testing.T) {
+	bf, err := New(1000, 5, WithOffHeap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bf.bits) != (1000+63)/64 {
+		t.Fatalf("wrong number of words %d", len(bf.bits))
+	}
+	for _, x := range hashableUint64Values() {
+		bf.Add(x)
+		if !bf.Contains(x) {
+			t.Fatalf("does not contain %d", x)
+		}
+	}
+	if err = bf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = bf.Close(); err != nil {
+		t.Fatal("second Close failed: ", err)
+	}
+}
+
+func TestBlocked(t *testing.T) {
+	bf, err := New(100000, 7, WithBlocked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bf.M()%blockBits != 0 {
+		t.Fatalf("m=%d is not a multiple of the block size", bf.M())
+	}
+	for i := uint64(0); i < 5000; i++ {
+		bf.AddHash(i)
+	}
+	for i := uint64(0); i < 5000; i++ {
+		if !bf.ContainsHash(i) {
+			t.Fatalf("does not contain %d", i)
+		}
+	}
+	fp := 0
+	for i := uint64(5000); i < 105000; i++ {
+		if bf.ContainsHash(i) {
+			fp++
+		}
+	}
+	// 5000 elements in 100k bits with k=7 is about 0.8% unblocked
+	if fp > 2000 {
+		t.Fatalf("false positive rate %f is too high", float64(fp)/100000)
+	}
+
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bf2 Filter
+	if err = bf2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	// 196 blocks
+	if _, err = bf2.Fold(3); err == nil {
+		t.Fatalf("folded %d blocks by 3", bf2.M()/blockBits)
+	}
+	folded, err := bf2.Fold(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thawed, _ := folded.Freeze().Thaw()
+	for i := uint64(0); i < 5000; i++ {
+		if !bf2.ContainsHash(i) || !thawed.ContainsHash(i) {
+			t.Fatalf("does not contain %d after unmarshaling and folding", i)
+		}
+	}
+}
+
+func TestRegisterBlocked(t *testing.T) {
+	bf, err := New(100000, 4, WithRegisterBlocked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 5000; i++ {
+		bf.AddHash(i)
+	}
+	fp := 0
+	for i := uint64(5000); i < 105000; i++ {
+		if bf.ContainsHash(i) {
+			fp++
+		}
+	}
+	if fp > 2000 {
+		t.Fatalf("false positive rate %f is too high", float64(fp)/100000)
+	}
+
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bf2 Filter
+	if err = bf2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	// 1563 words
+	folded, err := bf2.Fold(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 5000; i++ {
+		if !bf2.ContainsHash(i) || !folded.ContainsHash(i) {
+			t.Fatalf("does not contain %d after unmarshaling and folding", i)
+		}
+	}
+
+	if _, err = New(100000, maskMaxK+1, WithRegisterBlocked()); err == nil {
+		t.Fatal("expected error for too many keys")
+	}
+	if _, err = New(100000, 4, WithRegisterBlocked(), WithBlocked()); err == nil {
+		t.Fatal("expected error combining blocked layouts")
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	sizes := []uint64{^uint64(0), ^uint64(0) - 63}
+	if maxInt < 1<<32 {
+		// 32-bit platforms
+		sizes = append(sizes, 1<<34, 1<<40)
+	}
+	for _, m := range sizes {
+		if _, err := New(m, 3); err == nil {
+			t.Fatalf("expected error for m=%d", m)
+		}
+		if _, err := New(m, 3, WithOffHeap()); err == nil {
+			t.Fatalf("expected error for m=%d off heap", m)
+		}
+		if _, err := NewFrequencySketch(m, 3, 0); err == nil {
+			t.Fatalf("expected error for a sketch of m=%d", m)
+		}
+	}
+}
+
+func TestMaxMemory(t *testing.T) {
+	_, err := NewOptimal(1e9, 0.001, WithMaxMemory(1<<30))
+	if err == nil {
+		t.Fatal("expected error for a filter over the memory limit")
+	}
+	if !strings.Contains(err.Error(), "1797") {
+		t.Fatalf("error does not state the size required: %v", err)
+	}
+	if _, err = NewSegmented(1<<40, 3, DefaultSegmentBytes, WithMaxMemory(1<<30)); err == nil {
+		t.Fatal("expected error for a segmented filter over the memory limit")
+	}
+
+	f, err := New(8000, 3, WithMaxMemory(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Copy(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New(8001, 3, WithMaxMemory(1000)); err == nil {
+		t.Fatal("expected error for one word over the memory limit")
+	}
+}
+
+func TestIndexScheme(t *testing.T) {
+	for _, scheme := range []IndexScheme{DoubleHashing, EnhancedDoubleHashing} {
+		testIndexScheme(t, scheme)
+	}
+}
+
+func testIndexScheme(t *testing.T, scheme IndexScheme) {
+	bf, err := New(100000, 7, WithIndexScheme(scheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 5000; i++ {
+		bf.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	fp := 0
+	hashes := make([]uint64, 100000)
+	for i := range hashes {
+		hashes[i] = uint64(i+5000) * 0x9e3779b97f4a7c15
+		if bf.ContainsHash(hashes[i]) {
+			fp++
+		}
+	}
+	// 5000 elements in 100k bits with k=7 is about 0.8%
+	if fp > 1200 {
+		t.Fatalf("false positive rate %f is too high", float64(fp)/100000)
+	}
+	for i, ok := range bf.ContainsHashes(hashes, nil) {
+		if ok != bf.ContainsHash(hashes[i]) {
+			t.Fatalf("ContainsHashes differs for %#x", hashes[i])
+		}
+	}
+
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bf2 Filter
+	if err = bf2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	folded, err := bf2.Fold(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 5000; i++ {
+		hash := i * 0x9e3779b97f4a7c15
+		if !bf2.ContainsHash(hash) || !folded.ContainsHash(hash) {
+			t.Fatalf("does not contain %#x after unmarshaling and folding",
+				hash)
+		}
+	}
+
+	if _, err = New(100000, 4, WithBlocked(),
+		WithIndexScheme(scheme)); err == nil {
+		t.Fatal("expected error combining a scheme with a blocked layout")
+	}
+	if _, err = New(100000, 4, WithIndexScheme(1<<30)); err == nil {
+		t.Fatal("expected error for an unknown scheme")
+	}
+}
+
+func TestEnhancedDoubleHashing(t *testing.T) {
+	// a step which is a multiple of m gives every index of double hashing
+	// the same value, which the cubic term of enhanced double hashing
+	// spreads
+	for _, scheme := range []IndexScheme{DoubleHashing, EnhancedDoubleHashing} {
+		bf, err := New(1001, 16, WithIndexScheme(scheme))
+		if err != nil {
+			t.Fatal(err)
+		}
+		distinct := map[uint64]bool{}
+		for n := range bf.keys {
+			distinct[bf.index(42, 3*1001, n)] = true
+		}
+		if scheme == DoubleHashing && len(distinct) != 1 ||
+			scheme == EnhancedDoubleHashing && len(distinct) < 15 {
+			t.Fatalf("scheme %#x: %d distinct indexes", scheme, len(distinct))
+		}
+	}
+}
+
+func TestFastRange(t *testing.T) {
+	bf, err := New(100000, 7, WithFastRange())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// small hashes, whose high bits are all zeros
+	for i := uint64(0); i < 5000; i++ {
+		bf.AddHash(i)
+	}
+	for i := uint64(0); i < 5000; i++ {
+		if !bf.ContainsHash(i) {
+			t.Fatalf("does not contain %d", i)
+		}
+	}
+	fp := 0
+	for i := uint64(5000); i < 105000; i++ {
+		if bf.ContainsHash(i) {
+			fp++
+		}
+	}
+	// 5000 elements in 100k bits with k=7 is about 0.8%
+	if fp > 1200 {
+		t.Fatalf("false positive rate %f is too high", float64(fp)/100000)
+	}
+
+	if _, err = New(100000, 4, WithRegisterBlocked(),
+		WithFastRange()); err == nil {
+		t.Fatal("expected error combining fast range with a blocked layout")
+	}
+}
+
+func TestPowerOfTwo(t *testing.T) {
+	bf, err := New(100000, 7, WithPowerOfTwo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bf.M() != 1<<17 {
+		t.Fatalf("m=%d", bf.M())
+	}
+	for i := uint64(0); i < 5000; i++ {
+		bf.AddHash(i)
+	}
+	fp := 0
+	for i := uint64(5000); i < 105000; i++ {
+		if bf.ContainsHash(i) {
+			fp++
+		}
+	}
+	// 5000 elements in 128k bits with k=7 is about 0.004%
+	if fp > 200 {
+		t.Fatalf("false positive rate %f is too high", float64(fp)/100000)
+	}
+
+	bf, _, err = NewWithMemoryBudget(100000, 5000, WithPowerOfTwo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bf.M() != 1<<19 {
+		t.Fatalf("m=%d within a budget of 800000 bits", bf.M())
+	}
+
+	if _, err = New(100000, 4, WithPowerOfTwo(),
+		WithFastRange()); err == nil {
+		t.Fatal("expected error combining power of 2 and fast range")
+	}
+}
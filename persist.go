@@ -0,0 +1,175 @@
+package bloomfilter
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// PersistConfig is how often a Persister saves its filter. A filter which
+// was not modified since it was last saved is never saved again.
+type PersistConfig struct {
+	// Interval between saves, or 0 to only save after Mutations
+	Interval time.Duration
+	// Mutations after which to save, as counted by Generation, or 0 to only
+	// save every Interval
+	Mutations uint64
+}
+
+// persistPoll is how often a Persister checks for Mutations
+const persistPoll = 100 * time.Millisecond
+
+// Persister saves a filter in the background, so that long-lived services
+// survive restarts by reading it back with ReadFile
+type Persister struct {
+	f      *Filter
+	save   func() error
+	config PersistConfig
+	stop   chan struct{}
+	done   chan struct{}
+
+	lock  sync.Mutex // serializes saves
+	saved uint64     // generation of f last saved
+	err   error      // of the last save
+}
+
+// NewPersister saving f to filename in the background, as configured. Every
+// save writes a temporary file in the same directory and renames it to
+// filename, so that filename always holds a complete filter.
+func NewPersister(f *Filter, filename string, config PersistConfig) *Persister {
+	return newPersister(f, func() error {
+		return writeFileAtomic(f, filename)
+	}, config)
+}
+
+// NewPersisterTo saving f in the background, as configured, to the
+// io.WriteCloser returned by create for every save, which is closed once
+// the save completes or fails
+func NewPersisterTo(f *Filter, create func() (io.WriteCloser, error),
+	config PersistConfig,
+) *Persister {
+	return newPersister(f, func() error {
+		w, err := create()
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteTo(w)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, config)
+}
+
+func newPersister(f *Filter, save func() error, config PersistConfig) *Persister {
+	p := &Persister{
+		f:      f,
+		save:   save,
+		config: config,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		saved:  f.Generation(),
+	}
+	go p.run()
+	return p
+}
+
+func (p *Persister) run() {
+	defer close(p.done)
+	var interval, poll <-chan time.Time
+	if p.config.Interval > 0 {
+		ticker := time.NewTicker(p.config.Interval)
+		defer ticker.Stop()
+		interval = ticker.C
+	}
+	if p.config.Mutations > 0 {
+		ticker := time.NewTicker(persistPoll)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	for {
+		select {
+		case <-interval:
+			_ = p.Save()
+		case <-poll:
+			p.lock.Lock()
+			due := p.f.Generation()-p.saved >= p.config.Mutations
+			p.lock.Unlock()
+			if due {
+				_ = p.Save()
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Save the filter now, if it was modified since it was last saved
+func (p *Persister) Save() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	gen := p.f.Generation()
+	if gen == p.saved {
+		return nil
+	}
+	p.err = p.save()
+	if p.err != nil {
+		p.f.opts.logf("bloomfilter: cannot save filter: %v", p.err)
+		return p.err
+	}
+	p.saved = gen
+	return nil
+}
+
+// Err is the error of the last save, if it failed
+func (p *Persister) Err() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.err
+}
+
+// Close stops saving in the background, and saves the filter a last time
+// if it was modified. The filter itself is left open.
+func (p *Persister) Close() error {
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	<-p.done
+	return p.Save()
+}
+
+// writeFileAtomic writes f to a temporary file renamed to filename once
+// complete
+func writeFileAtomic(f *Filter, filename string) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename),
+		"."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = f.WriteTo(tmp)
+	if err != nil {
+		return err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
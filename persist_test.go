@@ -0,0 +1,100 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPersister(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloomfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "f.bf.gz")
+
+	f, _ := New(1<<12, 3)
+	p := NewPersister(f, filename, PersistConfig{Mutations: 2})
+	f.AddHash(1)
+	f.AddHash(2)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err = os.Stat(filename); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("filter was not saved after 2 mutations")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	f.AddHash(3)
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	g, _, err := ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.N() != 3 || !g.ContainsHash(3) {
+		t.Errorf("saved filter has n=%d, expected the last save on Close", g.N())
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("%d files left in the directory, expected 1", len(entries))
+	}
+}
+
+type bufferCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestPersisterTo(t *testing.T) {
+	f, _ := New(1<<12, 3)
+	var saves []*bufferCloser
+	fail := false
+	p := NewPersisterTo(f, func() (io.WriteCloser, error) {
+		if fail {
+			return nil, errors.New("disk full")
+		}
+		b := &bufferCloser{}
+		saves = append(saves, b)
+		return b, nil
+	}, PersistConfig{Interval: time.Hour})
+
+	if err := p.Save(); err != nil || len(saves) != 0 {
+		t.Errorf("unmodified filter saved: %d saves, error %v", len(saves), err)
+	}
+	f.AddHash(1)
+	if err := p.Save(); err != nil || len(saves) != 1 || !saves[0].closed {
+		t.Fatalf("%d saves, error %v", len(saves), err)
+	}
+	g, _, err := ReadFrom(&saves[0].Buffer)
+	if err != nil || !g.ContainsHash(1) {
+		t.Errorf("saved filter cannot be read back: %v", err)
+	}
+
+	fail = true
+	f.AddHash(2)
+	if err = p.Save(); err == nil || p.Err() == nil {
+		t.Error("failed save did not return an error")
+	}
+	fail = false
+	if err = p.Close(); err != nil || len(saves) != 2 {
+		t.Errorf("Close did not retry the failed save: %d saves, error %v",
+			len(saves), err)
+	}
+}
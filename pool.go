@@ -0,0 +1,65 @@
+package bloomfilter
+
+import (
+	"sync"
+)
+
+// Pool recycles scratch filters compatible with a template filter, so that
+// short-lived filters, e.g. built per task and then unioned, do not each
+// have to be allocated.
+//
+// A Pool takes back any filter with the parameters of its template, m, the
+// keys and the layout and index scheme, such as filters of an equivalent
+// template.
+//
+// Pooled filters always live on the Go heap, regardless of the options of
+// the template, since the pool may drop them at any time, and without the
+// alarms, hooks and other options of the filters put back.
+type Pool struct {
+	m     uint64
+	keys  []uint64
+	flags uint32
+	pool  sync.Pool
+}
+
+// NewPool of filters compatible with template
+func NewPool(template *Filter) *Pool {
+	template.lock.RLock()
+	defer template.lock.RUnlock()
+
+	keys := make([]uint64, len(template.keys))
+	copy(keys, template.keys)
+	return &Pool{
+		m:     template.m,
+		keys:  keys,
+		flags: template.flags,
+	}
+}
+
+// Get an empty filter from the pool, allocating one if the pool is empty
+func (p *Pool) Get() (*Filter, error) {
+	if f, ok := p.pool.Get().(*Filter); ok {
+		return f, nil
+	}
+	return newWithOptions(p.m, p.keys, options{flags: p.flags})
+}
+
+// Put f back into the pool, clearing it along with its alarms and options,
+// so that they do not carry over to the next caller of Get. f must not be
+// used afterwards. Filters which are not compatible with the pool are
+// dropped.
+func (p *Pool) Put(f *Filter) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.mem != nil || f.allocated || f.m != p.m || f.flags != p.flags ||
+		len(f.keys) != len(p.keys) ||
+		noBranchCompareUint64s(f.keys, p.keys) != 0 {
+		return
+	}
+	f.gen++
+	f.alarms = nil
+	f.opts = options{flags: p.flags}
+	f.reset()
+	p.pool.Put(f)
+}
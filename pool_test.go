@@ -0,0 +1,68 @@
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	b1, _ := New(10000, 5)
+	pool := NewPool(b1)
+
+	for i := 0; i < 3; i++ {
+		scratch, err := pool.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scratch.N() != 0 || scratch.PreciseFilledRatio() != 0 {
+			t.Fatal("pooled filter is not empty")
+		}
+		for _, x := range hashableUint64Values() {
+			scratch.Add(x)
+		}
+		if err = b1.UnionInPlace(scratch); err != nil {
+			t.Fatal(err)
+		}
+		pool.Put(scratch)
+	}
+	for _, x := range hashableUint64Values() {
+		if !b1.Contains(x) {
+			t.Fatalf("union does not contain %d", x)
+		}
+	}
+}
+
+func TestPoolPut(t *testing.T) {
+	b1, _ := New(10000, 5, WithBlocked())
+	b3, _ := New(10000, 5, WithBlocked())
+	pool := NewPool(b1)
+
+	// a filter of an equivalent template is pooled, without its alarms and
+	// options
+	fired, added := 0, 0
+	b2, _ := New(10000, 5, WithBlocked(), WithKeys(b1.keys),
+		WithHooks(Hooks{OnAdd: func(uint64) { added++ }}))
+	b2.OnSaturation(0.01, func(Stats) { fired++ })
+	b2.AddHash(1)
+	pool.Put(b2)
+	if f, ok := pool.pool.Get().(*Filter); ok {
+		if f != b2 {
+			t.Fatal("compatible filter not pooled")
+		}
+		if f.N() != 0 {
+			t.Fatal("pooled filter not cleared")
+		}
+		for i := uint64(0); i < 10000; i++ {
+			f.AddHash(i * 0x9e3779b97f4a7c15)
+		}
+		if fired != 0 || added != 1 {
+			t.Fatalf("alarms fired %d times, hooks called %d times", fired, added)
+		}
+	}
+
+	// a filter of another template is dropped
+	scratch3, _ := NewPool(b3).Get()
+	pool.Put(scratch3)
+	if f, ok := pool.pool.Get().(*Filter); ok && f == scratch3 {
+		t.Fatal("incompatible filter pooled")
+	}
+}
@@ -0,0 +1,343 @@
+package bloomfilter
+
+import "math/bits"
+
+// flags select how the bits of an element are chosen, they are serialized
+// along with k
+const (
+	// flagBlocked confines the bits of an element to one cache line
+	flagBlocked uint32 = 1 << iota
+	// flagRegisterBlocked confines the bits of an element to one word
+	flagRegisterBlocked
+	// flagDoubleHashing derives the bits of an element from two hashes
+	flagDoubleHashing
+	// flagEnhancedDoubleHashing perturbs double hashing by a cubic term
+	flagEnhancedDoubleHashing
+	// flagFastRange maps indexes to m bits by a multiplication, not a modulo
+	flagFastRange
+	// flagPowerOfTwo maps indexes to a power of 2 m bits by a mask
+	flagPowerOfTwo
+
+	knownFlags = flagBlocked | flagRegisterBlocked | flagDoubleHashing |
+		flagEnhancedDoubleHashing | flagFastRange | flagPowerOfTwo
+
+	// layoutFlags confine the bits of an element, at most one can be set
+	layoutFlags = flagBlocked | flagRegisterBlocked
+	// schemeFlags select how the indexes of filters which are not blocked
+	// are derived, at most one can be set
+	schemeFlags = flagDoubleHashing | flagEnhancedDoubleHashing
+	// rangeFlags select how the indexes of filters which are not blocked
+	// are mapped to m bits, at most one can be set
+	rangeFlags = flagFastRange | flagPowerOfTwo
+)
+
+// validFlags is true if flags are known and can be combined
+func validFlags(flags uint32) bool {
+	return flags&^knownFlags == 0 &&
+		bits.OnesCount32(flags&layoutFlags) <= 1 &&
+		bits.OnesCount32(flags&schemeFlags) <= 1 &&
+		bits.OnesCount32(flags&rangeFlags) <= 1 &&
+		(flags&layoutFlags == 0 || flags&(schemeFlags|rangeFlags) == 0)
+}
+
+const (
+	blockBits  = cacheLineSize * 8
+	blockWords = cacheLineSize / Uint64Bytes
+	// bit indexes within a block are the top bits of a mixed hash
+	blockShift = 64 - 9
+
+	// number of masks of register-blocked filters, a power of 2
+	maskPatterns = 1024
+	// maximum k of register-blocked filters
+	maskMaxK = 32
+)
+
+// core is what it takes to probe the bits of a filter for an element
+type core struct {
+	bits  []uint64
+	keys  []uint64
+	m     uint64 // number of bits the "bits" field should recognize
+	flags uint32
+	masks []uint64 // k-bit patterns of register-blocked filters
+}
+
+// newMasks derives maskPatterns distinct-looking masks of k bits each from
+// keys, so that compatible filters have the same masks
+func newMasks(keys []uint64) []uint64 {
+	masks := make([]uint64, maskPatterns)
+	k := len(keys)
+	for p := range masks {
+		x := keys[0] ^ uint64(p)
+		for bits.OnesCount64(masks[p]) < k {
+			x = mix64(x + 0x9e3779b97f4a7c15)
+			masks[p] |= 1 << (x >> 58)
+		}
+	}
+	return masks
+}
+
+// mix64 is the finalizer of splitmix64, which makes every bit of its result
+// depend on every bit of x
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// block holding the bits of hash, for a blocked filter
+//
+// The block is chosen by multiplying the mixed hash by the number of blocks
+// and keeping the high 64 bits, rather than by a modulo, so that the block
+// of a filter folded by a factor is the block of the original filter divided
+// by that factor. The mixed hash is xored with the first key, like every
+// other index, so that filters with different keys use different blocks.
+func (c *core) block(hash uint64) []uint64 {
+	b := c.blockIndex(hash)
+	return c.bits[b*blockWords : (b+1)*blockWords]
+}
+
+// blockIndex is the index of the block of hash
+func (c *core) blockIndex(hash uint64) uint64 {
+	b, _ := bits.Mul64(mix64(hash)^c.keys[0], c.m/blockBits)
+	return b
+}
+
+// word and mask of hash, for a register-blocked filter, the word being
+// chosen like the block of a blocked filter
+func (c *core) wordAndMask(hash uint64) (*uint64, uint64) {
+	w, mask := c.wordIndexAndMask(hash)
+	return &c.bits[w], mask
+}
+
+// wordIndexAndMask is wordAndMask, with the index of the word
+func (c *core) wordIndexAndMask(hash uint64) (uint64, uint64) {
+	h := mix64(hash ^ c.keys[0])
+	w, _ := bits.Mul64(h, c.m/64)
+	return w, c.masks[h&(maskPatterns-1)]
+}
+
+// step between the indexes of hash, for double hashing, or 0
+func (c *core) step(hash uint64) uint64 {
+	if c.flags&schemeFlags == 0 {
+		return 0
+	}
+	// odd, so that it is never a multiple of a power of 2 m
+	return mix64(hash^c.keys[0]) | 1
+}
+
+// index of the n-th bit of hash, for a filter which is not blocked, step
+// being c.step(hash)
+//
+// By default, every index is seeded by its own key, (hash ^ key) % m. With
+// double hashing (Kirsch and Mitzenmacher), the indexes are
+// (h1 + n*h2) % m, h1 being hash ^ key and h2 a mix of it, so that only the
+// first key is used. Enhanced double hashing (Dillinger and Manolios) adds
+// (n**3 - n)/6, so that elements whose h1 and h2 collide modulo m do not
+// share all their indexes.
+func (c *core) index(hash, step uint64, n int) uint64 {
+	switch {
+	case c.flags&flagDoubleHashing != 0:
+		return c.reduce((hash ^ c.keys[0]) + uint64(n)*step)
+	case c.flags&flagEnhancedDoubleHashing != 0:
+		i := uint64(n)
+		return c.reduce((hash ^ c.keys[0]) + i*step + (i*i*i-i)/6)
+	}
+	return c.reduce(hash ^ c.keys[n])
+}
+
+// reduce x to an index below m: x % m, or with fast range (Lemire), the
+// high 64 bits of x * m, which spares the division. Since these depend on
+// the high bits of x only, x is first multiplied by an odd constant, which
+// carries every bit of x into its high bits, so that elements differing in
+// their low bits do not share all their indexes.
+//
+// With a power of 2 m, the index is the low bits of x, once its high bits
+// were folded into them likewise.
+func (c *core) reduce(x uint64) uint64 {
+	switch {
+	case c.flags&flagFastRange != 0:
+		hi, _ := bits.Mul64(x*0x9e3779b97f4a7c15, c.m)
+		return hi
+	case c.flags&flagPowerOfTwo != 0:
+		x *= 0x9e3779b97f4a7c15
+		return (x ^ x>>32) & (c.m - 1)
+	}
+	return x % c.m
+}
+
+// locations appends the indexes of the bits of hash to dst
+func (c *core) locations(hash uint64, dst []uint64) []uint64 {
+	if c.flags&flagRegisterBlocked != 0 {
+		w, mask := c.wordIndexAndMask(hash)
+		for ; mask != 0; mask &= mask - 1 {
+			dst = append(dst, w*64+uint64(bits.TrailingZeros64(mask)))
+		}
+		return dst
+	}
+	if c.flags&flagBlocked != 0 {
+		b := c.blockIndex(hash)
+		for _, key := range c.keys {
+			dst = append(dst, b*blockBits+mix64(hash^key)>>blockShift)
+		}
+		return dst
+	}
+	step := c.step(hash)
+	for n := range c.keys {
+		dst = append(dst, c.index(hash, step, n))
+	}
+	return dst
+}
+
+// wordMasks is the indexes of the words holding the bits of hash, and
+// their bits in each of those: the locations merged by word, for probing
+// words stored other than in bits, such as by Key and StorageFilter. They
+// reuse the buffers words and masks, the locations being computed in words.
+func (c *core) wordMasks(hash uint64, words, masks []uint64) ([]uint64, []uint64) {
+	locations := c.locations(hash, words[:0])
+	words, masks = locations[:0], masks[:0]
+	for _, i := range locations {
+		word, bit := i>>6, uint64(1)<<uint(i&0x3f)
+		merged := false
+		for j, w := range words {
+			if w == word {
+				masks[j] |= bit
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			words = append(words, word)
+			masks = append(masks, bit)
+		}
+	}
+	return words, masks
+}
+
+// add sets the bits of hash
+func (c *core) add(hash uint64) {
+	if invariants {
+		c.checkProbe(hash)
+	}
+	if c.flags&flagRegisterBlocked != 0 {
+		word, mask := c.wordAndMask(hash)
+		*word |= mask
+		return
+	}
+	if c.flags&flagBlocked != 0 {
+		block := c.block(hash)
+		for _, key := range c.keys {
+			i := mix64(hash^key) >> blockShift
+			block[i>>6] |= 1 << uint(i&0x3f)
+		}
+		return
+	}
+	var (
+		i    uint64
+		step = c.step(hash)
+	)
+	for n := 0; n < len(c.keys); n++ {
+		i = c.index(hash, step, n)
+		c.bits[i>>6] |= 1 << uint(i&0x3f)
+	}
+}
+
+// contains tests if the bits of hash are all set
+func (c *core) contains(hash uint64) bool {
+	if invariants {
+		c.checkProbe(hash)
+	}
+	if c.flags&flagRegisterBlocked != 0 {
+		word, mask := c.wordAndMask(hash)
+		return *word&mask == mask
+	}
+	var (
+		i uint64
+		r = uint64(1)
+	)
+	if c.flags&flagBlocked != 0 {
+		block := c.block(hash)
+		for n := 0; n < len(c.keys) && r != 0; n++ {
+			i = mix64(hash^c.keys[n]) >> blockShift
+			r &= (block[i>>6] >> uint(i&0x3f)) & 1
+		}
+		return uint64ToBool(r)
+	}
+	step := c.step(hash)
+	for n := 0; n < len(c.keys) && r != 0; n++ {
+		i = c.index(hash, step, n)
+		r &= (c.bits[i>>6] >> uint(i&0x3f)) & 1
+	}
+	return uint64ToBool(r)
+}
+
+// testAndAdd sets the bits of hash, returning whether they were all set
+func (c *core) testAndAdd(hash uint64) bool {
+	if invariants {
+		c.checkProbe(hash)
+	}
+	if c.flags&flagRegisterBlocked != 0 {
+		word, mask := c.wordAndMask(hash)
+		contained := *word&mask == mask
+		*word |= mask
+		return contained
+	}
+	var (
+		i uint64
+		r = uint64(1)
+	)
+	if c.flags&flagBlocked != 0 {
+		block := c.block(hash)
+		for _, key := range c.keys {
+			i = mix64(hash^key) >> blockShift
+			r &= (block[i>>6] >> uint(i&0x3f)) & 1
+			block[i>>6] |= 1 << uint(i&0x3f)
+		}
+		return uint64ToBool(r)
+	}
+	step := c.step(hash)
+	for n := 0; n < len(c.keys); n++ {
+		i = c.index(hash, step, n)
+		r &= (c.bits[i>>6] >> uint(i&0x3f)) & 1
+		c.bits[i>>6] |= 1 << uint(i&0x3f)
+	}
+	return uint64ToBool(r)
+}
+
+// addCounting is add, returning the number of bits it set which were not
+// set before
+func (c *core) addCounting(hash uint64) (added uint64) {
+	if invariants {
+		c.checkProbe(hash)
+	}
+	if c.flags&flagRegisterBlocked != 0 {
+		word, mask := c.wordAndMask(hash)
+		added = uint64(bits.OnesCount64(mask &^ *word))
+		*word |= mask
+		return added
+	}
+	if c.flags&flagBlocked != 0 {
+		block := c.block(hash)
+		for _, key := range c.keys {
+			i := mix64(hash^key) >> blockShift
+			bit := uint64(1) << uint(i&0x3f)
+			if block[i>>6]&bit == 0 {
+				block[i>>6] |= bit
+				added++
+			}
+		}
+		return added
+	}
+	step := c.step(hash)
+	for n := range c.keys {
+		i := c.index(hash, step, n)
+		bit := uint64(1) << uint(i&0x3f)
+		if c.bits[i>>6]&bit == 0 {
+			c.bits[i>>6] |= bit
+			added++
+		}
+	}
+	return added
+}
@@ -0,0 +1,133 @@
+package bloomfilter
+
+import (
+	"io"
+	"runtime"
+)
+
+// Progress receives the progress of long operations on a filter created
+// WithProgress, as done units out of total, or out of an unknown total if
+// it is 0. It is called at most about once per MiB or thousand items, by
+// one goroutine at a time.
+type Progress func(done, total uint64)
+
+// WithProgress reports the progress of long operations to progress, for
+// progress bars or heartbeats:
+//
+//   - WriteTo, WriteCompactTo and ReadFrom, in bytes of uncompressed data
+//   - AddFromReader and Builder, in items added
+//   - UnionAll, in filters merged
+//   - Warm, in bytes of bits
+//
+// It carries over to the filters derived from the filter, such as by Copy.
+func WithProgress(progress Progress) Option {
+	return func(o *options) {
+		o.progress = progress
+	}
+}
+
+// progressBytes is how often bytes are reported to a Progress
+const progressBytes = 1 << 20
+
+// progressReader reports the bytes read from r to progress, if not nil
+type progressReader struct {
+	r              io.Reader
+	progress       Progress
+	done, total    uint64
+	lastReportedAt uint64
+}
+
+func newProgressReader(r io.Reader, total uint64, progress Progress) io.Reader {
+	if progress == nil {
+		return r
+	}
+	return &progressReader{r: r, progress: progress, total: total}
+}
+
+func (p *progressReader) Read(b []byte) (n int, err error) {
+	n, err = p.r.Read(b)
+	p.done += uint64(n)
+	if p.done-p.lastReportedAt >= progressBytes ||
+		n > 0 && p.done == p.total {
+		p.lastReportedAt = p.done
+		p.progress(p.done, p.total)
+	}
+	return n, err
+}
+
+// progressWriter reports the bytes written to w to progress, if not nil
+type progressWriter struct {
+	w              io.Writer
+	progress       Progress
+	done, total    uint64
+	lastReportedAt uint64
+}
+
+func newProgressWriter(w io.Writer, total uint64, progress Progress) io.Writer {
+	if progress == nil {
+		return w
+	}
+	return &progressWriter{w: w, progress: progress, total: total}
+}
+
+func (p *progressWriter) Write(b []byte) (n int, err error) {
+	n, err = p.w.Write(b)
+	p.done += uint64(n)
+	if p.done-p.lastReportedAt >= progressBytes ||
+		n > 0 && p.done == p.total {
+		p.lastReportedAt = p.done
+		p.progress(p.done, p.total)
+	}
+	return n, err
+}
+
+// UnionAll merges filters into a new Filter, created like the first one.
+// The filters must be compatible.
+func UnionAll(filters ...*Filter) (out *Filter, err error) {
+	if len(filters) == 0 {
+		return nil, errIncompatibleBloomFilters()
+	}
+	out, err = filters[0].Copy()
+	if err != nil {
+		return nil, err
+	}
+	total := uint64(len(filters))
+	if out.opts.progress != nil {
+		out.opts.progress(1, total)
+	}
+	for i, f := range filters[1:] {
+		err = out.UnionInPlace(f)
+		if err != nil {
+			_ = out.Close()
+			return nil, err
+		}
+		if out.opts.progress != nil {
+			out.opts.progress(uint64(i+2), total)
+		}
+	}
+	return out, nil
+}
+
+// pageWords is the number of words of the smallest pages, of 4 KiB
+const pageWords = 4096 / Uint64Bytes
+
+// Warm reads a word of every page of the bits of f, so that the pages of a
+// memory mapping, such as a file given to UnmarshalBinaryNoCopy, are
+// faulted in up front rather than by the first queries
+func (f *Filter) Warm() {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	var sum uint64
+	total := uint64(len(f.bits)) * Uint64Bytes
+	for i := 0; i < len(f.bits); i += pageWords {
+		sum += f.bits[i]
+		if f.opts.progress != nil && i%(progressBytes/Uint64Bytes) == 0 {
+			f.opts.progress(uint64(i)*Uint64Bytes, total)
+		}
+	}
+	if f.opts.progress != nil {
+		f.opts.progress(total, total)
+	}
+	runtime.KeepAlive(sum)
+}
@@ -0,0 +1,67 @@
+package bloomfilter
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type progressRecorder struct {
+	calls       int
+	done, total uint64
+}
+
+func (p *progressRecorder) progress(done, total uint64) {
+	p.calls++
+	p.done, p.total = done, total
+}
+
+func TestProgress(t *testing.T) {
+	var p progressRecorder
+	f, _ := New(1<<26, 3, WithProgress(p.progress))
+	f.AddHash(42)
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if p.calls < 8 || p.done != p.total || p.total < 1<<23 {
+		t.Fatalf("WriteTo reported %d of %d in %d calls", p.done, p.total, p.calls)
+	}
+
+	p = progressRecorder{}
+	if _, err := f.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if p.calls < 8 || p.done != p.total || !f.ContainsHash(42) {
+		t.Fatalf("ReadFrom reported %d of %d in %d calls", p.done, p.total, p.calls)
+	}
+
+	p = progressRecorder{}
+	f.Warm()
+	if p.calls < 8 || p.done != 1<<23 || p.total != 1<<23 {
+		t.Fatalf("Warm reported %d of %d in %d calls", p.done, p.total, p.calls)
+	}
+
+	p = progressRecorder{}
+	f2, _ := f.NewCompatible()
+	f3, _ := f.NewCompatible()
+	union, err := UnionAll(f, f2, f3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.calls != 3 || p.done != 3 || p.total != 3 || !union.ContainsHash(42) {
+		t.Fatalf("UnionAll reported %d of %d in %d calls", p.done, p.total, p.calls)
+	}
+
+	p = progressRecorder{}
+	lines := strings.Repeat("x\n", 3*addBatchSize+1)
+	if _, err = f.AddFromReader(strings.NewReader(lines),
+		bufio.ScanLines); err != nil {
+		t.Fatal(err)
+	}
+	if p.calls != 4 || p.done != 3*addBatchSize+1 || p.total != 0 {
+		t.Fatalf("AddFromReader reported %d of %d in %d calls", p.done, p.total, p.calls)
+	}
+}
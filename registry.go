@@ -0,0 +1,151 @@
+package bloomfilter
+
+import (
+	"sort"
+	"sync"
+)
+
+// FilterConfig is how a Registry creates a filter, see NewOptimal
+type FilterConfig struct {
+	MaxN    uint64   // maximum number of elements
+	P       float64  // maximum false positive probability
+	Options []Option // options of the filter, such as WithOffHeap
+}
+
+// Registry manages named filters, such as one filter per tenant. It is safe
+// for concurrent use.
+type Registry struct {
+	lock    sync.RWMutex
+	filters map[string]registered
+}
+
+type registered struct {
+	f      *Filter
+	config FilterConfig
+}
+
+// RegistryStats aggregates the filters of a Registry
+type RegistryStats struct {
+	Filters  int    // number of filters
+	Elements uint64 // sum of the N of the filters
+	Bytes    uint64 // memory taken by the bits of the filters
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{filters: make(map[string]registered)}
+}
+
+// Create a filter named name as configured, failing if the name is taken
+func (r *Registry) Create(name string, config FilterConfig) (*Filter, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.filters[name]; ok {
+		return nil, errFilterExists(name)
+	}
+	return r.create(name, config)
+}
+
+// create is Create, r must be locked
+func (r *Registry) create(name string, config FilterConfig) (*Filter, error) {
+	f, err := NewOptimal(config.MaxN, config.P, config.Options...)
+	if err != nil {
+		return nil, err
+	}
+	r.filters[name] = registered{f: f, config: config}
+	return f, nil
+}
+
+// Get the filter named name, if any
+func (r *Registry) Get(name string) (f *Filter, ok bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entry, ok := r.filters[name]
+	return entry.f, ok
+}
+
+// GetOrCreate gets the filter named name, creating it as configured if
+// there is none
+func (r *Registry) GetOrCreate(name string, config FilterConfig) (
+	*Filter, error,
+) {
+	if f, ok := r.Get(name); ok {
+		return f, nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if entry, ok := r.filters[name]; ok {
+		return entry.f, nil
+	}
+	return r.create(name, config)
+}
+
+// Config the filter named name was created with, if any
+func (r *Registry) Config(name string) (config FilterConfig, ok bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entry, ok := r.filters[name]
+	return entry.config, ok
+}
+
+// Drop the filter named name from r and close it. Callers still holding it,
+// from Get for instance, must stop using it if it was created WithOffHeap,
+// WithHugePages or WithAllocator, since its memory is released; other
+// filters can still be used, see Filter.Close.
+func (r *Registry) Drop(name string) error {
+	r.lock.Lock()
+	entry, ok := r.filters[name]
+	delete(r.filters, name)
+	r.lock.Unlock()
+
+	if !ok {
+		return errNoFilter(name)
+	}
+	return entry.f.Close()
+}
+
+// Names of the filters of r, sorted
+func (r *Registry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	names := make([]string, 0, len(r.filters))
+	for name := range r.filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stats aggregated over the filters of r
+func (r *Registry) Stats() (stats RegistryStats) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, entry := range r.filters {
+		stats.Filters++
+		stats.Elements += entry.f.N()
+		stats.Bytes += entry.f.Words() * Uint64Bytes
+	}
+	return stats
+}
+
+// Close drops all the filters of r like Drop, returning the first error
+// closing them
+func (r *Registry) Close() (err error) {
+	r.lock.Lock()
+	filters := r.filters
+	r.filters = make(map[string]registered)
+	r.lock.Unlock()
+
+	for _, entry := range filters {
+		if cerr := entry.f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
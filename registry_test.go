@@ -0,0 +1,73 @@
+package bloomfilter
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	config := FilterConfig{MaxN: 1000, P: 0.01}
+	a, err := r.Create("a", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Create("a", config); err == nil {
+		t.Error("created a filter under a taken name")
+	}
+	a.AddHash(1)
+	a.AddHash(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := r.GetOrCreate("b", FilterConfig{MaxN: 100, P: 0.1})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			f.AddHash(3)
+		}()
+	}
+	wg.Wait()
+
+	if got := r.Names(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("names %q", got)
+	}
+	if f, ok := r.Get("a"); !ok || f != a {
+		t.Error("Get did not return the filter created")
+	}
+	if c, ok := r.Config("b"); !ok || c.MaxN != 100 {
+		t.Errorf("config of b: %+v", c)
+	}
+	b, _ := r.Get("b")
+	stats := r.Stats()
+	if stats.Filters != 2 || stats.Elements != 10 ||
+		stats.Bytes != (a.Words()+b.Words())*Uint64Bytes {
+		t.Errorf("stats %+v", stats)
+	}
+
+	if err = r.Drop("a"); err != nil {
+		t.Fatal(err)
+	}
+	// a filter on the heap can still be used once dropped
+	a.AddHash(42)
+	if !a.ContainsHash(42) {
+		t.Error("dropped filter lost its bits")
+	}
+	if err = r.Drop("a"); err == nil {
+		t.Error("dropped a missing filter")
+	}
+	if _, ok := r.Get("a"); ok {
+		t.Error("dropped filter is still registered")
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats = r.Stats(); stats.Filters != 0 {
+		t.Errorf("stats after Close %+v", stats)
+	}
+}
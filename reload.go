@@ -0,0 +1,151 @@
+package bloomfilter
+
+import (
+	"hash"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReloadingFilter serves queries from a filter file, such as one written by
+// a Persister, and loads it again whenever the file is replaced or
+// modified. Queries keep going to the previous version until the new one is
+// completely loaded, and are never blocked by a reload.
+type ReloadingFilter struct {
+	filename string
+	opts     []Option
+	stop     chan struct{}
+	done     chan struct{}
+
+	lock sync.RWMutex
+	f    *Filter
+	info os.FileInfo // of the file f was loaded from
+	err  error       // of the last reload
+}
+
+// WatchFile loads the filter of filename, see ReadFile, and checks every
+// interval whether the file changed, going by its size, modification time
+// and inode. The options apply to every version loaded, such as WithLogger
+// to log reloads which fail. The interval must be positive.
+func WatchFile(filename string, interval time.Duration, opts ...Option) (
+	*ReloadingFilter, error,
+) {
+	if interval <= 0 {
+		return nil, errInterval(interval)
+	}
+	r := &ReloadingFilter{
+		filename: filename,
+		opts:     opts,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	go r.run(time.NewTicker(interval))
+	return r, nil
+}
+
+func (r *ReloadingFilter) run(ticker *time.Ticker) {
+	defer close(r.done)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_, _ = r.Reload()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Reload the file now if it changed, returning whether it did. A file
+// which cannot be read, such as one still being written, leaves the
+// current version in place and is tried again on the next check.
+func (r *ReloadingFilter) Reload() (reloaded bool, err error) {
+	info, err := os.Stat(r.filename)
+	if err == nil {
+		r.lock.RLock()
+		last := r.info
+		r.lock.RUnlock()
+		if last != nil && os.SameFile(info, last) &&
+			info.Size() == last.Size() && info.ModTime().Equal(last.ModTime()) {
+			return false, nil
+		}
+	}
+
+	var f *Filter
+	if err == nil {
+		f, err = r.load()
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.err = err
+	if err != nil {
+		if r.f != nil {
+			r.f.opts.logf("bloomfilter: cannot reload %s: %v", r.filename, err)
+		}
+		return false, err
+	}
+	r.f, r.info = f, info
+	return true, nil
+}
+
+// load a new version of the file
+func (r *ReloadingFilter) load() (f *Filter, err error) {
+	file, err := os.Open(r.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// keep the first error
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	f = &Filter{opts: newOptions(r.opts)}
+	_, err = f.ReadFrom(file)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Filter is the version of the filter currently loaded. It must not be
+// modified, since it is replaced by the next reload.
+func (r *ReloadingFilter) Filter() *Filter {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.f
+}
+
+// Contains tests if the current version of the filter contains v
+func (r *ReloadingFilter) Contains(v hash.Hash64) bool {
+	return r.Filter().Contains(v)
+}
+
+// ContainsHash tests if the current version of the filter contains the
+// already hashed item
+func (r *ReloadingFilter) ContainsHash(hash uint64) bool {
+	return r.Filter().ContainsHash(hash)
+}
+
+// Err is the error of the last reload, if it failed
+func (r *ReloadingFilter) Err() error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.err
+}
+
+// Close stops watching the file
+func (r *ReloadingFilter) Close() error {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	<-r.done
+	return nil
+}
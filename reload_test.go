@@ -0,0 +1,64 @@
+package bloomfilter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadingFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloomfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "f.bf.gz")
+
+	f, _ := New(1<<12, 3)
+	f.AddHash(1)
+	if err = writeFileAtomic(f, filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = WatchFile(filename, 0); err == nil {
+		t.Fatal("expected error for an interval of 0")
+	}
+	r, err := WatchFile(filename, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if !r.ContainsHash(1) || r.ContainsHash(2) {
+		t.Fatal("first version was not loaded")
+	}
+
+	f.AddHash(2)
+	if err = writeFileAtomic(f, filename); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !r.ContainsHash(2) {
+		if time.Now().After(deadline) {
+			t.Fatal("replaced file was not reloaded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// a broken file leaves the current version in place
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filename, []byte("truncated"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := r.Reload(); reloaded || err == nil || r.Err() == nil {
+		t.Errorf("broken file reloaded: %v, %v", reloaded, err)
+	}
+	if !r.ContainsHash(2) {
+		t.Error("failed reload lost the current version")
+	}
+	if _, err = r.Reload(); err == nil {
+		t.Error("failed reload was not retried")
+	}
+}
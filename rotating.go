@@ -0,0 +1,97 @@
+package bloomfilter
+
+import (
+	"hash"
+	"sync"
+)
+
+// RotatingFilter is a pair of compatible filters, active and standby, for
+// streams of elements churning too fast for one filter to hold them, without
+// resorting to a counting filter: elements are added to the active filter,
+// Contains tests both, and Rotate clears the standby filter and makes it the
+// active one. An element is remembered for at least one rotation and at most
+// two, whatever the caller rotates on: a timer, as TTLFilter does, or the
+// active filter filling up.
+type RotatingFilter struct {
+	lock    sync.RWMutex
+	active  *Filter
+	standby *Filter
+}
+
+// NewRotatingFilter of f, active, and an empty filter compatible with it.
+// The filters are owned by the RotatingFilter from now on.
+func NewRotatingFilter(f *Filter) (*RotatingFilter, error) {
+	standby, err := f.NewCompatible()
+	if err != nil {
+		return nil, err
+	}
+	return &RotatingFilter{active: f, standby: standby}, nil
+}
+
+// Rotate clears the standby filter and swaps it with the active one,
+// forgetting the elements added before the previous rotation. Concurrent
+// operations see the filters either before or after the rotation.
+func (r *RotatingFilter) Rotate() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.standby.Reset()
+	r.active, r.standby = r.standby, r.active
+}
+
+// Active filter, to which elements are added, such as to check its
+// saturation. It must not be used after the next rotation.
+func (r *RotatingFilter) Active() *Filter {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.active
+}
+
+// Add a hashable item, v, to the active filter
+func (r *RotatingFilter) Add(v hash.Hash64) {
+	r.AddHash(v.Sum64())
+}
+
+// AddHash adds an already hashed item to the active filter
+func (r *RotatingFilter) AddHash(hash uint64) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	r.active.AddHash(hash)
+}
+
+// Contains tests if v was added since the previous rotation but one
+func (r *RotatingFilter) Contains(v hash.Hash64) bool {
+	return r.ContainsHash(v.Sum64())
+}
+
+// ContainsHash is Contains for an already hashed item
+func (r *RotatingFilter) ContainsHash(hash uint64) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.active.ContainsHash(hash) || r.standby.ContainsHash(hash)
+}
+
+// TestAndAddHash adds the already hashed item, returning whether it was
+// already contained. An item only contained in the standby filter is added
+// to the active one, so that it survives the next rotation.
+func (r *RotatingFilter) TestAndAddHash(hash uint64) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.standby.ContainsHash(hash) {
+		r.active.AddHash(hash)
+		return true
+	}
+	return r.active.TestAndAddHash(hash)
+}
+
+// Close the filters
+func (r *RotatingFilter) Close() (err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err = r.active.Close()
+	if serr := r.standby.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
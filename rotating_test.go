@@ -0,0 +1,57 @@
+package bloomfilter
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRotatingFilter(t *testing.T) {
+	f, _ := New(10000, 5)
+	r, err := NewRotatingFilter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.AddHash(1)
+	if r.TestAndAddHash(2) || !r.ContainsHash(1) || !r.ContainsHash(2) {
+		t.Fatal("elements missing")
+	}
+	r.Rotate()
+	if !r.ContainsHash(1) || r.Active().N() != 0 {
+		t.Fatal("rotation forgot the active elements")
+	}
+	// refreshed into the active filter
+	if !r.TestAndAddHash(2) {
+		t.Fatal("standby element missing")
+	}
+	r.Rotate()
+	if r.ContainsHash(1) || !r.ContainsHash(2) {
+		t.Fatal("elements of two rotations ago remembered")
+	}
+	r.Rotate()
+	if r.ContainsHash(2) {
+		t.Fatal("element remembered")
+	}
+}
+
+func TestRotatingFilterConcurrent(t *testing.T) {
+	f, _ := New(100000, 5)
+	r, _ := NewRotatingFilter(f)
+	defer r.Close()
+	var wg sync.WaitGroup
+	for g := uint64(0); g < 4; g++ {
+		wg.Add(1)
+		go func(g uint64) {
+			defer wg.Done()
+			for i := uint64(0); i < 1000; i++ {
+				r.AddHash(g<<32 | i)
+				if i%100 == 0 {
+					r.Rotate()
+				}
+				_ = r.ContainsHash(i)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,112 @@
+package bloomfilter
+
+import "math"
+
+// Stats describe how full a filter is
+type Stats struct {
+	M, K, N uint64
+	SetBits uint64  // number of bits set
+	Fill    float64 // fraction of the bits set
+	// FalsePositiveProbability going by the bits set, Fill^K
+	FalsePositiveProbability float64
+}
+
+// saturationAlarms maintains the number of bits set in a filter for its
+// alarms
+type saturationAlarms struct {
+	setBits uint64
+	alarms  []saturationAlarm
+}
+
+type saturationAlarm struct {
+	threshold float64
+	fn        func(Stats)
+	above     bool
+}
+
+// OnSaturation calls fn once every time the fraction of the bits of f which
+// are set rises to threshold or above, such as 0.5, the fill of a filter
+// sized optimally for its elements, so that services learn that their
+// filter is degrading without polling it. It fires again only after the
+// fill fell below threshold, such as after Reset, and fires at once if f is
+// already that full.
+//
+// Registering an alarm makes f maintain the number of its bits set, by
+// testing the bits of every element added. fn is called on its own
+// goroutine, so that it can use f.
+func (f *Filter) OnSaturation(threshold float64, fn func(Stats)) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.alarms == nil {
+		f.alarms = &saturationAlarms{setBits: countBits(f.bits)}
+	}
+	f.alarms.alarms = append(f.alarms.alarms,
+		saturationAlarm{threshold: threshold, fn: fn})
+	f.checkAlarms()
+}
+
+// Stats of f, counting the bits set
+func (f *Filter) Stats() Stats {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.stats(countBits(f.bits))
+}
+
+// stats of f with setBits bits set. f must be locked.
+func (f *Filter) stats(setBits uint64) Stats {
+	fill := float64(setBits) / float64(f.m)
+	return Stats{
+		M:                        f.m,
+		K:                        uint64(len(f.keys)),
+		N:                        f.n,
+		SetBits:                  setBits,
+		Fill:                     fill,
+		FalsePositiveProbability: math.Pow(fill, float64(len(f.keys))),
+	}
+}
+
+// insert hash into f, maintaining the number of bits set for the alarms
+// of f, if any, which the caller checks once it counted the element. f must
+// be locked.
+func (f *Filter) insert(hash uint64) {
+	if f.alarms == nil {
+		f.add(hash)
+		return
+	}
+	f.alarms.setBits += f.addCounting(hash)
+}
+
+// testAndInsert is insert, returning whether the bits of hash were all set
+// already. f must be locked.
+func (f *Filter) testAndInsert(hash uint64) bool {
+	if f.alarms == nil {
+		return f.testAndAdd(hash)
+	}
+	added := f.addCounting(hash)
+	f.alarms.setBits += added
+	return added == 0
+}
+
+// recountBits for the alarms of f, if any, after its bits were changed in
+// bulk. f must be locked.
+func (f *Filter) recountBits() {
+	if f.alarms == nil {
+		return
+	}
+	f.alarms.setBits = countBits(f.bits)
+	f.checkAlarms()
+}
+
+// checkAlarms fires the alarms whose threshold the fill of f crossed. f
+// must be locked.
+func (f *Filter) checkAlarms() {
+	fill := float64(f.alarms.setBits) / float64(f.m)
+	for i := range f.alarms.alarms {
+		alarm := &f.alarms.alarms[i]
+		above := fill >= alarm.threshold
+		if above && !alarm.above {
+			go alarm.fn(f.stats(f.alarms.setBits))
+		}
+		alarm.above = above
+	}
+}
@@ -0,0 +1,85 @@
+package bloomfilter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOnSaturation(t *testing.T) {
+	f, err := New(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fired := make(chan Stats, 4)
+	f.OnSaturation(0.25, func(s Stats) { fired <- s })
+
+	var hash uint64
+	for f.Stats().Fill < 0.25 {
+		select {
+		case s := <-fired:
+			t.Fatalf("fired early at fill %v", s.Fill)
+		default:
+		}
+		hash++
+		f.AddHash(hash * 0x9e3779b97f4a7c15)
+	}
+	var s Stats
+	select {
+	case s = <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("alarm did not fire")
+	}
+	if s.Fill < 0.25 || s.SetBits != countBits(f.bits) || s.N != hash {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	// no further alarm while the filter stays saturated
+	for i := 0; i < 100; i++ {
+		hash++
+		f.AddHash(hash * 0x9e3779b97f4a7c15)
+	}
+	select {
+	case s = <-fired:
+		t.Fatalf("fired again at fill %v", s.Fill)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Reset re-arms the alarm, a union past the threshold fires it
+	full, _ := f.NewCompatible()
+	if err := full.UnionInPlace(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Reset()
+	if err := f.UnionInPlace(full); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("alarm did not fire again after Reset")
+	}
+
+	// registering on a saturated filter fires at once
+	f.OnSaturation(0.1, func(s Stats) { fired <- s })
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("alarm did not fire on registration")
+	}
+}
+
+func TestAddCounting(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBlocked()}, {WithRegisterBlocked()}} {
+		f, err := New(4096, 5, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var added uint64
+		for i := uint64(1); i < 300; i++ {
+			added += f.addCounting(i * 0x9e3779b97f4a7c15)
+		}
+		if bits := countBits(f.bits); added != bits {
+			t.Errorf("flags %x: counted %d bits, %d set", f.flags, added, bits)
+		}
+	}
+}
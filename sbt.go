@@ -0,0 +1,138 @@
+package bloomfilter
+
+import (
+	"sync"
+
+	"github.com/steakknife/hamming"
+)
+
+// SequenceBloomTree indexes many compatible filters, such as one per
+// sequencing dataset, to find which of them may contain a query without
+// probing every one of them.
+//
+// It is a binary tree whose leaves are the indexed filters, and whose
+// internal nodes hold the union of the leaves below them, so that a query
+// only descends into the subtrees whose union contains it. An inserted
+// filter descends towards the most similar subtree, by Hamming distance,
+// so that similar filters end up sharing subtrees. The unions take about as
+// much memory as the leaves.
+type SequenceBloomTree struct {
+	lock   sync.RWMutex
+	root   *sbtNode
+	leaves int
+}
+
+type sbtNode struct {
+	filter      *Filter
+	id          string   // leaves only
+	left, right *sbtNode // internal nodes only
+}
+
+// NewSequenceBloomTree with no filters
+func NewSequenceBloomTree() *SequenceBloomTree {
+	return &SequenceBloomTree{}
+}
+
+// Len is the number of indexed filters
+func (t *SequenceBloomTree) Len() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.leaves
+}
+
+// Insert the filter f of the dataset id. f must be compatible with the
+// filters already indexed, and must not be modified afterwards.
+func (t *SequenceBloomTree) Insert(id string, f *Filter) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	leaf := &sbtNode{filter: f, id: id}
+	if t.root == nil {
+		t.root = leaf
+		t.leaves++
+		return nil
+	}
+	if err := t.root.filter.IsCompatible(f); err != nil {
+		return err
+	}
+
+	slot := &t.root
+	for {
+		node := *slot
+		if node.left == nil {
+			union, err := node.filter.Union(f)
+			if err != nil {
+				return err
+			}
+			*slot = &sbtNode{filter: union, left: node, right: leaf}
+			t.leaves++
+			return nil
+		}
+		if err := node.filter.UnionInPlace(f); err != nil {
+			return err
+		}
+		if hammingDistance(node.left.filter, f) <=
+			hammingDistance(node.right.filter, f) {
+			slot = &node.left
+		} else {
+			slot = &node.right
+		}
+	}
+}
+
+// hammingDistance is the number of bits which differ between compatible
+// filters f and f2
+func hammingDistance(f, f2 *Filter) (d uint64) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	f2.lock.RLock()
+	defer f2.lock.RUnlock()
+
+	for i, bitword := range f.bits {
+		d += uint64(hamming.CountBitsUint64(bitword ^ f2.bits[i]))
+	}
+	return d
+}
+
+// Query the ids of the filters which may contain the (already hashed) key
+func (t *SequenceBloomTree) Query(hash uint64) []string {
+	return t.QueryHashes([]uint64{hash}, 1)
+}
+
+// QueryHashes returns the ids of the filters which may contain at least a
+// fraction theta of the (already hashed) keys, such as the k-mers of a
+// sequence. Since a union contains at least as many of the keys as any
+// filter below it, subtrees whose union contains fewer are skipped.
+func (t *SequenceBloomTree) QueryHashes(hashes []uint64, theta float64) (
+	ids []string,
+) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.root == nil {
+		return nil
+	}
+	need := theta * float64(len(hashes))
+	stack := []*sbtNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		found := 0
+		for _, hash := range hashes {
+			if node.filter.ContainsHash(hash) {
+				found++
+			}
+		}
+		if float64(found) < need {
+			continue
+		}
+		if node.left == nil {
+			ids = append(ids, node.id)
+		} else {
+			stack = append(stack, node.right, node.left)
+		}
+	}
+	return ids
+}
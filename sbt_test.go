@@ -0,0 +1,47 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSequenceBloomTree(t *testing.T) {
+	template, _ := New(1<<16, 5)
+	tree := NewSequenceBloomTree()
+	for d := uint64(0); d < 20; d++ {
+		f, _ := template.NewCompatible()
+		for i := uint64(0); i < 100; i++ {
+			f.AddHash(d*1000 + i)
+		}
+		if err := tree.Insert(fmt.Sprint("dataset", d), f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tree.Len() != 20 {
+		t.Fatalf("expected 20 filters, got %d", tree.Len())
+	}
+
+	for d := uint64(0); d < 20; d++ {
+		want := fmt.Sprint("dataset", d)
+		found := false
+		for _, id := range tree.Query(d*1000 + 42) {
+			found = found || id == want
+		}
+		if !found {
+			t.Fatalf("%s not found", want)
+		}
+	}
+
+	// half of the keys of dataset 3, and half of nothing
+	var hashes []uint64
+	for i := uint64(0); i < 50; i++ {
+		hashes = append(hashes, 3000+i, 1000000+i)
+	}
+	ids := tree.QueryHashes(hashes, 0.4)
+	if len(ids) != 1 || ids[0] != "dataset3" {
+		t.Fatalf("expected only dataset3, got %v", ids)
+	}
+	if ids = tree.QueryHashes(hashes, 0.9); len(ids) != 0 {
+		t.Fatalf("expected no dataset, got %v", ids)
+	}
+}
@@ -0,0 +1,297 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"hash"
+	"io"
+	"math/bits"
+	"sync"
+)
+
+// DefaultSegmentBytes is a suitable size for the segments of a
+// SegmentedFilter, 64 MiB
+const DefaultSegmentBytes = 64 << 20
+
+// SegmentedFilter is a Bloom filter whose bits are split into segments of a
+// fixed size, allocated separately rather than as one contiguous array, so
+// that a very large filter never needs a single allocation of its whole
+// size. A segment is only allocated once a bit within it is set, so that
+// memory grows with the filter, and Reset releases all of them.
+//
+// It has the same bits as a Filter with the same keys and options, and the
+// same binary layout, so that either can unmarshal what the other marshals.
+type SegmentedFilter struct {
+	lock     sync.RWMutex
+	core                // keys, m and layout, "bits" being unused
+	segments [][]uint64 // nil until a bit within them is set
+	shift    uint       // log2 of the number of words per segment
+	n        uint64
+}
+
+// NewSegmented SegmentedFilter with CSPRNG keys, see New, with segments of
+// segmentBytes, a power of 2 of at least 64 bytes, such as
+// DefaultSegmentBytes. Of the options, only the ones of the layout, index
+// scheme and range (WithBlocked, WithRegisterBlocked, WithIndexScheme,
+// WithFastRange and WithPowerOfTwo) and WithMaxMemory apply.
+func NewSegmented(m, k, segmentBytes uint64, opts ...Option) (
+	*SegmentedFilter, error,
+) {
+	o := newOptions(opts)
+	c, err := newCore(m, newRandKeys(k), o.flags)
+	if err != nil {
+		return nil, err
+	}
+	words, err := wordsOf(c.m)
+	if err != nil {
+		return nil, err
+	}
+	err = o.checkMemory(words)
+	if err != nil {
+		return nil, err
+	}
+	return newSegmented(c, segmentBytes)
+}
+
+func newSegmented(c core, segmentBytes uint64) (*SegmentedFilter, error) {
+	if segmentBytes < cacheLineSize || segmentBytes&(segmentBytes-1) != 0 {
+		return nil, errSegmentSize(segmentBytes)
+	}
+	if c.m < MMin {
+		return nil, errM()
+	}
+	words, err := wordsOf(c.m)
+	if err != nil {
+		return nil, err
+	}
+	shift := uint(bits.TrailingZeros64(segmentBytes / Uint64Bytes))
+	return &SegmentedFilter{
+		core:     c,
+		segments: make([][]uint64, (words+(1<<shift)-1)>>shift),
+		shift:    shift,
+	}, nil
+}
+
+// NewCompatible SegmentedFilter compatible with f, and with any Filter
+// compatible with f
+func (f *SegmentedFilter) NewCompatible() (*SegmentedFilter, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return newSegmented(f.core, Uint64Bytes<<f.shift)
+}
+
+// M is the size of the filter, in bits
+func (f *SegmentedFilter) M() uint64 {
+	return f.m
+}
+
+// K is the count of keys
+func (f *SegmentedFilter) K() uint64 {
+	return uint64(len(f.keys))
+}
+
+// N is how many elements have been inserted
+func (f *SegmentedFilter) N() uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.n
+}
+
+// CompatibilityHash is that of the compatible Filters, see
+// Filter.CompatibilityHash
+func (f *SegmentedFilter) CompatibilityHash() uint64 {
+	return f.compatibilityHash()
+}
+
+// AllocatedBytes is the memory taken by the segments allocated so far
+func (f *SegmentedFilter) AllocatedBytes() (size uint64) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for _, segment := range f.segments {
+		size += uint64(len(segment)) * Uint64Bytes
+	}
+	return size
+}
+
+// segment s, allocating it if it is nil
+func (f *SegmentedFilter) segment(s uint64) []uint64 {
+	if f.segments[s] == nil {
+		words := uint64(1) << f.shift
+		if last := (f.m+63)/64 - s<<f.shift; last < words {
+			words = last
+		}
+		f.segments[s] = newAlignedWords(words)
+	}
+	return f.segments[s]
+}
+
+// Add a hashable item, v, to the filter
+func (f *SegmentedFilter) Add(v hash.Hash64) {
+	f.AddHash(v.Sum64())
+}
+
+// AddHash adds an already hashed item to the filter
+func (f *SegmentedFilter) AddHash(hash uint64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var buf [16]uint64
+	mask := uint64(1)<<f.shift - 1
+	for _, i := range f.locations(hash, buf[:0]) {
+		word := i >> 6
+		f.segment(word >> f.shift)[word&mask] |= 1 << (i & 0x3f)
+	}
+	f.n++
+}
+
+// Contains tests if f contains v, see Filter.Contains
+func (f *SegmentedFilter) Contains(v hash.Hash64) bool {
+	return f.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if f contains the (already hashed) key
+func (f *SegmentedFilter) ContainsHash(hash uint64) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	var buf [16]uint64
+	mask := uint64(1)<<f.shift - 1
+	for _, i := range f.locations(hash, buf[:0]) {
+		word := i >> 6
+		segment := f.segments[word>>f.shift]
+		if segment == nil || segment[word&mask]&(1<<(i&0x3f)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Reset f to an empty filter, keeping its keys and releasing its segments
+func (f *SegmentedFilter) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for s := range f.segments {
+		f.segments[s] = nil
+	}
+	f.n = 0
+}
+
+// MarshalBinary converts f into the binary layout of a Filter, see
+// Filter.MarshalBinary
+func (f *SegmentedFilter) MarshalBinary() (data []byte, err error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	buf := new(bytes.Buffer)
+	words := (f.m + 63) / 64
+	buf.Grow(int(3+uint64(len(f.keys))+words)*Uint64Bytes + sha512.Size384)
+	h := sha512.New384()
+	w := io.MultiWriter(buf, h)
+
+	header := append([]uint64{
+		uint64(len(f.keys)) | uint64(f.flags)<<32, f.n, f.m,
+	}, f.keys...)
+	err = binary.Write(w, binary.LittleEndian, header)
+	if err != nil {
+		return nil, err
+	}
+	zeros := make([]uint64, wordsChunk)
+	for s, segment := range f.segments {
+		if segment != nil {
+			err = writeWords(w, segment)
+		} else {
+			left := words - uint64(s)<<f.shift
+			if size := uint64(1) << f.shift; left > size {
+				left = size
+			}
+			for ; left > 0 && err == nil; left -= uint64(len(zeros)) {
+				if left < uint64(len(zeros)) {
+					zeros = zeros[:left]
+				}
+				err = writeWords(w, zeros)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	buf.Write(h.Sum(nil))
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary converts the binary layout of a Filter into f, keeping
+// the segments of f at their size, or DefaultSegmentBytes for a zero
+// SegmentedFilter. Segments without any bit set are not allocated.
+func (f *SegmentedFilter) UnmarshalBinary(data []byte) (err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	buf := bytes.NewBuffer(data)
+	k, flags, n, m, err := unmarshalBinaryHeader(buf)
+	if err != nil {
+		return err
+	}
+	err = checkBinarySize(k, (m+63)/64, uint64(len(data)))
+	if err != nil {
+		return err
+	}
+	keys, err := unmarshalBinaryKeys(buf, k)
+	if err != nil {
+		return err
+	}
+	masks, err := newFlagsMasks(flags, keys)
+	if err != nil {
+		return err
+	}
+
+	segmentBytes := uint64(DefaultSegmentBytes)
+	if f.segments != nil {
+		segmentBytes = Uint64Bytes << f.shift
+	}
+	f2, err := newSegmented(core{
+		keys:  keys,
+		m:     m,
+		flags: flags,
+		masks: masks,
+	}, segmentBytes)
+	if err != nil {
+		return err
+	}
+	for s := range f2.segments {
+		segment := f2.segment(uint64(s))
+		err = readWords(buf, segment)
+		if err != nil {
+			return err
+		}
+		if zeroWords(segment) {
+			f2.segments[s] = nil
+		}
+	}
+	if m%64 != 0 {
+		last := f2.segments[len(f2.segments)-1]
+		if last != nil {
+			err = checkTrailingBits(last, m)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = checkBinaryHash(buf, data)
+	if err != nil {
+		return err
+	}
+
+	f.core, f.segments, f.shift, f.n = f2.core, f2.segments, f2.shift, n
+	return nil
+}
+
+// zeroWords is true if no bit of words is set
+func zeroWords(words []uint64) bool {
+	for _, word := range words {
+		if word != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func TestSegmentedFilter(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBlocked()}, {WithRegisterBlocked()}} {
+		// 8 segments of 4 KiB, the last one partial
+		sf, err := NewSegmented(7*32768+1000, 4, 4096, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sf.segments) != 8 || sf.AllocatedBytes() != 0 {
+			t.Fatalf("%d segments, %d bytes allocated",
+				len(sf.segments), sf.AllocatedBytes())
+		}
+		for i := uint64(0); i < 10; i++ {
+			sf.AddHash(i * 0x9e3779b97f4a7c15)
+		}
+		if sf.AllocatedBytes() == 0 {
+			t.Fatalf("%d bytes allocated for 10 elements", sf.AllocatedBytes())
+		}
+
+		data, err := sf.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f Filter
+		if err = f.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if f.CompatibilityHash() != sf.CompatibilityHash() {
+			t.Fatal("unmarshaled Filter is not compatible")
+		}
+		for i := uint64(0); i < 1000; i++ {
+			if f.ContainsHash(i*0x9e3779b97f4a7c15) !=
+				sf.ContainsHash(i*0x9e3779b97f4a7c15) {
+				t.Fatalf("Filter and SegmentedFilter disagree on %d", i)
+			}
+		}
+
+		f.AddHash(42)
+		data, _ = f.MarshalBinary()
+		sf2 := &SegmentedFilter{}
+		if err = sf2.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if !sf2.ContainsHash(42) || sf2.N() != 11 {
+			t.Fatal("SegmentedFilter does not contain what the Filter does")
+		}
+
+		sf2.Reset()
+		if sf2.AllocatedBytes() != 0 || sf2.ContainsHash(42) {
+			t.Fatal("Reset did not release the segments")
+		}
+	}
+
+	if _, err := NewSegmented(1000, 4, 100); err == nil {
+		t.Fatal("expected error for segments of 100 bytes")
+	}
+}
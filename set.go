@@ -0,0 +1,34 @@
+package bloomfilter
+
+import "encoding"
+
+// Set is the interface shared by the filters of the package, such as
+// Filter, SegmentedFilter, CountingQuotientFilter, MortonFilter and
+// GolombSet, for application code treating them uniformly: membership of
+// already hashed elements, and serialization. Filters to which elements
+// can be added are also HashFilters, except CountingQuotientFilter, whose
+// AddHash can fail. Filters of the same kind may be merged by Merge.
+type Set interface {
+	ContainsHash(hash uint64) bool
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// Merge the elements of s2 into s, if their kind supports it: a Filter
+// with a compatible Filter, by UnionInPlace, and a CountingQuotientFilter
+// with a CountingQuotientFilter of the same parameters, by Merge. Other
+// sets cannot be merged, and return an error, as do sets of different
+// kinds.
+func Merge(s, s2 Set) error {
+	switch s := s.(type) {
+	case *Filter:
+		if s2, ok := s2.(*Filter); ok {
+			return s.UnionInPlace(s2)
+		}
+	case *CountingQuotientFilter:
+		if s2, ok := s2.(*CountingQuotientFilter); ok {
+			return s.Merge(s2)
+		}
+	}
+	return errMergeUnsupported(s, s2)
+}
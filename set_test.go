@@ -0,0 +1,56 @@
+package bloomfilter
+
+import "testing"
+
+var (
+	_ Set = (*Filter)(nil)
+	_ Set = (*SegmentedFilter)(nil)
+	_ Set = (*CountingQuotientFilter)(nil)
+	_ Set = (*MortonFilter)(nil)
+	_ Set = (*GolombSet)(nil)
+)
+
+// roundTrip s through its binary layout into empty
+func roundTrip(t *testing.T, s, empty Set) Set {
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = empty.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	return empty
+}
+
+func TestSet(t *testing.T) {
+	f, _ := New(10000, 5)
+	f2, _ := f.NewCompatible()
+	c, _ := NewCountingQuotientFilter(10, 8)
+	c2, _ := NewCountingQuotientFilter(10, 8)
+	for i := uint64(0); i < 100; i++ {
+		f.AddHash(i)
+		f2.AddHash(i + 100)
+		_ = c.AddHash(i)
+		_ = c2.AddHash(i + 100)
+	}
+	for _, sets := range [][3]Set{
+		{f, f2, &Filter{}},
+		{c, c2, &CountingQuotientFilter{}},
+	} {
+		if err := Merge(sets[0], sets[1]); err != nil {
+			t.Fatal(err)
+		}
+		s := roundTrip(t, sets[0], sets[2])
+		for i := uint64(0); i < 200; i++ {
+			if !s.ContainsHash(i) {
+				t.Fatalf("%T: %d missing", s, i)
+			}
+		}
+	}
+
+	m, _ := NewMortonFilter(1000)
+	m2, _ := NewMortonFilter(1000)
+	if Merge(m, m2) == nil || Merge(f, c) == nil {
+		t.Fatal("expected error merging unsupported sets")
+	}
+}
@@ -0,0 +1,89 @@
+package bloomfilter
+
+import (
+	"hash"
+	"sync"
+)
+
+// HashFilter is any filter of already hashed elements, such as Filter,
+// SegmentedFilter or TrackedFilter
+type HashFilter interface {
+	AddHash(hash uint64)
+	ContainsHash(hash uint64) bool
+}
+
+// ShadowFilter mirrors every addition and query to a primary and a shadow
+// filter, configured differently, say with fewer keys or WithBlocked, and
+// counts how often their answers differ, so that a migration to the shadow's
+// configuration can be judged on real traffic. Queries return the primary's
+// answer.
+//
+// Neither filter has false negatives, so a disagreement is a false positive
+// of one of them.
+type ShadowFilter struct {
+	Primary, Shadow HashFilter
+
+	lock  sync.Mutex
+	stats ShadowStats
+}
+
+// ShadowStats are the queries of a ShadowFilter
+type ShadowStats struct {
+	Queries     uint64
+	PrimaryOnly uint64 // contained by the primary only
+	ShadowOnly  uint64 // contained by the shadow only
+}
+
+// NewShadowFilter mirroring primary to shadow. Both should be empty, or
+// hold the same elements.
+func NewShadowFilter(primary, shadow HashFilter) *ShadowFilter {
+	return &ShadowFilter{Primary: primary, Shadow: shadow}
+}
+
+// Add a hashable item, v, to both filters
+func (s *ShadowFilter) Add(v hash.Hash64) {
+	s.AddHash(v.Sum64())
+}
+
+// AddHash adds an already hashed item to both filters
+func (s *ShadowFilter) AddHash(hash uint64) {
+	s.Primary.AddHash(hash)
+	s.Shadow.AddHash(hash)
+}
+
+// Contains tests if the primary filter contains v
+func (s *ShadowFilter) Contains(v hash.Hash64) bool {
+	return s.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if the primary filter contains the (already hashed)
+// key, comparing its answer with the shadow's
+func (s *ShadowFilter) ContainsHash(hash uint64) bool {
+	contained := s.Primary.ContainsHash(hash)
+	shadowed := s.Shadow.ContainsHash(hash)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stats.Queries++
+	if contained && !shadowed {
+		s.stats.PrimaryOnly++
+	}
+	if shadowed && !contained {
+		s.stats.ShadowOnly++
+	}
+	return contained
+}
+
+// Stats of the queries so far
+func (s *ShadowFilter) Stats() ShadowStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.stats
+}
+
+// ResetStats of the queries
+func (s *ShadowFilter) ResetStats() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stats = ShadowStats{}
+}
@@ -0,0 +1,33 @@
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func TestShadowFilter(t *testing.T) {
+	primary, _ := New(100000, 7)
+	shadow, _ := New(100000, 2)
+	s := NewShadowFilter(primary, shadow)
+	for i := uint64(0); i < 10000; i++ {
+		s.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	for i := uint64(0); i < 100000; i++ {
+		if !s.ContainsHash(i*0x9e3779b97f4a7c15) && i < 10000 {
+			t.Fatalf("does not contain %d", i)
+		}
+	}
+
+	stats := s.Stats()
+	if stats.Queries != 100000 {
+		t.Fatalf("%d queries", stats.Queries)
+	}
+	// about 0.8% and 3.3% false positives of 90000 negatives
+	if stats.ShadowOnly < stats.PrimaryOnly || stats.ShadowOnly < 1000 {
+		t.Fatalf("unexpected disagreements %+v", stats)
+	}
+
+	s.ResetStats()
+	if s.Stats() != (ShadowStats{}) {
+		t.Fatal("stats were not reset")
+	}
+}
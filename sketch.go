@@ -0,0 +1,230 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"sync"
+)
+
+const (
+	counterBits     = 4
+	countersPerWord = 64 / counterBits
+	maxCount        = 1<<counterBits - 1
+	// every counter halved at once, see FrequencySketch.halve
+	halveMask = 0x7777777777777777
+)
+
+// FrequencySketch estimates how often keys were seen recently: it is the
+// count-min sketch of 4-bit counters used by W-TinyLFU cache policies, in
+// front of which a Doorkeeper filters out keys seen only once.
+//
+// A key is counted in k counters, chosen out of m like the bits of a Filter
+// with k keys, and its frequency is the smallest of them, saturating at 15.
+// After sampleSize increments, every counter is halved, so that old
+// popularity fades away.
+type FrequencySketch struct {
+	lock       sync.Mutex
+	counters   []uint64 // 16 counters per word
+	keys       []uint64
+	m          uint64 // number of counters
+	n          uint64 // increments since the counters were last halved
+	sampleSize uint64
+	// increment only the smallest counters, see WithConservativeUpdate
+	conservative bool
+}
+
+// NewFrequencySketch of m counters, with k random keys, halving its counters
+// every sampleSize increments. W-TinyLFU uses about as many counters as
+// cache entries, 4 keys, and a sample size of 10 times the cache size.
+//
+// Of opts, only WithConservativeUpdate applies.
+func NewFrequencySketch(m, k, sampleSize uint64, opts ...Option) (*FrequencySketch, error) {
+	if m < MMin {
+		return nil, errM()
+	}
+	words := m/countersPerWord + (m%countersPerWord+countersPerWord-1)/countersPerWord
+	if err := checkWords(words); err != nil {
+		return nil, err
+	}
+	keys, err := newKeysCopy(newRandKeys(k))
+	if err != nil {
+		return nil, err
+	}
+	return &FrequencySketch{
+		counters:     newAlignedWords(words),
+		keys:         keys,
+		m:            m,
+		sampleSize:   sampleSize,
+		conservative: newOptions(opts).conservative,
+	}, nil
+}
+
+// WithConservativeUpdate makes a FrequencySketch increment only the counters
+// of a key which are at its current frequency, the smallest of them, rather
+// than all of them (Estan and Varghese, "New Directions in Traffic
+// Measurement and Accounting"). Frequencies are still never underestimated,
+// but collisions inflate them much less, above all for the rare keys of
+// skewed streams. It does not apply to filters, whose elements could not be
+// removed.
+func WithConservativeUpdate() Option {
+	return func(o *options) {
+		o.conservative = true
+	}
+}
+
+// Increment the frequency of the (already hashed) key
+func (s *FrequencySketch) Increment(hash uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var (
+		i     uint64
+		added bool
+		// the frequency, the counters conservatively incremented
+		min uint64
+	)
+	if s.conservative {
+		min = s.frequency(hash)
+	}
+	for n := 0; n < len(s.keys); n++ {
+		i = (hash ^ s.keys[n]) % s.m
+		shift := uint(i%countersPerWord) * counterBits
+		c := (s.counters[i/countersPerWord] >> shift) & maxCount
+		if c < maxCount && (!s.conservative || c == min) {
+			s.counters[i/countersPerWord] += 1 << shift
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+	s.n++
+	if s.n >= s.sampleSize {
+		s.halve()
+	}
+}
+
+// CountHash is the estimated count of the (already hashed) key, up to 15,
+// the smallest of its counters, like CountingFilter.CountHash. Collisions
+// can only make it higher than the actual count, as halved along with every
+// counter.
+func (s *FrequencySketch) CountHash(hash uint64) uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.frequency(hash)
+}
+
+// frequency is CountHash. s must be locked.
+func (s *FrequencySketch) frequency(hash uint64) uint64 {
+	var (
+		i    uint64
+		freq = uint64(maxCount)
+	)
+	for n := 0; n < len(s.keys); n++ {
+		i = (hash ^ s.keys[n]) % s.m
+		shift := uint(i%countersPerWord) * counterBits
+		c := (s.counters[i/countersPerWord] >> shift) & maxCount
+		if c < freq {
+			freq = c
+		}
+	}
+	return freq
+}
+
+// halve every counter. s must be locked.
+func (s *FrequencySketch) halve() {
+	for i, word := range s.counters {
+		s.counters[i] = (word >> 1) & halveMask
+	}
+	s.n /= 2
+}
+
+// HalveAll halves every counter now, as is done every sampleSize
+// increments, so that a long-running tracker can forget old popularity on
+// its own schedule
+func (s *FrequencySketch) HalveAll() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.halve()
+}
+
+// Vacuum clamps every counter to at most max, so that keys which were
+// popular long ago do not outweigh the ones seen recently for as long
+func (s *FrequencySketch) Vacuum(max uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if max >= maxCount {
+		return
+	}
+	for i, word := range s.counters {
+		for shift := uint(0); shift < 64; shift += counterBits {
+			if (word>>shift)&maxCount > max {
+				word = word&^(maxCount<<shift) | max<<shift
+			}
+		}
+		s.counters[i] = word
+	}
+}
+
+// Reset every counter to 0
+func (s *FrequencySketch) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i := range s.counters {
+		s.counters[i] = 0
+	}
+	s.n = 0
+}
+
+// MarshalBinary converts s into []bytes, in the same layout as a Filter,
+// with the counters as the bits and the increments since the last halving
+// as n
+func (s *FrequencySketch) MarshalBinary() (data []byte, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	buf, _, err := marshalWords(s.keys, 0, s.n, s.m, s.counters)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary converts []bytes written by MarshalBinary into s. The
+// sample size is not serialized: s keeps its own, or uses 10*m if it has
+// none.
+func (s *FrequencySketch) UnmarshalBinary(data []byte) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	buf := bytes.NewBuffer(data)
+	k, flags, n, m, err := unmarshalBinaryHeader(buf)
+	if err != nil {
+		return err
+	}
+	if flags != 0 {
+		return errFlags(flags)
+	}
+	words := (m + countersPerWord - 1) / countersPerWord
+	err = checkBinarySize(k, words, uint64(len(data)))
+	if err != nil {
+		return err
+	}
+	keys, err := unmarshalBinaryKeys(buf, k)
+	if err != nil {
+		return err
+	}
+	counters, err := unmarshalBinaryWords(buf, words)
+	if err != nil {
+		return err
+	}
+	err = checkBinaryHash(buf, data)
+	if err != nil {
+		return err
+	}
+
+	s.keys, s.n, s.m, s.counters = keys, n, m, counters
+	if s.sampleSize == 0 {
+		s.sampleSize = 10 * m
+	}
+	return nil
+}
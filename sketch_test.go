@@ -0,0 +1,108 @@
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func TestFrequencySketch(t *testing.T) {
+	s, err := NewFrequencySketch(1000, 4, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		s.Increment(42)
+	}
+	for i := 0; i < 100; i++ {
+		s.Increment(7)
+	}
+	if f := s.CountHash(42); f < 5 {
+		t.Fatalf("frequency of 42 is %d, expected at least 5", f)
+	}
+	if f := s.CountHash(7); f != maxCount {
+		t.Fatalf("frequency of 7 is %d, expected to saturate at %d", f, maxCount)
+	}
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s2 FrequencySketch
+	if err = s2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if s2.CountHash(42) != s.CountHash(42) || s2.CountHash(7) != s.CountHash(7) {
+		t.Fatal("frequencies changed by serialization")
+	}
+
+	s.halve()
+	if f := s.CountHash(7); f != maxCount/2 {
+		t.Fatalf("frequency of 7 is %d after halving, expected %d", f, maxCount/2)
+	}
+}
+
+func TestFrequencySketchAging(t *testing.T) {
+	s, _ := NewFrequencySketch(1000, 4, 10)
+	for i := 0; i < 9; i++ {
+		s.Increment(42)
+	}
+	if f := s.CountHash(42); f != 9 {
+		t.Fatalf("frequency of 42 is %d, expected 9", f)
+	}
+	s.Increment(42) // 10th increment halves the counters
+	if f := s.CountHash(42); f != 5 {
+		t.Fatalf("frequency of 42 is %d after aging, expected 5", f)
+	}
+}
+
+func TestFrequencySketchDecay(t *testing.T) {
+	s, _ := NewFrequencySketch(1000, 4, 1000)
+	for i := 0; i < 12; i++ {
+		s.Increment(42)
+	}
+	s.Increment(43)
+	s.HalveAll()
+	if f := s.CountHash(42); f != 6 {
+		t.Fatalf("frequency of 42 is %d after halving, expected 6", f)
+	}
+	s.Vacuum(4)
+	if f := s.CountHash(42); f != 4 {
+		t.Fatalf("frequency of 42 is %d after vacuum, expected 4", f)
+	}
+	if f := s.CountHash(43); f != 0 {
+		t.Fatalf("frequency of 43 is %d, expected 0", f)
+	}
+}
+
+func TestFrequencySketchConservativeUpdate(t *testing.T) {
+	// a small sketch, so that keys collide often
+	s, _ := NewFrequencySketch(1024, 4, 1<<20)
+	cs, _ := NewFrequencySketch(1024, 4, 1<<20, WithConservativeUpdate())
+	// fixed keys, so that the collisions are the same on every run
+	s.keys = []uint64{0x243f6a8885a308d3, 0x13198a2e03707344,
+		0xa4093822299f31d0, 0x082efa98ec4e6c89}
+	cs.keys = s.keys
+
+	// a skewed stream: key i seen 1 + 8/(i+1) times
+	for i := uint64(0); i < 200; i++ {
+		for j := uint64(0); j <= 8/(i+1); j++ {
+			s.Increment(i * 0x9e3779b97f4a7c15)
+			cs.Increment(i * 0x9e3779b97f4a7c15)
+		}
+	}
+
+	var errs, conservativeErrs uint64
+	for i := uint64(0); i < 200; i++ {
+		actual := 1 + 8/(i+1)
+		f, cf := s.CountHash(i*0x9e3779b97f4a7c15), cs.CountHash(i*0x9e3779b97f4a7c15)
+		if cf < actual || cf > f {
+			t.Fatalf("key %d seen %d times, estimated %d, conservatively %d",
+				i, actual, f, cf)
+		}
+		errs += f - actual
+		conservativeErrs += cf - actual
+	}
+	if conservativeErrs*2 > errs {
+		t.Fatalf("overestimated by %d in all, conservatively by %d",
+			errs, conservativeErrs)
+	}
+}
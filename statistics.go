@@ -21,7 +21,7 @@ func (f *Filter) PreciseFilledRatio() float64 {
 	f.lock.RLock()
 	defer f.lock.RUnlock()
 
-	return float64(hamming.CountBitsUint64s(f.bits)) / float64(f.M())
+	return float64(countBits(f.bits)) / float64(f.M())
 }
 
 // N is how many elements have been inserted
@@ -34,10 +34,125 @@ func (f *Filter) N() uint64 {
 }
 
 // FalsePosititveProbability is the upper-bound probability of false positives
-//  (1 - exp(-k*(n+0.5)/(m-1))) ** k
+// with the N elements added so far, see FPForN
 func (f *Filter) FalsePosititveProbability() float64 {
-	k := float64(f.K())
-	n := float64(f.N())
-	m := float64(f.M())
-	return math.Pow(1.0-math.Exp(-k)*(n+0.5)/(m-1), k)
+	return f.FPForN(f.N())
+}
+
+// FPForN is the upper-bound probability of false positives if n elements
+// were added to f, such as to plan what pushing 3 times the designed number
+// of elements into f would do
+func (f *Filter) FPForN(n uint64) float64 {
+	return FalsePositiveProbability(f.M(), f.K(), n)
+}
+
+// FalsePositiveProbability is the upper-bound probability of false
+// positives of a filter with m bits and k keys into which n elements were
+// added
+//  (1 - exp(-k*(n+0.5)/(m-1))) ** k
+func FalsePositiveProbability(m, k, n uint64) float64 {
+	if m < 2 {
+		return 1
+	}
+	kf := float64(k)
+	return math.Pow(1.0-math.Exp(-kf*(float64(n)+0.5)/float64(m-1)), kf)
+}
+
+// estimateN is the estimated number of distinct elements inserted into a
+// filter with m bits and k keys, of which setBits are 1's
+//  -m/k * ln(1 - setBits/m)
+// A full filter is taken to miss one bit, for a finite estimate: the most
+// its bits can tell.
+func estimateN(setBits, m, k uint64) float64 {
+	if setBits >= m && m > 1 {
+		setBits = m - 1
+	}
+	return -float64(m) / float64(k) * math.Log(1-float64(setBits)/float64(m))
+}
+
+// countBits is the number of 1's in words, as a uint64 rather than the int
+// of hamming.CountBitsUint64s, which overflows on 32-bit platforms, with the
+// kernel selected for this CPU
+func countBits(words []uint64) (n uint64) {
+	return kernels.popcount(words)
+}
+
+// countBits is the number of 1's in f, in f2 and in their union
+func (f *Filter) countBits(f2 *Filter) (setBits, setBits2, unionBits uint64) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	if f2 != f {
+		f2.lock.RLock()
+		defer f2.lock.RUnlock()
+	}
+
+	for i, bitword := range f.bits {
+		setBits += uint64(hamming.CountBitsUint64(bitword))
+		setBits2 += uint64(hamming.CountBitsUint64(f2.bits[i]))
+		unionBits += uint64(hamming.CountBitsUint64(bitword | f2.bits[i]))
+	}
+	return setBits, setBits2, unionBits
+}
+
+// IntersectionEstimate is the estimated number of distinct elements in both
+// f and f2, by inclusion-exclusion over the cardinalities estimated from the
+// fill ratios of f, f2 and their union
+func (f *Filter) IntersectionEstimate(f2 *Filter) (float64, error) {
+	if err := f.IsCompatible(f2); err != nil {
+		return 0, err
+	}
+	if invariants {
+		checkCompatible(f, f2)
+	}
+
+	setBits, setBits2, unionBits := f.countBits(f2)
+	m, k := f.M(), f.K()
+	est := estimateN(setBits, m, k) + estimateN(setBits2, m, k) -
+		estimateN(unionBits, m, k)
+	return math.Max(est, 0), nil
+}
+
+// DifferenceEstimate is the estimated number of distinct elements in f but
+// not in f2, i.e. the cardinality of their union minus that of f2, both
+// estimated from fill ratios
+func (f *Filter) DifferenceEstimate(f2 *Filter) (float64, error) {
+	if err := f.IsCompatible(f2); err != nil {
+		return 0, err
+	}
+	if invariants {
+		checkCompatible(f, f2)
+	}
+
+	_, setBits2, unionBits := f.countBits(f2)
+	m, k := f.M(), f.K()
+	est := estimateN(unionBits, m, k) - estimateN(setBits2, m, k)
+	return math.Max(est, 0), nil
+}
+
+// AddsUntilFP is the estimated number of distinct elements which can still
+// be added to f before its false positive probability exceeds target, such
+// as to rotate f when fewer than a million adds remain before it exceeds
+// 0.001. The elements already in f are estimated from its fill ratio, so
+// that repeated adds are not counted.
+//  -m/k * ln(1 - target**(1/k)) - n
+func (f *Filter) AddsUntilFP(target float64) uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if target >= 1 {
+		return math.MaxUint64
+	}
+	if target <= 0 || len(f.keys) == 0 {
+		return 0
+	}
+	k := float64(len(f.keys))
+	maxN := -float64(f.m) / k * math.Log(1-math.Pow(target, 1/k))
+	remaining := maxN - estimateN(countBits(f.bits), f.m, uint64(len(f.keys)))
+	if remaining <= 0 {
+		return 0
+	}
+	if remaining >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(remaining)
 }
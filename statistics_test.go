@@ -0,0 +1,141 @@
+package bloomfilter
+
+import (
+	"math"
+	"testing"
+)
+
+// overlappingFilters returns two compatible filters holding na and nb
+// distinct values, of which common are in both
+func overlappingFilters(na, nb, common uint64) (a, b *Filter) {
+	a, _ = New(1000003, 5)
+	b, _ = a.NewCompatible()
+	for i := uint64(0); i < na; i++ {
+		a.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	for i := na - common; i < na-common+nb; i++ {
+		b.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	return a, b
+}
+
+func TestIntersectionEstimate(t *testing.T) {
+	a, b := overlappingFilters(20000, 30000, 5000)
+	est, err := a.IntersectionEstimate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(est-5000) > 500 {
+		t.Errorf("intersection estimate %f, expected about 5000", est)
+	}
+
+	est, _ = a.IntersectionEstimate(a)
+	if math.Abs(est-20000) > 500 {
+		t.Errorf("self intersection estimate %f, expected about 20000", est)
+	}
+}
+
+func TestEstimatesFull(t *testing.T) {
+	a, b := overlappingFilters(20000, 30000, 5000)
+	full, _ := a.NewCompatible()
+	for i := range full.bits {
+		full.bits[i] = ^uint64(0)
+	}
+	full.bits[len(full.bits)-1] = 1<<(full.M()%64) - 1 // none beyond m
+	for _, c := range []struct{ f, f2 *Filter }{{full, b}, {b, full}, {full, full}} {
+		est, err := c.f.IntersectionEstimate(c.f2)
+		if err != nil || math.IsNaN(est) || math.IsInf(est, 0) {
+			t.Errorf("intersection estimate %f, %v", est, err)
+		}
+		est, err = c.f.DifferenceEstimate(c.f2)
+		if err != nil || math.IsNaN(est) || math.IsInf(est, 0) {
+			t.Errorf("difference estimate %f, %v", est, err)
+		}
+	}
+	if n := estimateN(full.M(), full.M(), full.K()); math.IsInf(n, 0) {
+		t.Errorf("estimate of a full filter %f", n)
+	}
+}
+
+func TestDifferenceEstimate(t *testing.T) {
+	a, b := overlappingFilters(20000, 30000, 5000)
+	est, err := a.DifferenceEstimate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(est-15000) > 500 {
+		t.Errorf("difference estimate %f, expected about 15000", est)
+	}
+
+	est, _ = b.DifferenceEstimate(a)
+	if math.Abs(est-25000) > 500 {
+		t.Errorf("difference estimate %f, expected about 25000", est)
+	}
+
+	est, _ = a.DifferenceEstimate(a)
+	if est != 0 {
+		t.Errorf("self difference estimate %f, expected 0", est)
+	}
+}
+
+func TestAddsUntilFP(t *testing.T) {
+	f, err := NewOptimal(10000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adds := f.AddsUntilFP(0.01); adds < 9700 || adds > 10300 {
+		t.Errorf("empty filter: %d adds until FP 0.01, expected about 10000",
+			adds)
+	}
+
+	for i := uint64(0); i < 4000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+		f.AddHash(i * 0x9e3779b97f4a7c15) // repeated adds are not counted
+	}
+	adds := f.AddsUntilFP(0.01)
+	if adds < 5700 || adds > 6300 {
+		t.Errorf("%d adds until FP 0.01, expected about 6000", adds)
+	}
+	for i := uint64(4000); i < 4000+adds; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	fp := math.Pow(f.PreciseFilledRatio(), float64(f.K()))
+	if math.Abs(fp-0.01) > 0.002 {
+		t.Errorf("FP %f after the remaining adds, expected about 0.01", fp)
+	}
+	if adds := f.AddsUntilFP(0.001); adds != 0 {
+		t.Errorf("%d adds until FP 0.001 on a filter past it", adds)
+	}
+
+	if adds := f.AddsUntilFP(1); adds != math.MaxUint64 {
+		t.Errorf("%d adds until FP 1", adds)
+	}
+}
+
+func TestFPForN(t *testing.T) {
+	f, err := NewOptimal(10000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp := f.FPForN(10000); math.Abs(fp-0.01) > 0.001 {
+		t.Errorf("FP %f at the designed n, expected about 0.01", fp)
+	}
+	if fp := f.FPForN(30000); fp < 0.4 || fp > 0.5 {
+		t.Errorf("FP %f at 3 times the designed n", fp)
+	}
+	if fp := f.FalsePosititveProbability(); fp > 1e-9 {
+		t.Errorf("FP %f of an empty filter", fp)
+	}
+
+	for i := uint64(0); i < 10000; i++ {
+		f.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	fp := math.Pow(f.PreciseFilledRatio(), float64(f.K()))
+	if math.Abs(f.FalsePosititveProbability()-fp) > 0.002 {
+		t.Errorf("FP %f, expected about %f going by the bits set",
+			f.FalsePosititveProbability(), fp)
+	}
+	if FalsePositiveProbability(f.M(), f.K(), 10000) != f.FPForN(10000) {
+		t.Error("FalsePositiveProbability differs from FPForN")
+	}
+}
@@ -0,0 +1,163 @@
+package bloomfilter
+
+import (
+	"sync"
+)
+
+// Storage holds the bits of a StorageFilter, as words of 64 bits laid out
+// like the bits of a Filter, bit i being bit i%64 of word i/64, so that
+// the bits can be kept elsewhere than in a slice, such as in a memory
+// mapping, a remote store or compressed, with the same probe logic.
+//
+// GetWord may be called concurrently, but never along with OrWord.
+type Storage interface {
+	// GetWord is word i
+	GetWord(i uint64) uint64
+	// OrWord sets the bits of mask in word i
+	OrWord(i, mask uint64)
+	// Len is the number of words
+	Len() uint64
+}
+
+// SliceStorage is the Storage of a slice, the default
+type SliceStorage []uint64
+
+// GetWord is word i
+func (w SliceStorage) GetWord(i uint64) uint64 {
+	return w[i]
+}
+
+// OrWord sets the bits of mask in word i
+func (w SliceStorage) OrWord(i, mask uint64) {
+	w[i] |= mask
+}
+
+// Len is the number of words
+func (w SliceStorage) Len() uint64 {
+	return uint64(len(w))
+}
+
+// probeBuffer is the number of locations a StorageFilter probes without
+// allocating
+const probeBuffer = 16
+
+// StorageFilter is a Bloom filter whose bits are held by a Storage, probed
+// like those of a Filter with the same keys and options, so that either
+// can be converted to the other.
+//
+// It is a separate type, which only adds and tests elements: a Filter
+// always holds its bits in a slice, and the rest of its API, such as
+// unions, serialization, hooks and saturation alarms, is only available
+// on the Filter taken by Snapshot.
+type StorageFilter struct {
+	lock    sync.RWMutex
+	core    core // without bits
+	storage Storage
+	n       uint64
+}
+
+// NewStorageFilter creates a StorageFilter of m bits and k keys, see New,
+// its bits held by storage, which must have the words of m bits: (m+63)/64,
+// once m is rounded as options such as WithBlocked require. The keys are
+// random, unless given WithKeys. If storage is nil, the bits are held by
+// a SliceStorage.
+//
+// Of opts, only the ones of the layout and index scheme, and WithKeys,
+// apply.
+func NewStorageFilter(m, k uint64, storage Storage, opts ...Option) (
+	*StorageFilter, error,
+) {
+	o := newOptions(opts)
+	keys := o.keys
+	if keys == nil {
+		keys = newRandKeys(k)
+	}
+	if uint64(len(keys)) != k {
+		return nil, errKeysLen(k, len(keys))
+	}
+	c, err := newCore(m, keys, o.flags)
+	if err != nil {
+		return nil, err
+	}
+	if c.m < MMin {
+		return nil, errM()
+	}
+	words, err := wordsOf(c.m)
+	if err != nil {
+		return nil, err
+	}
+	if storage == nil {
+		storage = SliceStorage(newAlignedWords(words))
+	}
+	if storage.Len() != words {
+		return nil, errStorageLen(c.m, storage.Len())
+	}
+	return &StorageFilter{core: c, storage: storage}, nil
+}
+
+// M is the size of the filter, in bits
+func (s *StorageFilter) M() uint64 {
+	return s.core.m
+}
+
+// K is the number of keys
+func (s *StorageFilter) K() uint64 {
+	return uint64(len(s.core.keys))
+}
+
+// N is the number of elements added
+func (s *StorageFilter) N() uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.n
+}
+
+// Storage holding the bits of s
+func (s *StorageFilter) Storage() Storage {
+	return s.storage
+}
+
+// AddHash adds the (already hashed) element
+func (s *StorageFilter) AddHash(hash uint64) {
+	var wordsBuf, masksBuf [probeBuffer]uint64
+	words, masks := s.core.wordMasks(hash, wordsBuf[:], masksBuf[:])
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for j, w := range words {
+		s.storage.OrWord(w, masks[j])
+	}
+	s.n++
+}
+
+// ContainsHash tests if the (already hashed) element (maybe) was added
+func (s *StorageFilter) ContainsHash(hash uint64) bool {
+	var wordsBuf, masksBuf [probeBuffer]uint64
+	words, masks := s.core.wordMasks(hash, wordsBuf[:], masksBuf[:])
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for j, w := range words {
+		if s.storage.GetWord(w)&masks[j] != masks[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshot copies the filter to a Filter with the same keys and options,
+// so that it can be serialized or combined with other filters
+func (s *StorageFilter) Snapshot() (*Filter, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	out, err := newWithOptions(s.core.m, s.core.keys,
+		options{flags: s.core.flags})
+	if err != nil {
+		return nil, err
+	}
+	for i := range out.bits {
+		out.bits[i] = s.storage.GetWord(uint64(i))
+	}
+	out.n = s.n
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package bloomfilter
+
+import (
+	"testing"
+)
+
+// sparseStorage holds only the words which are not 0
+type sparseStorage struct {
+	words map[uint64]uint64
+	len   uint64
+}
+
+func (s *sparseStorage) GetWord(i uint64) uint64 {
+	return s.words[i]
+}
+
+func (s *sparseStorage) OrWord(i, mask uint64) {
+	s.words[i] |= mask
+}
+
+func (s *sparseStorage) Len() uint64 {
+	return s.len
+}
+
+func TestStorageFilter(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBlocked()},
+		{WithRegisterBlocked()}, {WithIndexScheme(EnhancedDoubleHashing)},
+		{WithFastRange()}} {
+		f, _ := New(100000, 5, opts...)
+		storage := &sparseStorage{words: map[uint64]uint64{},
+			len: uint64(len(f.bits))}
+		s, err := NewStorageFilter(100000, 5, storage,
+			append(opts, WithKeys(f.keys))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := uint64(0); i < 1000; i++ {
+			f.AddHash(i * 0x9e3779b97f4a7c15)
+			s.AddHash(i * 0x9e3779b97f4a7c15)
+		}
+		for i := uint64(0); i < 1000; i++ {
+			if !s.ContainsHash(i * 0x9e3779b97f4a7c15) {
+				t.Fatalf("false negative for %d", i)
+			}
+		}
+		for i := uint64(0); i < 10000; i++ {
+			hash := i * 0x2545f4914f6cdd1d
+			if s.ContainsHash(hash) != f.ContainsHash(hash) {
+				t.Fatalf("probes %d unlike a Filter", hash)
+			}
+		}
+
+		snapshot, err := s.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameFilter(f, snapshot) || s.N() != 1000 || s.M() != f.M() ||
+			s.K() != 5 {
+			t.Fatal("snapshot differs from the filter")
+		}
+	}
+}
+
+func TestStorageFilterWords(t *testing.T) {
+	s, err := NewStorageFilter(1000, 3, nil, WithBlocked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words, ok := s.Storage().(SliceStorage); !ok || len(words) != 16 ||
+		s.M() != 1024 {
+		t.Fatalf("%T storage of %d bits", s.Storage(), s.M())
+	}
+	s.AddHash(42)
+	if !s.ContainsHash(42) {
+		t.Fatal("false negative")
+	}
+
+	if _, err = NewStorageFilter(1000, 3, make(SliceStorage, 15)); err == nil {
+		t.Fatal("expected error for a storage too small")
+	}
+	if _, err = NewStorageFilter(1000, 3, nil,
+		WithKeys([]uint64{1, 2})); err == nil {
+		t.Fatal("expected error for too few keys")
+	}
+}
@@ -23,14 +23,16 @@ func (f *Filter) MarshalText() (text []byte, err error) {
 	s += fmt.Sprintln(f.n)
 	s += fmt.Sprintln("m")
 	s += fmt.Sprintln(f.m)
+	s += fmt.Sprintln("flags")
+	s += fmt.Sprintln(f.flags)
 
 	s += fmt.Sprintln("keys")
-	for key := range f.keys {
+	for _, key := range f.keys {
 		s += fmt.Sprintf(keyFormat, key) + nl()
 	}
 
 	s += fmt.Sprintln("bits")
-	for w := range f.bits {
+	for _, w := range f.bits {
 		s += fmt.Sprintf(bitsFormat, w) + nl()
 	}
 
@@ -39,7 +41,7 @@ func (f *Filter) MarshalText() (text []byte, err error) {
 		return nil, err
 	}
 	s += fmt.Sprintln("sha384")
-	for b := range hash {
+	for _, b := range hash {
 		s += fmt.Sprintf("%02x", b)
 	}
 	s += nl()
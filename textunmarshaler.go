@@ -27,44 +27,60 @@ func nl() string {
 	return fmt.Sprintln()
 }
 
-func unmarshalTextHeader(r io.Reader) (k, n, m uint64, err error) {
+func unmarshalTextHeader(r io.Reader) (
+	k uint64, flags uint32, n, m uint64, err error,
+) {
 	format := "k" + nl() + "%d" + nl()
 	format += "n" + nl() + "%d" + nl()
 	format += "m" + nl() + "%d" + nl()
+	format += "flags" + nl() + "%d" + nl()
 	format += "keys" + nl()
 
-	_, err = fmt.Fscanf(r, format, k, n, m)
-	return k, n, m, err
+	_, err = fmt.Fscanf(r, format, &k, &n, &m, &flags)
+	return k, flags, n, m, err
 }
 
-func unmarshalTextKeys(r io.Reader, keys []uint64) (err error) {
-	for i := range keys {
-		_, err = fmt.Fscanf(r, keyFormat, keys[i])
+// unmarshalTextWords reads count words in format, growing them wordsChunk
+// at a time as they are read, so that a count the text cannot hold fails
+// before it is allocated
+func unmarshalTextWords(r io.Reader, count uint64, format string) (
+	words []uint64, err error,
+) {
+	capacity := count
+	if capacity > wordsChunk {
+		capacity = wordsChunk
+	}
+	words = make([]uint64, 0, capacity)
+	for uint64(len(words)) < count {
+		var word uint64
+		_, err = fmt.Fscanf(r, format+nl(), &word)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		words = append(words, word)
 	}
-	return nil
+	return words, nil
 }
 
-func unmarshalTextBits(r io.Reader, bits []uint64) (err error) {
-	_, err = fmt.Fscanf(r, "bits")
+func unmarshalTextKeys(r io.Reader, k uint64) (keys []uint64, err error) {
+	return unmarshalTextWords(r, k, keyFormat)
+}
+
+func unmarshalTextBits(r io.Reader, m uint64) (bits []uint64, err error) {
+	_, err = fmt.Fscanf(r, "bits"+nl())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for i := range bits {
-		_, err = fmt.Fscanf(r, bitsFormat, bits[i])
-		if err != nil {
-			return err
-		}
+	words, err := wordsOf(m)
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	return unmarshalTextWords(r, words, bitsFormat)
 }
 
 func unmarshalAndCheckTextHash(r io.Reader, f *Filter) (err error) {
-	_, err = fmt.Fscanf(r, "sha384")
+	_, err = fmt.Fscanf(r, "sha384"+nl())
 	if err != nil {
 		return err
 	}
@@ -72,7 +88,7 @@ func unmarshalAndCheckTextHash(r io.Reader, f *Filter) (err error) {
 	actualHash := [sha512.Size384]byte{}
 
 	for i := range actualHash {
-		_, err = fmt.Fscanf(r, "%02x", actualHash[i])
+		_, err = fmt.Fscanf(r, "%02x", &actualHash[i])
 		if err != nil {
 			return err
 		}
@@ -93,32 +109,27 @@ func unmarshalAndCheckTextHash(r io.Reader, f *Filter) (err error) {
 // UnmarshalText conforms to TextUnmarshaler
 func UnmarshalText(text []byte) (f *Filter, err error) {
 	r := bytes.NewBuffer(text)
-	k, n, m, err := unmarshalTextHeader(r)
+	k, flags, n, m, err := unmarshalTextHeader(r)
 	if err != nil {
 		return nil, err
 	}
 
-	keys, err := newKeysBlank(k)
+	err = checkHeader(k, flags, m)
 	if err != nil {
 		return nil, err
 	}
 
-	err = unmarshalTextKeys(r, keys)
+	keys, err := unmarshalTextKeys(r, k)
 	if err != nil {
 		return nil, err
 	}
 
-	bits, err := newBits(m)
+	bits, err := unmarshalTextBits(r, m)
 	if err != nil {
 		return nil, err
 	}
 
-	err = unmarshalTextBits(r, bits)
-	if err != nil {
-		return nil, err
-	}
-
-	f, err = newWithKeysAndBits(m, keys, bits, n)
+	f, err = newWithKeysAndBits(m, keys, bits, n, flags)
 	if err != nil {
 		return nil, err
 	}
@@ -141,10 +152,15 @@ func (f *Filter) UnmarshalText(text []byte) error {
 		return err
 	}
 
-	f.m = f2.m
+	f.gen++
+	err = f.releaseMem()
+	if err != nil {
+		return err
+	}
+
+	f.core = f2.core
 	f.n = f2.n
-	copy(f.bits, f2.bits)
-	copy(f.keys, f2.keys)
+	f.recountBits()
 
 	return nil
 }
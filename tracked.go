@@ -0,0 +1,152 @@
+package bloomfilter
+
+import (
+	"hash"
+	"math"
+	"sync"
+)
+
+// TrackedFilter measures the actual false positive rate of a Filter, to
+// check it against the theory in production. The elements whose hashes
+// fall in a sample of the hash space are also kept in an exact set, or
+// looked up in an external oracle, so that their queries are known to be
+// true or false positives.
+//
+// It does not embed the Filter, so that every addition goes through it and
+// its sample: see Filter for the rest of the Filter methods.
+type TrackedFilter struct {
+	f *Filter
+
+	lock      sync.Mutex
+	threshold uint64 // elements with mix64(hash) < threshold are sampled
+	exact     map[uint64]struct{}
+	oracle    func(hash uint64) bool
+	stats     TrackedStats
+}
+
+// TrackedStats are the queries of the sampled elements of a TrackedFilter
+type TrackedStats struct {
+	Negatives      uint64 // queries of elements never added
+	FalsePositives uint64 // of these, those the filter contained
+}
+
+// Rate is the observed false positive rate, or NaN without negatives
+func (s TrackedStats) Rate() float64 {
+	if s.Negatives == 0 {
+		return math.NaN()
+	}
+	return float64(s.FalsePositives) / float64(s.Negatives)
+}
+
+// NewTrackedFilter tracking a fraction sampleRate of the elements of f in
+// an exact set, which takes about 50 bytes per sampled element. Only the
+// elements added through the TrackedFilter are tracked.
+func NewTrackedFilter(f *Filter, sampleRate float64) *TrackedFilter {
+	t := NewTrackedFilterWithOracle(f, sampleRate, nil)
+	t.exact = make(map[uint64]struct{})
+	return t
+}
+
+// NewTrackedFilterWithOracle tracking a fraction sampleRate of the
+// elements of f, whose true membership is given by oracle, such as a
+// database lookup, rather than an exact set
+func NewTrackedFilterWithOracle(f *Filter, sampleRate float64,
+	oracle func(hash uint64) bool,
+) *TrackedFilter {
+	threshold := ^uint64(0)
+	if sampleRate < 1 {
+		threshold = uint64(math.Max(sampleRate, 0) * (1 << 64))
+	}
+	return &TrackedFilter{
+		f:         f,
+		threshold: threshold,
+		oracle:    oracle,
+	}
+}
+
+// sampled is true if the element of hash is tracked
+func (t *TrackedFilter) sampled(hash uint64) bool {
+	return mix64(hash) < t.threshold
+}
+
+// Add a hashable item, v, to the filter
+func (t *TrackedFilter) Add(v hash.Hash64) {
+	t.AddHash(v.Sum64())
+}
+
+// AddHash adds an already hashed item to the filter
+func (t *TrackedFilter) AddHash(hash uint64) {
+	t.f.AddHash(hash)
+	if t.exact != nil && t.sampled(hash) {
+		t.lock.Lock()
+		t.exact[hash] = struct{}{}
+		t.lock.Unlock()
+	}
+}
+
+// AddHashes adds already hashed items to the filter, taking the locks once
+// for all of them
+func (t *TrackedFilter) AddHashes(hashes []uint64) {
+	t.f.AddHashes(hashes)
+	if t.exact == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, hash := range hashes {
+		if t.sampled(hash) {
+			t.exact[hash] = struct{}{}
+		}
+	}
+}
+
+// Filter tracked, whose elements added or merged other than through t are
+// not tracked, so that their queries count as false positives
+func (t *TrackedFilter) Filter() *Filter {
+	return t.f
+}
+
+// Contains tests if f contains v
+func (t *TrackedFilter) Contains(v hash.Hash64) bool {
+	return t.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if f contains the (already hashed) key, counting the
+// false positives of sampled elements
+func (t *TrackedFilter) ContainsHash(hash uint64) bool {
+	contained := t.f.ContainsHash(hash)
+	if !t.sampled(hash) {
+		return contained
+	}
+
+	var member bool
+	if t.oracle != nil {
+		member = t.oracle(hash)
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.oracle == nil {
+		_, member = t.exact[hash]
+	}
+	if !member {
+		t.stats.Negatives++
+		if contained {
+			t.stats.FalsePositives++
+		}
+	}
+	return contained
+}
+
+// Stats of the queries of the sampled elements so far
+func (t *TrackedFilter) Stats() TrackedStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.stats
+}
+
+// ResetStats of the queries, keeping the tracked elements
+func (t *TrackedFilter) ResetStats() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.stats = TrackedStats{}
+}
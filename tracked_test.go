@@ -0,0 +1,58 @@
+package bloomfilter
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTrackedFilter(t *testing.T) {
+	f, _ := New(100000, 5)
+	tracked := NewTrackedFilter(f, 0.5)
+	for i := uint64(0); i < 10000; i++ {
+		tracked.AddHash(i * 0x9e3779b97f4a7c15)
+	}
+	if len(tracked.exact) < 4000 || len(tracked.exact) > 6000 {
+		t.Fatalf("tracked %d of 10000 elements at a rate of 0.5", len(tracked.exact))
+	}
+	for i := uint64(0); i < 200000; i++ {
+		if !tracked.ContainsHash(i*0x9e3779b97f4a7c15) && i < 10000 {
+			t.Fatalf("does not contain %d", i)
+		}
+	}
+
+	stats := tracked.Stats()
+	if stats.Negatives < 80000 || stats.Negatives > 110000 {
+		t.Fatalf("%d negatives sampled", stats.Negatives)
+	}
+	// (1 - exp(-5 * 10000 / 100000)) ** 5
+	expected := math.Pow(1-math.Exp(-0.5), 5)
+	if rate := stats.Rate(); rate < expected/2 || rate > expected*2 {
+		t.Fatalf("observed rate %f, expected about %f", rate, expected)
+	}
+
+	tracked.ResetStats()
+	if !math.IsNaN(tracked.Stats().Rate()) {
+		t.Fatal("expected no rate without negatives")
+	}
+
+	// additions in batches are tracked as well
+	batch := NewTrackedFilter(f, 1)
+	batch.AddHashes([]uint64{1, 2, 3})
+	if len(batch.exact) != 3 || batch.Filter() != f || f.N() != 10003 {
+		t.Fatalf("tracked %d of 3 elements", len(batch.exact))
+	}
+
+	members := map[uint64]bool{}
+	for i := uint64(0); i < 10000; i++ {
+		members[i*0x9e3779b97f4a7c15] = true
+	}
+	oracle := NewTrackedFilterWithOracle(f, 1, func(hash uint64) bool {
+		return members[hash]
+	})
+	for i := uint64(0); i < 20000; i++ {
+		oracle.ContainsHash(i * 0x9e3779b97f4a7c15)
+	}
+	if stats = oracle.Stats(); stats.Negatives != 10000 || stats.FalsePositives == 0 {
+		t.Fatalf("oracle stats %+v", stats)
+	}
+}
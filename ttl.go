@@ -0,0 +1,136 @@
+package bloomfilter
+
+import (
+	"hash"
+	"sync"
+	"time"
+)
+
+// TTLFilter forgets its elements on a fixed interval, for deduplicating
+// what was seen within the last minutes without external cron logic.
+//
+// It either clears its filter every interval, so that elements are
+// remembered for up to one interval, or rotates two filters, so that they
+// are remembered for at least one interval and at most two: Contains tests
+// both the current filter, to which elements are added, and the previous
+// one, which is cleared and becomes the current one every interval: it is
+// then a RotatingFilter rotated on a timer.
+type TTLFilter struct {
+	lock     sync.Mutex
+	current  *Filter         // nil if rotating
+	rotating *RotatingFilter // nil unless rotating
+	stop     chan struct{}
+	done     chan struct{}
+	closed   bool
+}
+
+// NewTTLFilter expiring the elements of f every interval, by rotating f
+// and a filter compatible with it if rotate is true, else by clearing f.
+// The filters are owned by the TTLFilter from now on, and Close must be
+// called to stop its ticker. The interval must be positive.
+func NewTTLFilter(f *Filter, interval time.Duration, rotate bool) (
+	*TTLFilter, error,
+) {
+	if interval <= 0 {
+		return nil, errInterval(interval)
+	}
+	t := &TTLFilter{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if rotate {
+		rotating, err := NewRotatingFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		t.rotating = rotating
+	} else {
+		t.current = f
+	}
+	go t.run(time.NewTicker(interval))
+	return t, nil
+}
+
+func (t *TTLFilter) run(ticker *time.Ticker) {
+	defer close(t.done)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.Expire()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// Expire the oldest elements now, as the ticker does every interval
+func (t *TTLFilter) Expire() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return
+	}
+	if t.rotating != nil {
+		t.rotating.Rotate()
+		return
+	}
+	t.current.Reset()
+}
+
+// Add a hashable item, v, to the filter
+func (t *TTLFilter) Add(v hash.Hash64) {
+	t.AddHash(v.Sum64())
+}
+
+// AddHash adds an already hashed item to the filter
+func (t *TTLFilter) AddHash(hash uint64) {
+	if t.rotating != nil {
+		t.rotating.AddHash(hash)
+		return
+	}
+	t.current.AddHash(hash)
+}
+
+// Contains tests if v was added within the last interval or two
+func (t *TTLFilter) Contains(v hash.Hash64) bool {
+	return t.ContainsHash(v.Sum64())
+}
+
+// ContainsHash is Contains for an already hashed item
+func (t *TTLFilter) ContainsHash(hash uint64) bool {
+	if t.rotating != nil {
+		return t.rotating.ContainsHash(hash)
+	}
+	return t.current.ContainsHash(hash)
+}
+
+// TestAndAddHash adds the already hashed item, returning whether it was
+// already contained, see Filter.TestAndAddHash and
+// RotatingFilter.TestAndAddHash
+func (t *TTLFilter) TestAndAddHash(hash uint64) bool {
+	if t.rotating != nil {
+		return t.rotating.TestAndAddHash(hash)
+	}
+	return t.current.TestAndAddHash(hash)
+}
+
+// Close stops the ticker, waiting for an expiry in progress, and closes
+// the filters
+func (t *TTLFilter) Close() error {
+	t.lock.Lock()
+	if t.closed {
+		t.lock.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.lock.Unlock()
+
+	close(t.stop)
+	<-t.done
+	if t.rotating != nil {
+		return t.rotating.Close()
+	}
+	return t.current.Close()
+}
@@ -0,0 +1,71 @@
+package bloomfilter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLFilter(t *testing.T) {
+	for _, rotate := range []bool{false, true} {
+		f, _ := New(1<<12, 3)
+		ttl, err := NewTTLFilter(f, time.Hour, rotate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl.TestAndAddHash(1) {
+			t.Errorf("rotate=%v: new element reported as contained", rotate)
+		}
+		ttl.Expire()
+		if got := ttl.ContainsHash(1); got != rotate {
+			t.Errorf("rotate=%v: contained after one expiry: %v", rotate, got)
+		}
+		ttl.Expire()
+		if ttl.ContainsHash(1) {
+			t.Errorf("rotate=%v: contained after two expiries", rotate)
+		}
+
+		// refreshed elements outlive the previous filter
+		ttl.AddHash(2)
+		ttl.Expire()
+		if ttl.TestAndAddHash(2) != rotate {
+			t.Errorf("rotate=%v: element lost after one expiry", rotate)
+		}
+		ttl.Expire()
+		if ttl.ContainsHash(2) != rotate {
+			t.Errorf("rotate=%v: refreshed element expired", rotate)
+		}
+
+		if err = ttl.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = ttl.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTTLFilterInterval(t *testing.T) {
+	f, _ := New(1<<12, 3)
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := NewTTLFilter(f, interval, true); err == nil {
+			t.Errorf("expected error for an interval of %v", interval)
+		}
+	}
+}
+
+func TestTTLFilterTicker(t *testing.T) {
+	f, _ := New(1<<12, 3)
+	ttl, err := NewTTLFilter(f, time.Millisecond, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ttl.Close()
+	ttl.AddHash(1)
+	deadline := time.Now().Add(5 * time.Second)
+	for ttl.ContainsHash(1) {
+		if time.Now().After(deadline) {
+			t.Fatal("the ticker never cleared the filter")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
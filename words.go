@@ -0,0 +1,69 @@
+package bloomfilter
+
+// Words is the number of 64-bit words holding the bits of f
+func (f *Filter) Words() uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return uint64(len(f.bits))
+}
+
+// CopyWords copies the words of f, starting at word off, into dst, and
+// returns the number of words copied
+func (f *Filter) CopyWords(dst []uint64, off uint64) int {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if off >= uint64(len(f.bits)) {
+		return 0
+	}
+	return copy(dst, f.bits[off:])
+}
+
+// UnionWords merges src into the words of f, starting at word off. It is the
+// word-level building block of UnionInPlace, for words obtained with
+// CopyWords from a compatible filter.
+func (f *Filter) UnionWords(src []uint64, off uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if off > uint64(len(f.bits)) || uint64(len(src)) > uint64(len(f.bits))-off {
+		return errWordRange(off, len(src))
+	}
+	if err := f.checkLastWord(src, off); err != nil {
+		return err
+	}
+	f.gen++
+	kernels.or(f.bits[off:], src)
+	f.recountBits()
+	return nil
+}
+
+// SetWords overwrites the words of f, starting at word off, with src. It is
+// the word-level building block of replicating a filter, for words obtained
+// with CopyWords from a compatible filter. Like UnionWords, it refuses bits
+// set beyond M in the last word, which no compatible filter has.
+func (f *Filter) SetWords(src []uint64, off uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if off > uint64(len(f.bits)) || uint64(len(src)) > uint64(len(f.bits))-off {
+		return errWordRange(off, len(src))
+	}
+	if err := f.checkLastWord(src, off); err != nil {
+		return err
+	}
+	f.gen++
+	copy(f.bits[off:], src)
+	f.recountBits()
+	return nil
+}
+
+// checkLastWord checks that src, to be copied at word off of f, sets no bit
+// beyond m if it covers the last word. f must be locked.
+func (f *Filter) checkLastWord(src []uint64, off uint64) error {
+	if len(src) == 0 || off+uint64(len(src)) != uint64(len(f.bits)) {
+		return nil
+	}
+	return checkTrailingBits(src, f.m)
+}
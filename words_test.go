@@ -0,0 +1,41 @@
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func TestSetWords(t *testing.T) {
+	f, _ := New(1000, 5)
+	f.AddHash(42)
+	words := make([]uint64, f.Words())
+	if n := f.CopyWords(words, 0); n != len(words) {
+		t.Fatalf("copied %d of %d words", n, len(words))
+	}
+
+	f2, _ := f.NewCompatible()
+	if err := f2.SetWords(words[1:], 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := f2.UnionWords(words[:1], 0); err != nil {
+		t.Fatal(err)
+	}
+	if !f2.ContainsHash(42) {
+		t.Fatal("words not copied")
+	}
+	if err := f2.SetWords(words, 1); err == nil {
+		t.Fatal("expected error for words beyond the filter")
+	}
+
+	// 1000 bits leave 24 bits of the last word unused
+	last := []uint64{1 << 63}
+	off := uint64(len(words) - 1)
+	if err := f2.SetWords(last, off); err == nil {
+		t.Fatal("expected error for bits beyond m")
+	}
+	if err := f2.UnionWords(last, off); err == nil {
+		t.Fatal("expected error for bits beyond m")
+	}
+	if !f2.ContainsHash(42) {
+		t.Fatal("refused words were copied")
+	}
+}
@@ -0,0 +1,100 @@
+package bloomfilter
+
+import (
+	"bufio"
+	"bytes"
+	"hash"
+	"io"
+)
+
+// LineWriter is an io.Writer adding every newline-delimited record written
+// to it to a Filter, so that an output stream can be tee'd into a filter
+// with io.MultiWriter. Records are hashed without their trailing newline.
+type LineWriter struct {
+	f       *Filter
+	h       hash.Hash64
+	partial []byte // last record, not newline-terminated yet
+}
+
+// NewLineWriter adding the records written to it to f, hashed with h
+func NewLineWriter(f *Filter, h hash.Hash64) *LineWriter {
+	return &LineWriter{f: f, h: h}
+}
+
+// Write p, adding every record it completes to the filter
+func (w *LineWriter) Write(p []byte) (n int, err error) {
+	n = len(p)
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			break
+		}
+		if len(w.partial) > 0 {
+			w.partial = append(w.partial, p[:i]...)
+			w.add(w.partial)
+			w.partial = w.partial[:0]
+		} else {
+			w.add(p[:i])
+		}
+		p = p[i+1:]
+	}
+	w.partial = append(w.partial, p...)
+	return n, nil
+}
+
+// Close adds the last record, if it was not newline-terminated
+func (w *LineWriter) Close() error {
+	if len(w.partial) > 0 {
+		w.add(w.partial)
+		w.partial = w.partial[:0]
+	}
+	return nil
+}
+
+func (w *LineWriter) add(record []byte) {
+	w.h.Reset()
+	_, _ = w.h.Write(record) // hash.Hash never returns an error
+	w.f.AddHash(w.h.Sum64())
+}
+
+// addBatchSize is the number of hashes added at once by AddFromReader
+const addBatchSize = 1024
+
+// AddFromReader adds the tokens scanned from r with split, such as
+// bufio.ScanLines, hashed with ComparableHash(f), so that they can be
+// tested with ContainsComparable. It returns the number of tokens added.
+func (f *Filter) AddFromReader(r io.Reader, split bufio.SplitFunc) (
+	uint64, error,
+) {
+	return f.AddFromReaderHash(r, split, ComparableHash(f))
+}
+
+// AddFromReaderHash is AddFromReader, hashing the tokens with h
+func (f *Filter) AddFromReaderHash(r io.Reader, split bufio.SplitFunc,
+	h hash.Hash64,
+) (n uint64, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(split)
+	batch := make([]uint64, 0, addBatchSize)
+	for scanner.Scan() {
+		h.Reset()
+		_, _ = h.Write(scanner.Bytes())
+		batch = append(batch, h.Sum64())
+		if len(batch) == cap(batch) {
+			f.AddHashes(batch)
+			n += uint64(len(batch))
+			batch = batch[:0]
+			if f.opts.progress != nil {
+				f.opts.progress(n, 0)
+			}
+		}
+	}
+	if len(batch) > 0 {
+		f.AddHashes(batch)
+		n += uint64(len(batch))
+		if f.opts.progress != nil {
+			f.opts.progress(n, 0)
+		}
+	}
+	return n, scanner.Err()
+}
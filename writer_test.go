@@ -0,0 +1,77 @@
+package bloomfilter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	bf, _ := New(10000, 5)
+	w := NewLineWriter(bf, fnv.New64a())
+	for _, chunk := range []string{"foo\nba", "r\n", "\nbaz"} {
+		if _, err := io.WriteString(w, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bf.N() != 3 {
+		t.Fatalf("expected 3 records before Close, got %d", bf.N())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := fnv.New64a()
+	for _, record := range []string{"foo", "bar", "", "baz"} {
+		h.Reset()
+		_, _ = io.WriteString(h, record)
+		if !bf.ContainsHash(h.Sum64()) {
+			t.Fatalf("record %q was not added", record)
+		}
+	}
+}
+
+func TestAddFromReaderComparable(t *testing.T) {
+	bf, _ := New(100000, 5)
+	n, err := bf.AddFromReader(strings.NewReader("apple\ncherry\n"),
+		bufio.ScanLines)
+	if err != nil || n != 2 {
+		t.Fatalf("added %d records, %v", n, err)
+	}
+	h := ComparableHash(bf)
+	for _, record := range []string{"apple", "cherry"} {
+		h.Reset()
+		_, _ = io.WriteString(h, record)
+		if !bf.ContainsHash(h.Sum64()) {
+			t.Fatalf("record %q was not added", record)
+		}
+	}
+}
+
+func TestAddFromReaderHash(t *testing.T) {
+	bf, _ := New(100000, 5)
+	var input bytes.Buffer
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&input, "record %d\n", i)
+	}
+	n, err := bf.AddFromReaderHash(&input, bufio.ScanLines, fnv.New64a())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3000 || bf.N() != 3000 {
+		t.Fatalf("expected 3000 records, got n=%d N=%d", n, bf.N())
+	}
+
+	h := fnv.New64a()
+	for i := 0; i < 3000; i++ {
+		h.Reset()
+		fmt.Fprintf(h, "record %d", i)
+		if !bf.ContainsHash(h.Sum64()) {
+			t.Fatalf("record %d was not added", i)
+		}
+	}
+}